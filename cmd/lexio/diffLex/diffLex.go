@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/stts-se/pronlex/dbapi"
+	"github.com/stts-se/pronlex/lex"
+)
+
+func main() {
+
+	var cmdName = "diffLex"
+
+	var engineFlag = flag.String("db_engine", "sqlite", "db engine (sqlite or mariadb)")
+	var dbLocation = flag.String("db_location", "", "db location (folder for sqlite; address for mariadb)")
+	var jsonOutput = flag.Bool("json", false, "print the diff as JSON (default: text)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: diffLex [FLAGS] <FROM DB:LEXICON> <TO DB:LEXICON>\n\n")
+		fmt.Fprintf(os.Stderr, "Text output: removed entries are prefixed by '-', added entries by '+', and changed entries by '~'.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(flag.Args()) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *dbLocation == "" {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("[%s] flag db_location is required", cmdName))
+		os.Exit(1)
+	}
+
+	from, err := lex.ParseLexRef(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] invalid lexicon ref '%s' : %v\n", cmdName, flag.Arg(0), err)
+		os.Exit(1)
+	}
+	to, err := lex.ParseLexRef(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] invalid lexicon ref '%s' : %v\n", cmdName, flag.Arg(1), err)
+		os.Exit(1)
+	}
+
+	dbapi.Sqlite3WithRegex()
+
+	var dbm *dbapi.DBManager
+	if *engineFlag == "mariadb" {
+		dbm = dbapi.NewMariaDBManager()
+	} else if *engineFlag == "sqlite" {
+		dbm = dbapi.NewSqliteDBManager()
+	} else {
+		fmt.Fprintf(os.Stderr, "invalid db engine : %s\n", *engineFlag)
+		os.Exit(1)
+	}
+
+	for _, dbRef := range []lex.DBRef{from.DBRef, to.DBRef} {
+		if dbm.ContainsDB(dbRef) {
+			continue
+		}
+		err = dbm.OpenDB(*dbLocation, dbRef)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open db '%s' : %v\n", dbRef, err)
+			os.Exit(1)
+		}
+	}
+
+	diff, err := dbm.DiffLexicons(from, to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to diff lexicons : %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		res, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to marshal diff : %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(res))
+		return
+	}
+	fmt.Println(diff.String())
+}
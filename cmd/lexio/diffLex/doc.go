@@ -0,0 +1,2 @@
+// Command line tool for comparing two lexicons in the database, possibly in different databases. Entries are matched on orthography and tag, and added, removed and changed entries are printed as text or JSON.
+package main
@@ -1,2 +1,2 @@
-// Command line tool for exporting lexicons from the database to a file. The pre-defined Wikispeech file format is defined in line/ws.go.
+// Command line tool for exporting lexicons from the database to a file. The pre-defined Wikispeech file format is defined in line/ws.go. Use the -snapshot flag to export a frozen lexicon snapshot (see dbapi.DBManager.CreateSnapshot) instead of the current lexicon content.
 package main
@@ -25,6 +25,7 @@ func main() {
 	var dbName = flag.String("db_name", "", "db name (if empty, a list of available lexicons will be printed)")
 	var lexName = flag.String("lex_name", "", "lexicon name")
 	var outFile = flag.String("out_file", "", "Output file")
+	var snapshot = flag.String("snapshot", "", "export a lexicon snapshot (release name) instead of the current lexicon content")
 
 	var fatalError = false
 	var dieIfEmptyFlag = func(name string, val *string) {
@@ -120,6 +121,13 @@ func main() {
 	}
 
 	writer := line.FileWriter{Parser: wsFmt, Writer: bf}
+	if *snapshot != "" {
+		err = dbm.ExportSnapshot(lexRef, *snapshot, writer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to export snapshot : %v\n", err)
+		}
+		return
+	}
 	err = dbm.LookUp(q, writer)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to do lexicon lookup : %v\n", err)
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stts-se/pronlex/dbapi"
@@ -52,6 +53,45 @@ func printStats(stats dbapi.LexStats, validate bool) error {
 	return nil
 }
 
+func importModes() string {
+	var res []string
+	for _, m := range dbapi.ImportModes {
+		res = append(res, string(m))
+	}
+	return strings.Join(res, ", ")
+}
+
+func printImportResult(res dbapi.ImportResult, validate bool) {
+	var fstr = "%-16s %6d\n"
+	if res.DryRun {
+		println("\nDRY RUN (nothing was imported)")
+	} else {
+		println("\nIMPORT REPORT")
+	}
+	fmt.Printf("%-16s %6s\n", "mode", res.Mode)
+	fmt.Printf(fstr, "lines read", res.Read)
+	fmt.Printf(fstr, "inserted", res.Inserted)
+	fmt.Printf(fstr, "updated", res.Updated)
+	fmt.Printf(fstr, "unchanged", res.Unchanged)
+	fmt.Printf(fstr, "skipped", res.Skipped)
+	fmt.Printf(fstr, "deleted", res.Deleted)
+	fmt.Printf(fstr, "duplicates", res.SkippedDuplicates)
+	fmt.Printf(fstr, "failed lines", len(res.Errors))
+	if res.ResumedAfterLine > 0 {
+		fmt.Printf(fstr, "resumed after", res.ResumedAfterLine)
+	}
+	if validate && res.ValidationStats != nil {
+		fmt.Printf(fstr, "invalid entries", res.ValidationStats.InvalidEntries)
+		fmt.Printf(fstr, "validation msgs", res.ValidationStats.TotalValidations)
+	}
+}
+
+func printImportErrors(res dbapi.ImportResult) {
+	for _, e := range res.Errors {
+		fmt.Fprintf(os.Stderr, "line %d: %s\n", e.LineNumber, e.Error)
+	}
+}
+
 func main() {
 
 	var cmdName = "importLex"
@@ -63,6 +103,12 @@ func main() {
 	var help = flag.Bool("help", false, "print help message")
 	var createDb = flag.Bool("createdb", false, "create db if it doesn't exist (default: false)")
 	var createLex = flag.Bool("createlex", false, "create lexicon if it doesn't exist (default: false)")
+	var dryRun = flag.Bool("dry_run", false, "run the import inside a transaction that is rolled back, and print what would have been imported (default: false)")
+	var allOrNothing = flag.Bool("all_or_nothing", false, "import the whole file in one transaction, so that nothing is imported if any line fails (default: false)")
+	var continueOnError = flag.Bool("continue_on_error", false, "skip lines that fail, instead of aborting the import on the first error; cannot be combined with mode replace-lexicon (default: false)")
+	var errorReport = flag.String("error_report", "", "write failed lines to this file (line number, error, input line; tab separated)")
+	var checkpoint = flag.String("checkpoint", "", "save import progress to this file, and resume from it if it exists (not for -dry_run or -all_or_nothing)")
+	var modeFlag = flag.String("mode", string(dbapi.ImportInsertOnly), fmt.Sprintf("import mode for entries already in the lexicon, matched on orthography and tag (%s)", importModes()))
 
 	var engineFlag = flag.String("db_engine", "sqlite", "db engine (sqlite or mariadb)")
 	var dbLocation = flag.String("db_location", "", "db location (folder for sqlite; address for mariadb)")
@@ -124,6 +170,12 @@ SAMPLE INVOCATION:
 		os.Exit(1)
 	}
 
+	mode, err := dbapi.ParseImportMode(*modeFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("[%s] %v", cmdName, err))
+		os.Exit(1)
+	}
+
 	dbapi.Sqlite3WithRegex()
 	dbRef := lex.DBRef(*dbName)
 
@@ -235,13 +287,45 @@ SAMPLE INVOCATION:
 	}
 	// TODO handle errors? Does it make sent to return array of error...?
 	stderrLogger.Write(fmt.Sprintf("importing lexicon file %s ...", *lexFile))
-	err = dbm.ImportLexiconFile(lexRef, logger, *lexFile, validator)
+	res, err := dbm.ImportLexiconFile(lexRef, logger, *lexFile, validator, dbapi.ImportOptions{
+		Mode:            mode,
+		DryRun:          *dryRun,
+		AllOrNothing:    *allOrNothing,
+		ContinueOnError: *continueOnError,
+		ErrorReport:     *errorReport,
+		Checkpoint:      *checkpoint,
+	})
 
 	if err != nil {
+		printImportErrors(res)
+		// a lexicon created for the dry run is removed also if the dry run fails
+		if *dryRun && !lexExists {
+			err2 := dbm.DeleteLexicon(lexRef)
+			if err2 != nil {
+				log.Printf("couldn't delete lexicon %s : %v", lexRef, err2)
+			}
+		}
 		log.Fatal(err)
 		return
 	}
 
+	if *dryRun {
+		// a lexicon created for the dry run is removed again
+		if !lexExists {
+			err = dbm.DeleteLexicon(lexRef)
+			if err != nil {
+				log.Fatal(err)
+				return
+			}
+		}
+		printImportResult(res, *validate)
+		return
+	}
+	if *errorReport == "" {
+		printImportErrors(res)
+	}
+	printImportResult(res, *validate)
+
 	// stderrLogger.Write("running the Sqlite3 ANALYZE command. It may take a little while...")
 	// _, err = db.Exec("ANALYZE")
 	// if err != nil {
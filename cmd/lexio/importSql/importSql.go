@@ -48,8 +48,6 @@ func sqlDump(dbFile string, outFile string) error {
 	return nil
 }
 */
-var dotAndAfter = regexp.MustCompile("[.].*$")
-
 func validateSchemaVersion(dbm *dbapi.DBManager, dbRef lex.DBRef) error {
 	dbVer, err := dbm.GetSchemaVersion(dbRef)
 	apiVer := dbapi.SchemaVersion
@@ -57,13 +55,7 @@ func validateSchemaVersion(dbm *dbapi.DBManager, dbRef lex.DBRef) error {
 		log.Fatalf("Couldn't retrive schema version : %v", err)
 	}
 	if dbVer != apiVer {
-		dbVerX := dotAndAfter.ReplaceAllString(dbVer, "")
-		apiVerX := dotAndAfter.ReplaceAllString(apiVer, "")
-		if dbVerX != apiVerX {
-			log.Fatalf("Mismatching schema versions. Input file: %s, dbapi.Schema: %s ", dbVer, apiVer)
-		} else {
-			log.Printf("Compatible schema versions. Input file: %s, dbapi.Schema: %s ", dbVer, apiVer)
-		}
+		log.Fatalf("Mismatching schema versions. Imported db: %s, dbapi.Schema: %s ", dbVer, apiVer)
 	} else {
 		log.Printf("Schema version matching dbapi.SchemaVersion: %s\n", apiVer)
 	}
@@ -73,6 +65,8 @@ func validateSchemaVersion(dbm *dbapi.DBManager, dbRef lex.DBRef) error {
 func runPostTests(dbm *dbapi.DBManager, dbLocation string, dbRef lex.DBRef, sqlDumpFile string) {
 
 	//err = dbm.DefineDB(dbm, dbLocation, dbRef)
+	// sql dumps of older dbs are migrated to the current schema version on open
+	dbm.SchemaCheck = dbapi.MigrateOutdatedSchema
 	err := dbm.OpenDB(dbLocation, dbRef)
 	if err != nil {
 		log.Fatalf("Couldn't open db: %v", err)
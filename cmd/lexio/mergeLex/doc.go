@@ -0,0 +1,2 @@
+// Command line tool for merging one lexicon into another, possibly in different databases. Entries are matched on orthography and tag. New entries are added to the target lexicon, and conflicting entries are handled according to the selected merge strategy. A report of the merge is printed as text or JSON.
+package main
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/stts-se/pronlex/dbapi"
+	"github.com/stts-se/pronlex/lex"
+)
+
+func main() {
+
+	var cmdName = "mergeLex"
+
+	var strategies []string
+	for _, s := range dbapi.MergeStrategies {
+		strategies = append(strategies, string(s))
+	}
+
+	var engineFlag = flag.String("db_engine", "sqlite", "db engine (sqlite or mariadb)")
+	var dbLocation = flag.String("db_location", "", "db location (folder for sqlite; address for mariadb)")
+	var strategyFlag = flag.String("strategy", string(dbapi.MergeKeepTarget), fmt.Sprintf("merge strategy (%s)", strings.Join(strategies, ", ")))
+	var source = flag.String("source", "", "source (the merging user), saved as the source of a new entry status for modified entries")
+	var jsonOutput = flag.Bool("json", false, "print the merge report as JSON (default: text summary)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: mergeLex [FLAGS] <FROM DB:LEXICON> <TO DB:LEXICON>\n\n")
+		fmt.Fprintf(os.Stderr, "Merges the entries of the FROM lexicon into the TO lexicon. The FROM lexicon is not modified.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(flag.Args()) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *dbLocation == "" {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("[%s] flag db_location is required", cmdName))
+		os.Exit(1)
+	}
+	if strings.TrimSpace(*source) == "" {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("[%s] flag source is required", cmdName))
+		os.Exit(1)
+	}
+
+	strategy, err := dbapi.ParseMergeStrategy(*strategyFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] %v\n", cmdName, err)
+		os.Exit(1)
+	}
+
+	from, err := lex.ParseLexRef(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] invalid lexicon ref '%s' : %v\n", cmdName, flag.Arg(0), err)
+		os.Exit(1)
+	}
+	to, err := lex.ParseLexRef(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] invalid lexicon ref '%s' : %v\n", cmdName, flag.Arg(1), err)
+		os.Exit(1)
+	}
+
+	dbapi.Sqlite3WithRegex()
+
+	var dbm *dbapi.DBManager
+	if *engineFlag == "mariadb" {
+		dbm = dbapi.NewMariaDBManager()
+	} else if *engineFlag == "sqlite" {
+		dbm = dbapi.NewSqliteDBManager()
+	} else {
+		fmt.Fprintf(os.Stderr, "invalid db engine : %s\n", *engineFlag)
+		os.Exit(1)
+	}
+
+	for _, dbRef := range []lex.DBRef{from.DBRef, to.DBRef} {
+		if dbm.ContainsDB(dbRef) {
+			continue
+		}
+		err = dbm.OpenDB(*dbLocation, dbRef)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open db '%s' : %v\n", dbRef, err)
+			os.Exit(1)
+		}
+	}
+
+	res, err := dbm.MergeLexicons(from, to, strategy, *source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to merge lexicons : %v\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		jsn, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to marshal merge result : %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsn))
+		return
+	}
+	for _, e := range res.Entries {
+		if e.Action == "unchanged" {
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\n", e.Action, e.Strn, e.Tag)
+	}
+	fmt.Printf("added: %d, updated: %d, flagged: %d, kept: %d, unchanged: %d\n", res.Added, res.Updated, res.Flagged, res.Kept, res.Unchanged)
+}
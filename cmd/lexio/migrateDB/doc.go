@@ -0,0 +1,2 @@
+// Command line tool for copying a whole lexicon database to another db engine (e.g., from Sqlite to MariaDB), table by table. Unlike exporting and importing lexicon files, the copy keeps all row ids, the status history, validation timestamps, comments, entry history and snapshots. The number of rows of each table is verified after the copy, and an interrupted copy can be resumed using a checkpoint file.
+package main
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/stts-se/pronlex/dbapi"
+	"github.com/stts-se/pronlex/lex"
+)
+
+func newDBManager(engine string) (*dbapi.DBManager, error) {
+	if engine == "mariadb" {
+		return dbapi.NewMariaDBManager(), nil
+	} else if engine == "sqlite" {
+		return dbapi.NewSqliteDBManager(), nil
+	}
+	return nil, fmt.Errorf("invalid db engine : %s", engine)
+}
+
+func main() {
+
+	var cmdName = "migrateDB"
+
+	var fromEngine = flag.String("from_engine", "sqlite", "db engine of the source db (sqlite or mariadb)")
+	var fromLocation = flag.String("from_location", "", "location of the source db (folder for sqlite; address for mariadb)")
+	var toEngine = flag.String("to_engine", "mariadb", "db engine of the target db (sqlite or mariadb)")
+	var toLocation = flag.String("to_location", "", "location of the target db (folder for sqlite; address for mariadb)")
+	var batchSize = flag.Int("batch_size", 0, "number of rows copied in each transaction (default 1000)")
+	var checkpoint = flag.String("checkpoint", "", "checkpoint file, for resuming an interrupted copy (if the file exists, the copy is resumed)")
+	var jsonOutput = flag.Bool("json", false, "print the result as JSON (default: text summary)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: migrateDB [FLAGS] <FROM DB> <TO DB>\n\n")
+		fmt.Fprintf(os.Stderr, "Copies the FROM db into the TO db, table by table, keeping all row ids. The TO db is created (for MariaDB, the database must be created beforehand by an administrator, but without tables). When resuming a copy, the TO db must exist.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(flag.Args()) != 2 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *fromLocation == "" {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("[%s] flag from_location is required", cmdName))
+		os.Exit(1)
+	}
+	if *toLocation == "" {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("[%s] flag to_location is required", cmdName))
+		os.Exit(1)
+	}
+	from := lex.DBRef(flag.Arg(0))
+	to := lex.DBRef(flag.Arg(1))
+
+	dbapi.Sqlite3WithRegex()
+
+	fromDBM, err := newDBManager(*fromEngine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] %v\n", cmdName, err)
+		os.Exit(1)
+	}
+	toDBM, err := newDBManager(*toEngine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] %v\n", cmdName, err)
+		os.Exit(1)
+	}
+
+	err = fromDBM.OpenDB(*fromLocation, from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] failed to open db '%s' : %v\n", cmdName, from, err)
+		os.Exit(1)
+	}
+
+	resume := false
+	if *checkpoint != "" {
+		if _, err := os.Stat(*checkpoint); err == nil {
+			resume = true
+		}
+	}
+	if resume {
+		err = toDBM.OpenDB(*toLocation, to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[%s] failed to open db '%s' : %v\n", cmdName, to, err)
+			os.Exit(1)
+		}
+	} else {
+		if *toEngine == "sqlite" {
+			dbExists, err := toDBM.DBExists(*toLocation, to)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[%s] %v\n", cmdName, err)
+				os.Exit(1)
+			}
+			if dbExists {
+				fmt.Fprintf(os.Stderr, "[%s] cannot copy to a db that already exists: %s\n", cmdName, to)
+				os.Exit(1)
+			}
+		}
+		err = toDBM.DefineDB(*toLocation, to)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[%s] couldn't create db '%s' : %v\n", cmdName, to, err)
+			os.Exit(1)
+		}
+	}
+
+	logger := dbapi.StderrLogger{}
+	res, err := fromDBM.CopyDBTo(from, toDBM, to, logger, dbapi.CopyDBOptions{BatchSize: *batchSize, Checkpoint: *checkpoint})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] failed to copy db : %v\n", cmdName, err)
+		if *checkpoint != "" {
+			fmt.Fprintf(os.Stderr, "[%s] re-run with the same checkpoint file to resume the copy\n", cmdName)
+		}
+		os.Exit(1)
+	}
+
+	if *jsonOutput {
+		jsn, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to marshal result : %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsn))
+		return
+	}
+	if res.ResumedAtTable != "" {
+		fmt.Printf("resumed at table %s, after %d\n", res.ResumedAtTable, res.ResumedAfterKey)
+	}
+	for _, t := range res.Tables {
+		fmt.Printf("%s\t%d rows\t%d copied\n", t.Table, t.Rows, t.Copied)
+	}
+	if res.FullText {
+		fmt.Println("full-text index created")
+	}
+}
@@ -0,0 +1,2 @@
+// Command line tool for upgrading lexicon databases to the current schema version, by applying the pending schema migrations in order. Out-of-date databases are refused by lexserver and the other lexio commands, unless migrated.
+package main
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/stts-se/pronlex/dbapi"
+	"github.com/stts-se/pronlex/lex"
+)
+
+func main() {
+
+	var cmdName = "migrateSchema"
+
+	var engineFlag = flag.String("db_engine", "sqlite", "db engine (sqlite or mariadb)")
+	var dbLocation = flag.String("db_location", "", "db location (folder for sqlite; address for mariadb)")
+	var dryRun = flag.Bool("dry_run", false, "list the pending migrations, without applying them")
+	var jsonOutput = flag.Bool("json", false, "print the result as JSON (default: text summary)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: migrateSchema [FLAGS] <DB NAMES>\n\n")
+		fmt.Fprintf(os.Stderr, "Upgrades the dbs to the current schema version (%s). Please make a backup of the dbs before migrating.\n\n", dbapi.SchemaVersion)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(flag.Args()) < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *dbLocation == "" {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("[%s] flag db_location is required", cmdName))
+		os.Exit(1)
+	}
+
+	var dbm *dbapi.DBManager
+	if *engineFlag == "mariadb" {
+		dbm = dbapi.NewMariaDBManager()
+	} else if *engineFlag == "sqlite" {
+		dbm = dbapi.NewSqliteDBManager()
+		dbapi.Sqlite3WithRegex()
+	} else {
+		fmt.Fprintf(os.Stderr, "[%s] invalid db engine : %s\n", cmdName, *engineFlag)
+		os.Exit(1)
+	}
+	// out-of-date dbs are refused by OpenDB by default
+	dbm.SchemaCheck = dbapi.SkipSchemaCheck
+
+	var results []dbapi.MigrateDBResult
+	for _, dbName := range flag.Args() {
+		dbRef := lex.DBRef(dbName)
+		dbExists, err := dbm.DBExists(*dbLocation, dbRef)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[%s] %v\n", cmdName, err)
+			os.Exit(1)
+		}
+		if !dbExists {
+			fmt.Fprintf(os.Stderr, "[%s] no such db: %s\n", cmdName, dbName)
+			os.Exit(1)
+		}
+		err = dbm.OpenDB(*dbLocation, dbRef)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[%s] failed to open db '%s' : %v\n", cmdName, dbName, err)
+			os.Exit(1)
+		}
+
+		var res dbapi.MigrateDBResult
+		if *dryRun {
+			version, err := dbm.GetSchemaVersion(dbRef)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[%s] %v\n", cmdName, err)
+				os.Exit(1)
+			}
+			pending, err := dbm.PendingSchemaMigrations(dbRef)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[%s] %v\n", cmdName, err)
+				os.Exit(1)
+			}
+			// In a dry run, Applied lists the migrations that would be applied
+			res = dbapi.MigrateDBResult{DB: dbRef, FromVersion: version, ToVersion: dbapi.SchemaVersion, Applied: pending}
+		} else {
+			res, err = dbm.MigrateDB(dbRef)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[%s] failed to migrate db '%s' : %v\n", cmdName, dbName, err)
+				os.Exit(1)
+			}
+		}
+		err = dbm.CloseDB(dbRef)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[%s] %v\n", cmdName, err)
+			os.Exit(1)
+		}
+		results = append(results, res)
+	}
+
+	if *jsonOutput {
+		jsn, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to marshal result : %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsn))
+		return
+	}
+	for _, res := range results {
+		if len(res.Applied) == 0 {
+			fmt.Printf("%s\tschema version %s\tup-to-date\n", res.DB, res.FromVersion)
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("%s\tschema version %s\t%d pending migration(s)\n", res.DB, res.FromVersion, len(res.Applied))
+		} else {
+			fmt.Printf("%s\tmigrated from schema version %s to %s\n", res.DB, res.FromVersion, res.ToVersion)
+		}
+		for _, m := range res.Applied {
+			fmt.Printf("  %s\t%s\n", m.Version, m.Description)
+		}
+	}
+}
@@ -43,9 +43,9 @@ func isLikeExpression(s string) bool {
 	return false
 }
 
-func deleteEntry(dbm *dbapi.DBManager, entryID int64, dbRef, lexName string) error {
+func deleteEntry(dbm *dbapi.DBManager, entryID int64, dbRef, lexName, source string) error {
 	lexRef := lex.LexRef{DBRef: lex.DBRef(dbRef), LexName: lex.LexName(lexName)}
-	_, err := dbm.DeleteEntry(entryID, lexRef)
+	_, err := dbm.DeleteEntry(entryID, lexRef, source)
 
 	return err
 }
@@ -139,8 +139,9 @@ func main() {
 
 	verb := true
 
-	deleteFlag := flag.Bool("delete", false, "Delete entry. Required flags: -id <int> -db_engine <string> -db_location <string> -db_name <string> -lex_name <string>")
+	deleteFlag := flag.Bool("delete", false, "Delete entry. Required flags: -id <int> -db_engine <string> -db_location <string> -db_name <string> -lex_name <string>. Optional flag: -source <string>")
 	idFlag := flag.Int("id", 0, "DB entry id")
+	sourceFlag := flag.String("source", "", "Source (user) of the deletion, saved in the entry history")
 
 	printMissingFlag := flag.Bool("missing", false, "Print the words not found in the lexicon. Required flags: -db_engine <string> -db_location <string> -db_name <string> -lex_name <string>")
 
@@ -249,7 +250,7 @@ Flags:`)
 
 	// Delete entry
 	if *deleteFlag {
-		err := deleteEntry(dbm, int64(*idFlag), *dbName, *lexName)
+		err := deleteEntry(dbm, int64(*idFlag), *dbName, *lexName, *sourceFlag)
 
 		if err != nil {
 
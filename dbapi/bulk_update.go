@@ -0,0 +1,238 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// BulkOperationType is the type of edit applied by DBManager.BulkUpdate
+type BulkOperationType string
+
+const (
+	// BulkSetStatus sets the entry status name to BulkOperation.Value
+	BulkSetStatus BulkOperationType = "set-status"
+	// BulkSetPartOfSpeech sets the part of speech to BulkOperation.Value
+	BulkSetPartOfSpeech BulkOperationType = "set-part-of-speech"
+	// BulkSetMorphology sets the morphology to BulkOperation.Value
+	BulkSetMorphology BulkOperationType = "set-morphology"
+	// BulkSetLanguage sets the language to BulkOperation.Value
+	BulkSetLanguage BulkOperationType = "set-language"
+	// BulkAddComment adds a comment with the text BulkOperation.Value and the label BulkOperation.Label
+	BulkAddComment BulkOperationType = "add-comment"
+	// BulkReplaceTranscription replaces the matches of the regexp BulkOperation.Pattern in all transcriptions with BulkOperation.Value (see TranscriptionReplacer)
+	BulkReplaceTranscription BulkOperationType = "replace-transcription"
+	// BulkSetPreferred marks the entries as preferred
+	BulkSetPreferred BulkOperationType = "set-preferred"
+	// BulkClearPreferred marks the entries as not preferred
+	BulkClearPreferred BulkOperationType = "clear-preferred"
+)
+
+// BulkOperationTypes lists the available bulk operation types
+var BulkOperationTypes = []BulkOperationType{BulkSetStatus, BulkSetPartOfSpeech, BulkSetMorphology, BulkSetLanguage, BulkAddComment, BulkReplaceTranscription, BulkSetPreferred, BulkClearPreferred}
+
+// ParseBulkOperationType returns the BulkOperationType with the input name
+func ParseBulkOperationType(name string) (BulkOperationType, error) {
+	for _, t := range BulkOperationTypes {
+		if string(t) == name {
+			return t, nil
+		}
+	}
+	var names []string
+	for _, t := range BulkOperationTypes {
+		names = append(names, string(t))
+	}
+	return "", fmt.Errorf("invalid bulk operation '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// BulkOperation is an edit applied to each entry matching the query of DBManager.BulkUpdate
+type BulkOperation struct {
+	Type BulkOperationType `json:"type"`
+	// The new value (status name, part of speech, morphology or language), the comment text, or the transcription replacement
+	Value string `json:"value,omitempty"`
+	// The transcription regexp to replace, for BulkReplaceTranscription
+	Pattern string `json:"pattern,omitempty"`
+	// The comment label, for BulkAddComment
+	Label string `json:"label,omitempty"`
+}
+
+// bulkUpdateFields are the entry fields that can be modified by a bulk operation, and are reported in the change log
+var bulkUpdateFields = []string{"language", "partOfSpeech", "morphology", "preferred", "transcriptions", "status", "comments"}
+
+// validate checks that the operation has the values required by its type
+func (op BulkOperation) validate() error {
+	if _, err := ParseBulkOperationType(string(op.Type)); err != nil {
+		return err
+	}
+	switch op.Type {
+	case BulkSetStatus, BulkSetPartOfSpeech, BulkSetLanguage, BulkAddComment:
+		if trm(op.Value) == "" {
+			return fmt.Errorf("bulk operation %s requires a value", op.Type)
+		}
+	case BulkReplaceTranscription:
+		if _, err := NewTranscriptionReplacer(op.Pattern, op.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TranscriptionReplacer replaces a regexp in transcriptions, only matching at phoneme boundaries: a match must start at the start of the transcription or after a phoneme delimiter (space), and end at the end of the transcription or before a phoneme delimiter.
+// Example: the pattern 'r s' with the replacement 'rs' replaces /r s/ in '" f 9 r s t' (yielding '" f 9 rs t'), but not in '" f 9 r s2 t'.
+// The replacement may refer to submatches of the pattern, using $1, ${name}, etc, as in regexp.Regexp.Expand.
+type TranscriptionReplacer struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// NewTranscriptionReplacer compiles a TranscriptionReplacer
+func NewTranscriptionReplacer(pattern string, replacement string) (TranscriptionReplacer, error) {
+	if trm(pattern) == "" {
+		return TranscriptionReplacer{}, fmt.Errorf("empty transcription pattern")
+	}
+	// The trailing group consumes the phoneme delimiter following the match, and is put back after the replacement
+	re, err := regexp.Compile("^(?:" + pattern + ")( |$)")
+	if err != nil {
+		return TranscriptionReplacer{}, fmt.Errorf("invalid transcription pattern '%s' : %v", pattern, err)
+	}
+	return TranscriptionReplacer{re: re, replacement: replacement}, nil
+}
+
+// Replace replaces all non-overlapping matches in a transcription, from left to right. Multiple spaces in the result are collapsed into one.
+func (tr TranscriptionReplacer) Replace(trans string) string {
+	var res []byte
+	i := 0
+	for i <= len(trans) {
+		// i is at a phoneme boundary
+		if m := tr.re.FindStringSubmatchIndex(trans[i:]); m != nil && m[1] > 0 {
+			delimStart := m[len(m)-2]
+			res = tr.re.ExpandString(res, tr.replacement, trans[i:], m)
+			res = append(res, trans[i+delimStart:i+m[1]]...)
+			i += m[1]
+			continue
+		}
+		next := strings.IndexByte(trans[i:], ' ')
+		if next < 0 {
+			res = append(res, trans[i:]...)
+			break
+		}
+		res = append(res, trans[i:i+next+1]...)
+		i += next + 1
+	}
+	return strings.Join(strings.Fields(string(res)), " ")
+}
+
+// apply returns a copy of e with the operation applied. The entry status is only modified by BulkSetStatus.
+func (op BulkOperation) apply(e lex.Entry, source string) (lex.Entry, error) {
+	res := e
+	switch op.Type {
+	case BulkSetStatus:
+		// status names and sources are saved in lower case
+		res.EntryStatus = lex.EntryStatus{Name: strings.ToLower(trm(op.Value)), Source: strings.ToLower(source)}
+	case BulkSetPartOfSpeech:
+		res.PartOfSpeech = trm(op.Value)
+	case BulkSetMorphology:
+		res.Morphology = trm(op.Value)
+	case BulkSetLanguage:
+		res.Language = trm(op.Value)
+	case BulkAddComment:
+		res.Comments = append(append([]lex.EntryComment{}, e.Comments...), lex.EntryComment{Label: trm(op.Label), Source: source, Comment: trm(op.Value)})
+	case BulkReplaceTranscription:
+		tr, err := NewTranscriptionReplacer(op.Pattern, op.Value)
+		if err != nil {
+			return res, err
+		}
+		res.Transcriptions = make([]lex.Transcription, len(e.Transcriptions))
+		for i, t := range e.Transcriptions {
+			t.Strn = tr.Replace(t.Strn)
+			if t.Strn == "" {
+				return res, fmt.Errorf("empty transcription after replacement in entry id '%d'", e.ID)
+			}
+			res.Transcriptions[i] = t
+		}
+	case BulkSetPreferred:
+		res.Preferred = true
+	case BulkClearPreferred:
+		res.Preferred = false
+	default:
+		return res, fmt.Errorf("unknown bulk operation '%s'", op.Type)
+	}
+	return res, nil
+}
+
+func bulkUpdate(dbif DBIF, db *sql.DB, lexNames []lex.LexName, q Query, op BulkOperation, source string, dryRun bool) (BulkUpdateResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return BulkUpdateResult{}, fmt.Errorf("bulkUpdate failed to start db transaction : %v", err)
+	}
+
+	res, err := bulkUpdateTx(dbif, tx, lexNames, q, op, source)
+	if err != nil {
+		msg := fmt.Sprintf("bulkUpdate failed : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil && err2 != sql.ErrTxDone {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+		return res, fmt.Errorf(msg)
+	}
+
+	if dryRun {
+		res.DryRun = true
+		err = tx.Rollback()
+		if err != nil {
+			return res, fmt.Errorf("bulkUpdate rollback failed : %v", err)
+		}
+		return res, nil
+	}
+	err = tx.Commit()
+	if err != nil {
+		return res, fmt.Errorf("bulkUpdate commit failed : %v", err)
+	}
+	return res, nil
+}
+
+// bulkUpdateTx applies the operation to each entry matching the query. Only entries modified by the operation are updated, with a new entry status having the input source (for BulkSetStatus, the new status).
+func bulkUpdateTx(dbif DBIF, tx *sql.Tx, lexNames []lex.LexName, q Query, op BulkOperation, source string) (BulkUpdateResult, error) {
+	res := BulkUpdateResult{Operation: op, Entries: []BulkUpdateEntryResult{}}
+
+	if trm(source) == "" {
+		return res, fmt.Errorf("source (the updating user) must not be empty")
+	}
+	if err := op.validate(); err != nil {
+		return res, err
+	}
+
+	var esw lex.EntrySliceWriter
+	err := dbif.lookUpTx(tx, lexNames, q, &esw)
+	if err != nil {
+		return res, err
+	}
+	res.Matched = len(esw.Entries)
+
+	for _, e := range esw.Entries {
+		ne, err := op.apply(e, source)
+		if err != nil {
+			return res, err
+		}
+		changes := entryDiffFields(e, ne, bulkUpdateFields)
+		if len(changes) == 0 {
+			res.Unchanged++
+			continue
+		}
+		if op.Type != BulkSetStatus {
+			ne.EntryStatus = lex.EntryStatus{Name: e.EntryStatus.Name, Source: strings.ToLower(source)}
+			changes = entryDiffFields(e, ne, bulkUpdateFields)
+		}
+
+		_, err = dbif.updateEntryTx(tx, ne, false)
+		if err != nil {
+			return res, fmt.Errorf("failed to update entry id '%d' : %v", e.ID, err)
+		}
+		res.Updated++
+		res.Entries = append(res.Entries, BulkUpdateEntryResult{ID: e.ID, LexRef: e.LexRef, Strn: e.Strn, Changes: changes})
+	}
+	return res, nil
+}
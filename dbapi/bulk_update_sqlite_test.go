@@ -0,0 +1,206 @@
+package dbapi
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestTranscriptionReplacer(t *testing.T) {
+	for _, test := range []struct {
+		pattern, replacement, input, expect string
+	}{
+		{"r s", "rs", `" f 9 r s t`, `" f 9 rs t`},
+		{"r s", "rs", `" f 9 r s2 t`, `" f 9 r s2 t`},
+		{"r s", "rs", `" f 9 rr s t`, `" f 9 rr s t`},
+		{"s", "z", `" s a s`, `" z a z`},
+		{"s", "z", `" s s`, `" z z`},
+		{"a:?", "A:", `" h a: s a`, `" h A: s A:`},
+		{`(\S+) \.`, "$1 -", `" k a . t a`, `" k a - t a`},
+		{`"`, "", `" k a . t a`, `k a . t a`},
+		{"x", "y", `" k a`, `" k a`},
+	} {
+		tr, err := NewTranscriptionReplacer(test.pattern, test.replacement)
+		if err != nil {
+			t.Errorf("NewTranscriptionReplacer failed : %v", err)
+			continue
+		}
+		if got := tr.Replace(test.input); got != test.expect {
+			t.Errorf("%s -> %s for '%s' : expected '%s', got '%s'", test.pattern, test.replacement, test.input, test.expect, got)
+		}
+	}
+
+	for _, pattern := range []string{"", " ", "a("} {
+		if _, err := NewTranscriptionReplacer(pattern, "x"); err == nil {
+			t.Errorf("expected error for pattern '%s', got nil", pattern)
+		}
+	}
+}
+
+func TestBulkUpdateSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testBulkUpdate(t, sqliteDBIF{}, db)
+}
+
+// testBulkUpdate is shared between the sqlite and mariadb tests
+func testBulkUpdate(t *testing.T, dbif DBIF, db *sql.DB) {
+	dbm, err := NewDBManager(dbif.engine())
+	if err != nil {
+		t.Fatalf("NewDBManager failed : %v", err)
+	}
+	err = dbm.AddDB("bulkdb", db)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	entry := func(strn, pos, morph, trans string) lex.Entry {
+		return lex.Entry{Strn: strn, PartOfSpeech: pos, Morphology: morph, Language: "sv", WordParts: strn,
+			Transcriptions: []lex.Transcription{{Strn: trans, Language: "sv"}},
+			EntryStatus:    lex.EntryStatus{Name: "ok", Source: "tst"}}
+	}
+	l, err := dbif.defineLexicon(db, lexicon{name: "bulklex", symbolSetName: "ZZ", locale: "sv_SE"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	_, err = dbif.insertEntries(db, l, []lex.Entry{
+		entry("först", "AB", "POS", `" f 9 r s t`),
+		entry("fors", "NN", "UTR SIN IND NOM", `" f O r s`),
+		entry("forsen", "NN", "UTR SIN DEF NOM", `" f O . r s e n`),
+		entry("kort", "JJ", "POS", `" k O r t`),
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+	lexRef := lex.NewLexRef("bulkdb", "bulklex")
+	q := DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{PartOfSpeechLike: "NN"}}
+	lookUp := func(words ...string) map[string]lex.Entry {
+		res := make(map[string]lex.Entry)
+		es, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{Words: words}})
+		if err != nil {
+			t.Fatalf("LookUpIntoSlice failed : %v", err)
+		}
+		for _, e := range es {
+			res[e.Strn] = e
+		}
+		return res
+	}
+
+	// Dry run
+	op := BulkOperation{Type: BulkSetPartOfSpeech, Value: "NNS"}
+	res, err := dbm.BulkUpdate(q, op, "bulker", true)
+	if err != nil {
+		t.Fatalf("BulkUpdate failed : %v", err)
+	}
+	if !res.DryRun || res.Matched != 2 || res.Updated != 2 || len(res.Entries) != 2 {
+		t.Errorf("unexpected dry run result : %#v", res)
+	}
+	if pos := lookUp("fors")["fors"].PartOfSpeech; pos != "NN" {
+		t.Errorf(fs, "NN", pos)
+	}
+
+	// Set part of speech
+	res, err = dbm.BulkUpdate(q, op, "bulker", false)
+	if err != nil {
+		t.Fatalf("BulkUpdate failed : %v", err)
+	}
+	if res.DryRun || res.Matched != 2 || res.Updated != 2 {
+		t.Errorf("unexpected result : %#v", res)
+	}
+	if len(res.Entries) == 2 {
+		r := res.Entries[0]
+		if r.LexRef != lexRef {
+			t.Errorf(fs, lexRef, r.LexRef)
+		}
+		var fields []string
+		for _, c := range r.Changes {
+			fields = append(fields, c.Field)
+		}
+		if x, g := "partOfSpeech status", strings.Join(fields, " "); x != g {
+			t.Errorf(fs, x, g)
+		}
+		if x, g := (FieldChange{Field: "partOfSpeech", OldValue: "NN", NewValue: "NNS"}), r.Changes[0]; x != g {
+			t.Errorf(fs, x, g)
+		}
+	}
+	es := lookUp("fors", "forsen", "kort")
+	for _, w := range []string{"fors", "forsen"} {
+		if e := es[w]; e.PartOfSpeech != "NNS" || e.EntryStatus.Name != "ok" || e.EntryStatus.Source != "bulker" {
+			t.Errorf("unexpected entry after bulk update : %#v", e)
+		}
+	}
+	if e := es["kort"]; e.PartOfSpeech != "JJ" || e.EntryStatus.Source != "tst" {
+		t.Errorf("unexpected entry after bulk update : %#v", e)
+	}
+
+	// The same update again: nothing changed
+	res, err = dbm.BulkUpdate(DBMQuery{LexRefs: q.LexRefs, Query: Query{PartOfSpeechLike: "NN%"}}, op, "bulker", false)
+	if err != nil {
+		t.Fatalf("BulkUpdate failed : %v", err)
+	}
+	if res.Matched != 2 || res.Updated != 0 || res.Unchanged != 2 || len(res.Entries) != 0 {
+		t.Errorf("unexpected result : %#v", res)
+	}
+
+	// Replace transcriptions, status and comments
+	all := DBMQuery{LexRefs: q.LexRefs, Query: Query{WordLike: "%"}}
+	res, err = dbm.BulkUpdate(all, BulkOperation{Type: BulkReplaceTranscription, Pattern: "r s", Value: "rs"}, "bulker", false)
+	if err != nil {
+		t.Fatalf("BulkUpdate failed : %v", err)
+	}
+	if res.Matched != 4 || res.Updated != 3 || res.Unchanged != 1 {
+		t.Errorf("unexpected result : %#v", res)
+	}
+	res, err = dbm.BulkUpdate(DBMQuery{LexRefs: q.LexRefs, Query: Query{Words: []string{"kort"}}}, BulkOperation{Type: BulkSetStatus, Value: "Delete"}, "bulker", false)
+	if err != nil {
+		t.Fatalf("BulkUpdate failed : %v", err)
+	}
+	if res.Updated != 1 {
+		t.Errorf("unexpected result : %#v", res)
+	}
+	res, err = dbm.BulkUpdate(DBMQuery{LexRefs: q.LexRefs, Query: Query{Words: []string{"fors"}}}, BulkOperation{Type: BulkAddComment, Value: "tagset revision", Label: "pos"}, "bulker", false)
+	if err != nil {
+		t.Fatalf("BulkUpdate failed : %v", err)
+	}
+	if res.Updated != 1 {
+		t.Errorf("unexpected result : %#v", res)
+	}
+	es = lookUp("först", "fors", "forsen", "kort")
+	for w, x := range map[string]string{"först": `" f 9 rs t`, "fors": `" f O rs`, "forsen": `" f O . rs e n`, "kort": `" k O r t`} {
+		if g := es[w].Transcriptions[0].Strn; g != x {
+			t.Errorf(fs, x, g)
+		}
+	}
+	if e := es["kort"]; e.EntryStatus.Name != "delete" || e.EntryStatus.Source != "bulker" {
+		t.Errorf("unexpected entry status : %#v", e.EntryStatus)
+	}
+	if cs := es["fors"].Comments; len(cs) != 1 || cs[0].Label != "pos" || cs[0].Comment != "tagset revision" || cs[0].Source != "bulker" {
+		t.Errorf("unexpected comments : %#v", cs)
+	}
+
+	// Errors
+	for _, test := range []struct {
+		q      DBMQuery
+		op     BulkOperation
+		source string
+	}{
+		{DBMQuery{LexRefs: q.LexRefs}, op, "bulker"},
+		{DBMQuery{Query: q.Query}, op, "bulker"},
+		{DBMQuery{LexRefs: []lex.LexRef{lexRef, lex.NewLexRef("otherdb", "bulklex")}, Query: q.Query}, op, "bulker"},
+		{q, op, ""},
+		{q, BulkOperation{Type: "set-tag", Value: "x"}, "bulker"},
+		{q, BulkOperation{Type: BulkSetStatus}, "bulker"},
+		{q, BulkOperation{Type: BulkReplaceTranscription, Pattern: "(", Value: "x"}, "bulker"},
+		{all, BulkOperation{Type: BulkReplaceTranscription, Pattern: ".+", Value: ""}, "bulker"},
+	} {
+		if _, err := dbm.BulkUpdate(test.q, test.op, test.source, false); err == nil {
+			t.Errorf("expected error for %#v %#v '%s', got nil", test.q, test.op, test.source)
+		}
+	}
+	// Nothing was changed by the failing replacement
+	if g := lookUp("kort")["kort"].Transcriptions[0].Strn; g != `" k O r t` {
+		t.Errorf(fs, `" k O r t`, g)
+	}
+}
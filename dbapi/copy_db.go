@@ -0,0 +1,308 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// CopyDBOptions holds the options for CopyDBTo
+type CopyDBOptions struct {
+	// BatchSize is the number of rows copied in each transaction. If zero, defaultCopyDBBatchSize is used.
+	BatchSize int
+	// Checkpoint is the name of a file in which the table and key of the last committed row are saved after each batch. If the file exists when the copy starts, the copy is resumed at the saved table, after the last row found in the target table. The file is removed when the copy has finished.
+	Checkpoint string
+}
+
+const defaultCopyDBBatchSize = 1000
+
+// copyDBTable is a table copied by CopyDBTo
+type copyDBTable struct {
+	name string
+	// key is a unique integer column, used for ordering and resuming
+	key     string
+	columns []string
+}
+
+// copyDBTables lists the tables copied by CopyDBTo, with referenced tables before referencing tables. The key column must be the first column. The SchemaVersion and SchemaMigration tables are not copied, they are created along with the target database.
+var copyDBTables = []copyDBTable{
+	{name: "Lexicon", key: "id", columns: []string{"id", "name", "symbolSetName", "locale"}},
+	{name: "Lemma", key: "id", columns: []string{"id", "reading", "paradigm", "strn"}},
+	{name: "Entry", key: "id", columns: []string{"id", "wordParts", "label", "language", "strn", "reversedStrn", "lexiconId", "partOfSpeech", "morphology", "preferred", "revision"}},
+	{name: "EntryTag", key: "entryId", columns: []string{"entryId", "tag", "wordForm"}},
+	{name: "EntryComment", key: "id", columns: []string{"id", "entryId", "source", "label", "comment"}},
+	{name: "EntryValidation", key: "id", columns: []string{"id", "entryId", "level", "name", "message", "Timestamp"}},
+	{name: "EntryStatus", key: "id", columns: []string{"id", "entryId", "name", "source", "Timestamp", "current"}},
+	{name: "Transcription", key: "id", columns: []string{"id", "entryId", "preference", "label", "language", "strn", "reversedStrn", "sources"}},
+	{name: "Lemma2Entry", key: "entryId", columns: []string{"entryId", "lemmaId"}},
+	{name: "EntryHistory", key: "id", columns: []string{"id", "entryId", "lexiconId", "action", "source", "Timestamp", "changes", "entry"}},
+	{name: "Snapshot", key: "id", columns: []string{"id", "lexiconId", "name", "Timestamp"}},
+	{name: "SnapshotEntry", key: "id", columns: []string{"id", "snapshotId", "entryId", "entry"}},
+}
+
+// readCopyDBCheckpoint returns the table and key saved in the checkpoint file, or empty values if there is no such file. The checkpoint must have been saved for the same source and target databases.
+func readCopyDBCheckpoint(checkpointFile string, from lex.DBRef, to lex.DBRef) (string, int64, error) {
+	bts, err := os.ReadFile(filepath.Clean(checkpointFile))
+	if os.IsNotExist(err) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("couldn't read checkpoint file : %v", err)
+	}
+	fs := strings.Split(strings.TrimSpace(string(bts)), "\t")
+	if len(fs) != 4 {
+		return "", 0, fmt.Errorf("invalid checkpoint file %s, expected four tab separated fields, found %d", checkpointFile, len(fs))
+	}
+	if fs[0] != string(from) || fs[1] != string(to) {
+		return "", 0, fmt.Errorf("checkpoint file %s was saved for copying db %s to %s", checkpointFile, fs[0], fs[1])
+	}
+	key, err := strconv.ParseInt(fs[3], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid key in checkpoint file %s : %v", checkpointFile, err)
+	}
+	return fs[2], key, nil
+}
+
+// writeCopyDBCheckpoint saves the source and target databases, the table and the key of the last committed row to the checkpoint file
+func writeCopyDBCheckpoint(checkpointFile string, from lex.DBRef, to lex.DBRef, table string, key int64) error {
+	tmpFile := checkpointFile + ".tmp"
+	err := os.WriteFile(tmpFile, []byte(fmt.Sprintf("%s\t%s\t%s\t%d\n", from, to, table, key)), 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't write checkpoint file : %v", err)
+	}
+	return os.Rename(tmpFile, checkpointFile)
+}
+
+// copyDBValue converts a value read from any of the db engines into a value that can be inserted into any of them
+func copyDBValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.UTC().Format(copyTimestampLayout)
+	default:
+		return v
+	}
+}
+
+// copyDBKey returns the value of a key column as an integer
+func copyDBKey(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case string:
+		return strconv.ParseInt(x, 10, 64)
+	default:
+		return 0, fmt.Errorf("unexpected key value %#v", v)
+	}
+}
+
+func tableRowCount(db *sql.DB, table string) (int64, error) {
+	var n int64
+	err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rows of table %s : %v", table, err)
+	}
+	return n, nil
+}
+
+func tableMaxKey(db *sql.DB, t copyDBTable) (int64, error) {
+	var n int64
+	err := db.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) FROM %s", t.key, t.name)).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read max %s of table %s : %v", t.key, t.name, err)
+	}
+	return n, nil
+}
+
+// copyDBTableBatch copies at most batchSize rows of a table, having a key larger than after. Returns the number of copied rows and the key of the last copied row. The rows are inserted in a single transaction.
+func copyDBTableBatch(fromDB *sql.DB, toDB *sql.DB, t copyDBTable, after int64, batchSize int) (int, int64, error) {
+	cols := strings.Join(t.columns, ", ")
+	rows, err := fromDB.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s > ? ORDER BY %s LIMIT ?", cols, t.name, t.key, t.key), after, batchSize)
+	if err != nil {
+		return 0, after, fmt.Errorf("failed to read table %s : %v", t.name, err)
+	}
+	defer rows.Close()
+
+	var batch [][]interface{}
+	for rows.Next() {
+		vals := make([]interface{}, len(t.columns))
+		ptrs := make([]interface{}, len(t.columns))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return 0, after, fmt.Errorf("failed to scan row of table %s : %v", t.name, err)
+		}
+		for i, v := range vals {
+			vals[i] = copyDBValue(v)
+		}
+		batch = append(batch, vals)
+	}
+	err = rows.Err()
+	if err != nil {
+		return 0, after, fmt.Errorf("failed to read table %s : %v", t.name, err)
+	}
+	if len(batch) == 0 {
+		return 0, after, nil
+	}
+	last, err := copyDBKey(batch[len(batch)-1][0])
+	if err != nil {
+		return 0, after, fmt.Errorf("table %s : %v", t.name, err)
+	}
+
+	tx, err := toDB.Begin()
+	if err != nil {
+		return 0, after, fmt.Errorf("failed to start db transaction : %v", err)
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.name, cols, strings.TrimSuffix(strings.Repeat("?, ", len(t.columns)), ", "))
+	for _, vals := range batch {
+		_, err = tx.Exec(insert, vals...)
+		if err != nil {
+			msg := fmt.Sprintf("failed to insert into table %s : %v", t.name, err)
+			err2 := tx.Rollback()
+			if err2 != nil {
+				msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+			}
+			return 0, after, fmt.Errorf(msg)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, after, fmt.Errorf("failed to commit table %s : %v", t.name, err)
+	}
+	return len(batch), last, nil
+}
+
+// copyDB copies all rows of the source database into the target database, table by table, keeping the row ids. See DBManager.CopyDBTo.
+func copyDB(fromDBIF DBIF, fromDB *sql.DB, from lex.DBRef, toDBIF DBIF, toDB *sql.DB, to lex.DBRef, logger Logger, opts CopyDBOptions) (CopyDBResult, error) {
+	res := CopyDBResult{From: from, To: to, Tables: []CopyDBTableResult{}}
+
+	fromVersion, err := fromDBIF.getSchemaVersion(fromDB)
+	if err != nil {
+		return res, err
+	}
+	toVersion, err := toDBIF.getSchemaVersion(toDB)
+	if err != nil {
+		return res, err
+	}
+	if fromVersion != toVersion {
+		return res, fmt.Errorf("schema version mismatch : %s has version %s, %s has version %s", from, fromVersion, to, toVersion)
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultCopyDBBatchSize
+	}
+
+	resumeTable := ""
+	if opts.Checkpoint != "" {
+		resumeTable, _, err = readCopyDBCheckpoint(opts.Checkpoint, from, to)
+		if err != nil {
+			return res, err
+		}
+	}
+	if resumeTable == "" {
+		for _, t := range copyDBTables {
+			n, err := tableRowCount(toDB, t.name)
+			if err != nil {
+				return res, err
+			}
+			if n > 0 {
+				return res, fmt.Errorf("target db %s is not empty : table %s has %d rows", to, t.name, n)
+			}
+		}
+	} else {
+		res.ResumedAtTable = resumeTable
+	}
+
+	resuming := resumeTable != ""
+	for _, t := range copyDBTables {
+		total, err := tableRowCount(fromDB, t.name)
+		if err != nil {
+			return res, err
+		}
+		tRes := CopyDBTableResult{Table: t.name, Rows: total}
+
+		var after int64
+		if resuming && t.name != resumeTable {
+			// copied by an earlier run
+			res.Tables = append(res.Tables, tRes)
+			continue
+		}
+		if resumeTable != "" {
+			// the checkpoint may lag behind the last committed batch, so the copy is resumed after the largest key in the target table
+			after, err = tableMaxKey(toDB, t)
+			if err != nil {
+				return res, err
+			}
+			if resuming {
+				res.ResumedAfterKey = after
+				logger.Write(fmt.Sprintf("Resuming copy at table %s, after %s %d", t.name, t.key, after))
+			}
+			resuming = false
+		}
+
+		logger.Write(fmt.Sprintf("Copying table %s (%d rows)", t.name, total))
+		for {
+			n, last, err := copyDBTableBatch(fromDB, toDB, t, after, batchSize)
+			if err != nil {
+				return res, err
+			}
+			if n == 0 {
+				break
+			}
+			after = last
+			tRes.Copied += int64(n)
+			if opts.Checkpoint != "" {
+				err = writeCopyDBCheckpoint(opts.Checkpoint, from, to, t.name, after)
+				if err != nil {
+					return res, err
+				}
+			}
+			logger.Progress(fmt.Sprintf("Copying table %s: %d rows copied", t.name, tRes.Copied))
+		}
+
+		n, err := tableRowCount(toDB, t.name)
+		if err != nil {
+			return res, err
+		}
+		if n != total {
+			return res, fmt.Errorf("row count mismatch for table %s : %s has %d rows, %s has %d rows", t.name, from, total, to, n)
+		}
+		res.Tables = append(res.Tables, tRes)
+	}
+	if resuming {
+		return res, fmt.Errorf("invalid table '%s' in checkpoint file %s", resumeTable, opts.Checkpoint)
+	}
+
+	fullText, err := fullTextEnabled(fromDBIF.engine(), fromDB)
+	if err != nil {
+		return res, err
+	}
+	if fullText {
+		err = enableFullText(toDBIF.engine(), toDB)
+		if err != nil {
+			// all rows are already copied, so this is not treated as a failure
+			logger.Write(fmt.Sprintf("Failed to create full-text index for %s (see DBManager.EnableFullTextSearch) : %v", to, err))
+		} else {
+			res.FullText = true
+		}
+	}
+
+	if opts.Checkpoint != "" {
+		err = os.Remove(opts.Checkpoint)
+		if err != nil && !os.IsNotExist(err) {
+			return res, fmt.Errorf("failed to remove checkpoint file : %v", err)
+		}
+	}
+	logger.Write(fmt.Sprintf("Copied db %s to %s", from, to))
+	return res, nil
+}
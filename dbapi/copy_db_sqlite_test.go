@@ -0,0 +1,234 @@
+package dbapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestCopyDBSqlite(t *testing.T) {
+	toDB := newSqliteTestDB(t)
+
+	testCopyDB(t, toDB, sqliteDBIF{})
+}
+
+// copyDBTestSource creates a DBManager with a populated sqlite db 'copydb_from', to be copied by the sqlite and mariadb tests
+func copyDBTestSource(t *testing.T) (*DBManager, *sql.DB) {
+	db := newSqliteTestDB(t)
+	dbm := NewSqliteDBManager()
+	err := dbm.AddDB("copydb_from", db)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	for _, lexName := range []string{"lex1", "lex2"} {
+		l, err := sqliteDBIF{}.defineLexicon(db, lexicon{name: lexName, symbolSetName: "ZZ", locale: "sv_SE"})
+		if err != nil {
+			t.Fatalf("Ooops! : %v", err)
+		}
+		_, err = sqliteDBIF{}.insertEntries(db, l, []lex.Entry{
+			{Strn: "apa", PartOfSpeech: "NN", Language: "sv", WordParts: "apa", Preferred: true, Tag: "animal_" + lexName,
+				Lemma:            lex.Lemma{Strn: "apa", Reading: "", Paradigm: "s1a-flicka"},
+				Transcriptions:   []lex.Transcription{{Strn: "\" A: . p a", Language: "sv"}, {Strn: "\" a . p a", Language: "sv"}},
+				EntryStatus:      lex.EntryStatus{Name: "imported", Source: "tst"},
+				Comments:         []lex.EntryComment{{Label: "note", Source: "tst", Comment: "a comment"}},
+				EntryValidations: []lex.EntryValidation{{Level: "Fatal", RuleName: "rule1", Message: "a message"}},
+			},
+			{Strn: "bepa", PartOfSpeech: "NN", Language: "sv", WordParts: "bepa",
+				Transcriptions: []lex.Transcription{{Strn: "\" b e: . p a", Language: "sv"}},
+				EntryStatus:    lex.EntryStatus{Name: "imported", Source: "tst"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert entries : %v", err)
+		}
+	}
+	lexRef := lex.NewLexRef("copydb_from", "lex1")
+	es, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{Words: []string{"bepa"}}})
+	if err != nil || len(es) != 1 {
+		t.Fatalf("LookUpIntoSlice failed : %v", err)
+	}
+	bepa := es[0]
+	bepa.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor"}
+	bepa.Transcriptions[0].Strn = "\" b e: . p A"
+	_, _, err = dbm.UpdateEntry(bepa)
+	if err != nil {
+		t.Fatalf("UpdateEntry failed : %v", err)
+	}
+	_, err = dbm.CreateSnapshot(lexRef, "release1")
+	if err != nil {
+		t.Fatalf("CreateSnapshot failed : %v", err)
+	}
+	return dbm, db
+}
+
+// testCopyDB is shared between the sqlite and mariadb tests. The source db is always sqlite, and toDB is an empty db of the target engine.
+func testCopyDB(t *testing.T, toDB *sql.DB, toDBIF DBIF) {
+	dbm, _ := copyDBTestSource(t)
+
+	target, err := NewDBManager(toDBIF.engine())
+	if err != nil {
+		t.Fatalf("NewDBManager failed : %v", err)
+	}
+	err = target.AddDB("copydb_to", toDB)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	res, err := dbm.CopyDBTo("copydb_from", target, "copydb_to", SilentLogger{}, CopyDBOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatalf("CopyDBTo failed : %v", err)
+	}
+	if w, g := len(copyDBTables), len(res.Tables); w != g {
+		t.Fatalf(fs, w, g)
+	}
+	for _, tRes := range res.Tables {
+		if tRes.Rows != tRes.Copied {
+			t.Errorf("expected all rows of table %s to be copied, got %#v", tRes.Table, tRes)
+		}
+		if tRes.Table == "Entry" && tRes.Rows != 4 {
+			t.Errorf("expected 4 rows in table Entry, got %d", tRes.Rows)
+		}
+	}
+
+	compareCopiedDB(t, dbm, "copydb_from", target, "copydb_to")
+
+	// The target db is not empty
+	_, err = dbm.CopyDBTo("copydb_from", target, "copydb_to", SilentLogger{}, CopyDBOptions{})
+	if err == nil {
+		t.Errorf("expected error for non-empty target db")
+	}
+
+	// New entries get new ids in the target db
+	ids, err := target.InsertEntries(lex.NewLexRef("copydb_to", "lex1"), []lex.Entry{{Strn: "cepa", Language: "sv", Transcriptions: []lex.Transcription{{Strn: "\" s e: . p a", Language: "sv"}}}})
+	if err != nil {
+		t.Fatalf("InsertEntries failed : %v", err)
+	}
+	if w, g := int64(5), ids[0]; w != g {
+		t.Errorf(fs, w, g)
+	}
+}
+
+// compareCopiedDB checks that the entries, entry history and snapshots are equal in the two dbs. Timestamps are normalized, since the db engines use different formats.
+func compareCopiedDB(t *testing.T, fromDBM *DBManager, from lex.DBRef, toDBM *DBManager, to lex.DBRef) {
+	normalize := func(ts string) string {
+		res, err := copyTimestamp(ts)
+		if err != nil {
+			t.Errorf("invalid timestamp : %v", err)
+		}
+		return res
+	}
+	dump := func(dbm *DBManager, dbRef lex.DBRef) string {
+		var res []interface{}
+		for _, lexName := range []lex.LexName{"lex1", "lex2"} {
+			lexRef := lex.LexRef{DBRef: dbRef, LexName: lexName}
+			es, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{WordLike: "%"}})
+			if err != nil {
+				t.Fatalf("LookUpIntoSlice failed : %v", err)
+			}
+			for _, e := range es {
+				e.LexRef.DBRef = ""
+				e.EntryStatus.Timestamp = normalize(e.EntryStatus.Timestamp)
+				for i, v := range e.EntryValidations {
+					v.Timestamp = normalize(v.Timestamp)
+					e.EntryValidations[i] = v
+				}
+				res = append(res, e)
+
+				hist, err := dbm.EntryHistory(lexRef, e.ID)
+				if err != nil {
+					t.Fatalf("EntryHistory failed : %v", err)
+				}
+				for _, h := range hist {
+					res = append(res, h.ID, h.Action, h.Source, normalize(h.Timestamp), h.Changes)
+				}
+			}
+			snapshots, err := dbm.ListSnapshots(lexRef)
+			if err != nil {
+				t.Fatalf("ListSnapshots failed : %v", err)
+			}
+			for _, s := range snapshots {
+				res = append(res, s.ID, s.Name, s.EntryCount, normalize(s.Timestamp))
+			}
+		}
+		bts, err := json.Marshal(res)
+		if err != nil {
+			t.Fatalf("Marshal failed : %v", err)
+		}
+		return string(bts)
+	}
+
+	if w, g := dump(fromDBM, from), dump(toDBM, to); w != g {
+		t.Errorf("copied db differs from source db:\n%s\n%s", w, g)
+	}
+}
+
+func TestCopyDBResumeSqlite(t *testing.T) {
+	dbm, fromDB := copyDBTestSource(t)
+	toDB := newSqliteTestDB(t)
+	target := NewSqliteDBManager()
+	err := target.AddDB("copydb_to", toDB)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	// An interrupted copy: the tables before Entry, and the first batch of Entry are copied
+	checkpoint := filepath.Join(t.TempDir(), "copydb_resume.checkpoint")
+	for _, tbl := range copyDBTables[:2] {
+		_, _, err = copyDBTableBatch(fromDB, toDB, tbl, 0, 100)
+		if err != nil {
+			t.Fatalf("copyDBTableBatch failed : %v", err)
+		}
+	}
+	_, last, err := copyDBTableBatch(fromDB, toDB, copyDBTables[2], 0, 3)
+	if err != nil {
+		t.Fatalf("copyDBTableBatch failed : %v", err)
+	}
+	// the checkpoint lags behind the last committed batch
+	err = writeCopyDBCheckpoint(checkpoint, "copydb_from", "copydb_to", "Entry", 1)
+	if err != nil {
+		t.Fatalf("writeCopyDBCheckpoint failed : %v", err)
+	}
+
+	// Wrong db in checkpoint file
+	_, _, err = readCopyDBCheckpoint(checkpoint, "copydb_from", "copydb_other")
+	if err == nil {
+		t.Errorf("expected error for wrong db in checkpoint")
+	}
+
+	res, err := dbm.CopyDBTo("copydb_from", target, "copydb_to", SilentLogger{}, CopyDBOptions{Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("CopyDBTo failed : %v", err)
+	}
+	if w, g := "Entry", res.ResumedAtTable; w != g {
+		t.Errorf(fs, w, g)
+	}
+	if w, g := last, res.ResumedAfterKey; w != g {
+		t.Errorf(fs, w, g)
+	}
+	for _, tRes := range res.Tables {
+		switch tRes.Table {
+		case "Lexicon", "Lemma":
+			if tRes.Copied != 0 {
+				t.Errorf("expected no rows of table %s to be copied, got %#v", tRes.Table, tRes)
+			}
+		case "Entry":
+			if tRes.Copied != 1 || tRes.Rows != 4 {
+				t.Errorf("expected 1 of 4 rows of table Entry to be copied, got %#v", tRes)
+			}
+		default:
+			if tRes.Rows != tRes.Copied {
+				t.Errorf("expected all rows of table %s to be copied, got %#v", tRes.Table, tRes)
+			}
+		}
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("expected checkpoint file to be removed")
+	}
+
+	compareCopiedDB(t, dbm, "copydb_from", target, "copydb_to")
+}
@@ -0,0 +1,245 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// copyTimestampLayout is the timestamp format used when inserting copied timestamps. It is accepted by both Sqlite and MariaDB.
+const copyTimestampLayout = "2006-01-02 15:04:05"
+
+// copyTimestamp converts a timestamp read from any of the db engines into copyTimestampLayout
+func copyTimestamp(s string) (string, error) {
+	t, err := parseHistoryTimestamp(s)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(copyTimestampLayout), nil
+}
+
+// entryStatusRow is a row of the EntryStatus table, including non-current statuses
+type entryStatusRow struct {
+	name      string
+	source    string
+	timestamp string
+	current   bool
+}
+
+// lexiconCopy is the content of a lexicon read by readLexiconCopy
+type lexiconCopy struct {
+	lexicon  lexicon
+	entries  []lex.Entry
+	statuses map[int64][]entryStatusRow // entry id => all statuses of the entry, oldest first
+}
+
+// readLexiconCopy reads the complete content of a lexicon, to be inserted using insertLexiconCopy
+func readLexiconCopy(dbif DBIF, db *sql.DB, lexName string) (lexiconCopy, error) {
+	res := lexiconCopy{statuses: make(map[int64][]entryStatusRow)}
+
+	l, err := dbif.getLexicon(db, lexName)
+	if err != nil {
+		return res, err
+	}
+	l.locale, err = dbif.locale(db, lexName)
+	if err != nil {
+		return res, err
+	}
+	res.lexicon = l
+
+	var esw lex.EntrySliceWriter
+	err = dbif.lookUp(db, []lex.LexName{lex.LexName(lexName)}, Query{WordLike: "%"}, &esw)
+	if err != nil {
+		return res, err
+	}
+	res.entries = esw.Entries
+
+	rows, err := db.Query("SELECT EntryStatus.entryId, EntryStatus.name, EntryStatus.source, EntryStatus.Timestamp, EntryStatus.current FROM EntryStatus, Entry, Lexicon WHERE EntryStatus.entryId = Entry.id AND Entry.lexiconId = Lexicon.id AND Lexicon.name = ? ORDER BY EntryStatus.id", l.name)
+	if err != nil {
+		return res, fmt.Errorf("failed to read entry statuses : %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entryID int64
+		var s entryStatusRow
+		err = rows.Scan(&entryID, &s.name, &s.source, &s.timestamp, &s.current)
+		if err != nil {
+			return res, fmt.Errorf("failed to scan entry status : %v", err)
+		}
+		res.statuses[entryID] = append(res.statuses[entryID], s)
+	}
+	err = rows.Err()
+	if err != nil {
+		return res, fmt.Errorf("failed to read entry statuses : %v", err)
+	}
+
+	return res, nil
+}
+
+func insertLexiconCopy(dbif DBIF, db *sql.DB, lexName string, lc lexiconCopy) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("insertLexiconCopy failed to start db transaction : %v", err)
+	}
+
+	n, err := insertLexiconCopyTx(dbif, tx, lexName, lc)
+	if err != nil {
+		// insertEntriesTx rolls back the transaction on failure
+		err2 := tx.Rollback()
+		if err2 != nil && err2 != sql.ErrTxDone {
+			return n, fmt.Errorf("%v : rollback failed : %v", err, err2)
+		}
+		return n, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return n, fmt.Errorf("insertLexiconCopy commit failed : %v", err)
+	}
+	return n, nil
+}
+
+// insertLexiconCopyTx creates the lexicon lexName, and inserts the lexicon content read by readLexiconCopy. The entry statuses are replaced by the complete status history of the source entries, and validations are inserted with their original timestamps. Returns the number of inserted entries.
+func insertLexiconCopyTx(dbif DBIF, tx *sql.Tx, lexName string, lc lexiconCopy) (int, error) {
+	lexName = strings.ToLower(lexName)
+	lexMap, err := dbif.getLexiconMapTx(tx)
+	if err != nil {
+		return 0, err
+	}
+	if lexMap[lexName] {
+		return 0, fmt.Errorf("lexicon '%s' already exists", lexName)
+	}
+	err = checkCopyTagsTx(tx, lc.entries)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("INSERT INTO Lexicon (name, symbolSetName, locale) VALUES (?, ?, ?)", lexName, lc.lexicon.symbolSetName, lc.lexicon.locale)
+	if err != nil {
+		return 0, fmt.Errorf("failed to define lexicon '%s' : %v", lexName, err)
+	}
+	l, err := dbif.getLexiconTx(tx, lexName)
+	if err != nil {
+		return 0, err
+	}
+
+	// Preferred is set after insert, since inserting a preferred entry may unset the preferred flag of entries in other lexicons
+	es := make([]lex.Entry, len(lc.entries))
+	for i, e := range lc.entries {
+		ne := newEntryForInsert(e, e.EntryStatus.Source)
+		ne.Preferred = false
+		es[i] = ne
+	}
+	ids, err := dbif.insertEntriesTx(tx, l, es)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, e := range lc.entries {
+		id := ids[i]
+		if e.Preferred {
+			_, err = tx.Exec("UPDATE Entry SET preferred = 1 WHERE id = ?", id)
+			if err != nil {
+				return 0, fmt.Errorf("failed to set preferred for '%s' : %v", e.Strn, err)
+			}
+		}
+
+		if statuses, ok := lc.statuses[e.ID]; ok {
+			_, err = tx.Exec("DELETE FROM EntryStatus WHERE entryId = ?", id)
+			if err != nil {
+				return 0, fmt.Errorf("failed to delete entry status for '%s' : %v", e.Strn, err)
+			}
+			for _, s := range statuses {
+				ts, err := copyTimestamp(s.timestamp)
+				if err != nil {
+					return 0, fmt.Errorf("entry status for '%s' : %v", e.Strn, err)
+				}
+				_, err = tx.Exec("INSERT INTO EntryStatus (entryId, name, source, Timestamp, current) VALUES (?, ?, ?, ?, ?)", id, s.name, s.source, ts, s.current)
+				if err != nil {
+					return 0, fmt.Errorf("failed to insert entry status for '%s' : %v", e.Strn, err)
+				}
+			}
+		}
+
+		for _, v := range e.EntryValidations {
+			ts, err := copyTimestamp(v.Timestamp)
+			if err != nil {
+				return 0, fmt.Errorf("entry validation for '%s' : %v", e.Strn, err)
+			}
+			_, err = tx.Exec("INSERT INTO EntryValidation (entryId, level, name, message, Timestamp) VALUES (?, ?, ?, ?, ?)", id, strings.ToLower(v.Level), v.RuleName, v.Message, ts)
+			if err != nil {
+				return 0, fmt.Errorf("failed to insert entry validation for '%s' : %v", e.Strn, err)
+			}
+		}
+	}
+
+	return len(ids), nil
+}
+
+// checkCopyTagsTx checks that none of the entry tags to copy is already used in the target database. Entry tags are unique per database (for each orthography), so a lexicon with tagged entries cannot be copied within the same database.
+func checkCopyTagsTx(tx *sql.Tx, es []lex.Entry) error {
+	var used []string
+	for _, e := range es {
+		tag := strings.TrimSpace(strings.ToLower(e.Tag))
+		if tag == "" {
+			continue
+		}
+		var n int
+		err := tx.QueryRow("SELECT count(*) FROM EntryTag WHERE tag = ? AND wordForm = ?", tag, strings.ToLower(e.Strn)).Scan(&n)
+		if err != nil {
+			return fmt.Errorf("failed to look up entry tag '%s' : %v", tag, err)
+		}
+		if n > 0 {
+			used = append(used, fmt.Sprintf("%s (%s)", e.Strn, tag))
+		}
+	}
+	if len(used) > 0 {
+		return fmt.Errorf("entry tags are unique per database, and the target database already has tagged entries for: %s", strings.Join(used, ", "))
+	}
+	return nil
+}
+
+func renameLexicon(dbif DBIF, db *sql.DB, from string, to string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("renameLexicon failed to start db transaction : %v", err)
+	}
+
+	err = renameLexiconTx(dbif, tx, from, to)
+	if err != nil {
+		err2 := tx.Rollback()
+		if err2 != nil {
+			return fmt.Errorf("%v : rollback failed : %v", err, err2)
+		}
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("renameLexicon commit failed : %v", err)
+	}
+	return nil
+}
+
+// renameLexiconTx changes the name of a lexicon. Entries, history and snapshots refer to the lexicon id, and are not affected.
+func renameLexiconTx(dbif DBIF, tx *sql.Tx, from string, to string) error {
+	from = strings.ToLower(from)
+	to = strings.ToLower(to)
+	if trm(to) == "" {
+		return fmt.Errorf("new lexicon name must not be empty")
+	}
+	lexMap, err := dbif.getLexiconMapTx(tx)
+	if err != nil {
+		return err
+	}
+	if !lexMap[from] {
+		return fmt.Errorf("no such lexicon '%s'", from)
+	}
+	if lexMap[to] {
+		return fmt.Errorf("lexicon '%s' already exists", to)
+	}
+	_, err = tx.Exec("UPDATE Lexicon SET name = ? WHERE name = ?", to, from)
+	if err != nil {
+		return fmt.Errorf("failed to rename lexicon '%s' : %v", from, err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestCopyLexiconSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+	db2 := newSqliteTestDB(t)
+
+	testCopyLexicon(t, sqliteDBIF{}, db, db2)
+}
+
+// testCopyLexicon is shared between the sqlite and mariadb tests
+func testCopyLexicon(t *testing.T, dbif DBIF, db *sql.DB, db2 *sql.DB) {
+	dbm, err := NewDBManager(dbif.engine())
+	if err != nil {
+		t.Fatalf("NewDBManager failed : %v", err)
+	}
+	err = dbm.AddDB("copydb", db)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+	// A separate DBManager, as for copying to another db engine
+	dbm2, err := NewDBManager(dbif.engine())
+	if err != nil {
+		t.Fatalf("NewDBManager failed : %v", err)
+	}
+	err = dbm2.AddDB("copydb2", db2)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	l, err := dbif.defineLexicon(db, lexicon{name: "copylex", symbolSetName: "ZZ", locale: "sv_SE"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	_, err = dbif.insertEntries(db, l, []lex.Entry{
+		{Strn: "apa", PartOfSpeech: "NN", Language: "sv", WordParts: "apa", Preferred: true, Tag: "animal",
+			Lemma:            lex.Lemma{Strn: "apa", Reading: "", Paradigm: "s1a-flicka"},
+			Transcriptions:   []lex.Transcription{{Strn: "\" A: . p a", Language: "sv"}},
+			EntryStatus:      lex.EntryStatus{Name: "imported", Source: "tst"},
+			Comments:         []lex.EntryComment{{Label: "note", Source: "tst", Comment: "a comment"}},
+			EntryValidations: []lex.EntryValidation{{Level: "Fatal", RuleName: "rule1", Message: "a message"}},
+		},
+		{Strn: "bepa", PartOfSpeech: "NN", Language: "sv", WordParts: "bepa",
+			Transcriptions: []lex.Transcription{{Strn: "\" b e: . p a", Language: "sv"}},
+			EntryStatus:    lex.EntryStatus{Name: "imported", Source: "tst"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+	from := lex.NewLexRef("copydb", "copylex")
+	lookUp := func(dbm *DBManager, lexRef lex.LexRef) []lex.Entry {
+		es, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{WordLike: "%"}})
+		if err != nil {
+			t.Fatalf("LookUpIntoSlice failed : %v", err)
+		}
+		return es
+	}
+	es := lookUp(dbm, from)
+	if len(es) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(es))
+	}
+	bepa := es[1]
+	bepa.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor"}
+	_, _, err = dbm.UpdateEntry(bepa)
+	if err != nil {
+		t.Fatalf("UpdateEntry failed : %v", err)
+	}
+	srcEs := lookUp(dbm, from)
+
+	statusHistory := func(db *sql.DB, lexName string) []entryStatusRow {
+		lc, err := readLexiconCopy(dbif, db, lexName)
+		if err != nil {
+			t.Fatalf("readLexiconCopy failed : %v", err)
+		}
+		var res []entryStatusRow
+		for _, e := range lc.entries {
+			res = append(res, lc.statuses[e.ID]...)
+		}
+		return res
+	}
+	compare := func(to lex.LexRef, toEs []lex.Entry) {
+		if len(toEs) != len(srcEs) {
+			t.Fatalf("expected %d entries in %s, got %d", len(srcEs), to, len(toEs))
+		}
+		for i, e := range toEs {
+			src := srcEs[i]
+			if e.ID == src.ID && to.DBRef == "copydb" {
+				t.Errorf("expected new entry id for %s, got %d", e.Strn, e.ID)
+			}
+			if e.LexRef != to {
+				t.Errorf(fs, to, e.LexRef)
+			}
+			if changes := entryDiff(src, e); len(changes) != 0 {
+				t.Errorf("unexpected differences for %s : %#v", e.Strn, changes)
+			}
+			if w, g := src.EntryStatus.Timestamp, e.EntryStatus.Timestamp; w != g {
+				t.Errorf(fs, w, g)
+			}
+			if w, g := len(src.EntryValidations), len(e.EntryValidations); w != g {
+				t.Fatalf(fs, w, g)
+			}
+			for j, v := range e.EntryValidations {
+				if w, g := src.EntryValidations[j].String(), v.String(); w != g {
+					t.Errorf(fs, w, g)
+				}
+			}
+		}
+	}
+
+	// Copy into another database
+	to2 := lex.NewLexRef("copydb2", "copylex")
+	_, err = dbm.CopyLexiconTo(from, dbm2, to2)
+	if err != nil {
+		t.Fatalf("CopyLexiconTo failed : %v", err)
+	}
+	compare(to2, lookUp(dbm2, to2))
+	if w, g := statusHistory(db, "copylex"), statusHistory(db2, "copylex"); len(w) != 3 || fmt.Sprintf("%v", w) != fmt.Sprintf("%v", g) {
+		t.Errorf(fs, w, g)
+	}
+
+	// Copy within the same database: entry tags are unique per database
+	to := lex.NewLexRef("copydb", "copylex2")
+	_, err = dbm.CopyLexicon(from, to)
+	if err == nil {
+		t.Errorf("expected error for copying tagged entries within the same database")
+	} else if !strings.Contains(err.Error(), "already has tagged entries for: apa (animal)") {
+		t.Errorf("unexpected error for copying tagged entries : %v", err)
+	}
+	if ok, _ := dbm.LexiconExists(to); ok {
+		t.Errorf("expected lexicon %s not to be created", to)
+	}
+	apa := srcEs[0]
+	apa.Tag = ""
+	_, _, err = dbm.UpdateEntry(apa)
+	if err != nil {
+		t.Fatalf("UpdateEntry failed : %v", err)
+	}
+	srcEs = lookUp(dbm, from)
+	res, err := dbm.CopyLexicon(from, to)
+	if err != nil {
+		t.Fatalf("CopyLexicon failed : %v", err)
+	}
+	if w, g := 2, res.Entries; w != g {
+		t.Errorf(fs, w, g)
+	}
+	compare(to, lookUp(dbm, to))
+	// the source lexicon is not modified
+	if changes := entryDiff(srcEs[0], lookUp(dbm, from)[0]); len(changes) != 0 {
+		t.Errorf("unexpected differences in source lexicon : %#v", changes)
+	}
+
+	// Existing target lexicon
+	_, err = dbm.CopyLexicon(from, to)
+	if err == nil {
+		t.Errorf("expected error for existing target lexicon")
+	}
+	_, err = dbm.CopyLexicon(lex.NewLexRef("copydb", "nonexisting"), lex.NewLexRef("copydb", "copylex3"))
+	if err == nil {
+		t.Errorf("expected error for non-existing source lexicon")
+	}
+
+	// Rename
+	err = dbm.RenameLexicon(to, "renamed")
+	if err != nil {
+		t.Fatalf("RenameLexicon failed : %v", err)
+	}
+	renamed := lex.NewLexRef("copydb", "renamed")
+	if ok, _ := dbm.LexiconExists(to); ok {
+		t.Errorf("expected lexicon %s to be renamed", to)
+	}
+	if w, g := 2, len(lookUp(dbm, renamed)); w != g {
+		t.Errorf(fs, w, g)
+	}
+	err = dbm.RenameLexicon(renamed, "copylex")
+	if err == nil {
+		t.Errorf("expected error for renaming to an existing lexicon")
+	}
+	err = dbm.RenameLexicon(to, "copylex4")
+	if err == nil {
+		t.Errorf("expected error for renaming a non-existing lexicon")
+	}
+}
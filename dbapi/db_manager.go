@@ -10,6 +10,7 @@ import (
 
 	"github.com/stts-se/pronlex/lex"
 	"github.com/stts-se/pronlex/validation"
+	"github.com/stts-se/symbolset"
 )
 
 // DBManager is used by external services (i.e., lexserver) to cache sql database instances along with their names
@@ -18,6 +19,12 @@ type DBManager struct {
 	dbs          map[lex.DBRef]*sql.DB
 	dbif         DBIF
 	MaxOpenConns int
+
+	// SchemaCheck defines how OpenDB handles databases with an out-of-date schema version (default: RefuseOutdatedSchema)
+	SchemaCheck SchemaCheck
+
+	// symbol sets for phoneme search, see AddSymbolSet
+	symbolSets map[string]symbolset.SymbolSet
 }
 
 func (dbm DBManager) Engine() DBEngine {
@@ -38,6 +45,20 @@ func (dbm DBManager) RUnlock() {
 	dbm.mutex.RUnlock()
 }
 
+// SchemaCheck defines how DBManager.OpenDB handles databases with a schema version older than SchemaVersion
+type SchemaCheck int
+
+const (
+	// RefuseOutdatedSchema makes OpenDB return an error for out-of-date databases, that have to be migrated using DBManager.MigrateDB (or cmd/lexio/migrateSchema)
+	RefuseOutdatedSchema SchemaCheck = iota
+
+	// MigrateOutdatedSchema makes OpenDB migrate out-of-date databases to SchemaVersion
+	MigrateOutdatedSchema
+
+	// SkipSchemaCheck makes OpenDB skip the schema version check, e.g., for opening an out-of-date database to be migrated
+	SkipSchemaCheck
+)
+
 // NewDBManager creates a new DBManager instance with empty cache
 func NewDBManager(engine DBEngine) (*DBManager, error) {
 	if engine == Sqlite {
@@ -51,12 +72,12 @@ func NewDBManager(engine DBEngine) (*DBManager, error) {
 
 // NewSqliteDBManager creates a new DBManager instance with empty cache
 func NewSqliteDBManager() *DBManager {
-	return &DBManager{mutex: &sync.RWMutex{}, dbs: make(map[lex.DBRef]*sql.DB), dbif: sqliteDBIF{}}
+	return &DBManager{mutex: &sync.RWMutex{}, dbs: make(map[lex.DBRef]*sql.DB), dbif: sqliteDBIF{}, symbolSets: make(map[string]symbolset.SymbolSet)}
 }
 
 // NewMariaDBManager creates a new DBManager instance with empty cache
 func NewMariaDBManager() *DBManager {
-	return &DBManager{mutex: &sync.RWMutex{}, dbs: make(map[lex.DBRef]*sql.DB), dbif: mariaDBIF{}}
+	return &DBManager{mutex: &sync.RWMutex{}, dbs: make(map[lex.DBRef]*sql.DB), dbif: mariaDBIF{}, symbolSets: make(map[string]symbolset.SymbolSet)}
 }
 
 // CloseDB is used to close the specified database
@@ -162,11 +183,49 @@ func (dbm *DBManager) OpenDB(dbLocation string, dbRef lex.DBRef) error {
 		db.SetMaxOpenConns(dbm.MaxOpenConns)
 	}
 
+	err = checkFullTextSupport(dbm.dbif.engine(), db)
+	if err == nil {
+		err = dbm.checkSchemaVersion(db, dbRef)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("DBManager.OpenDB: %v", err)
+		err2 := db.Close()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : failed to close db : %v", msg, err2)
+		}
+		return fmt.Errorf(msg)
+	}
+
 	dbm.dbs[dbRef] = db
 
 	return nil
 }
 
+// checkSchemaVersion checks the schema version of a database to be opened, as defined by dbm.SchemaCheck
+func (dbm *DBManager) checkSchemaVersion(db *sql.DB, dbRef lex.DBRef) error {
+	if dbm.SchemaCheck == SkipSchemaCheck {
+		return nil
+	}
+	pending, err := listPendingSchemaMigrations(dbm.dbif, db)
+	if err != nil {
+		return fmt.Errorf("invalid schema version for db '%s' : %v", dbRef, err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if dbm.SchemaCheck != MigrateOutdatedSchema {
+		return fmt.Errorf("db '%s' needs %d schema migration(s) to schema version %s : use cmd/lexio/migrateSchema to upgrade the db", dbRef, len(pending), SchemaVersion)
+	}
+	res, err := migrateSchema(dbm.dbif, db, dbRef)
+	if err != nil {
+		return err
+	}
+	for _, m := range res.Applied {
+		log.Printf("DBManager.OpenDB: migrated db '%s' to schema version %s : %s", dbRef, m.Version, m.Description)
+	}
+	return nil
+}
+
 // AddDB is used to add a database to the cached map of available databases. It does NOT create the database on disk. To create AND add the database, use DefineDB instead. To open and add an existing db, use OpenDB
 func (dbm *DBManager) AddDB(dbRef lex.DBRef, db *sql.DB) error {
 	name := string(dbRef)
@@ -253,7 +312,7 @@ func (dbm *DBManager) ListDBNames() ([]lex.DBRef, error) {
 // }
 
 // DeleteLexicon deletes the lexicon from the associated lexicon
-// database. Returns an error if the lexicon doesn't exist,  or if the lexicon is not empty.
+// database. Returns an error if the lexicon doesn't exist,  or if the lexicon is not empty, or if it has snapshots (see DeleteSnapshot).
 func (dbm *DBManager) DeleteLexicon(lexRef lex.LexRef) error {
 	dbm.Lock()
 	defer dbm.Unlock()
@@ -380,6 +439,89 @@ func (dbm *DBManager) LookUpIntoMap(q DBMQuery) (map[lex.DBRef][]lex.Entry, erro
 	return res, nil
 }
 
+// QueryStats counts the entries matching a DBMQuery, regardless of the page settings of the query. If withFacets is true, the matching entries are also counted per value of each facet (see Facets).
+func (dbm *DBManager) QueryStats(q DBMQuery, withFacets bool) (QueryStats, error) {
+	res := QueryStats{Query: q.Query}
+	if len(q.LexRefs) == 0 {
+		return res, fmt.Errorf("DBManager.QueryStats cannot perform a search without at least one lexicon specified (using the 'lexicons' parameter)")
+	}
+
+	dbz := make(map[lex.DBRef][]lex.LexName)
+	for _, l := range q.LexRefs {
+		dbz[l.DBRef] = append(dbz[l.DBRef], l.LexName)
+	}
+
+	dbm.RLock()
+	defer dbm.RUnlock()
+
+	for dbR, lexNames := range dbz {
+		db, ok := dbm.dbs[dbR]
+		if !ok {
+			return res, fmt.Errorf("DBManager.QueryStats failed: no db of name '%s'", dbR)
+		}
+		q0, err := dbm.prepareQuery(db, lexNames, q.Query)
+		if err != nil {
+			return res, fmt.Errorf("DBManager.QueryStats failed for %v:%v : %v", dbR, lexNames, err)
+		}
+		stats, err := queryStats(dbm.dbif, db, lexNames, q0, withFacets)
+		if err != nil {
+			return res, fmt.Errorf("DBManager.QueryStats failed for %v:%v : %v", dbR, lexNames, err)
+		}
+		mergeQueryStats(&res, stats)
+	}
+	return res, nil
+}
+
+// CountEntries returns the number of entries matching a DBMQuery, regardless of the page settings of the query
+func (dbm *DBManager) CountEntries(q DBMQuery) (int64, error) {
+	stats, err := dbm.QueryStats(q, false)
+	if err != nil {
+		return 0, err
+	}
+	return stats.Entries, nil
+}
+
+// dbRefWriter sets the DBRef of each entry before passing it on to the wrapped lex.EntryWriter
+type dbRefWriter struct {
+	dbRef lex.DBRef
+	out   lex.EntryWriter
+}
+
+func (w dbRefWriter) Write(e lex.Entry) error {
+	e.LexRef.DBRef = w.dbRef
+	return w.out.Write(e)
+}
+
+func (w dbRefWriter) Size() int {
+	return w.out.Size()
+}
+
+// ExportLexicon searches one lexicon for the search query, and writes the result to a lex.EntryWriter. If the query is empty, all entries of the lexicon are written.
+// Unlike LookUp, the result set is not collected in memory, but each entry is written as soon as it is read from the database, so that large lexicons can be streamed to the output.
+func (dbm *DBManager) ExportLexicon(lexRef lex.LexRef, q Query, out lex.EntryWriter) error {
+	// the lock is only held while looking up the db and compiling the query, not during the (possibly slow) streamed export
+	dbm.RLock()
+	db, ok := dbm.dbs[lexRef.DBRef]
+	if !ok {
+		dbm.RUnlock()
+		return fmt.Errorf("DBManager.ExportLexicon: no such db '%s'", lexRef.DBRef)
+	}
+
+	if q.Empty() {
+		q.WordLike = "%"
+	}
+	q, err := dbm.prepareQuery(db, []lex.LexName{lexRef.LexName}, q)
+	dbm.RUnlock()
+	if err != nil {
+		return fmt.Errorf("DBManager.ExportLexicon failed for lexicon '%s' : %v", lexRef, err)
+	}
+	err = dbm.dbif.lookUp(db, []lex.LexName{lexRef.LexName}, q, dbRefWriter{dbRef: lexRef.DBRef, out: out})
+	if err != nil {
+		return fmt.Errorf("DBManager.ExportLexicon failed for lexicon '%s' : %v", lexRef, err)
+	}
+	return nil
+}
+
 // LookUp takes a DBMQuery, searches the specified lexicon for the included search query. The result is written to a lex.EntryWriter.
 func (dbm *DBManager) LookUp(q DBMQuery, out lex.EntryWriter) error {
 	if len(q.LexRefs) == 0 { //  && len(q.Query.EntryIDs) == 0 {
@@ -406,7 +548,13 @@ func (dbm *DBManager) LookUp(q DBMQuery, out lex.EntryWriter) error {
 			rez := lookUpRes{}
 			rez.dbRef = dbRef
 			ew := lex.EntrySliceWriter{}
-			err := dbm.dbif.lookUp(db0, lexNames, q.Query, &ew)
+			q0, err := dbm.prepareQuery(db0, lexNames, q.Query)
+			if err != nil {
+				rez.err = fmt.Errorf("dbapi.LookUp failed for %v:%v : %v", dbRef, lexNames, err)
+				ch <- rez
+				return
+			}
+			err = dbm.dbif.lookUp(db0, lexNames, q0, &ew)
 			if err != nil {
 				rez.err = fmt.Errorf("dbapi.LookUp failed for %v:%v : %v", dbRef, lexNames, err)
 				ch <- rez
@@ -548,7 +696,8 @@ func (dbm *DBManager) UpdateValidation(e lex.Entry) error {
 	return dbm.dbif.updateValidation(db, []lex.Entry{e})
 }
 
-// UpdateEntry wraps call to UpdateEntryTx with a transaction, and returns the updated entry, fresh from the db
+// UpdateEntry wraps call to UpdateEntryTx with a transaction, and returns the updated entry, fresh from the db.
+// The input entry must have the revision it was read with. If the revision doesn't match the revision in the db, the update is rejected with an *EntryConflictError.
 func (dbm *DBManager) UpdateEntry(e lex.Entry) (lex.Entry, bool, error) {
 	var res lex.Entry
 
@@ -559,11 +708,15 @@ func (dbm *DBManager) UpdateEntry(e lex.Entry) (lex.Entry, bool, error) {
 		return res, false, fmt.Errorf("DBManager.UpdateEntry: no such db '%s'", e.LexRef.DBRef)
 	}
 
-	return dbm.dbif.updateEntry(db, e)
+	res, updated, err := dbm.dbif.updateEntry(db, e)
+	if conflict, ok := err.(*EntryConflictError); ok {
+		conflict.Current.LexRef.DBRef = e.LexRef.DBRef
+	}
+	return res, updated, err
 }
 
-// DeleteEntry deletes an entry from the database
-func (dbm *DBManager) DeleteEntry(entryID int64, lexRef lex.LexRef) (int64, error) {
+// DeleteEntry deletes an entry from the database. The source (the deleting user) is saved in the entry history.
+func (dbm *DBManager) DeleteEntry(entryID int64, lexRef lex.LexRef, source string) (int64, error) {
 	dbm.Lock()
 	defer dbm.Unlock()
 	db, ok := dbm.dbs[lexRef.DBRef]
@@ -571,18 +724,355 @@ func (dbm *DBManager) DeleteEntry(entryID int64, lexRef lex.LexRef) (int64, erro
 		return 0, fmt.Errorf("DBManager.DeleteEntry: no such db '%s'", lexRef.DBRef)
 	}
 
-	return dbm.dbif.deleteEntry(db, entryID, string(lexRef.LexName))
+	return dbm.dbif.deleteEntry(db, entryID, string(lexRef.LexName), source)
+}
+
+// EntryHistory lists the recorded changes (insert, update, delete) of an entry, oldest change first
+func (dbm *DBManager) EntryHistory(lexRef lex.LexRef, entryID int64) ([]EntryHistoryItem, error) {
+	dbm.RLock()
+	defer dbm.RUnlock()
+	db, ok := dbm.dbs[lexRef.DBRef]
+	if !ok {
+		return []EntryHistoryItem{}, fmt.Errorf("DBManager.EntryHistory: no such db '%s'", lexRef.DBRef)
+	}
+
+	res, err := entryHistory(db, string(lexRef.LexName), entryID)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.EntryHistory failed for entry id '%d' in lexicon '%s' : %v", entryID, lexRef, err)
+	}
+	for i := range res {
+		res[i].Entry.LexRef.DBRef = lexRef.DBRef
+	}
+	return res, nil
+}
+
+// RevertEntry restores the transcriptions, lemma, tag, part of speech, morphology, preferred flag and comments of an entry to an earlier revision (see lex.Entry.Revision and EntryHistory). The revert is recorded as a new entry status, with source as status source. Returns the reverted entry.
+func (dbm *DBManager) RevertEntry(lexRef lex.LexRef, entryID int64, revision int64, source string) (lex.Entry, error) {
+	dbm.Lock()
+	defer dbm.Unlock()
+	db, ok := dbm.dbs[lexRef.DBRef]
+	if !ok {
+		return lex.Entry{}, fmt.Errorf("DBManager.RevertEntry: no such db '%s'", lexRef.DBRef)
+	}
+
+	res, err := revertEntry(dbm.dbif, db, string(lexRef.LexName), entryID, revision, source)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.RevertEntry failed for entry id '%d' in lexicon '%s' : %v", entryID, lexRef, err)
+	}
+	res.LexRef.DBRef = lexRef.DBRef
+	return res, nil
+}
+
+// EntryAsOf returns an entry as it was at the specified timestamp, using the recorded entry history. Accepted timestamp formats are RFC3339 (2006-01-02T15:04:05Z), 2006-01-02 15:04:05 and 2006-01-02 (UTC).
+func (dbm *DBManager) EntryAsOf(lexRef lex.LexRef, entryID int64, timestamp string) (lex.Entry, error) {
+	asOf, err := parseHistoryTimestamp(timestamp)
+	if err != nil {
+		return lex.Entry{}, fmt.Errorf("DBManager.EntryAsOf: %v", err)
+	}
+
+	history, err := dbm.EntryHistory(lexRef, entryID)
+	if err != nil {
+		return lex.Entry{}, err
+	}
+
+	res, err := entryAsOf(history, asOf)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.EntryAsOf failed for entry id '%d' in lexicon '%s' : %v", entryID, lexRef, err)
+	}
+	return res, nil
+}
+
+// CreateSnapshot freezes the current content of a lexicon (entries, transcriptions, lemmas, tags, statuses, comments and validations) under a snapshot name, e.g. a release name. The name must be unique for the lexicon. Subsequent changes to the lexicon do not affect the snapshot.
+func (dbm *DBManager) CreateSnapshot(lexRef lex.LexRef, name string) (Snapshot, error) {
+	dbm.Lock()
+	defer dbm.Unlock()
+	db, ok := dbm.dbs[lexRef.DBRef]
+	if !ok {
+		return Snapshot{}, fmt.Errorf("DBManager.CreateSnapshot: no such db '%s'", lexRef.DBRef)
+	}
+
+	res, err := createSnapshot(dbm.dbif, db, string(lexRef.LexName), name)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.CreateSnapshot failed for lexicon '%s' : %v", lexRef, err)
+	}
+	return res, nil
+}
+
+// ListSnapshots lists the snapshots of a lexicon, oldest snapshot first
+func (dbm *DBManager) ListSnapshots(lexRef lex.LexRef) ([]Snapshot, error) {
+	dbm.RLock()
+	defer dbm.RUnlock()
+	db, ok := dbm.dbs[lexRef.DBRef]
+	if !ok {
+		return []Snapshot{}, fmt.Errorf("DBManager.ListSnapshots: no such db '%s'", lexRef.DBRef)
+	}
+
+	res, err := listSnapshots(db, string(lexRef.LexName))
+	if err != nil {
+		return res, fmt.Errorf("DBManager.ListSnapshots failed for lexicon '%s' : %v", lexRef, err)
+	}
+	return res, nil
+}
+
+// DeleteSnapshot deletes a snapshot of a lexicon. A lexicon cannot be deleted while it has snapshots.
+func (dbm *DBManager) DeleteSnapshot(lexRef lex.LexRef, name string) error {
+	dbm.Lock()
+	defer dbm.Unlock()
+	db, ok := dbm.dbs[lexRef.DBRef]
+	if !ok {
+		return fmt.Errorf("DBManager.DeleteSnapshot: no such db '%s'", lexRef.DBRef)
+	}
+
+	err := deleteSnapshot(db, string(lexRef.LexName), name)
+	if err != nil {
+		return fmt.Errorf("DBManager.DeleteSnapshot failed for lexicon '%s' : %v", lexRef, err)
+	}
+	return nil
+}
+
+// ExportSnapshot writes the entries of a lexicon snapshot to a lex.EntryWriter, such as a line.FileWriter using the line.WS format
+func (dbm *DBManager) ExportSnapshot(lexRef lex.LexRef, name string, out lex.EntryWriter) error {
+	dbm.RLock()
+	defer dbm.RUnlock()
+	db, ok := dbm.dbs[lexRef.DBRef]
+	if !ok {
+		return fmt.Errorf("DBManager.ExportSnapshot: no such db '%s'", lexRef.DBRef)
+	}
+
+	err := exportSnapshot(db, lexRef, name, out)
+	if err != nil {
+		return fmt.Errorf("DBManager.ExportSnapshot failed for lexicon '%s' : %v", lexRef, err)
+	}
+	return nil
+}
+
+// DiffLexicons compares two lexicons, possibly in different databases. Entries are matched on orthography (Entry.Strn) and tag, and compared on transcriptions (regardless of order), part of speech, morphology, lemma and entry status.
+func (dbm *DBManager) DiffLexicons(from lex.LexRef, to lex.LexRef) (LexiconDiff, error) {
+	fromEs, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{from}, Query: Query{WordLike: "%"}})
+	if err != nil {
+		return LexiconDiff{}, fmt.Errorf("DBManager.DiffLexicons failed to look up lexicon '%s' : %v", from, err)
+	}
+	toEs, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{to}, Query: Query{WordLike: "%"}})
+	if err != nil {
+		return LexiconDiff{}, fmt.Errorf("DBManager.DiffLexicons failed to look up lexicon '%s' : %v", to, err)
+	}
+
+	res := diffEntries(fromEs, toEs)
+	res.From = from
+	res.To = to
+	return res, nil
+}
+
+// MergeLexicons merges the entries of the from lexicon into the to lexicon, possibly in different databases. Entries are matched on orthography and tag (see DiffLexicons). Source entries without a matching target entry are added to the target lexicon, and differing entries are handled according to the merge strategy. Modified target entries get a new entry status with source (the merging user) as status source. The source lexicon is not modified. Returns a report of what happened to each source entry.
+func (dbm *DBManager) MergeLexicons(from lex.LexRef, to lex.LexRef, strategy MergeStrategy, source string) (MergeResult, error) {
+	if from == to {
+		return MergeResult{}, fmt.Errorf("DBManager.MergeLexicons: cannot merge lexicon '%s' into itself", from)
+	}
+
+	dbm.Lock()
+	defer dbm.Unlock()
+	fromDB, ok := dbm.dbs[from.DBRef]
+	if !ok {
+		return MergeResult{}, fmt.Errorf("DBManager.MergeLexicons: no such db '%s'", from.DBRef)
+	}
+	toDB, ok := dbm.dbs[to.DBRef]
+	if !ok {
+		return MergeResult{}, fmt.Errorf("DBManager.MergeLexicons: no such db '%s'", to.DBRef)
+	}
+
+	var esw lex.EntrySliceWriter
+	err := dbm.dbif.lookUp(fromDB, []lex.LexName{from.LexName}, Query{WordLike: "%"}, &esw)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("DBManager.MergeLexicons failed to look up lexicon '%s' : %v", from, err)
+	}
+
+	res, err := mergeEntries(dbm.dbif, toDB, from, esw.Entries, to, strategy, source)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.MergeLexicons failed for lexicon '%s' into '%s' : %v", from, to, err)
+	}
+	return res, nil
+}
+
+// BulkUpdate applies an operation to all entries matching a query, such as setting the part of speech of all entries with a certain morphology. All lexicons of the query must be in the same database, and the page settings of the query are ignored. Entries modified by the operation get a new entry status with source (the updating user) as status source.
+// The update is executed in a single transaction: if any entry fails, no entry is updated. Returns the number of matching entries and a change log of the updated entries. If dryRun is true, the transaction is rolled back, so that the result can be used as a preview.
+// NB that BulkSetPreferred unsets the preferred flag of other entries with the same orthography, so that only one of several matching homographs will remain preferred.
+func (dbm *DBManager) BulkUpdate(q DBMQuery, op BulkOperation, source string, dryRun bool) (BulkUpdateResult, error) {
+	if len(q.LexRefs) == 0 {
+		return BulkUpdateResult{}, fmt.Errorf("DBManager.BulkUpdate cannot perform a search without at least one lexicon specified (using the 'lexicons' parameter)")
+	}
+	if q.Query.Empty() {
+		return BulkUpdateResult{}, fmt.Errorf("DBManager.BulkUpdate requires a non-empty query (use wordLike '%%' to update all entries)")
+	}
+	dbRef := q.LexRefs[0].DBRef
+	var lexNames []lex.LexName
+	for _, l := range q.LexRefs {
+		if l.DBRef != dbRef {
+			return BulkUpdateResult{}, fmt.Errorf("DBManager.BulkUpdate: all lexicons must be in the same database, found '%s' and '%s'", dbRef, l.DBRef)
+		}
+		lexNames = append(lexNames, l.LexName)
+	}
+
+	dbm.Lock()
+	defer dbm.Unlock()
+	db, ok := dbm.dbs[dbRef]
+	if !ok {
+		return BulkUpdateResult{}, fmt.Errorf("DBManager.BulkUpdate: no such db '%s'", dbRef)
+	}
+
+	query := q.Query
+	query.Page, query.PageLength, query.After = 0, 0, 0
+	query, err := dbm.prepareQuery(db, lexNames, query)
+	if err != nil {
+		return BulkUpdateResult{}, fmt.Errorf("DBManager.BulkUpdate failed for %v:%v : %v", dbRef, lexNames, err)
+	}
+	res, err := bulkUpdate(dbm.dbif, db, lexNames, query, op, source, dryRun)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.BulkUpdate failed for %v:%v : %v", dbRef, lexNames, err)
+	}
+	for i := range res.Entries {
+		res.Entries[i].LexRef.DBRef = dbRef
+	}
+	return res, nil
+}
+
+// DeleteEntries deletes all entries matching a query, such as all entries with a certain status or status source. All lexicons of the query must be in the same database, and the page settings of the query are ignored.
+// As a safety check, expectedCount must be equal to the number of matching entries (see CountEntries), or else nothing is deleted and a *DeleteCountError is returned.
+// If archive is not nil, the matching entries are written to it before they are deleted. The deletion is executed in a single transaction: if any entry fails, no entry is deleted. The source (the deleting user) is saved in the entry history.
+func (dbm *DBManager) DeleteEntries(q DBMQuery, expectedCount int64, source string, archive lex.EntryWriter) (DeleteEntriesResult, error) {
+	if len(q.LexRefs) == 0 {
+		return DeleteEntriesResult{}, fmt.Errorf("DBManager.DeleteEntries cannot perform a search without at least one lexicon specified (using the 'lexicons' parameter)")
+	}
+	if q.Query.Empty() {
+		return DeleteEntriesResult{}, fmt.Errorf("DBManager.DeleteEntries requires a non-empty query (to delete a whole lexicon, use DeleteLexicon)")
+	}
+	dbRef := q.LexRefs[0].DBRef
+	var lexNames []lex.LexName
+	for _, l := range q.LexRefs {
+		if l.DBRef != dbRef {
+			return DeleteEntriesResult{}, fmt.Errorf("DBManager.DeleteEntries: all lexicons must be in the same database, found '%s' and '%s'", dbRef, l.DBRef)
+		}
+		lexNames = append(lexNames, l.LexName)
+	}
+
+	dbm.Lock()
+	defer dbm.Unlock()
+	db, ok := dbm.dbs[dbRef]
+	if !ok {
+		return DeleteEntriesResult{}, fmt.Errorf("DBManager.DeleteEntries: no such db '%s'", dbRef)
+	}
+
+	query := q.Query
+	query.Page, query.PageLength, query.After = 0, 0, 0
+	query, err := dbm.prepareQuery(db, lexNames, query)
+	if err != nil {
+		return DeleteEntriesResult{}, fmt.Errorf("DBManager.DeleteEntries failed for %v:%v : %v", dbRef, lexNames, err)
+	}
+	res, err := deleteEntries(dbm.dbif, db, dbRef, lexNames, query, expectedCount, source, archive)
+	if _, ok := err.(*DeleteCountError); ok {
+		return res, err
+	}
+	if err != nil {
+		return res, fmt.Errorf("DBManager.DeleteEntries failed for %v:%v : %v", dbRef, lexNames, err)
+	}
+	return res, nil
+}
+
+// CopyLexicon copies the from lexicon into a new lexicon, in the same or in another database. The new lexicon gets the symbol set and locale of the source lexicon. Entries are copied with lemmas, tags, comments, the complete status history (with original timestamps) and validations. The entry history of the source lexicon is not copied: each copied entry gets an insert in the history of the new lexicon.
+// NB that entry tags are unique per database (for each orthography), so a lexicon with tagged entries cannot be copied within the same database. If any of the tags is already used in the target database, CopyLexicon returns an error before anything is written.
+func (dbm *DBManager) CopyLexicon(from lex.LexRef, to lex.LexRef) (CopyLexiconResult, error) {
+	return dbm.CopyLexiconTo(from, dbm, to)
+}
+
+// CopyLexiconTo copies the from lexicon into a new lexicon in a database of the target DBManager, as CopyLexicon. The target may use another db engine, so that a lexicon can be copied from Sqlite to MariaDB, or back.
+func (dbm *DBManager) CopyLexiconTo(from lex.LexRef, target *DBManager, to lex.LexRef) (CopyLexiconResult, error) {
+	res := CopyLexiconResult{From: from, To: to}
+	if from == to && target == dbm {
+		return res, fmt.Errorf("DBManager.CopyLexicon: cannot copy lexicon '%s' into itself", from)
+	}
+
+	// The source and target are locked one at a time, since the target may be the same DBManager
+	dbm.RLock()
+	fromDB, ok := dbm.dbs[from.DBRef]
+	if !ok {
+		dbm.RUnlock()
+		return res, fmt.Errorf("DBManager.CopyLexicon: no such db '%s'", from.DBRef)
+	}
+	lc, err := readLexiconCopy(dbm.dbif, fromDB, string(from.LexName))
+	dbm.RUnlock()
+	if err != nil {
+		return res, fmt.Errorf("DBManager.CopyLexicon failed to read lexicon '%s' : %v", from, err)
+	}
+
+	target.Lock()
+	defer target.Unlock()
+	toDB, ok := target.dbs[to.DBRef]
+	if !ok {
+		return res, fmt.Errorf("DBManager.CopyLexicon: no such db '%s'", to.DBRef)
+	}
+	res.Entries, err = insertLexiconCopy(target.dbif, toDB, string(to.LexName), lc)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.CopyLexicon failed to copy lexicon '%s' into '%s' : %v", from, to, err)
+	}
+	return res, nil
 }
 
-// ImportLexiconFile is intended for 'clean' imports. It doesn't check whether the words already exist and so on. It does not do any sanity checks whatsoever of the transcriptions before they are added. If the validator parameter is initialized, each entry will be validated before import, and the validation result will be added to the db.
-func (dbm *DBManager) ImportLexiconFile(lexRef lex.LexRef, logger Logger, lexiconFileName string, validator *validation.Validator) error {
+// CopyDBTo copies the complete content of a database into a database of the target DBManager, that may use another db engine (e.g., to move a database from Sqlite to MariaDB). Unlike exporting and importing lexicon files, the copy keeps all row ids, the status history, validation timestamps, comments, entry history and snapshots.
+// The target database must be defined beforehand (see DefineDB), with the same schema version as the source database, and it must be empty unless the copy is resumed. The tables are copied in batches, with progress reported to the logger, and the number of rows of each table is verified after the copy. To be able to resume an interrupted copy, use a checkpoint file (see CopyDBOptions).
+// The source database should not be modified during the copy.
+func (dbm *DBManager) CopyDBTo(from lex.DBRef, target *DBManager, to lex.DBRef, logger Logger, opts CopyDBOptions) (CopyDBResult, error) {
+	if target == dbm && from == to {
+		return CopyDBResult{}, fmt.Errorf("DBManager.CopyDBTo: cannot copy db '%s' into itself", from)
+	}
+
+	// The target is locked for the whole copy, so that it isn't modified by anyone else. If the target is the same DBManager, the lock is only taken once.
+	if target != dbm {
+		dbm.RLock()
+		defer dbm.RUnlock()
+	}
+	target.Lock()
+	defer target.Unlock()
+
+	fromDB, ok := dbm.dbs[from]
+	if !ok {
+		return CopyDBResult{}, fmt.Errorf("DBManager.CopyDBTo: no such db '%s'", from)
+	}
+	toDB, ok := target.dbs[to]
+	if !ok {
+		return CopyDBResult{}, fmt.Errorf("DBManager.CopyDBTo: no such db '%s'", to)
+	}
+	res, err := copyDB(dbm.dbif, fromDB, from, target.dbif, toDB, to, logger, opts)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.CopyDBTo failed to copy db '%s' to '%s' : %v", from, to, err)
+	}
+	return res, nil
+}
+
+// RenameLexicon changes the name of a lexicon. Returns an error if the lexicon doesn't exist, or if there already is a lexicon with the new name in the database.
+func (dbm *DBManager) RenameLexicon(lexRef lex.LexRef, newName lex.LexName) error {
+	dbm.Lock()
+	defer dbm.Unlock()
+
+	db, ok := dbm.dbs[lexRef.DBRef]
+	if !ok {
+		return fmt.Errorf("DBManager.RenameLexicon: no such db '%s'", lexRef.DBRef)
+	}
+	err := renameLexicon(dbm.dbif, db, string(lexRef.LexName), string(newName))
+	if err != nil {
+		return fmt.Errorf("DBManager.RenameLexicon failed for '%s' : %v", lexRef, err)
+	}
+	return nil
+}
+
+// ImportLexiconFile imports a lexicon file into a lexicon. Entries already existing in the lexicon (matched on orthography and tag) are handled according to the import mode of the options (see ImportMode). It does not do any sanity checks whatsoever of the transcriptions before they are added. If the validator parameter is initialized, each entry will be validated before import, and the validation result will be added to the db.
+// For dry runs (see ImportOptions), the import is run inside a transaction that is rolled back, and the result also contains the orthographies of the would-be affected entries, and the validation stats of the lexicon as it would look after the import.
+func (dbm *DBManager) ImportLexiconFile(lexRef lex.LexRef, logger Logger, lexiconFileName string, validator *validation.Validator, opts ImportOptions) (ImportResult, error) {
 	dbm.Lock()
 	defer dbm.Unlock()
 	db, ok := dbm.dbs[lexRef.DBRef]
 	if !ok {
-		return fmt.Errorf("DBManager.ImportLexiconFile: no such db '%s'", lexRef.DBRef)
+		return ImportResult{}, fmt.Errorf("DBManager.ImportLexiconFile: no such db '%s'", lexRef.DBRef)
 	}
-	return importLexiconFile(dbm.dbif, db, lexRef.LexName, logger, lexiconFileName, validator)
+	return importLexiconFile(dbm.dbif, db, lexRef.LexName, logger, lexiconFileName, validator, opts)
 }
 
 // EntryCount counts the number of entries in a lexicon
@@ -705,13 +1195,20 @@ func (dbm *DBManager) GetLexicon(lexRef lex.LexRef) (lex.LexRefWithInfo, error)
 // rationale behind this function is to first create a small
 // additional lexicon with new entries (the fromLexicon), that can
 // later be appended to the master lexicon (the toLexicon).
-func (dbm *DBManager) MoveNewEntries(dbRef lex.DBRef, fromLex, toLex lex.LexName, newSource, newStatus string) (MoveResult, error) {
+//
+// If dryRun is true, the move is run inside a transaction that is
+// rolled back, and the result also contains the validation stats of
+// the toLexicon as it would look after the move.
+func (dbm *DBManager) MoveNewEntries(dbRef lex.DBRef, fromLex, toLex lex.LexName, newSource, newStatus string, dryRun bool) (MoveResult, error) {
 	dbm.Lock()
 	defer dbm.Unlock()
 	db, ok := dbm.dbs[dbRef]
 	if !ok {
 		return MoveResult{}, fmt.Errorf("DBManager.MoveNewEntries: no such db '%s'", dbRef)
 	}
+	if dryRun {
+		return moveNewEntriesDryRun(dbm.dbif, db, string(fromLex), string(toLex), newSource, newStatus)
+	}
 	return dbm.dbif.moveNewEntries(db, string(fromLex), string(toLex), newSource, newStatus)
 }
 
@@ -723,6 +1220,10 @@ func (dbm *DBManager) Validate(lexRef lex.LexRef, logger Logger, vd validation.V
 	if !ok {
 		return ValStats{}, fmt.Errorf("DBManager.Validate: no such db '%s'", lexRef.DBRef)
 	}
+	q, err := dbm.prepareQuery(db, []lex.LexName{lexRef.LexName}, q)
+	if err != nil {
+		return ValStats{}, fmt.Errorf("DBManager.Validate failed for lexicon '%s' : %v", lexRef, err)
+	}
 	return validate(dbm.dbif, db, []lex.LexName{lexRef.LexName}, logger, vd, q)
 }
 
@@ -749,6 +1250,44 @@ func (dbm *DBManager) GetSchemaVersion(dbRef lex.DBRef) (string, error) {
 
 }
 
+// MigrateDB upgrades the database to the current SchemaVersion, by applying the pending schema migrations in order. If the database is up-to-date, no migrations are applied.
+// To open an out-of-date database for migration, set DBManager.SchemaCheck to SkipSchemaCheck before calling OpenDB.
+func (dbm *DBManager) MigrateDB(dbRef lex.DBRef) (MigrateDBResult, error) {
+	dbm.Lock()
+	defer dbm.Unlock()
+	db, ok := dbm.dbs[dbRef]
+	if !ok {
+		return MigrateDBResult{}, fmt.Errorf("DBManager.MigrateDB: no such db '%s'", dbRef)
+	}
+	res, err := migrateSchema(dbm.dbif, db, dbRef)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.MigrateDB: %v", err)
+	}
+	return res, nil
+}
+
+// PendingSchemaMigrations lists the schema migrations needed to upgrade the database to the current SchemaVersion
+func (dbm *DBManager) PendingSchemaMigrations(dbRef lex.DBRef) ([]SchemaMigration, error) {
+	dbm.RLock()
+	defer dbm.RUnlock()
+	db, ok := dbm.dbs[dbRef]
+	if !ok {
+		return []SchemaMigration{}, fmt.Errorf("DBManager.PendingSchemaMigrations: no such db '%s'", dbRef)
+	}
+	return listPendingSchemaMigrations(dbm.dbif, db)
+}
+
+// ListSchemaMigrations lists the schema migrations applied to the database. A database created with the current schema has no applied migrations.
+func (dbm *DBManager) ListSchemaMigrations(dbRef lex.DBRef) ([]SchemaMigration, error) {
+	dbm.RLock()
+	defer dbm.RUnlock()
+	db, ok := dbm.dbs[dbRef]
+	if !ok {
+		return []SchemaMigration{}, fmt.Errorf("DBManager.ListSchemaMigrations: no such db '%s'", dbRef)
+	}
+	return listSchemaMigrations(dbm.dbif, db)
+}
+
 // DropDB drop the database (cannot be undone).
 // For Sqlite, the database is entirely dropped, for MariaDB, all database tables are dropped, but the database is not deleted. Deletion of MariaDB databases should be done by a server admiinstrator.
 func (dbm *DBManager) DropDB(dbLocation string, dbRef lex.DBRef) error {
@@ -759,3 +1298,26 @@ func (dbm *DBManager) DropDB(dbLocation string, dbRef lex.DBRef) error {
 func (dbm *DBManager) DBExists(dbLocation string, dbRef lex.DBRef) (bool, error) {
 	return dbm.dbif.dbExists(dbLocation, dbRef)
 }
+
+// prepareQuery prepares a query for the lexicons of a database: the phoneme search is compiled using the symbol set of the lexicons, and the full-text index must exist if the query contains full-text search criteria.
+// The DBManager must be locked by the caller.
+func (dbm *DBManager) prepareQuery(db *sql.DB, lexNames []lex.LexName, q Query) (Query, error) {
+	q, err := dbm.compilePhonemes(db, lexNames, q)
+	if err != nil {
+		return q, err
+	}
+	if q.hasFullText() {
+		enabled, err := fullTextEnabled(dbm.dbif.engine(), db)
+		if err != nil {
+			return q, err
+		}
+		if !enabled {
+			return q, fmt.Errorf("full-text search is not enabled for the database (see DBManager.EnableFullTextSearch)")
+		}
+		err = checkFullTextSupport(dbm.dbif.engine(), db)
+		if err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
@@ -277,6 +277,79 @@ func Test_DBManagerMariadb(t *testing.T) {
 		t.Errorf("wanted %s got %s", w, g)
 	}
 
+	// Diff lexicons in different dbs
+	diff, err := dbm.DiffLexicons(lex.NewLexRef("db2", "zuperduperlex"), lex.NewLexRef("db1", "zuperlex1"))
+	if err != nil {
+		t.Errorf("DiffLexicons failed : %v", err)
+	}
+	if w, g := 0, len(diff.Added)+len(diff.Removed); w != g {
+		t.Errorf("wanted %d got %d", w, g)
+	}
+	if w, g := 1, len(diff.Changed); w != g {
+		t.Fatalf("wanted %d got %d", w, g)
+	}
+	if w, g := (FieldChange{Field: "transcriptions", OldValue: "A: p a | a pp a", NewValue: w1}), diff.Changed[0].Changes[0]; w != g {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+
+	diff, err = dbm.DiffLexicons(lex.NewLexRef("db1", "zuperlex3"), lex.NewLexRef("db1", "zuperlex1"))
+	if err != nil {
+		t.Errorf("DiffLexicons failed : %v", err)
+	}
+	if w, g := 1, len(diff.Added); w != g {
+		t.Errorf("wanted %d got %d", w, g)
+	}
+	if w, g := 2, len(diff.Removed); w != g {
+		t.Errorf("wanted %d got %d", w, g)
+	}
+	if w, g := 0, len(diff.Changed); w != g {
+		t.Errorf("wanted %d got %d", w, g)
+	}
+
+	// Count entries over several dbs
+	n, err := dbm.CountEntries(DBMQuery{[]lex.LexRef{lex.NewLexRef("db2", "zuperduperlex"), lex.NewLexRef("db1", "zuperlex1"), lex.NewLexRef("db1", "zuperlex3")}, Query{WordRegexp: ".", PageLength: 1}})
+	if err != nil {
+		t.Errorf("CountEntries failed : %v", err)
+	}
+	if w, g := int64(4), n; w != g {
+		t.Errorf("wanted %d got %d", w, g)
+	}
+	qStats, err := dbm.QueryStats(DBMQuery{[]lex.LexRef{lex.NewLexRef("db2", "zuperduperlex"), lex.NewLexRef("db1", "zuperlex3")}, Query{WordRegexp: "."}}, true)
+	if err != nil {
+		t.Errorf("QueryStats failed : %v", err)
+	}
+	if w, g := "[{old1 3}]", fmt.Sprintf("%v", qStats.Facets[FacetStatus]); w != g {
+		t.Errorf("wanted %s got %s", w, g)
+	}
+
+	// Stream a lexicon, or a query subset of it
+	var exported lex.EntrySliceWriter
+	err = dbm.ExportLexicon(lex.NewLexRef("db1", "zuperlex3"), Query{}, &exported)
+	if err != nil {
+		t.Errorf("ExportLexicon failed : %v", err)
+	}
+	if w, g := 2, exported.Size(); w != g {
+		t.Fatalf("wanted %d got %d", w, g)
+	}
+	if w, g := lex.NewLexRef("db1", "zuperlex3"), exported.Entries[0].LexRef; w != g {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+	exported = lex.EntrySliceWriter{}
+	err = dbm.ExportLexicon(lex.NewLexRef("db1", "zuperlex3"), Query{WordLike: "upp%"}, &exported)
+	if err != nil {
+		t.Errorf("ExportLexicon failed : %v", err)
+	}
+	if w, g := 1, exported.Size(); w != g {
+		t.Fatalf("wanted %d got %d", w, g)
+	}
+	if w, g := "uppa", exported.Entries[0].Strn; w != g {
+		t.Errorf("wanted %s got %s", w, g)
+	}
+	err = dbm.ExportLexicon(lex.NewLexRef("db1", "nonexistinglex"), Query{}, &exported)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+
 	fmt.Printf("")
 	//fmt.Printf("%v\n", lexs)
 }
@@ -223,6 +223,15 @@ func deleteLexiconTx(tx *sql.Tx, lexName string) error {
 		return fmt.Errorf("delete all its entries before deleting a lexicon (number of entries: " + strconv.Itoa(n) + ")")
 	}
 
+	// snapshots are frozen releases of the lexicon, and are not deleted along with it
+	err = tx.QueryRow("select count(*) from Snapshot, Lexicon where Lexicon.name = ? and Snapshot.lexiconId = Lexicon.id", lexName).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("delete all its snapshots before deleting a lexicon (number of snapshots: " + strconv.Itoa(n) + ")")
+	}
+
 	_, err = tx.Exec("delete from Lexicon where name = ?", lexName)
 	if err != nil {
 		msg := fmt.Sprintf("failed to delete lexicon : %v", err)
@@ -319,7 +328,7 @@ func lexiconExists(tx *sql.Tx, lexName string) (bool, error) {
 
 //TODO: Check that lexName exists, or report error
 //TODO: Check that entryId exists, or report error
-func (mdb mariaDBIF) deleteEntry(db *sql.DB, entryID int64, lexName string) (int64, error) {
+func (mdb mariaDBIF) deleteEntry(db *sql.DB, entryID int64, lexName string, source string) (int64, error) {
 	tx, err := db.Begin()
 	if err != nil {
 		msg := fmt.Sprintf("dbapi.deleteEntry failed to start db transaction : %v", err)
@@ -346,6 +355,18 @@ func (mdb mariaDBIF) deleteEntry(db *sql.DB, entryID int64, lexName string) (int
 		return 0, fmt.Errorf(msg)
 	}
 
+	err = recordEntryDeleteTx(mdb, tx, lexName, entryID, source)
+	if err != nil {
+		msg := fmt.Sprintf("dbapi.deleteEntry failed to record history for entry with id '%d' : %v", entryID, err)
+
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return 0, fmt.Errorf(msg)
+	}
+
 	res, err := tx.Exec("DELETE FROM Entry WHERE  id = ? AND lexiconId IN (SELECT id FROM Lexicon WHERE name = ?)", entryID, lexName)
 	if err != nil {
 		msg := fmt.Sprintf("dbapi.deleteEntry failed to delete entry with id '%d' from lexicon '%s' : %v", entryID, lexName, err)
@@ -447,10 +468,14 @@ func defineLexiconTx(tx *sql.Tx, l lexicon) (lexicon, error) {
 }
 
 // MoveResult is returned from the MoveNewEntries function.
-// TODO Since it only contains a single int64, this struct is probably not needed.
-// Only useful if more info is to be returned.
 type MoveResult struct {
 	N int64
+	// Strns lists the orthographies of the moved entries
+	Strns []string
+	// DryRun is true if the move was rolled back (see DBManager.MoveNewEntries)
+	DryRun bool
+	// ValidationStats for the target lexicon after the move. Only set for dry runs.
+	ValidationStats *ValStats `json:",omitempty"`
 }
 
 // MoveNewEntries moves lexical entries from the lexicon named
@@ -531,6 +556,34 @@ func (mdb mariaDBIF) moveNewEntriesTx(tx *sql.Tx, fromLexicon, toLexicon, newSou
 	const where = `WHERE Entry.id IN (SELECT a.id FROM (select * from Entry) AS a WHERE a.lexiconId = ?
                        AND NOT EXISTS(SELECT ee.strn FROM (select * from Entry) AS ee WHERE ee.lexiconId = ? AND ee.strn = a.strn))`
 
+	strnsQuery := `SELECT DISTINCT a.strn FROM Entry AS a WHERE a.lexiconId = ?
+                       AND NOT EXISTS(SELECT ee.strn FROM Entry AS ee WHERE ee.lexiconId = ? AND ee.strn = a.strn) ORDER BY a.strn`
+	rows, err := tx.Query(strnsQuery, fromLex.id, toLex.id)
+	if err != nil {
+		msg := fmt.Sprintf("failed to list entries to move : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return res, fmt.Errorf(msg)
+	}
+	defer rows.Close()
+	res.Strns = []string{}
+	for rows.Next() {
+		var strn string
+		err = rows.Scan(&strn)
+		if err != nil {
+			return res, fmt.Errorf("scanning row failed : %v", err)
+		}
+		res.Strns = append(res.Strns, strn)
+	}
+	err = rows.Err()
+	if err != nil {
+		return res, err
+	}
+	rows.Close()
+
 	insertQuery := `INSERT INTO EntryStatus (name, source, entryId, current) SELECT ?, ?, Entry.id, '1' FROM Entry ` + where
 
 	// updateQuery0 := `UPDATE entrystatus SET current = 1 AND source = ? AND name = ? ` + where + ` AND entrystatus.entryId = entry.id`
@@ -548,6 +601,19 @@ func (mdb mariaDBIF) moveNewEntriesTx(tx *sql.Tx, fromLexicon, toLexicon, newSou
 
 	//_ = q0Rez
 
+	// the history of the moved entries follows them to the new lexicon
+	historyQuery := `UPDATE EntryHistory SET lexiconId = ? WHERE lexiconId = ? AND entryId IN (SELECT Entry.id FROM Entry ` + where + `)`
+	_, err = tx.Exec(historyQuery, toLex.id, fromLex.id, fromLex.id, toLex.id)
+	if err != nil {
+		msg := fmt.Sprintf("failed to update entry history : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return res, fmt.Errorf(msg)
+	}
+
 	updateQuery := `UPDATE Entry SET lexiconId = ? ` + where
 
 	//log.Printf("Q: %s\n", updateQuery)
@@ -577,25 +643,28 @@ func (mdb mariaDBIF) moveNewEntriesTx(tx *sql.Tx, fromLexicon, toLexicon, newSou
 }
 
 // TODO move to function?
-var entrySTMTMDB = "insert into Entry (lexiconId, strn, language, partofspeech, morphology, wordparts, preferred) values (?, ?, ?, ?, ?, ?, ?)"
-var transAfterEntrySTMTMDB = "insert into Transcription (entryId, strn, language, sources) values (?, ?, ?, ?)"
+var entrySTMTMDB = "insert into Entry (lexiconId, strn, reversedStrn, language, partofspeech, morphology, wordparts, preferred) values (?, ?, ?, ?, ?, ?, ?, ?)"
+var transAfterEntrySTMTMDB = "insert into Transcription (entryId, strn, reversedStrn, language, sources) values (?, ?, ?, ?, ?)"
 
 var statusSetCurrentFalse = "UPDATE EntryStatus SET current = 0 WHERE EntryStatus.entryId = ?"
 var insertStatusMDB = "INSERT INTO EntryStatus (entryId, name, source) values (?, ?, ?)"
 
 // InsertEntries saves a list of Entries and associates them to Lexicon
 // TODO: Change second input argument to string (lexicon name) instead of Lexicon struct.
-// TODO change input arg to sql.Tx
 func (mdb mariaDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]int64, error) {
-
-	var ids []int64
 	// Transaction -->
 	tx, err := db.Begin()
 	if err != nil {
-		return ids, fmt.Errorf("begin transaction failed : %v", err)
+		return []int64{}, fmt.Errorf("begin transaction failed : %v", err)
 	}
 	defer tx.Commit()
+	return mdb.insertEntriesTx(tx, l, es)
+}
 
+// insertEntriesTx is documented under insertEntries
+func (mdb mariaDBIF) insertEntriesTx(tx *sql.Tx, l lexicon, es []lex.Entry) ([]int64, error) {
+
+	var ids []int64
 	stmt1, err := tx.Prepare(entrySTMTMDB)
 	if err != nil {
 		return ids, fmt.Errorf("failed prepare : %v", err)
@@ -605,6 +674,8 @@ func (mdb mariaDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]int
 		return ids, fmt.Errorf("failed prepare : %v", err)
 	}
 
+	// the entries with ids, for the entry history
+	var inserted []lex.Entry
 	for _, e := range es {
 		//log.Printf("dbapi: insert entry: %#v", e)
 
@@ -639,6 +710,7 @@ func (mdb mariaDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]int
 		res, err := tx.Stmt(stmt1).Exec(
 			l.id,
 			strings.ToLower(e.Strn),
+			reverseString(strings.ToLower(e.Strn)),
 			e.Language,
 			e.PartOfSpeech,
 			e.Morphology,
@@ -672,7 +744,7 @@ func (mdb mariaDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]int
 		// res.Close()
 
 		for _, t := range e.Transcriptions {
-			_, err := tx.Stmt(stmt2).Exec(id, t.Strn, t.Language, t.SourcesString())
+			_, err := tx.Stmt(stmt2).Exec(id, t.Strn, reverseString(t.Strn), t.Language, t.SourcesString())
 			if err != nil {
 				msg := fmt.Sprintf("failed exec : %v", err)
 				err2 := tx.Rollback()
@@ -766,6 +838,18 @@ func (mdb mariaDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]int
 			return ids, fmt.Errorf(msg)
 		}
 
+		inserted = append(inserted, e)
+	}
+
+	err = recordEntryInsertsTx(tx, l, inserted)
+	if err != nil {
+		msg := fmt.Sprintf("inserting EntryHistory failed : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return ids, fmt.Errorf(msg)
 	}
 
 	//tx.Commit()
@@ -898,7 +982,27 @@ func (mdb mariaDBIF) lookUpIdsTx(tx *sql.Tx, lexNames []lex.LexName, q Query) ([
 		return result, err
 	}
 
-	sqlStmt := selectEntryIdsSQL(lexNames, q)
+	q, err = q.compileFullText(MariaDB)
+	if err != nil {
+		msg := fmt.Sprintf("%v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return result, fmt.Errorf(msg)
+	}
+
+	sqlStmt, err := selectEntryIdsSQL(lexNames, q)
+	if err != nil {
+		msg := fmt.Sprintf("%v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return result, fmt.Errorf(msg)
+	}
 
 	rows, err := tx.Query(sqlStmt.sql, sqlStmt.values...)
 	if err != nil {
@@ -1002,16 +1106,36 @@ func (mdb mariaDBIF) lookUpTx(tx *sql.Tx, lexNames []lex.LexName, q Query, out l
 
 	//log.Printf("dbapi lookUpTx QUWRY %#v\n\n", q)
 
-	sqlStmt := selectEntriesSQL(lexNames, q)
-
-	// log.Printf("SQL %v\n\n", sqlStmt)
-	// log.Printf("VALUES %v\n\n", sqlStmt.values)
-
 	err := mdb.validateInputLexicons(tx, lexNames, q)
 	if err != nil {
 		return err
 	}
 
+	q, err = q.compileFullText(MariaDB)
+	if err != nil {
+		msg := fmt.Sprintf("%v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return fmt.Errorf(msg)
+	}
+
+	sqlStmt, err := selectEntriesSQL(lexNames, q)
+	if err != nil {
+		msg := fmt.Sprintf("%v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return fmt.Errorf(msg)
+	}
+
+	// log.Printf("SQL %v\n\n", sqlStmt)
+	// log.Printf("VALUES %v\n\n", sqlStmt.values)
+
 	rows, err := tx.Query(sqlStmt.sql, sqlStmt.values...)
 	if err != nil {
 		// nothing to rollback here, but may have been called from within another transaction
@@ -1025,7 +1149,7 @@ func (mdb mariaDBIF) lookUpTx(tx *sql.Tx, lexNames []lex.LexName, q Query, out l
 	}
 	defer rows.Close()
 
-	var entryID, preferred int64
+	var entryID, preferred, revision int64
 	var lexiconName, entryStrn, entryLanguage, partOfSpeech, morphology, wordParts string
 
 	var transcriptionID, transcriptionEntryID int64
@@ -1067,6 +1191,7 @@ func (mdb mariaDBIF) lookUpTx(tx *sql.Tx, lexNames []lex.LexName, q Query, out l
 			&morphology,
 			&wordParts,
 			&preferred,
+			&revision,
 
 			&transcriptionID,
 			&transcriptionEntryID,
@@ -1129,6 +1254,7 @@ func (mdb mariaDBIF) lookUpTx(tx *sql.Tx, lexNames []lex.LexName, q Query, out l
 				Morphology:   morphology,
 				WordParts:    wordParts,
 				Preferred:    pref,
+				Revision:     revision,
 				Tag:          entryTag.String,
 			}
 
@@ -1318,13 +1444,16 @@ func (mdb mariaDBIF) updateEntry(db *sql.DB, e lex.Entry) (res lex.Entry, update
 	}
 	defer tx.Commit()
 
-	updated, err = mdb.updateEntryTx(tx, e)
+	updated, err = mdb.updateEntryTx(tx, e, true)
 	if err != nil {
 		msg := fmt.Sprintf("failed updating entry : %v", err)
 		err2 := tx.Rollback()
 		if err2 != nil {
 			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
 		}
+		if conflict, ok := err.(*EntryConflictError); ok {
+			return res, updated, conflict
+		}
 		return res, updated, fmt.Errorf(msg)
 	}
 	err = tx.Commit()
@@ -1346,8 +1475,9 @@ func (mdb mariaDBIF) updateEntry(db *sql.DB, e lex.Entry) (res lex.Entry, update
 }
 
 // UpdateEntryTx updates the fields of an lex.Entry that do not match the
-// corresponding values in the db
-func (mdb mariaDBIF) updateEntryTx(tx *sql.Tx, e lex.Entry) (updated bool, err error) { // TODO return the updated entry?
+// corresponding values in the db. If checkRevision is true, the revision of the entry must match the revision in the db, or else an *EntryConflictError is returned.
+// Internal callers that have just read the entry in the same transaction, or that update entries from other sources (such as imports), may skip the check.
+func (mdb mariaDBIF) updateEntryTx(tx *sql.Tx, e lex.Entry, checkRevision bool) (updated bool, err error) { // TODO return the updated entry?
 	// updated == false
 	//dbEntryMap := //GetEntriesFromIDsTx(tx, []int64{(e.ID)})
 	var esw lex.EntrySliceWriter
@@ -1365,6 +1495,14 @@ func (mdb mariaDBIF) updateEntryTx(tx *sql.Tx, e lex.Entry) (updated bool, err e
 		return updated, fmt.Errorf("very bad error, more than one entry with id '%d'", e.ID)
 	}
 
+	// Optimistic concurrency control
+	if checkRevision && e.Revision == 0 {
+		return false, fmt.Errorf("no revision for entry with id '%d'", e.ID)
+	}
+	if checkRevision && e.Revision != dbEntries[0].Revision {
+		return false, &EntryConflictError{Revision: e.Revision, Current: dbEntries[0]}
+	}
+
 	updated1, err := mdb.updateTranscriptions(tx, e, dbEntries[0])
 	if err != nil {
 		return updated1, err
@@ -1416,7 +1554,20 @@ func (mdb mariaDBIF) updateEntryTx(tx *sql.Tx, e lex.Entry) (updated bool, err e
 		return updated11, err
 	}
 
-	return updated1 || updated2 || updated3 || updated4 || updated5 || updated6 || updated7 || updated8 || updated9 || updated10 || updated11, err
+	updated = updated1 || updated2 || updated3 || updated4 || updated5 || updated6 || updated7 || updated8 || updated9 || updated10 || updated11
+	if updated {
+		// the revision is only increased if no one else has updated the entry since it was read above
+		err = bumpEntryRevisionTx(mdb, tx, dbEntries[0])
+		if err != nil {
+			return updated, err
+		}
+		err = recordEntryUpdateTx(mdb, tx, e.EntryStatus.Source, dbEntries[0])
+		if err != nil {
+			return updated, err
+		}
+	}
+
+	return updated, err
 }
 
 func getTIDs(ts []lex.Transcription) []int64 {
@@ -1559,8 +1710,7 @@ func (mdb mariaDBIF) updatePreferred(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (bo
 
 	//TODO: Sqlite trigger doesn't work in MaryDB. Must set previous preferred to false manually
 	if e.Preferred {
-		var setPreferredFalse = "UPDATE Entry SET preferred = 0 WHERE Entry.strn = ?"
-		_, err := tx.Exec(setPreferredFalse, e.Strn)
+		err := unsetPreferredTx(mdb, tx, e.EntryStatus.Source, e)
 		if err != nil {
 			msg := fmt.Sprintf("failed preferred update of previous entries : %v", err)
 			err2 := tx.Rollback()
@@ -1586,6 +1736,31 @@ func (mdb mariaDBIF) updateLemma(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (update
 	if e.Lemma == dbE.Lemma {
 		return false, nil
 	}
+	// If the db entry has no lemma, associate the new one
+	if dbE.Lemma.ID == 0 {
+		if e.Lemma.Strn == "" {
+			return false, nil
+		}
+		lemma, err := mdb.setOrGetLemma(tx, e.Lemma.Strn, e.Lemma.Reading, e.Lemma.Paradigm)
+		if err != nil {
+			msg := fmt.Sprintf("failed to set or get lemma : %v", err)
+			err2 := tx.Rollback()
+			if err2 != nil {
+				msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+			}
+			return false, fmt.Errorf(msg)
+		}
+		err = mdb.associateLemma2Entry(tx, lemma, dbE)
+		if err != nil {
+			msg := fmt.Sprintf("failed to associate lemma : %v", err)
+			err2 := tx.Rollback()
+			if err2 != nil {
+				msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+			}
+			return false, fmt.Errorf(msg)
+		}
+		return true, nil
+	}
 	// If e.Lemma uninitialized, and different from dbE, then wipe
 	// old lemma from db
 	if e.Lemma.ID == 0 && e.Lemma.Strn == "" {
@@ -1728,7 +1903,7 @@ func (mdb mariaDBIF) updateEntryComments(tx *sql.Tx, e lex.Entry, dbE lex.Entry)
 }
 
 // TODO move to function
-var transSTMTMDB = "insert into Transcription (entryId, strn, language, sources) values (?, ?, ?, ?)"
+var transSTMTMDB = "insert into Transcription (entryId, strn, reversedStrn, language, sources) values (?, ?, ?, ?, ?)"
 
 func (mdb mariaDBIF) updateTranscriptions(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (updated bool, err error) {
 	if e.ID != dbE.ID {
@@ -1758,7 +1933,7 @@ func (mdb mariaDBIF) updateTranscriptions(tx *sql.Tx, e lex.Entry, dbE lex.Entry
 			return false, fmt.Errorf(msg)
 		}
 		for _, t := range e.Transcriptions {
-			_, err := tx.Exec(transSTMTMDB, e.ID, t.Strn, t.Language, t.SourcesString())
+			_, err := tx.Exec(transSTMTMDB, e.ID, t.Strn, reverseString(t.Strn), t.Language, t.SourcesString())
 			if err != nil {
 				msg := fmt.Sprintf("failed transcription update : %v", err)
 				err2 := tx.Rollback()
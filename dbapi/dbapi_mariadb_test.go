@@ -604,6 +604,29 @@ func TestMariadbImportLexiconFile(t *testing.T) {
 	}
 
 	// actual tests start here
+
+	// dry run
+	dryRes, err := importLexiconFile(mariaDBIF{}, db, lex.LexName(l.name), logger, "./sv-lextest.txt", &validation.Validator{}, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Errorf(fs, nil, err)
+	}
+	if w, g := 19, dryRes.Inserted; w != g {
+		t.Errorf(fs, w, g)
+	}
+	if w, g := 19, len(dryRes.Strns); w != g {
+		t.Errorf(fs, w, g)
+	}
+	if dryRes.ValidationStats == nil || dryRes.ValidationStats.TotalEntries != 19 {
+		t.Errorf(fs, "19 entries in validation stats", dryRes.ValidationStats)
+	}
+	n, err := mariaDBIF{}.entryCount(db, l.name)
+	if err != nil {
+		t.Errorf(fs, nil, err)
+	}
+	if w, g := int64(0), n; w != g {
+		t.Errorf(fs, w, g)
+	}
+
 	err = ImportMariaDBLexiconFile(db, lex.LexName(l.name), logger, "./sv-lextest.txt", &validation.Validator{})
 	if err != nil {
 		t.Errorf(fs, nil, err)
@@ -639,7 +662,7 @@ func TestMariadbImportLexiconFile(t *testing.T) {
 
 	//Let's throw in a test of deleteEntry as well:
 	eX := res[0]
-	mariaDBIF{}.deleteEntry(db, eX.ID, l.name)
+	mariaDBIF{}.deleteEntry(db, eX.ID, l.name, "")
 
 	// Run same query again, efter deleting Entry
 	resX, err := mariaDBIF{}.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, q)
@@ -883,7 +906,7 @@ func Test_ImportLexiconFileGz(t *testing.T) {
 
 	//Let's throw in a test of deleteEntry as well:
 	eX := res[0]
-	mariaDBIF{}.deleteEntry(db, eX.ID, l.name)
+	mariaDBIF{}.deleteEntry(db, eX.ID, l.name, "")
 
 	// Run same query again, efter deleting Entry
 	resX, err := mariaDBIF{}.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, q)
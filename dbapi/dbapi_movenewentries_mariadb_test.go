@@ -107,9 +107,9 @@ func Test_MoveNewEntriesMariadb(t *testing.T) {
 		EntryStatus:    lex.EntryStatus{Name: "newEntry", Source: "testSource"},
 	}
 
-	_, err = mariaDBIF{}.insertEntries(db, l1, []lex.Entry{e2})
+	ids2, err := mariaDBIF{}.insertEntries(db, l1, []lex.Entry{e2})
 	if err != nil {
-		t.Errorf("The horror, the horror : %v", err)
+		t.Fatalf("The horror, the horror : %v", err)
 	}
 
 	// Insert the same entry in "unrelated" third lexicon, to or from which nothing should be moved
@@ -118,6 +118,28 @@ func Test_MoveNewEntriesMariadb(t *testing.T) {
 		t.Errorf("Unbelievable! : %v", err)
 	}
 
+	// Dry run, nothing should be moved
+	resDry, err := moveNewEntriesDryRun(mariaDBIF{}, db, l1.name, l2.name, "from:"+l1.name, "moved")
+	if err != nil {
+		t.Errorf("No fun : %v", err)
+	}
+	if w, g := int64(1), resDry.N; w != g {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+	if w, g := []string{"fingerlikas"}, resDry.Strns; len(g) != 1 || w[0] != g[0] {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+	if resDry.ValidationStats == nil || resDry.ValidationStats.TotalEntries != 2 {
+		t.Errorf("wanted validation stats for 2 entries, got %v", resDry.ValidationStats)
+	}
+	statsDry, err := mariaDBIF{}.lexiconStats(db, l2.name)
+	if err != nil {
+		t.Errorf("didn't expect that : %v", err)
+	}
+	if w, g := int64(1), statsDry.Entries; w != g {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+
 	res2, err := mariaDBIF{}.moveNewEntries(db, l1.name, l2.name, "from:"+l1.name, "moved")
 	if err != nil {
 		t.Errorf("No fun : %v", err)
@@ -126,6 +148,15 @@ func Test_MoveNewEntriesMariadb(t *testing.T) {
 		t.Errorf("wanted %v got %v", w, g)
 	}
 
+	// The history of the moved entry is moved along with it
+	history, err := entryHistory(db, l2.name, ids2[0])
+	if err != nil {
+		t.Errorf("didn't expect that : %v", err)
+	}
+	if w, g := 1, len(history); w != g {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+
 	statsL1, err := mariaDBIF{}.lexiconStats(db, l1.name)
 	if err != nil {
 		t.Errorf("didn't expect that : %v", err)
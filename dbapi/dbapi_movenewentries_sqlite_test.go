@@ -102,9 +102,9 @@ func Test_MoveNewEntriesSqlite(t *testing.T) {
 		EntryStatus:    lex.EntryStatus{Name: "newEntry", Source: "testSource"},
 	}
 
-	_, err = sqliteDBIF{}.insertEntries(db, l1, []lex.Entry{e2})
+	ids2, err := sqliteDBIF{}.insertEntries(db, l1, []lex.Entry{e2})
 	if err != nil {
-		t.Errorf("The horror, the horror : %v", err)
+		t.Fatalf("The horror, the horror : %v", err)
 	}
 
 	// Insert the same entry in "unrelated" third lexicon, to or from which nothing should be moved
@@ -113,6 +113,28 @@ func Test_MoveNewEntriesSqlite(t *testing.T) {
 		t.Errorf("Unbelievable! : %v", err)
 	}
 
+	// Dry run, nothing should be moved
+	resDry, err := moveNewEntriesDryRun(sqliteDBIF{}, db, l1.name, l2.name, "from:"+l1.name, "moved")
+	if err != nil {
+		t.Errorf("No fun : %v", err)
+	}
+	if w, g := int64(1), resDry.N; w != g {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+	if w, g := []string{"fingerlikas"}, resDry.Strns; len(g) != 1 || w[0] != g[0] {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+	if resDry.ValidationStats == nil || resDry.ValidationStats.TotalEntries != 2 {
+		t.Errorf("wanted validation stats for 2 entries, got %v", resDry.ValidationStats)
+	}
+	statsDry, err := sqliteDBIF{}.lexiconStats(db, l2.name)
+	if err != nil {
+		t.Errorf("didn't expect that : %v", err)
+	}
+	if w, g := int64(1), statsDry.Entries; w != g {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+
 	res2, err := sqliteDBIF{}.moveNewEntries(db, l1.name, l2.name, "from:"+l1.name, "moved")
 	if err != nil {
 		t.Errorf("No fun : %v", err)
@@ -121,6 +143,15 @@ func Test_MoveNewEntriesSqlite(t *testing.T) {
 		t.Errorf("wanted %v got %v", w, g)
 	}
 
+	// The history of the moved entry is moved along with it
+	history, err := entryHistory(db, l2.name, ids2[0])
+	if err != nil {
+		t.Errorf("didn't expect that : %v", err)
+	}
+	if w, g := 1, len(history); w != g {
+		t.Errorf("wanted %v got %v", w, g)
+	}
+
 	statsL1, err := sqliteDBIF{}.lexiconStats(db, l1.name)
 	if err != nil {
 		t.Errorf("didn't expect that : %v", err)
@@ -22,30 +22,48 @@ import (
 	//"github.com/stts-se/pronlex/validation"
 )
 
+// remem caches compiled regular expressions for the Sqlite regexp function. A regexp.Regexp is safe for concurrent use, so the lock is only held while looking up or adding a compiled expression, not while matching.
 var remem = struct {
-	sync.Mutex
+	sync.RWMutex
 	re map[string]*regexp.Regexp
 }{
 	re: make(map[string]*regexp.Regexp),
 }
 
+// rememMaxSize is the max number of regular expressions cached. When it is reached, the cache is cleared.
+const rememMaxSize = 1000
+
 var regexMem = func(re, s string) (bool, error) {
+	r, err := cachedRegexp(re)
+	if err != nil {
+		return false, err
+	}
+	return r.MatchString(s), nil
+}
 
-	remem.Lock()
-	defer remem.Unlock()
-	if r, ok := remem.re[re]; ok {
-		return r.MatchString(s), nil
+func cachedRegexp(re string) (*regexp.Regexp, error) {
+	remem.RLock()
+	r, ok := remem.re[re]
+	remem.RUnlock()
+	if ok {
+		return r, nil
 	}
 
 	r, err := regexp.Compile(re)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	remem.Lock()
+	defer remem.Unlock()
+	if len(remem.re) >= rememMaxSize {
+		remem.re = make(map[string]*regexp.Regexp)
 	}
 	remem.re[re] = r
-	return r.MatchString(s), nil
+	return r, nil
 }
 
-// Sqlite3WithRegex registers an Sqlite3 driver with regexp support. (Unfortunately quite slow regexp matching)
+// Sqlite3WithRegex registers an Sqlite3 driver with regexp support, using the syntax of the Go regexp package, including flags such as (?i) for case insensitive matching, and Unicode classes such as \p{Lu}.
+// Regexp matching is quite slow, since the regexp function is called for each row, but the SQL generated for queries uses a LIKE prefilter where possible (see regexpCond).
 func Sqlite3WithRegex() {
 	// regex := func(re, s string) (bool, error) {
 	// 	//return regexp.MatchString(re, s)
@@ -358,6 +376,15 @@ func (sdb sqliteDBIF) deleteLexiconTx(tx *sql.Tx, lexName string) error {
 		return fmt.Errorf("delete all its entries before deleting a lexicon (number of entries: " + strconv.Itoa(n) + ")")
 	}
 
+	// snapshots are frozen releases of the lexicon, and are not deleted along with it
+	err = tx.QueryRow("select count(*) from Snapshot, lexicon where lexicon.name = ? and Snapshot.lexiconId = lexicon.id", lexName).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("delete all its snapshots before deleting a lexicon (number of snapshots: " + strconv.Itoa(n) + ")")
+	}
+
 	_, err = tx.Exec("delete from lexicon where name = ?", lexName)
 	if err != nil {
 		msg := fmt.Sprintf("failed to delete lexicon : %v", err)
@@ -455,7 +482,7 @@ func (sdb sqliteDBIF) lexiconExists(tx *sql.Tx, lexName string) (bool, error) {
 
 //TODO: Check that lexName exists, or report error
 //TODO: Check that entryID exists, or report error
-func (sdb sqliteDBIF) deleteEntry(db *sql.DB, entryID int64, lexName string) (int64, error) {
+func (sdb sqliteDBIF) deleteEntry(db *sql.DB, entryID int64, lexName string, source string) (int64, error) {
 	tx, err := db.Begin()
 	if err != nil {
 		msg := fmt.Sprintf("dbapi.deleteEntry failed to start db transaction : %v", err)
@@ -482,6 +509,18 @@ func (sdb sqliteDBIF) deleteEntry(db *sql.DB, entryID int64, lexName string) (in
 		return 0, fmt.Errorf(msg)
 	}
 
+	err = recordEntryDeleteTx(sdb, tx, lexName, entryID, source)
+	if err != nil {
+		msg := fmt.Sprintf("dbapi.deleteEntry failed to record history for entry with id '%d' : %v", entryID, err)
+
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return 0, fmt.Errorf(msg)
+	}
+
 	res, err := tx.Exec("DELETE FROM entry WHERE  id = ? AND lexiconid IN (SELECT id FROM lexicon WHERE name = ?)", entryID, lexName)
 	if err != nil {
 		msg := fmt.Sprintf("dbapi.deleteEntry failed to delete entry with id '%d' from lexicon '%s' : %v", entryID, lexName, err)
@@ -668,6 +707,34 @@ func (sdb sqliteDBIF) moveNewEntriesTx(tx *sql.Tx, fromLexicon, toLexicon, newSo
 	const where = `WHERE entry.id IN (SELECT a.id FROM entry a WHERE a.lexiconid = ?
                        AND NOT EXISTS(SELECT strn FROM entry WHERE lexiconid = ? AND strn = a.strn))`
 
+	strnsQuery := `SELECT DISTINCT a.strn FROM entry a WHERE a.lexiconid = ?
+                       AND NOT EXISTS(SELECT strn FROM entry WHERE lexiconid = ? AND strn = a.strn) ORDER BY a.strn`
+	rows, err := tx.Query(strnsQuery, fromLex.id, toLex.id)
+	if err != nil {
+		msg := fmt.Sprintf("failed to list entries to move : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return res, fmt.Errorf(msg)
+	}
+	defer rows.Close()
+	res.Strns = []string{}
+	for rows.Next() {
+		var strn string
+		err = rows.Scan(&strn)
+		if err != nil {
+			return res, fmt.Errorf("scanning row failed : %v", err)
+		}
+		res.Strns = append(res.Strns, strn)
+	}
+	err = rows.Err()
+	if err != nil {
+		return res, err
+	}
+	rows.Close()
+
 	insertQuery := `INSERT INTO entrystatus (name, source, entryid, current) SELECT ?, ?, entry.id, '1' FROM entry ` + where
 
 	// updateQuery0 := `UPDATE entrystatus SET current = 1 AND source = ? AND name = ? ` + where + ` AND entrystatus.entryid = entry.id`
@@ -685,6 +752,19 @@ func (sdb sqliteDBIF) moveNewEntriesTx(tx *sql.Tx, fromLexicon, toLexicon, newSo
 
 	//_ = q0Rez
 
+	// the history of the moved entries follows them to the new lexicon
+	historyQuery := `UPDATE EntryHistory SET lexiconId = ? WHERE lexiconId = ? AND entryId IN (SELECT entry.id FROM entry ` + where + `)`
+	_, err = tx.Exec(historyQuery, toLex.id, fromLex.id, fromLex.id, toLex.id)
+	if err != nil {
+		msg := fmt.Sprintf("failed to update entry history : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return res, fmt.Errorf(msg)
+	}
+
 	updateQuery := `UPDATE entry SET lexiconid = ? ` + where
 
 	//log.Printf("Q: %s\n", updateQuery)
@@ -714,25 +794,28 @@ func (sdb sqliteDBIF) moveNewEntriesTx(tx *sql.Tx, fromLexicon, toLexicon, newSo
 }
 
 // TODO move to function?
-var entrySTMTSqlite = "insert into entry (lexiconid, strn, language, partofspeech, morphology, wordparts, preferred) values (?, ?, ?, ?, ?, ?, ?)"
-var transAfterEntrySTMTSqlite = "insert into transcription (entryid, strn, language, sources) values (?, ?, ?, ?)"
+var entrySTMTSqlite = "insert into entry (lexiconid, strn, reversedStrn, language, partofspeech, morphology, wordparts, preferred) values (?, ?, ?, ?, ?, ?, ?, ?)"
+var transAfterEntrySTMTSqlite = "insert into transcription (entryid, strn, reversedStrn, language, sources) values (?, ?, ?, ?, ?)"
 
 //var statusSetCurrentFalse = "UPDATE entrystatus SET current = 0 WHERE entrystatus.entryid = ?"
 var insertStatusSqlite = "INSERT INTO entrystatus (entryid, name, source) values (?, ?, ?)"
 
 // InsertEntries saves a list of Entries and associates them to Lexicon
 // TODO: Change second input argument to string (lexicon name) instead of Lexicon struct.
-// TODO change input arg to sql.Tx
 func (sdb sqliteDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]int64, error) {
-
-	var ids []int64
 	// Transaction -->
 	tx, err := db.Begin()
 	if err != nil {
-		return ids, fmt.Errorf("begin transaction failed : %v", err)
+		return []int64{}, fmt.Errorf("begin transaction failed : %v", err)
 	}
 	defer tx.Commit()
+	return sdb.insertEntriesTx(tx, l, es)
+}
+
+// insertEntriesTx is documented under insertEntries
+func (sdb sqliteDBIF) insertEntriesTx(tx *sql.Tx, l lexicon, es []lex.Entry) ([]int64, error) {
 
+	var ids []int64
 	stmt1, err := tx.Prepare(entrySTMTSqlite)
 	if err != nil {
 		return ids, fmt.Errorf("failed prepare : %v", err)
@@ -742,6 +825,8 @@ func (sdb sqliteDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]in
 		return ids, fmt.Errorf("failed prepare : %v", err)
 	}
 
+	// the entries with ids, for the entry history
+	var inserted []lex.Entry
 	for _, e := range es {
 		//log.Printf("dbapi: insert entry: %#v", e)
 
@@ -776,6 +861,7 @@ func (sdb sqliteDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]in
 		res, err := tx.Stmt(stmt1).Exec(
 			l.id,
 			strings.ToLower(e.Strn),
+			reverseString(strings.ToLower(e.Strn)),
 			e.Language,
 			e.PartOfSpeech,
 			e.Morphology,
@@ -809,7 +895,7 @@ func (sdb sqliteDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]in
 		// res.Close()
 
 		for _, t := range e.Transcriptions {
-			_, err := tx.Stmt(stmt2).Exec(id, t.Strn, t.Language, t.SourcesString())
+			_, err := tx.Stmt(stmt2).Exec(id, t.Strn, reverseString(t.Strn), t.Language, t.SourcesString())
 			if err != nil {
 				msg := fmt.Sprintf("failed exec : %v", err)
 				err2 := tx.Rollback()
@@ -903,6 +989,18 @@ func (sdb sqliteDBIF) insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]in
 			return ids, fmt.Errorf(msg)
 		}
 
+		inserted = append(inserted, e)
+	}
+
+	err = recordEntryInsertsTx(tx, l, inserted)
+	if err != nil {
+		msg := fmt.Sprintf("inserting EntryHistory failed : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return ids, fmt.Errorf(msg)
 	}
 
 	//tx.Commit()
@@ -1029,7 +1127,27 @@ func (sdb sqliteDBIF) lookUpIdsTx(tx *sql.Tx, lexNames []lex.LexName, q Query) (
 		return result, err
 	}
 
-	sqlStmt := selectEntryIdsSQL(lexNames, q)
+	q, err = q.compileFullText(Sqlite)
+	if err != nil {
+		msg := fmt.Sprintf("%v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return result, fmt.Errorf(msg)
+	}
+
+	sqlStmt, err := selectEntryIdsSQL(lexNames, q)
+	if err != nil {
+		msg := fmt.Sprintf("%v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return result, fmt.Errorf(msg)
+	}
 
 	rows, err := tx.Query(sqlStmt.sql, sqlStmt.values...)
 	if err != nil {
@@ -1134,13 +1252,33 @@ func (sdb sqliteDBIF) lookUpTx(tx *sql.Tx, lexNames []lex.LexName, q Query, out
 
 	//log.Printf("dbapi lookUpTx QUWRY %#v\n\n", q)
 
-	sqlStmt := selectEntriesSQL(lexNames, q)
-
 	err := sdb.validateInputLexicons(tx, lexNames, q)
 	if err != nil {
 		return err
 	}
 
+	q, err = q.compileFullText(Sqlite)
+	if err != nil {
+		msg := fmt.Sprintf("%v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return fmt.Errorf(msg)
+	}
+
+	sqlStmt, err := selectEntriesSQL(lexNames, q)
+	if err != nil {
+		msg := fmt.Sprintf("%v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+
+		return fmt.Errorf(msg)
+	}
+
 	rows, err := tx.Query(sqlStmt.sql, sqlStmt.values...)
 	if err != nil {
 		// nothing to rollback here, but may have been called from within another transaction
@@ -1154,7 +1292,7 @@ func (sdb sqliteDBIF) lookUpTx(tx *sql.Tx, lexNames []lex.LexName, q Query, out
 	}
 	defer rows.Close()
 
-	var entryID, preferred int64
+	var entryID, preferred, revision int64
 	var lexiconName, entryStrn, entryLanguage, partOfSpeech, morphology, wordParts string
 
 	var transcriptionID, transcriptionEntryID int64
@@ -1196,6 +1334,7 @@ func (sdb sqliteDBIF) lookUpTx(tx *sql.Tx, lexNames []lex.LexName, q Query, out
 			&morphology,
 			&wordParts,
 			&preferred,
+			&revision,
 
 			&transcriptionID,
 			&transcriptionEntryID,
@@ -1258,6 +1397,7 @@ func (sdb sqliteDBIF) lookUpTx(tx *sql.Tx, lexNames []lex.LexName, q Query, out
 				Morphology:   morphology,
 				WordParts:    wordParts,
 				Preferred:    pref,
+				Revision:     revision,
 				Tag:          entryTag.String,
 			}
 
@@ -1464,13 +1604,16 @@ func (sdb sqliteDBIF) updateEntry(db *sql.DB, e lex.Entry) (res lex.Entry, updat
 	}
 	defer tx.Commit()
 
-	updated, err = sdb.updateEntryTx(tx, e)
+	updated, err = sdb.updateEntryTx(tx, e, true)
 	if err != nil {
 		msg := fmt.Sprintf("failed updating entry : %v", err)
 		err2 := tx.Rollback()
 		if err2 != nil {
 			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
 		}
+		if conflict, ok := err.(*EntryConflictError); ok {
+			return res, updated, conflict
+		}
 		return res, updated, fmt.Errorf(msg)
 	}
 	err = tx.Commit()
@@ -1492,8 +1635,9 @@ func (sdb sqliteDBIF) updateEntry(db *sql.DB, e lex.Entry) (res lex.Entry, updat
 }
 
 // UpdateEntryTx updates the fields of an lex.Entry that do not match the
-// corresponding values in the db
-func (sdb sqliteDBIF) updateEntryTx(tx *sql.Tx, e lex.Entry) (updated bool, err error) { // TODO return the updated entry?
+// corresponding values in the db. If checkRevision is true, the revision of the entry must match the revision in the db, or else an *EntryConflictError is returned.
+// Internal callers that have just read the entry in the same transaction, or that update entries from other sources (such as imports), may skip the check.
+func (sdb sqliteDBIF) updateEntryTx(tx *sql.Tx, e lex.Entry, checkRevision bool) (updated bool, err error) { // TODO return the updated entry?
 	// updated == false
 	//dbEntryMap := //GetEntriesFromIDsTx(tx, []int64{(e.ID)})
 	var esw lex.EntrySliceWriter
@@ -1511,6 +1655,14 @@ func (sdb sqliteDBIF) updateEntryTx(tx *sql.Tx, e lex.Entry) (updated bool, err
 		return updated, fmt.Errorf("very bad error, more than one entry with id '%d'", e.ID)
 	}
 
+	// Optimistic concurrency control
+	if checkRevision && e.Revision == 0 {
+		return false, fmt.Errorf("no revision for entry with id '%d'", e.ID)
+	}
+	if checkRevision && e.Revision != dbEntries[0].Revision {
+		return false, &EntryConflictError{Revision: e.Revision, Current: dbEntries[0]}
+	}
+
 	updated1, err := sdb.updateTranscriptions(tx, e, dbEntries[0])
 	if err != nil {
 		return updated1, err
@@ -1562,7 +1714,20 @@ func (sdb sqliteDBIF) updateEntryTx(tx *sql.Tx, e lex.Entry) (updated bool, err
 		return updated11, err
 	}
 
-	return updated1 || updated2 || updated3 || updated4 || updated5 || updated6 || updated7 || updated8 || updated9 || updated10 || updated11, err
+	updated = updated1 || updated2 || updated3 || updated4 || updated5 || updated6 || updated7 || updated8 || updated9 || updated10 || updated11
+	if updated {
+		// the revision is only increased if no one else has updated the entry since it was read above
+		err = bumpEntryRevisionTx(sdb, tx, dbEntries[0])
+		if err != nil {
+			return updated, err
+		}
+		err = recordEntryUpdateTx(sdb, tx, e.EntryStatus.Source, dbEntries[0])
+		if err != nil {
+			return updated, err
+		}
+	}
+
+	return updated, err
 }
 
 // TODO: Defined in dbapi_mariadb.go
@@ -1706,8 +1871,7 @@ func (sdb sqliteDBIF) updatePreferred(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (b
 	}
 	//TODO: Trigger doesn't work in Sqlite as of 2020-06-16. Must set previous preferred to false manually
 	if e.Preferred {
-		var setPreferredFalse = "UPDATE Entry SET preferred = 0 WHERE Entry.strn = ?"
-		_, err := tx.Exec(setPreferredFalse, e.Strn)
+		err := unsetPreferredTx(sdb, tx, e.EntryStatus.Source, e)
 		if err != nil {
 			msg := fmt.Sprintf("failed preferred update of previous entries : %v", err)
 			err2 := tx.Rollback()
@@ -1734,6 +1898,31 @@ func (sdb sqliteDBIF) updateLemma(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (updat
 	if e.Lemma == dbE.Lemma {
 		return false, nil
 	}
+	// If the db entry has no lemma, associate the new one
+	if dbE.Lemma.ID == 0 {
+		if e.Lemma.Strn == "" {
+			return false, nil
+		}
+		lemma, err := sdb.setOrGetLemma(tx, e.Lemma.Strn, e.Lemma.Reading, e.Lemma.Paradigm)
+		if err != nil {
+			msg := fmt.Sprintf("failed to set or get lemma : %v", err)
+			err2 := tx.Rollback()
+			if err2 != nil {
+				msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+			}
+			return false, fmt.Errorf(msg)
+		}
+		err = sdb.associateLemma2Entry(tx, lemma, dbE)
+		if err != nil {
+			msg := fmt.Sprintf("failed to associate lemma : %v", err)
+			err2 := tx.Rollback()
+			if err2 != nil {
+				msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+			}
+			return false, fmt.Errorf(msg)
+		}
+		return true, nil
+	}
 	// If e.Lemma uninitialized, and different from dbE, then wipe
 	// old lemma from db
 	if e.Lemma.ID == 0 && e.Lemma.Strn == "" {
@@ -1875,7 +2064,7 @@ func (sdb sqliteDBIF) updateEntryComments(tx *sql.Tx, e lex.Entry, dbE lex.Entry
 }
 
 // TODO move to function
-var transSTMTSqlite = "insert into transcription (entryid, strn, language, sources) values (?, ?, ?, ?)"
+var transSTMTSqlite = "insert into transcription (entryid, strn, reversedStrn, language, sources) values (?, ?, ?, ?, ?)"
 
 func (sdb sqliteDBIF) updateTranscriptions(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (updated bool, err error) {
 	if e.ID != dbE.ID {
@@ -1905,7 +2094,7 @@ func (sdb sqliteDBIF) updateTranscriptions(tx *sql.Tx, e lex.Entry, dbE lex.Entr
 			return false, fmt.Errorf(msg)
 		}
 		for _, t := range e.Transcriptions {
-			_, err := tx.Exec(transSTMTSqlite, e.ID, t.Strn, t.Language, t.SourcesString())
+			_, err := tx.Exec(transSTMTSqlite, e.ID, t.Strn, reverseString(t.Strn), t.Language, t.SourcesString())
 			if err != nil {
 				msg := fmt.Sprintf("failed transcription update : %v", err)
 				err2 := tx.Rollback()
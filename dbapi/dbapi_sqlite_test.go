@@ -620,6 +620,29 @@ func TestSqliteImportLexiconFile(t *testing.T) {
 	}
 
 	// actual tests start here
+
+	// dry run
+	dryRes, err := importLexiconFile(sqliteDBIF{}, db, lex.LexName(l.name), logger, "./sv-lextest.txt", &validation.Validator{}, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Errorf(fs, nil, err)
+	}
+	if w, g := 19, dryRes.Inserted; w != g {
+		t.Errorf(fs, w, g)
+	}
+	if w, g := 19, len(dryRes.Strns); w != g {
+		t.Errorf(fs, w, g)
+	}
+	if dryRes.ValidationStats == nil || dryRes.ValidationStats.TotalEntries != 19 {
+		t.Errorf(fs, "19 entries in validation stats", dryRes.ValidationStats)
+	}
+	n, err := sqliteDBIF{}.entryCount(db, l.name)
+	if err != nil {
+		t.Errorf(fs, nil, err)
+	}
+	if w, g := int64(0), n; w != g {
+		t.Errorf(fs, w, g)
+	}
+
 	err = ImportSqliteLexiconFile(db, lex.LexName(l.name), logger, "./sv-lextest.txt", &validation.Validator{})
 	if err != nil {
 		t.Errorf(fs, nil, err)
@@ -655,7 +678,7 @@ func TestSqliteImportLexiconFile(t *testing.T) {
 
 	//Let's throw in a test of deleteEntry as well:
 	eX := res[0]
-	sqliteDBIF{}.deleteEntry(db, eX.ID, l.name)
+	sqliteDBIF{}.deleteEntry(db, eX.ID, l.name, "")
 
 	// Run same query again, efter deleting Entry
 	resX, err := sqliteDBIF{}.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, q)
@@ -899,7 +922,7 @@ func TestSqliteImportLexiconFileGz(t *testing.T) {
 
 	//Let's throw in a test of deleteEntry as well:
 	eX := res[0]
-	sqliteDBIF{}.deleteEntry(db, eX.ID, l.name)
+	sqliteDBIF{}.deleteEntry(db, eX.ID, l.name, "")
 
 	// Run same query again, efter deleting Entry
 	resX, err := sqliteDBIF{}.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, q)
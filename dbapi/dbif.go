@@ -15,7 +15,7 @@ type DBIF interface {
 
 	associateLemma2Entry(db *sql.Tx, l lex.Lemma, e lex.Entry) error
 	defineLexicon(db *sql.DB, l lexicon) (lexicon, error)
-	deleteEntry(db *sql.DB, entryID int64, lexName string) (int64, error)
+	deleteEntry(db *sql.DB, entryID int64, lexName string, source string) (int64, error)
 	deleteLexicon(db *sql.DB, lexName string) error
 	entryCount(db *sql.DB, lexiconName string) (int64, error)
 	getEntryFromID(db *sql.DB, id int64) (lex.Entry, error)
@@ -23,6 +23,7 @@ type DBIF interface {
 	getLexiconMapTx(tx *sql.Tx) (map[string]bool, error)
 	getLexiconTx(tx *sql.Tx, name string) (lexicon, error)
 	insertEntries(db *sql.DB, l lexicon, es []lex.Entry) ([]int64, error)
+	insertEntriesTx(tx *sql.Tx, l lexicon, es []lex.Entry) ([]int64, error)
 	insertEntryComments(tx *sql.Tx, eID int64, eComments []lex.EntryComment) error
 	//insertEntryTagTx(tx *sql.Tx, entryID int64, tag string) error // different signature for mariadb/sqlite
 	insertEntryValidations(tx *sql.Tx, e lex.Entry, eValis []lex.EntryValidation) error
@@ -53,7 +54,7 @@ type DBIF interface {
 	updateEntry(db *sql.DB, e lex.Entry) (res lex.Entry, updated bool, err error)
 	updateEntryStatus(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (updated bool, err error)
 	updateEntryTag(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (bool, error)
-	updateEntryTx(tx *sql.Tx, e lex.Entry) (updated bool, err error)
+	updateEntryTx(tx *sql.Tx, e lex.Entry, checkRevision bool) (updated bool, err error)
 	updateEntryValidationForce(tx *sql.Tx, e lex.Entry) (bool, error)
 	updateEntryValidation(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (bool, error)
 	updateLanguage(tx *sql.Tx, e lex.Entry, dbE lex.Entry) (bool, error)
@@ -0,0 +1,77 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// DeleteCountError is returned by DBManager.DeleteEntries if the number of entries matching the query differs from the expected count. Nothing is deleted.
+type DeleteCountError struct {
+	Expected int64
+	Found    int64
+}
+
+func (e *DeleteCountError) Error() string {
+	return fmt.Sprintf("expected %d matching entries, found %d : nothing was deleted", e.Expected, e.Found)
+}
+
+func deleteEntries(dbif DBIF, db *sql.DB, dbRef lex.DBRef, lexNames []lex.LexName, q Query, expectedCount int64, source string, archive lex.EntryWriter) (DeleteEntriesResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return DeleteEntriesResult{}, fmt.Errorf("deleteEntries failed to start db transaction : %v", err)
+	}
+
+	res, err := deleteEntriesTx(dbif, tx, dbRef, lexNames, q, expectedCount, source, archive)
+	if err != nil {
+		err2 := tx.Rollback()
+		if err2 != nil {
+			return res, fmt.Errorf("%v : rollback failed : %v", err, err2)
+		}
+		return res, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return res, fmt.Errorf("deleteEntries commit failed : %v", err)
+	}
+	return res, nil
+}
+
+// deleteEntriesTx deletes the entries matching the query, if there are exactly expectedCount of them. Each entry is written to the archive writer (if not nil) before it is deleted. The deletion is recorded in the entry history, with source as the deleting user.
+func deleteEntriesTx(dbif DBIF, tx *sql.Tx, dbRef lex.DBRef, lexNames []lex.LexName, q Query, expectedCount int64, source string, archive lex.EntryWriter) (DeleteEntriesResult, error) {
+	res := DeleteEntriesResult{DeletedIDs: []int64{}}
+
+	var esw lex.EntrySliceWriter
+	err := dbif.lookUpTx(tx, lexNames, q, &esw)
+	if err != nil {
+		return res, err
+	}
+	if n := int64(len(esw.Entries)); n != expectedCount {
+		return res, &DeleteCountError{Expected: expectedCount, Found: n}
+	}
+
+	if archive != nil {
+		for _, e := range esw.Entries {
+			e.LexRef.DBRef = dbRef
+			err = archive.Write(e)
+			if err != nil {
+				return res, fmt.Errorf("failed to archive entry id '%d' : %v", e.ID, err)
+			}
+		}
+	}
+
+	for _, e := range esw.Entries {
+		err = insertEntryHistoryTx(tx, historyActionDelete, source, e, entryDiff(e, lex.Entry{}))
+		if err != nil {
+			return res, fmt.Errorf("failed to record history for entry id '%d' : %v", e.ID, err)
+		}
+		_, err = tx.Exec("DELETE FROM Entry WHERE id = ? AND lexiconId IN (SELECT id FROM Lexicon WHERE name = ?)", e.ID, string(e.LexRef.LexName))
+		if err != nil {
+			return res, fmt.Errorf("failed to delete entry id '%d' : %v", e.ID, err)
+		}
+		res.DeletedIDs = append(res.DeletedIDs, e.ID)
+	}
+	res.Deleted = len(res.DeletedIDs)
+	return res, nil
+}
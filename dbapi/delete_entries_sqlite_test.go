@@ -0,0 +1,114 @@
+package dbapi
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestDeleteEntriesSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testDeleteEntries(t, sqliteDBIF{}, db)
+}
+
+// testDeleteEntries is shared between the sqlite and mariadb tests
+func testDeleteEntries(t *testing.T, dbif DBIF, db *sql.DB) {
+	dbm, err := NewDBManager(dbif.engine())
+	if err != nil {
+		t.Fatalf("NewDBManager failed : %v", err)
+	}
+	err = dbm.AddDB("deletedb", db)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	entry := func(strn, status, source string) lex.Entry {
+		return lex.Entry{Strn: strn, PartOfSpeech: "NN", Language: "sv", WordParts: strn,
+			Transcriptions: []lex.Transcription{{Strn: "\" a", Language: "sv"}},
+			EntryStatus:    lex.EntryStatus{Name: status, Source: source}}
+	}
+	l, err := dbif.defineLexicon(db, lexicon{name: "deletelex", symbolSetName: "ZZ", locale: "sv_SE"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	ids, err := dbif.insertEntries(db, l, []lex.Entry{
+		entry("apa", "ok", "tst"),
+		entry("bepa", "delete", "tst"),
+		entry("cepa", "ok", "bad-import"),
+		entry("depa", "delete", "bad-import"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+	lexRef := lex.NewLexRef("deletedb", "deletelex")
+	q := DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{EntryStatus: []string{"delete"}}}
+	remaining := func() string {
+		es, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{WordLike: "%"}})
+		if err != nil {
+			t.Fatalf("LookUpIntoSlice failed : %v", err)
+		}
+		var res []string
+		for _, e := range es {
+			res = append(res, e.Strn)
+		}
+		return strings.Join(res, " ")
+	}
+
+	// Wrong expected count
+	_, err = dbm.DeleteEntries(q, 1, "", nil)
+	if cErr, ok := err.(*DeleteCountError); !ok || cErr.Found != 2 {
+		t.Errorf("expected DeleteCountError with 2 found entries, got %v", err)
+	}
+	if x, g := "apa bepa cepa depa", remaining(); x != g {
+		t.Errorf(fs, x, g)
+	}
+
+	// Delete with archive
+	var archive lex.EntrySliceWriter
+	res, err := dbm.DeleteEntries(q, 2, "editor1", &archive)
+	if err != nil {
+		t.Fatalf("DeleteEntries failed : %v", err)
+	}
+	if res.Deleted != 2 || len(res.DeletedIDs) != 2 || res.DeletedIDs[0] != ids[1] || res.DeletedIDs[1] != ids[3] {
+		t.Errorf("unexpected result : %#v", res)
+	}
+	if len(archive.Entries) != 2 || archive.Entries[0].Strn != "bepa" || archive.Entries[0].LexRef != lexRef {
+		t.Errorf("unexpected archive : %#v", archive.Entries)
+	}
+	if x, g := "apa cepa", remaining(); x != g {
+		t.Errorf(fs, x, g)
+	}
+	hist, err := dbm.EntryHistory(lexRef, ids[1])
+	if err != nil {
+		t.Fatalf("EntryHistory failed : %v", err)
+	}
+	if len(hist) == 0 || hist[len(hist)-1].Action != historyActionDelete || hist[len(hist)-1].Source != "editor1" {
+		t.Errorf("expected delete by editor1 in entry history, got %#v", hist)
+	}
+
+	// Zero matching entries
+	res, err = dbm.DeleteEntries(q, 0, "", nil)
+	if err != nil {
+		t.Fatalf("DeleteEntries failed : %v", err)
+	}
+	if res.Deleted != 0 {
+		t.Errorf("unexpected result : %#v", res)
+	}
+
+	// Errors
+	for _, q0 := range []DBMQuery{
+		{LexRefs: q.LexRefs},
+		{Query: q.Query},
+		{LexRefs: []lex.LexRef{lexRef, lex.NewLexRef("otherdb", "deletelex")}, Query: q.Query},
+	} {
+		if _, err := dbm.DeleteEntries(q0, 0, "", nil); err == nil {
+			t.Errorf("expected error for %#v, got nil", q0)
+		}
+	}
+	if x, g := "apa cepa", remaining(); x != g {
+		t.Errorf(fs, x, g)
+	}
+}
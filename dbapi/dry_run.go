@@ -0,0 +1,38 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// moveNewEntriesDryRun runs moveNewEntriesTx, and collects the validation stats of the target lexicon after the move. The transaction is always rolled back, so that the database is left unchanged.
+func moveNewEntriesDryRun(dbif DBIF, db *sql.DB, fromLexicon, toLexicon, newSource, newStatus string) (MoveResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return MoveResult{}, fmt.Errorf("failed to get db transaction : %v", err)
+	}
+	// moveNewEntriesTx rolls back on most errors, in which case this rollback is a no-op
+	defer tx.Rollback()
+
+	res, err := dbif.moveNewEntriesTx(tx, fromLexicon, toLexicon, newSource, newStatus)
+	if err != nil {
+		return res, err
+	}
+	res.DryRun = true
+
+	toLex, err := dbif.getLexiconTx(tx, toLexicon)
+	if err != nil {
+		return res, fmt.Errorf("couldn't find lexicon %s : %v", toLexicon, err)
+	}
+	stats, err := dbif.validationStatsTx(tx, toLex.id)
+	if err != nil {
+		return res, fmt.Errorf("couldn't get validation stats for lexicon %s : %v", toLexicon, err)
+	}
+	res.ValidationStats = &stats
+
+	err = tx.Rollback()
+	if err != nil {
+		return res, fmt.Errorf("rollback failed : %v", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,460 @@
+package dbapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// Actions recorded in the EntryHistory table
+const (
+	historyActionInsert = "insert"
+	historyActionUpdate = "update"
+	historyActionDelete = "delete"
+)
+
+// historyFields are the entry fields compared when recording the entry history, in output order
+var historyFields = []string{"strn", "language", "partOfSpeech", "morphology", "wordParts", "lemma", "tag", "preferred", "transcriptions", "status", "comments", "validations"}
+
+// historyFieldValue returns a string representation of the named entry field
+func historyFieldValue(e lex.Entry, field string) string {
+	switch field {
+	case "strn":
+		return e.Strn
+	case "language":
+		return e.Language
+	case "partOfSpeech":
+		return e.PartOfSpeech
+	case "morphology":
+		return e.Morphology
+	case "wordParts":
+		return e.WordParts
+	case "lemma":
+		return strings.Join(RemoveEmptyStrings([]string{e.Lemma.Strn, e.Lemma.Reading, e.Lemma.Paradigm}), " | ")
+	case "tag":
+		return e.Tag
+	case "preferred":
+		return strconv.FormatBool(e.Preferred)
+	case "transcriptions":
+		var ts []string
+		for _, t := range e.Transcriptions {
+			s := t.Strn
+			if len(t.Sources) > 0 {
+				s = fmt.Sprintf("%s (%s)", s, t.SourcesString())
+			}
+			ts = append(ts, s)
+		}
+		return strings.Join(ts, " | ")
+	case "status":
+		if e.EntryStatus.Name == "" {
+			return ""
+		}
+		return fmt.Sprintf("%s (%s)", e.EntryStatus.Name, e.EntryStatus.Source)
+	case "comments":
+		var cs []string
+		for _, c := range e.Comments {
+			cs = append(cs, c.String())
+		}
+		return strings.Join(cs, " | ")
+	case "validations":
+		var vs []string
+		for _, v := range e.EntryValidations {
+			vs = append(vs, fmt.Sprintf("%s|%s: %s", v.Level, v.RuleName, v.Message))
+		}
+		return strings.Join(vs, " | ")
+	}
+	return ""
+}
+
+// entryDiff lists the fields that differ between two versions of an entry. For an inserted entry, use an empty old entry, and for a deleted entry, an empty new entry.
+func entryDiff(old lex.Entry, new lex.Entry) []FieldChange {
+	var res []FieldChange
+	for _, f := range historyFields {
+		o := historyFieldValue(old, f)
+		n := historyFieldValue(new, f)
+		if o != n {
+			res = append(res, FieldChange{Field: f, OldValue: o, NewValue: n})
+		}
+	}
+	return res
+}
+
+// insertEntryHistoryTx adds a row to the EntryHistory table. The entry must exist in the Entry table when this function is called.
+func insertEntryHistoryTx(tx *sql.Tx, action string, source string, e lex.Entry, changes []FieldChange) error {
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return fmt.Errorf("insertEntryHistoryTx failed to marshal changes : %v", err)
+	}
+	entryJSON, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("insertEntryHistoryTx failed to marshal entry : %v", err)
+	}
+
+	q := "INSERT INTO EntryHistory (entryId, lexiconId, action, source, changes, entry) SELECT id, lexiconId, ?, ?, ?, ? FROM Entry WHERE id = ?"
+	res, err := tx.Exec(q, action, strings.ToLower(source), string(changesJSON), string(entryJSON), e.ID)
+	if err != nil {
+		return fmt.Errorf("insertEntryHistoryTx failed to insert history for entry id '%d' : %v", e.ID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("insertEntryHistoryTx failed to call RowsAffected : %v", err)
+	}
+	if n != 1 {
+		return fmt.Errorf("insertEntryHistoryTx failed to insert history for entry id '%d' : no such entry", e.ID)
+	}
+	return nil
+}
+
+// historyBatchSize is the max number of rows inserted by each statement of recordEntryInsertsTx
+const historyBatchSize = 100
+
+// recordEntryInsertsTx records the history of newly inserted entries of a lexicon. The rows are inserted in batches, since this is called for each entry of an imported lexicon file.
+func recordEntryInsertsTx(tx *sql.Tx, l lexicon, es []lex.Entry) error {
+	for i := 0; i < len(es); i += historyBatchSize {
+		end := i + historyBatchSize
+		if end > len(es) {
+			end = len(es)
+		}
+		var vals []string
+		var args []interface{}
+		for _, e := range es[i:end] {
+			e.Strn = strings.ToLower(e.Strn)
+			e.LexRef.LexName = lex.LexName(l.name)
+			e.Revision = 1
+			e.EntryStatus.Name = strings.ToLower(e.EntryStatus.Name)
+			e.EntryStatus.Source = strings.ToLower(e.EntryStatus.Source)
+			changesJSON, err := json.Marshal(entryDiff(lex.Entry{}, e))
+			if err != nil {
+				return fmt.Errorf("recordEntryInsertsTx failed to marshal changes : %v", err)
+			}
+			entryJSON, err := json.Marshal(e)
+			if err != nil {
+				return fmt.Errorf("recordEntryInsertsTx failed to marshal entry : %v", err)
+			}
+			vals = append(vals, "(?, ?, ?, ?, ?, ?)")
+			args = append(args, e.ID, l.id, historyActionInsert, e.EntryStatus.Source, string(changesJSON), string(entryJSON))
+		}
+		q := "INSERT INTO EntryHistory (entryId, lexiconId, action, source, changes, entry) VALUES " + strings.Join(vals, ", ")
+		_, err := tx.Exec(q, args...)
+		if err != nil {
+			return fmt.Errorf("recordEntryInsertsTx failed to insert history : %v", err)
+		}
+	}
+	return nil
+}
+
+// recordEntryUpdateTx looks up the updated entry, and records the changes compared to dbE, the entry as it was before the update. If no recorded field has changed, nothing is added to the history.
+func recordEntryUpdateTx(dbif DBIF, tx *sql.Tx, source string, dbE lex.Entry) error {
+	var esw lex.EntrySliceWriter
+	err := dbif.lookUpTx(tx, []lex.LexName{dbE.LexRef.LexName}, Query{EntryIDs: []int64{dbE.ID}}, &esw)
+	if err != nil {
+		return fmt.Errorf("recordEntryUpdateTx : %v", err)
+	}
+	if len(esw.Entries) != 1 {
+		return fmt.Errorf("recordEntryUpdateTx : expected one entry with id '%d', found %d", dbE.ID, len(esw.Entries))
+	}
+	newE := esw.Entries[0]
+	changes := entryDiff(dbE, newE)
+	if len(changes) == 0 {
+		return nil
+	}
+	return insertEntryHistoryTx(tx, historyActionUpdate, source, newE, changes)
+}
+
+// bumpEntryRevisionTx increases the revision of an updated entry. The update only succeeds if the entry still has the given revision in the db, otherwise an EntryConflictError is returned, with the current version of the entry.
+func bumpEntryRevisionTx(dbif DBIF, tx *sql.Tx, dbE lex.Entry) error {
+	res, err := tx.Exec("UPDATE Entry SET revision = revision + 1 WHERE id = ? AND revision = ?", dbE.ID, dbE.Revision)
+	if err != nil {
+		return fmt.Errorf("failed to update entry revision : %v", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update entry revision : %v", err)
+	}
+	if n == 0 {
+		var esw lex.EntrySliceWriter
+		err = dbif.lookUpTx(tx, []lex.LexName{dbE.LexRef.LexName}, Query{EntryIDs: []int64{dbE.ID}}, &esw)
+		if err != nil {
+			return fmt.Errorf("failed to look up entry with id '%d' : %v", dbE.ID, err)
+		}
+		if len(esw.Entries) != 1 {
+			return fmt.Errorf("failed to update entry revision : no entry with id '%d'", dbE.ID)
+		}
+		return &EntryConflictError{Revision: dbE.Revision, Current: esw.Entries[0]}
+	}
+	return nil
+}
+
+// unsetPreferredTx sets preferred to false for all other entries with the same orthography as e. The revisions of these entries are increased, and the changes are recorded in the entry history.
+func unsetPreferredTx(dbif DBIF, tx *sql.Tx, source string, e lex.Entry) error {
+	q := "SELECT Entry.id, Lexicon.name FROM Entry, Lexicon WHERE Entry.lexiconId = Lexicon.id AND Entry.strn = ? AND Entry.preferred <> 0 AND Entry.id <> ?"
+	rows, err := tx.Query(q, e.Strn, e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to look up preferred entries : %v", err)
+	}
+	lexNames := make(map[int64]string)
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var lexName string
+		err = rows.Scan(&id, &lexName)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan preferred entry : %v", err)
+		}
+		ids = append(ids, id)
+		lexNames[id] = lexName
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to look up preferred entries : %v", err)
+	}
+
+	for _, id := range ids {
+		var esw lex.EntrySliceWriter
+		err = dbif.lookUpTx(tx, []lex.LexName{lex.LexName(lexNames[id])}, Query{EntryIDs: []int64{id}}, &esw)
+		if err != nil {
+			return fmt.Errorf("failed to look up entry with id '%d' : %v", id, err)
+		}
+		if len(esw.Entries) != 1 {
+			return fmt.Errorf("expected one entry with id '%d', found %d", id, len(esw.Entries))
+		}
+		_, err = tx.Exec("UPDATE Entry SET preferred = 0, revision = revision + 1 WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("failed to unset preferred for entry with id '%d' : %v", id, err)
+		}
+		err = recordEntryUpdateTx(dbif, tx, source, esw.Entries[0])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordEntryDeleteTx records the deletion of an entry, with source as the deleting user. It must be called before the entry is deleted. If the entry doesn't exist in the lexicon, nothing is recorded.
+func recordEntryDeleteTx(dbif DBIF, tx *sql.Tx, lexName string, entryID int64, source string) error {
+	var esw lex.EntrySliceWriter
+	err := dbif.lookUpTx(tx, []lex.LexName{lex.LexName(lexName)}, Query{EntryIDs: []int64{entryID}}, &esw)
+	if err != nil {
+		return fmt.Errorf("recordEntryDeleteTx : %v", err)
+	}
+	if len(esw.Entries) != 1 {
+		return nil
+	}
+	dbE := esw.Entries[0]
+	return insertEntryHistoryTx(tx, historyActionDelete, source, dbE, entryDiff(dbE, lex.Entry{}))
+}
+
+func entryHistory(db *sql.DB, lexName string, entryID int64) ([]EntryHistoryItem, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return []EntryHistoryItem{}, fmt.Errorf("entryHistory failed to start db transaction : %v", err)
+	}
+	defer tx.Commit()
+	return entryHistoryTx(tx, lexName, entryID)
+}
+
+// entryHistoryTx lists the history of an entry in the given lexicon, oldest change first. When entries are moved between lexicons (see moveNewEntries), their history is moved along with them.
+func entryHistoryTx(tx *sql.Tx, lexName string, entryID int64) ([]EntryHistoryItem, error) {
+	var res = []EntryHistoryItem{}
+
+	var lexID int64
+	err := tx.QueryRow("SELECT id FROM Lexicon WHERE name = ?", lexName).Scan(&lexID)
+	if err == sql.ErrNoRows {
+		return res, fmt.Errorf("entryHistoryTx : no such lexicon '%s'", lexName)
+	}
+	if err != nil {
+		return res, fmt.Errorf("entryHistoryTx : failed to look up lexicon '%s' : %v", lexName, err)
+	}
+
+	q := "SELECT id, entryId, action, source, Timestamp, changes, entry FROM EntryHistory WHERE lexiconId = ? AND entryId = ? ORDER BY id"
+	rows, err := tx.Query(q, lexID, entryID)
+	if err != nil {
+		return res, fmt.Errorf("entryHistoryTx : failed to query history : %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item EntryHistoryItem
+		var changesJSON, entryJSON string
+		err = rows.Scan(&item.ID, &item.EntryID, &item.Action, &item.Source, &item.Timestamp, &changesJSON, &entryJSON)
+		if err != nil {
+			return res, fmt.Errorf("entryHistoryTx : failed to scan row : %v", err)
+		}
+		err = json.Unmarshal([]byte(changesJSON), &item.Changes)
+		if err != nil {
+			return res, fmt.Errorf("entryHistoryTx : failed to unmarshal changes for history id '%d' : %v", item.ID, err)
+		}
+		err = json.Unmarshal([]byte(entryJSON), &item.Entry)
+		if err != nil {
+			return res, fmt.Errorf("entryHistoryTx : failed to unmarshal entry for history id '%d' : %v", item.ID, err)
+		}
+		item.Revision = item.Entry.Revision
+		res = append(res, item)
+	}
+	err = rows.Err()
+	if err != nil {
+		return res, fmt.Errorf("entryHistoryTx : %v", err)
+	}
+
+	return res, nil
+}
+
+// historyTimestampLayouts are the accepted timestamp formats for entry history look-up. The database engines return timestamps in different formats.
+var historyTimestampLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+func parseHistoryTimestamp(s string) (time.Time, error) {
+	for _, layout := range historyTimestampLayouts {
+		t, err := time.Parse(layout, strings.TrimSpace(s))
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp '%s'", s)
+}
+
+// entryAsOf returns the entry version that was current at the given time, according to the input history (oldest change first)
+func entryAsOf(history []EntryHistoryItem, asOf time.Time) (lex.Entry, error) {
+	var found *EntryHistoryItem
+	for i, item := range history {
+		t, err := parseHistoryTimestamp(item.Timestamp)
+		if err != nil {
+			return lex.Entry{}, fmt.Errorf("history id '%d' : %v", item.ID, err)
+		}
+		if t.After(asOf) {
+			break
+		}
+		found = &history[i]
+	}
+	if found == nil {
+		return lex.Entry{}, fmt.Errorf("no recorded history before %s", asOf.Format(time.RFC3339))
+	}
+	if found.Action == historyActionDelete {
+		return lex.Entry{}, fmt.Errorf("entry was deleted at %s", found.Timestamp)
+	}
+	return found.Entry, nil
+}
+
+// revertEntry restores an entry to an earlier revision, in a single transaction. See revertEntryTx.
+func revertEntry(dbif DBIF, db *sql.DB, lexName string, entryID int64, revision int64, source string) (lex.Entry, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return lex.Entry{}, fmt.Errorf("revertEntry failed to start db transaction : %v", err)
+	}
+	defer tx.Commit()
+
+	res, err := revertEntryTx(dbif, tx, lexName, entryID, revision, source)
+	if err != nil {
+		msg := fmt.Sprintf("revertEntry failed : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+		return res, fmt.Errorf(msg)
+	}
+	return res, nil
+}
+
+// revertFields are the entry fields restored by revertEntryTx
+var revertFields = []string{"transcriptions", "lemma", "tag", "partOfSpeech", "morphology", "preferred", "comments"}
+
+// copyEntryFields returns a copy of dst, with the named fields (transcriptions, lemma, tag, partOfSpeech, morphology, wordParts, language, preferred, comments or status) copied from src. Fields with equal values are kept as is, so that the update functions (comparing ids) won't re-insert them. The lemma id of dst is kept, since the update functions identify the lemma by id.
+func copyEntryFields(dst lex.Entry, src lex.Entry, fields []string) lex.Entry {
+	e := dst
+	for _, f := range fields {
+		if historyFieldValue(dst, f) == historyFieldValue(src, f) {
+			continue
+		}
+		switch f {
+		case "transcriptions":
+			e.Transcriptions = src.Transcriptions
+		case "lemma":
+			if src.Lemma.Strn == "" {
+				e.Lemma = lex.Lemma{}
+			} else {
+				e.Lemma = lex.Lemma{ID: dst.Lemma.ID, Strn: src.Lemma.Strn, Reading: src.Lemma.Reading, Paradigm: src.Lemma.Paradigm}
+			}
+		case "tag":
+			e.Tag = src.Tag
+		case "partOfSpeech":
+			e.PartOfSpeech = src.PartOfSpeech
+		case "morphology":
+			e.Morphology = src.Morphology
+		case "preferred":
+			e.Preferred = src.Preferred
+		case "wordParts":
+			e.WordParts = src.WordParts
+		case "language":
+			e.Language = src.Language
+		case "comments":
+			e.Comments = src.Comments
+		case "status":
+			e.EntryStatus = lex.EntryStatus{Name: src.EntryStatus.Name, Source: src.EntryStatus.Source}
+		}
+	}
+	return e
+}
+
+// revertEntryTx restores the transcriptions, lemma, tag, part of speech, morphology, preferred flag and comments of an entry to an earlier revision (Entry.Revision), as recorded in the entry history. The revert is recorded as a new entry status, with the name of the status at the reverted revision, and the input source (the reverting user) as status source. Deleted entries cannot be reverted.
+func revertEntryTx(dbif DBIF, tx *sql.Tx, lexName string, entryID int64, revision int64, source string) (lex.Entry, error) {
+	var res lex.Entry
+
+	if trm(source) == "" {
+		return res, fmt.Errorf("source (the reverting user) must not be empty")
+	}
+
+	history, err := entryHistoryTx(tx, lexName, entryID)
+	if err != nil {
+		return res, err
+	}
+	var rev *EntryHistoryItem
+	for i, item := range history {
+		if item.Revision == revision && item.Action != historyActionDelete {
+			rev = &history[i]
+			break
+		}
+	}
+	if rev == nil {
+		return res, fmt.Errorf("no revision '%d' for entry id '%d'", revision, entryID)
+	}
+
+	var esw lex.EntrySliceWriter
+	err = dbif.lookUpTx(tx, []lex.LexName{lex.LexName(lexName)}, Query{EntryIDs: []int64{entryID}}, &esw)
+	if err != nil {
+		return res, err
+	}
+	if len(esw.Entries) != 1 {
+		return res, fmt.Errorf("no entry with id '%d' in lexicon '%s'", entryID, lexName)
+	}
+	current := esw.Entries[0]
+	old := rev.Entry
+
+	e := copyEntryFields(current, old, revertFields)
+
+	statusName := old.EntryStatus.Name
+	if statusName == "" {
+		statusName = current.EntryStatus.Name
+	}
+	e.EntryStatus = lex.EntryStatus{Name: statusName, Source: source}
+
+	_, err = dbif.updateEntryTx(tx, e, false)
+	if err != nil {
+		return res, err
+	}
+
+	esw = lex.EntrySliceWriter{}
+	err = dbif.lookUpTx(tx, []lex.LexName{lex.LexName(lexName)}, Query{EntryIDs: []int64{entryID}}, &esw)
+	if err != nil {
+		return res, err
+	}
+	if len(esw.Entries) != 1 {
+		return res, fmt.Errorf("no entry with id '%d' in lexicon '%s' after revert", entryID, lexName)
+	}
+	return esw.Entries[0], nil
+}
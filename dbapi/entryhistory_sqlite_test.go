@@ -0,0 +1,534 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestEntryHistorySqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testEntryHistory(t, sqliteDBIF{}, db)
+	testRevertEntry(t, sqliteDBIF{}, db)
+	testUpdateConflict(t, sqliteDBIF{}, db)
+	testUnsetPreferred(t, sqliteDBIF{}, db)
+}
+
+// testEntryHistory is shared between the sqlite and mariadb tests
+func testEntryHistory(t *testing.T, dbif DBIF, db *sql.DB) {
+	l := lexicon{name: "history_test", symbolSetName: "ZZ", locale: "ll"}
+	l, err := dbif.defineLexicon(db, l)
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+
+	e := lex.Entry{Strn: "Rom",
+		PartOfSpeech:   "PM",
+		WordParts:      "rom",
+		Language:       "sv",
+		Transcriptions: []lex.Transcription{{Strn: "\" r u m", Language: "sv"}},
+		EntryStatus:    lex.EntryStatus{Name: "unchecked", Source: "imported"}}
+
+	ids, err := dbif.insertEntries(db, l, []lex.Entry{e})
+	if err != nil {
+		t.Fatalf("Failed to insert entry : %v", err)
+	}
+	id := ids[0]
+
+	history, err := entryHistory(db, l.name, id)
+	if err != nil {
+		t.Fatalf("Failed to get history : %v", err)
+	}
+	if w, g := 1, len(history); w != g {
+		t.Fatalf("Expected %d history items, got %d", w, g)
+	}
+	if w, g := historyActionInsert, history[0].Action; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "imported", history[0].Source; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "rom", history[0].Entry.Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+
+	// The history is not listed for an entry in another lexicon
+	l2 := lexicon{name: "history_test2", symbolSetName: "ZZ", locale: "ll"}
+	_, err = dbif.defineLexicon(db, l2)
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	history2, err := entryHistory(db, l2.name, id)
+	if err != nil {
+		t.Fatalf("Failed to get history : %v", err)
+	}
+	if w, g := 0, len(history2); w != g {
+		t.Errorf("Expected %d history items, got %d", w, g)
+	}
+
+	// Update transcription and status
+	dbE, err := dbif.getEntryFromID(db, id)
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	dbE.Transcriptions = []lex.Transcription{{Strn: "\" r O m", Language: "sv"}}
+	dbE.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor1"}
+	_, updated, err := dbif.updateEntry(db, dbE)
+	if err != nil {
+		t.Fatalf("Failed to update entry : %v", err)
+	}
+	if !updated {
+		t.Errorf("Expected entry to be updated")
+	}
+
+	history, err = entryHistory(db, l.name, id)
+	if err != nil {
+		t.Fatalf("Failed to get history : %v", err)
+	}
+	if w, g := 2, len(history); w != g {
+		t.Fatalf("Expected %d history items, got %d", w, g)
+	}
+	upd := history[1]
+	if w, g := historyActionUpdate, upd.Action; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "editor1", upd.Source; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	wantChanges := []FieldChange{
+		{Field: "transcriptions", OldValue: "\" r u m", NewValue: "\" r O m"},
+		{Field: "status", OldValue: "unchecked (imported)", NewValue: "ok (editor1)"},
+	}
+	if w, g := len(wantChanges), len(upd.Changes); w != g {
+		t.Fatalf("Expected %d changes, got %d : %#v", w, g, upd.Changes)
+	}
+	for i, w := range wantChanges {
+		if g := upd.Changes[i]; w != g {
+			t.Errorf("Expected %#v, got %#v", w, g)
+		}
+	}
+
+	// An update without changes should not be recorded
+	dbE, err = dbif.getEntryFromID(db, id)
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	_, _, err = dbif.updateEntry(db, dbE)
+	if err != nil {
+		t.Fatalf("Failed to update entry : %v", err)
+	}
+	history, err = entryHistory(db, l.name, id)
+	if err != nil {
+		t.Fatalf("Failed to get history : %v", err)
+	}
+	if w, g := 2, len(history); w != g {
+		t.Errorf("Expected %d history items, got %d", w, g)
+	}
+
+	// Entry as of
+	asOf, err := entryAsOf(history, time.Now().UTC().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to get entry as of now : %v", err)
+	}
+	if w, g := "\" r O m", asOf.Transcriptions[0].Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	_, err = entryAsOf(history, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err == nil {
+		t.Errorf("Expected error for timestamp before insert, got nil")
+	}
+
+	// Delete
+	_, err = dbif.deleteEntry(db, id, l.name, "Editor2")
+	if err != nil {
+		t.Fatalf("Failed to delete entry : %v", err)
+	}
+	history, err = entryHistory(db, l.name, id)
+	if err != nil {
+		t.Fatalf("Failed to get history : %v", err)
+	}
+	if w, g := 3, len(history); w != g {
+		t.Fatalf("Expected %d history items, got %d", w, g)
+	}
+	if w, g := historyActionDelete, history[2].Action; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "editor2", history[2].Source; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "\" r O m", history[2].Entry.Transcriptions[0].Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	_, err = entryAsOf(history, time.Now().UTC().Add(time.Hour))
+	if err == nil {
+		t.Errorf("Expected error for deleted entry, got nil")
+	}
+
+	_, err = entryHistory(db, "no_such_lexicon", id)
+	if err == nil {
+		t.Errorf("Expected error for non-existing lexicon, got nil")
+	}
+}
+
+// testRevertEntry is shared between the sqlite and mariadb tests
+func testRevertEntry(t *testing.T, dbif DBIF, db *sql.DB) {
+	l := lexicon{name: "revert_test", symbolSetName: "ZZ", locale: "ll"}
+	l, err := dbif.defineLexicon(db, l)
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+
+	e := lex.Entry{Strn: "rom",
+		PartOfSpeech:   "PM",
+		Morphology:     "",
+		WordParts:      "rom",
+		Language:       "sv",
+		Tag:            "city",
+		Preferred:      true,
+		Lemma:          lex.Lemma{Strn: "Rom"},
+		Transcriptions: []lex.Transcription{{Strn: "\" r u m", Language: "sv"}},
+		Comments:       []lex.EntryComment{{Label: "place", Source: "imported", Comment: "capital of Italy"}},
+		EntryStatus:    lex.EntryStatus{Name: "unchecked", Source: "imported"}}
+
+	ids, err := dbif.insertEntries(db, l, []lex.Entry{e})
+	if err != nil {
+		t.Fatalf("Failed to insert entry : %v", err)
+	}
+	id := ids[0]
+
+	dbE, err := dbif.getEntryFromID(db, id)
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	dbE.PartOfSpeech = "NN"
+	dbE.Morphology = "UTR IND SIN"
+	dbE.Tag = "drink"
+	dbE.Preferred = false
+	dbE.Lemma.Strn = "rom"
+	dbE.Lemma.Paradigm = "s2r"
+	dbE.Transcriptions = []lex.Transcription{{Strn: "\" r O m", Language: "sv"}}
+	dbE.Comments = []lex.EntryComment{}
+	dbE.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor1"}
+	_, _, err = dbif.updateEntry(db, dbE)
+	if err != nil {
+		t.Fatalf("Failed to update entry : %v", err)
+	}
+
+	history, err := entryHistory(db, l.name, id)
+	if err != nil {
+		t.Fatalf("Failed to get history : %v", err)
+	}
+	if w, g := 2, len(history); w != g {
+		t.Fatalf("Expected %d history items, got %d", w, g)
+	}
+	if w, g := int64(1), history[0].Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+	if w, g := int64(2), history[1].Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+
+	_, err = revertEntry(dbif, db, l.name, id, history[0].Revision, "")
+	if err == nil {
+		t.Errorf("Expected error for empty source, got nil")
+	}
+	_, err = revertEntry(dbif, db, l.name, id, history[1].Revision+100, "editor2")
+	if err == nil {
+		t.Errorf("Expected error for non-existing revision, got nil")
+	}
+
+	res, err := revertEntry(dbif, db, l.name, id, history[0].Revision, "editor2")
+	if err != nil {
+		t.Fatalf("Failed to revert entry : %v", err)
+	}
+	if w, g := "PM", res.PartOfSpeech; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "", res.Morphology; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "city", res.Tag; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := true, res.Preferred; w != g {
+		t.Errorf("Expected '%v', got '%v'", w, g)
+	}
+	if w, g := "Rom", res.Lemma.Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "", res.Lemma.Paradigm; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := 1, len(res.Transcriptions); w != g {
+		t.Fatalf("Expected %d transcriptions, got %d", w, g)
+	}
+	if w, g := "\" r u m", res.Transcriptions[0].Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := 1, len(res.Comments); w != g {
+		t.Fatalf("Expected %d comments, got %d", w, g)
+	}
+	if w, g := "capital of Italy", res.Comments[0].Comment; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := (lex.EntryStatus{Name: "unchecked", Source: "editor2"}), res.EntryStatus; w.Name != g.Name || w.Source != g.Source {
+		t.Errorf("Expected '%v', got '%v'", w, g)
+	}
+
+	history, err = entryHistory(db, l.name, id)
+	if err != nil {
+		t.Fatalf("Failed to get history : %v", err)
+	}
+	if w, g := 3, len(history); w != g {
+		t.Fatalf("Expected %d history items, got %d", w, g)
+	}
+	if w, g := "editor2", history[2].Source; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := int64(3), history[2].Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+
+	// A deleted entry cannot be reverted
+	_, err = dbif.deleteEntry(db, id, l.name, "")
+	if err != nil {
+		t.Fatalf("Failed to delete entry : %v", err)
+	}
+	_, err = revertEntry(dbif, db, l.name, id, history[0].Revision, "editor2")
+	if err == nil {
+		t.Errorf("Expected error for deleted entry, got nil")
+	}
+}
+
+// testUpdateConflict is shared between the sqlite and mariadb tests
+func testUpdateConflict(t *testing.T, dbif DBIF, db *sql.DB) {
+	l := lexicon{name: "conflict_test", symbolSetName: "ZZ", locale: "ll"}
+	l, err := dbif.defineLexicon(db, l)
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+
+	e := lex.Entry{Strn: "bil",
+		PartOfSpeech:   "NN",
+		WordParts:      "bil",
+		Language:       "sv",
+		Transcriptions: []lex.Transcription{{Strn: "\" b i: l", Language: "sv"}},
+		EntryStatus:    lex.EntryStatus{Name: "unchecked", Source: "imported"}}
+
+	ids, err := dbif.insertEntries(db, l, []lex.Entry{e})
+	if err != nil {
+		t.Fatalf("Failed to insert entry : %v", err)
+	}
+	id := ids[0]
+
+	// Two editors read the same entry
+	e1, err := dbif.getEntryFromID(db, id)
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	if w, g := int64(1), e1.Revision; w != g {
+		t.Fatalf("Expected revision %d, got %d", w, g)
+	}
+	e2 := e1
+
+	e1.Tag = "vehicle"
+	e1.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor1"}
+	res, updated, err := dbif.updateEntry(db, e1)
+	if err != nil {
+		t.Fatalf("Failed to update entry : %v", err)
+	}
+	if !updated {
+		t.Errorf("Expected entry to be updated")
+	}
+	if w, g := int64(2), res.Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+
+	// The second editor's update is based on a stale revision
+	e2.Tag = "car"
+	e2.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor2"}
+	_, updated, err = dbif.updateEntry(db, e2)
+	if err == nil {
+		t.Fatalf("Expected update conflict, got nil")
+	}
+	conflict, ok := err.(*EntryConflictError)
+	if !ok {
+		t.Fatalf("Expected *EntryConflictError, got %T : %v", err, err)
+	}
+	if updated {
+		t.Errorf("Expected entry not to be updated")
+	}
+	if w, g := int64(1), conflict.Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+	if w, g := int64(2), conflict.Current.Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+	if w, g := "vehicle", conflict.Current.Tag; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+
+	dbE, err := dbif.getEntryFromID(db, id)
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	if w, g := "vehicle", dbE.Tag; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+
+	// An update without revision is rejected
+	e2.Revision = 0
+	_, _, err = dbif.updateEntry(db, e2)
+	if err == nil {
+		t.Errorf("Expected error for missing revision, got nil")
+	}
+
+	// The revision check can only be skipped by internal callers
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to start transaction : %v", err)
+	}
+	_, err = dbif.updateEntryTx(tx, e2, false)
+	if err != nil {
+		t.Fatalf("Failed to update entry : %v", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatalf("Failed to commit : %v", err)
+	}
+	res, err = dbif.getEntryFromID(db, id)
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	if w, g := "car", res.Tag; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := int64(3), res.Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+
+	// The revision is not increased if the entry has been updated since it was read
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Failed to start transaction : %v", err)
+	}
+	err = bumpEntryRevisionTx(dbif, tx, e1)
+	conflict, ok = err.(*EntryConflictError)
+	if !ok {
+		t.Errorf("Expected *EntryConflictError, got %T : %v", err, err)
+	} else if w, g := int64(3), conflict.Current.Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatalf("Failed to rollback : %v", err)
+	}
+}
+
+// testUnsetPreferred is shared between the sqlite and mariadb tests
+func testUnsetPreferred(t *testing.T, dbif DBIF, db *sql.DB) {
+	l := lexicon{name: "preferred_test", symbolSetName: "ZZ", locale: "ll"}
+	l, err := dbif.defineLexicon(db, l)
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+
+	e1 := lex.Entry{Strn: "tomte",
+		PartOfSpeech:   "NN",
+		WordParts:      "tomte",
+		Language:       "sv",
+		Preferred:      true,
+		Transcriptions: []lex.Transcription{{Strn: "\" t O m . t e", Language: "sv"}},
+		EntryStatus:    lex.EntryStatus{Name: "unchecked", Source: "imported"}}
+	e2 := e1
+	e2.PartOfSpeech = "PM"
+	e2.Preferred = false
+
+	ids, err := dbif.insertEntries(db, l, []lex.Entry{e1, e2})
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	// Setting the second entry as preferred un-prefers the first one
+	dbE2, err := dbif.getEntryFromID(db, ids[1])
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	dbE2.Preferred = true
+	dbE2.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor1"}
+	_, _, err = dbif.updateEntry(db, dbE2)
+	if err != nil {
+		t.Fatalf("Failed to update entry : %v", err)
+	}
+
+	dbE1, err := dbif.getEntryFromID(db, ids[0])
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	if dbE1.Preferred {
+		t.Errorf("Expected entry not to be preferred")
+	}
+	if w, g := int64(2), dbE1.Revision; w != g {
+		t.Errorf("Expected revision %d, got %d", w, g)
+	}
+	history, err := entryHistory(db, l.name, ids[0])
+	if err != nil {
+		t.Fatalf("Failed to get history : %v", err)
+	}
+	if w, g := 2, len(history); w != g {
+		t.Fatalf("Expected %d history items, got %d", w, g)
+	}
+	if w, g := "editor1", history[1].Source; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	wantChanges := []FieldChange{{Field: "preferred", OldValue: "true", NewValue: "false"}}
+	if w, g := len(wantChanges), len(history[1].Changes); w != g {
+		t.Fatalf("Expected %d changes, got %d : %#v", w, g, history[1].Changes)
+	}
+	if w, g := wantChanges[0], history[1].Changes[0]; w != g {
+		t.Errorf("Expected %#v, got %#v", w, g)
+	}
+}
+
+func TestParseHistoryTimestamp(t *testing.T) {
+	w := time.Date(2017, 11, 14, 9, 34, 30, 0, time.UTC)
+	for _, s := range []string{"2017-11-14T09:34:30Z", "2017-11-14 09:34:30", "2017-11-14T09:34:30"} {
+		g, err := parseHistoryTimestamp(s)
+		if err != nil {
+			t.Errorf("Failed to parse '%s' : %v", s, err)
+		}
+		if !w.Equal(g) {
+			t.Errorf("Expected %v, got %v", w, g)
+		}
+	}
+	_, err := parseHistoryTimestamp("yesterday")
+	if err == nil {
+		t.Errorf("Expected error for invalid timestamp, got nil")
+	}
+}
+
+// BenchmarkInsertEntriesSqlite measures the import of entries into a lexicon, including the recording of the entry history
+func BenchmarkInsertEntriesSqlite(b *testing.B) {
+	db := newSqliteTestDB(b)
+	defer db.Close()
+
+	var es []lex.Entry
+	for _, w := range regexpBenchWords(10000) {
+		es = append(es, regexpTestEntry(w))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l, err := sqliteDBIF{}.defineLexicon(db, lexicon{name: fmt.Sprintf("insertbench%d", i), symbolSetName: "ZZ", locale: "sv_SE"})
+		if err != nil {
+			b.Fatalf("defineLexicon failed : %v", err)
+		}
+		_, err = sqliteDBIF{}.insertEntries(db, l, es)
+		if err != nil {
+			b.Fatalf("insertEntries failed : %v", err)
+		}
+	}
+}
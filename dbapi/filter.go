@@ -0,0 +1,179 @@
+package dbapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Filter is a composable tree of search criteria, used in Query.Filter.
+// A Filter node is either a single search criterion (Field, Op and Value/Values), or a boolean composition of sub-filters (exactly one of And, Or or Not).
+//
+// Criteria are matched against whole entries: a criterion on transcriptions matches an entry if any of its transcriptions match, and the negated criterion matches an entry if none of its transcriptions match.
+//
+// Example, in JSON: all entries with a transcription matching a regexp, and a current status that is not 'ok':
+//
+//	{"and": [{"field": "transcription", "op": "regexp", "value": "^\" ?A:"},
+//	         {"not": {"field": "status", "op": "eq", "value": "ok"}}]}
+type Filter struct {
+	// Field is the name of the field to match, see FilterFields
+	Field string `json:"field,omitempty"`
+	// Op is the comparison operator, see FilterOps
+	Op string `json:"op,omitempty"`
+	// Value is the value to compare with (for all ops except 'in')
+	Value string `json:"value,omitempty"`
+	// Values is the list of values to compare with (for op 'in')
+	Values []string `json:"values,omitempty"`
+
+	// And matches entries matching all of the sub-filters
+	And []Filter `json:"and,omitempty"`
+	// Or matches entries matching at least one of the sub-filters
+	Or []Filter `json:"or,omitempty"`
+	// Not matches entries that don't match the sub-filter
+	Not *Filter `json:"not,omitempty"`
+}
+
+// filterField holds the SQL for a field name. If subQuery is set, the field is in another table than Entry, and the criterion is compiled into an 'Entry.id IN (subQuery AND criterion)' expression.
+type filterField struct {
+	column   string
+	subQuery string
+}
+
+var filterFields = map[string]filterField{
+	"strn":         {column: "Entry.strn"},
+	"wordParts":    {column: "Entry.wordParts"},
+	"partOfSpeech": {column: "Entry.partOfSpeech"},
+	"morphology":   {column: "Entry.morphology"},
+	"language":     {column: "Entry.language"},
+
+	"transcription": {column: "ft.strn", subQuery: "SELECT ft.entryId FROM Transcription ft WHERE"},
+
+	"lemma":    {column: "fl.strn", subQuery: "SELECT fle.entryId FROM Lemma2Entry fle, Lemma fl WHERE fl.id = fle.lemmaId AND"},
+	"reading":  {column: "fl.reading", subQuery: "SELECT fle.entryId FROM Lemma2Entry fle, Lemma fl WHERE fl.id = fle.lemmaId AND"},
+	"paradigm": {column: "fl.paradigm", subQuery: "SELECT fle.entryId FROM Lemma2Entry fle, Lemma fl WHERE fl.id = fle.lemmaId AND"},
+
+	"tag": {column: "ftag.tag", subQuery: "SELECT ftag.entryId FROM EntryTag ftag WHERE"},
+
+	"status": {column: "fs.name", subQuery: "SELECT fs.entryId FROM EntryStatus fs WHERE fs.current = 1 AND"},
+	"user":   {column: "fs.source", subQuery: "SELECT fs.entryId FROM EntryStatus fs WHERE fs.current = 1 AND"},
+
+	"commentLabel":  {column: "fc.label", subQuery: "SELECT fc.entryId FROM EntryComment fc WHERE"},
+	"commentSource": {column: "fc.source", subQuery: "SELECT fc.entryId FROM EntryComment fc WHERE"},
+	"comment":       {column: "fc.comment", subQuery: "SELECT fc.entryId FROM EntryComment fc WHERE"},
+
+	"validationRule":  {column: "fv.name", subQuery: "SELECT fv.entryId FROM EntryValidation fv WHERE"},
+	"validationLevel": {column: "fv.level", subQuery: "SELECT fv.entryId FROM EntryValidation fv WHERE"},
+}
+
+var filterOps = map[string]string{
+	"eq":     "=",
+	"like":   "LIKE",
+	"regexp": "REGEXP",
+	"in":     "IN",
+}
+
+// FilterFields returns the field names that can be used in a Filter
+func FilterFields() []string {
+	var res []string
+	for f := range filterFields {
+		res = append(res, f)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// FilterOps returns the operators that can be used in a Filter
+func FilterOps() []string {
+	var res []string
+	for op := range filterOps {
+		res = append(res, op)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Validate returns an error if the filter is malformed, for example if it contains unknown field names or operators.
+func (f Filter) Validate() error {
+	_, _, err := f.sql()
+	return err
+}
+
+func (f Filter) isLeaf() bool {
+	return f.Field != "" || f.Op != "" || f.Value != "" || len(f.Values) > 0
+}
+
+// sql compiles the filter into a piece of SQL, along with a slice of values corresponding to the '?':s in the SQL string
+func (f Filter) sql() (string, []interface{}, error) {
+	var resv []interface{}
+
+	nNodes := 0
+	for _, isSet := range []bool{f.isLeaf(), len(f.And) > 0, len(f.Or) > 0, f.Not != nil} {
+		if isSet {
+			nNodes++
+		}
+	}
+	if nNodes != 1 {
+		return "", resv, fmt.Errorf("a filter must have exactly one of field, and, or, not : %#v", f)
+	}
+
+	switch {
+	case len(f.And) > 0:
+		return joinFilters(f.And, " AND ")
+	case len(f.Or) > 0:
+		return joinFilters(f.Or, " OR ")
+	case f.Not != nil:
+		s, v, err := f.Not.sql()
+		if err != nil {
+			return "", resv, err
+		}
+		return "NOT (" + s + ")", v, nil
+	}
+
+	field, ok := filterFields[f.Field]
+	if !ok {
+		return "", resv, fmt.Errorf("unknown filter field '%s' (expected one of %s)", f.Field, strings.Join(FilterFields(), ", "))
+	}
+	op, ok := filterOps[f.Op]
+	if !ok {
+		return "", resv, fmt.Errorf("unknown filter op '%s' (expected one of %s)", f.Op, strings.Join(FilterOps(), ", "))
+	}
+
+	var cond string
+	if f.Op == "in" {
+		if len(f.Values) == 0 {
+			return "", resv, fmt.Errorf("filter op 'in' requires a list of values (field '%s')", f.Field)
+		}
+		cond = field.column + " " + op + " " + nQs(len(f.Values))
+		resv = append(resv, convS(f.Values)...)
+	} else {
+		if len(f.Values) > 0 {
+			return "", resv, fmt.Errorf("filter op '%s' requires a single value (field '%s')", f.Op, f.Field)
+		}
+		if f.Op == "regexp" {
+			// prefiltered using LIKE, when possible
+			cond, resv = regexpCond(field.column, f.Value)
+		} else {
+			cond = field.column + " " + op + " ?"
+			resv = append(resv, f.Value)
+		}
+	}
+
+	if field.subQuery != "" {
+		return "Entry.id IN (" + field.subQuery + " " + cond + ")", resv, nil
+	}
+	return cond, resv, nil
+}
+
+func joinFilters(fs []Filter, sep string) (string, []interface{}, error) {
+	var reses []string
+	var resv []interface{}
+	for _, f := range fs {
+		s, v, err := f.sql()
+		if err != nil {
+			return "", resv, err
+		}
+		reses = append(reses, s)
+		resv = append(resv, v...)
+	}
+	return "(" + strings.Join(reses, sep) + ")", resv, nil
+}
@@ -0,0 +1,111 @@
+package dbapi
+
+import (
+	"database/sql"
+	"sort"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestFilterSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testFilter(t, sqliteDBIF{}, db)
+}
+
+// testFilter is shared between the sqlite and mariadb tests
+func testFilter(t *testing.T, dbif DBIF, db *sql.DB) {
+	l, err := dbif.defineLexicon(db, lexicon{name: "filterlex", symbolSetName: "ZZ", locale: "ll"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+
+	entry := func(strn, pos, status string, trans ...string) lex.Entry {
+		e := lex.Entry{Strn: strn, PartOfSpeech: pos, Language: "sv", WordParts: strn, EntryStatus: lex.EntryStatus{Name: status, Source: "tst"}}
+		for _, t := range trans {
+			e.Transcriptions = append(e.Transcriptions, lex.Transcription{Strn: t, Language: "sv"})
+		}
+		return e
+	}
+	es := []lex.Entry{
+		entry("apa", "NN", "ok", "\" A: . p a"),
+		entry("anna", "PM", "imported", "\" a . n a"),
+		entry("andersson", "PM|NOM", "ok", "\" a n . d e . s O n"),
+		entry("bil", "NN", "imported", "\" b i: l", "\" b I l"),
+	}
+	_, err = dbif.insertEntries(db, l, es)
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	lookUp := func(f Filter) []string {
+		res, err := dbif.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, Query{Filter: &f})
+		if err != nil {
+			t.Fatalf("lookUp failed for filter %#v : %v", f, err)
+		}
+		var strns []string
+		for _, e := range res {
+			strns = append(strns, e.Strn)
+		}
+		sort.Strings(strns)
+		return strns
+	}
+	expect := func(f Filter, w ...string) {
+		g := lookUp(f)
+		if len(w) != len(g) {
+			t.Errorf("filter %#v : expected %v, got %v", f, w, g)
+			return
+		}
+		for i := range w {
+			if w[i] != g[i] {
+				t.Errorf("filter %#v : expected %v, got %v", f, w, g)
+				return
+			}
+		}
+	}
+
+	// Transcription matching a regexp, and a status that is NOT 'ok'
+	expect(Filter{And: []Filter{
+		{Field: "transcription", Op: "regexp", Value: "^\" [aA]"},
+		{Not: &Filter{Field: "status", Op: "eq", Value: "ok"}},
+	}}, "anna")
+
+	// POS NOT LIKE 'PM%'
+	expect(Filter{Not: &Filter{Field: "partOfSpeech", Op: "like", Value: "PM%"}}, "apa", "bil")
+
+	// OR group
+	expect(Filter{Or: []Filter{
+		{Field: "strn", Op: "in", Values: []string{"apa", "bil"}},
+		{Field: "partOfSpeech", Op: "eq", Value: "PM|NOM"},
+	}}, "andersson", "apa", "bil")
+
+	// A negated transcription criterion excludes the entry if any of its transcriptions match
+	expect(Filter{Not: &Filter{Field: "transcription", Op: "like", Value: "%I%"}}, "andersson", "anna", "apa")
+	// ... but the entries found are complete, with all their transcriptions
+	res, err := dbif.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, Query{Filter: &Filter{Field: "transcription", Op: "like", Value: "%I%"}})
+	if err != nil {
+		t.Fatalf("lookUp failed : %v", err)
+	}
+	if w, g := 1, len(res); w != g {
+		t.Fatalf("expected %d, got %d", w, g)
+	}
+	if w, g := 2, len(res[0].Transcriptions); w != g {
+		t.Errorf("expected %d, got %d", w, g)
+	}
+
+	// Filter combined with other criteria
+	res, err = dbif.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, Query{WordLike: "a%", Filter: &Filter{Field: "status", Op: "eq", Value: "ok"}})
+	if err != nil {
+		t.Fatalf("lookUp failed : %v", err)
+	}
+	if w, g := 2, len(res); w != g {
+		t.Errorf("expected %d, got %d", w, g)
+	}
+
+	// Invalid filter
+	_, err = dbif.lookUpIds(db, []lex.LexName{lex.LexName(l.name)}, Query{Filter: &Filter{Field: "nofield", Op: "eq", Value: "x"}})
+	if err == nil {
+		t.Errorf("expected error for invalid filter, got nil")
+	}
+}
@@ -0,0 +1,282 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// Full-text search (Query.CommentText and Query.FreeText) is an optional subsystem, enabled per database using DBManager.EnableFullTextSearch.
+//
+// For Sqlite, FTS5 virtual tables are kept in sync with the Entry and EntryComment tables using triggers.
+// FTS5 is not included in the default build of the Sqlite driver: lexserver and the lexio commands must be built with the tag sqlite_fts5 (go build -tags sqlite_fts5).
+//
+// For MariaDB, FULLTEXT indexes are used, and kept in sync by the database. Please note that MariaDB by default ignores stopwords, and words shorter than three characters (innodb_ft_min_token_size).
+
+var fullTextSchemaSqlite = []string{
+	`CREATE VIRTUAL TABLE EntryFTS USING fts5(strn, wordParts, content='Entry', content_rowid='id', tokenize='unicode61 remove_diacritics 0')`,
+	`CREATE TRIGGER entryFTSInsert AFTER INSERT ON Entry BEGIN
+	   INSERT INTO EntryFTS (rowid, strn, wordParts) VALUES (new.id, new.strn, new.wordParts);
+	 END`,
+	`CREATE TRIGGER entryFTSDelete AFTER DELETE ON Entry BEGIN
+	   INSERT INTO EntryFTS (EntryFTS, rowid, strn, wordParts) VALUES ('delete', old.id, old.strn, old.wordParts);
+	 END`,
+	`CREATE TRIGGER entryFTSUpdate AFTER UPDATE OF strn, wordParts ON Entry BEGIN
+	   INSERT INTO EntryFTS (EntryFTS, rowid, strn, wordParts) VALUES ('delete', old.id, old.strn, old.wordParts);
+	   INSERT INTO EntryFTS (rowid, strn, wordParts) VALUES (new.id, new.strn, new.wordParts);
+	 END`,
+	`INSERT INTO EntryFTS (EntryFTS) VALUES ('rebuild')`,
+
+	`CREATE VIRTUAL TABLE EntryCommentFTS USING fts5(comment, content='EntryComment', content_rowid='id', tokenize='unicode61 remove_diacritics 0')`,
+	`CREATE TRIGGER entryCommentFTSInsert AFTER INSERT ON EntryComment BEGIN
+	   INSERT INTO EntryCommentFTS (rowid, comment) VALUES (new.id, new.comment);
+	 END`,
+	`CREATE TRIGGER entryCommentFTSDelete AFTER DELETE ON EntryComment BEGIN
+	   INSERT INTO EntryCommentFTS (EntryCommentFTS, rowid, comment) VALUES ('delete', old.id, old.comment);
+	 END`,
+	`CREATE TRIGGER entryCommentFTSUpdate AFTER UPDATE OF comment ON EntryComment BEGIN
+	   INSERT INTO EntryCommentFTS (EntryCommentFTS, rowid, comment) VALUES ('delete', old.id, old.comment);
+	   INSERT INTO EntryCommentFTS (rowid, comment) VALUES (new.id, new.comment);
+	 END`,
+	`INSERT INTO EntryCommentFTS (EntryCommentFTS) VALUES ('rebuild')`,
+}
+
+var fullTextSchemaMariaDB = []string{
+	`ALTER TABLE Entry ADD FULLTEXT INDEX ftentry (strn, wordParts)`,
+	`ALTER TABLE EntryComment ADD FULLTEXT INDEX ftcomment (comment)`,
+}
+
+// fullTextEnabled checks if the full-text index has been created in the database
+func fullTextEnabled(engine DBEngine, db *sql.DB) (bool, error) {
+	var q string
+	switch engine {
+	case Sqlite:
+		q = "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'EntryCommentFTS'"
+	case MariaDB:
+		q = "SELECT count(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'EntryComment' AND index_name = 'ftcomment'"
+	default:
+		return false, fmt.Errorf("unknown db engine: %s", engine.String())
+	}
+	var n int64
+	err := db.QueryRow(q).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for full-text index : %v", err)
+	}
+	return n > 0, nil
+}
+
+// checkFullTextSupport returns an error if the database has a full-text index that this build cannot keep in sync. For Sqlite, the triggers of the index make every write to Entry and EntryComment fail with "no such module: fts5", if the driver is built without the tag sqlite_fts5.
+func checkFullTextSupport(engine DBEngine, db *sql.DB) error {
+	if engine != Sqlite {
+		return nil
+	}
+	enabled, err := fullTextEnabled(engine, db)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+	var fts5 bool
+	err = db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5)
+	if err != nil {
+		return fmt.Errorf("failed to check for FTS5 support : %v", err)
+	}
+	if !fts5 {
+		return fmt.Errorf("the database has a full-text index, but the sqlite driver is built without FTS5 (all binaries using the database must be built with the tag sqlite_fts5)")
+	}
+	return nil
+}
+
+// enableFullText creates the full-text index of the database, and populates it with the existing entries and comments. If the index already exists, nothing is done.
+func enableFullText(engine DBEngine, db *sql.DB) error {
+	enabled, err := fullTextEnabled(engine, db)
+	if err != nil {
+		return err
+	}
+	if enabled {
+		return nil
+	}
+
+	var stmts []string
+	switch engine {
+	case Sqlite:
+		stmts = fullTextSchemaSqlite
+	case MariaDB:
+		stmts = fullTextSchemaMariaDB
+	default:
+		return fmt.Errorf("unknown db engine: %s", engine.String())
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to initialize transaction : %v", err)
+	}
+	for _, stmt := range stmts {
+		_, err = tx.Exec(stmt)
+		if err != nil {
+			msg := fmt.Sprintf("failed to create full-text index : %v", err)
+			if engine == Sqlite && strings.Contains(err.Error(), "fts5") {
+				msg = fmt.Sprintf("%s (the sqlite driver must be built with the tag sqlite_fts5)", msg)
+			}
+			err2 := tx.Rollback()
+			if err2 != nil {
+				msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+			}
+			return fmt.Errorf(msg)
+		}
+	}
+	return tx.Commit()
+}
+
+// fullTextTermRe matches "quoted phrases" and single words of a full-text search string
+var fullTextTermRe = regexp.MustCompile(`"([^"]*)"|(\S+)`)
+
+// fullTextTerm is a word or a phrase (several words) of a full-text search. If prefix is true, the (last) word is matched as a prefix.
+type fullTextTerm struct {
+	words  []string
+	prefix bool
+}
+
+// parseFullText splits a full-text search string into terms, which must all be found in the text searched.
+// Terms are single words, or "quoted phrases". A word ending with * is matched as a prefix.
+// Other punctuation is ignored, and cannot be used for search operators, so that the same search string works the same way for all db engines.
+func parseFullText(s string) ([]fullTextTerm, error) {
+	var res []fullTextTerm
+	notWordChar := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+	for _, m := range fullTextTermRe.FindAllStringSubmatch(s, -1) {
+		if m[1] != "" {
+			if words := strings.FieldsFunc(m[1], notWordChar); len(words) > 0 {
+				res = append(res, fullTextTerm{words: words})
+			}
+			continue
+		}
+		words := strings.FieldsFunc(m[2], notWordChar)
+		if len(words) == 0 {
+			continue
+		}
+		res = append(res, fullTextTerm{words: words, prefix: strings.HasSuffix(m[2], "*")})
+	}
+	if len(res) == 0 {
+		return res, fmt.Errorf("no words to search for in full-text search '%s'", s)
+	}
+	return res, nil
+}
+
+// fullTextQuery converts a full-text search string to the query syntax of the db engine (FTS5 MATCH for Sqlite, AGAINST ... IN BOOLEAN MODE for MariaDB)
+func fullTextQuery(engine DBEngine, s string) (string, error) {
+	terms, err := parseFullText(s)
+	if err != nil {
+		return "", err
+	}
+	var res []string
+	for _, t := range terms {
+		term := `"` + strings.Join(t.words, " ") + `"`
+		if len(t.words) == 1 && engine == MariaDB {
+			term = t.words[0]
+		}
+		// MariaDB doesn't support prefix search in phrases
+		if t.prefix && (engine == Sqlite || len(t.words) == 1) {
+			term += "*"
+		}
+		if engine == MariaDB {
+			term = "+" + term
+		}
+		res = append(res, term)
+	}
+	return strings.Join(res, " "), nil
+}
+
+// fullTextSQL holds the SQL for the full-text search criteria of a Query
+type fullTextSQL struct {
+	cond     string
+	condArgs []interface{}
+	// rank is an expression for the relevance of an entry, where lower values are more relevant. The %[1]s:s are to be replaced with the alias of the Entry table.
+	rank     string
+	rankArgs []interface{}
+}
+
+var fullTextSQLTemplates = map[DBEngine]struct{ entryMatch, entryRank, commentMatch, commentRank string }{
+	Sqlite: {
+		entryMatch:   "Entry.id IN (SELECT rowid FROM EntryFTS WHERE EntryFTS MATCH ?)",
+		entryRank:    "COALESCE((SELECT rank FROM EntryFTS WHERE EntryFTS MATCH ? AND EntryFTS.rowid = %[1]s.id), 0)",
+		commentMatch: "Entry.id IN (SELECT ftc.entryId FROM EntryComment ftc WHERE ftc.id IN (SELECT rowid FROM EntryCommentFTS WHERE EntryCommentFTS MATCH ?))",
+		commentRank:  "COALESCE((SELECT MIN(EntryCommentFTS.rank) FROM EntryCommentFTS, EntryComment rkc WHERE EntryCommentFTS MATCH ? AND rkc.id = EntryCommentFTS.rowid AND rkc.entryId = %[1]s.id), 0)",
+	},
+	MariaDB: {
+		entryMatch:   "Entry.id IN (SELECT fte.id FROM Entry fte WHERE MATCH(fte.strn, fte.wordParts) AGAINST (? IN BOOLEAN MODE))",
+		entryRank:    "-(SELECT MATCH(rke.strn, rke.wordParts) AGAINST (? IN BOOLEAN MODE) FROM Entry rke WHERE rke.id = %[1]s.id)",
+		commentMatch: "Entry.id IN (SELECT ftc.entryId FROM EntryComment ftc WHERE MATCH(ftc.comment) AGAINST (? IN BOOLEAN MODE))",
+		commentRank:  "-COALESCE((SELECT MAX(MATCH(rkc.comment) AGAINST (? IN BOOLEAN MODE)) FROM EntryComment rkc WHERE rkc.entryId = %[1]s.id), 0)",
+	},
+}
+
+// hasFullText returns true if the query contains full-text search criteria
+func (q Query) hasFullText() bool {
+	return trm(q.CommentText) != "" || trm(q.FreeText) != ""
+}
+
+// compileFullText compiles Query.CommentText and Query.FreeText into SQL for the db engine, so that they can be used in the SQL generation
+func (q Query) compileFullText(engine DBEngine) (Query, error) {
+	if !q.hasFullText() {
+		return q, nil
+	}
+	tmpl, ok := fullTextSQLTemplates[engine]
+	if !ok {
+		return q, fmt.Errorf("unknown db engine: %s", engine.String())
+	}
+	var conds, ranks []string
+	res := &fullTextSQL{}
+	if trm(q.CommentText) != "" {
+		ft, err := fullTextQuery(engine, q.CommentText)
+		if err != nil {
+			return q, err
+		}
+		conds = append(conds, tmpl.commentMatch)
+		res.condArgs = append(res.condArgs, ft)
+		ranks = append(ranks, tmpl.commentRank)
+		res.rankArgs = append(res.rankArgs, ft)
+	}
+	if trm(q.FreeText) != "" {
+		ft, err := fullTextQuery(engine, q.FreeText)
+		if err != nil {
+			return q, err
+		}
+		conds = append(conds, "("+tmpl.entryMatch+" OR "+tmpl.commentMatch+")")
+		res.condArgs = append(res.condArgs, ft, ft)
+		ranks = append(ranks, tmpl.entryRank, tmpl.commentRank)
+		res.rankArgs = append(res.rankArgs, ft, ft)
+	}
+	res.cond = strings.Join(conds, " AND ")
+	res.rank = "(" + strings.Join(ranks, " + ") + ")"
+	q.fullText = res
+	return q, nil
+}
+
+// EnableFullTextSearch creates the full-text index used for Query.CommentText and Query.FreeText, and populates it with the existing entries and comments.
+// Once created, the index is kept in sync with the entries and comments of the database. If the index already exists, nothing is done.
+// For Sqlite, this requires the driver to be built with the tag sqlite_fts5.
+func (dbm *DBManager) EnableFullTextSearch(dbRef lex.DBRef) error {
+	dbm.Lock()
+	defer dbm.Unlock()
+	db, ok := dbm.dbs[dbRef]
+	if !ok {
+		return fmt.Errorf("DBManager.EnableFullTextSearch: no such db '%s'", dbRef)
+	}
+	return enableFullText(dbm.dbif.engine(), db)
+}
+
+// FullTextSearchEnabled checks if the full-text index has been created for the database
+func (dbm *DBManager) FullTextSearchEnabled(dbRef lex.DBRef) (bool, error) {
+	dbm.RLock()
+	defer dbm.RUnlock()
+	db, ok := dbm.dbs[dbRef]
+	if !ok {
+		return false, fmt.Errorf("DBManager.FullTextSearchEnabled: no such db '%s'", dbRef)
+	}
+	return fullTextEnabled(dbm.dbif.engine(), db)
+}
@@ -0,0 +1,213 @@
+package dbapi
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestFullTextSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	// FTS5 is only available if the sqlite driver is built with the tag sqlite_fts5
+	_, err := db.Exec("CREATE VIRTUAL TABLE temp.fts5probe USING fts5(x)")
+	if err != nil {
+		t.Skipf("full-text search not available (run the tests with -tags sqlite_fts5) : %v", err)
+	}
+	_, err = db.Exec("DROP TABLE temp.fts5probe")
+	if err != nil {
+		t.Errorf("Failed to drop table : %v", err)
+	}
+
+	testFullText(t, sqliteDBIF{}, db)
+}
+
+// testFullText is shared between the sqlite and mariadb tests
+func testFullText(t *testing.T, dbif DBIF, db *sql.DB) {
+	l, err := dbif.defineLexicon(db, lexicon{name: "fulltextlex", symbolSetName: "ZZ", locale: "sv_SE"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	lexNames := []lex.LexName{lex.LexName(l.name)}
+
+	entry := func(strn, wordParts string, comments ...string) lex.Entry {
+		e := lex.Entry{Strn: strn, PartOfSpeech: "NN", Language: "sv", WordParts: wordParts, EntryStatus: lex.EntryStatus{Name: "ok", Source: "tst"}}
+		e.Transcriptions = []lex.Transcription{{Strn: "\" d u m i", Language: "sv"}}
+		for _, c := range comments {
+			e.Comments = append(e.Comments, lex.EntryComment{Label: "info", Source: "tst", Comment: c})
+		}
+		return e
+	}
+
+	// Entries inserted before the full-text index is created must be indexed when it is created
+	_, err = dbif.insertEntries(db, l, []lex.Entry{
+		entry("hundkoja", "hund+koja", "compound with wrong stress pattern"),
+		entry("kattlucka", "katt+lucka", "check the pronunciation of the double consonant"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+	enabled, err := fullTextEnabled(dbif.engine(), db)
+	if err != nil {
+		t.Fatalf("fullTextEnabled failed : %v", err)
+	}
+	if enabled {
+		t.Fatalf("expected full-text search to be disabled before enableFullText")
+	}
+	for i := 0; i < 2; i++ { // enableFullText should be idempotent
+		err = enableFullText(dbif.engine(), db)
+		if err != nil {
+			t.Fatalf("enableFullText failed : %v", err)
+		}
+	}
+	enabled, err = fullTextEnabled(dbif.engine(), db)
+	if err != nil {
+		t.Fatalf("fullTextEnabled failed : %v", err)
+	}
+	if !enabled {
+		t.Fatalf("expected full-text search to be enabled after enableFullText")
+	}
+
+	// Entries inserted after the full-text index is created
+	_, err = dbif.insertEntries(db, l, []lex.Entry{
+		entry("hund", "hund", "common noun, pronunciation verified"),
+		entry("stressmönster", "stress+mönster"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	lookUp := func(q Query) []string {
+		res, err := dbif.lookUpIntoSlice(db, lexNames, q)
+		if err != nil {
+			t.Fatalf("lookUp failed for query %#v : %v", q, err)
+		}
+		var strns []string
+		for _, e := range res {
+			strns = append(strns, e.Strn)
+		}
+		return strns
+	}
+	expect := func(q Query, w ...string) {
+		g := lookUp(q)
+		sort.Strings(g)
+		if strings.Join(w, " ") != strings.Join(g, " ") {
+			t.Errorf("query %#v : expected %v, got %v", q, w, g)
+		}
+	}
+
+	// Comment text: all words must be found in a comment, in any order, unless quoted as a phrase
+	expect(Query{CommentText: "pronunciation"}, "hund", "kattlucka")
+	expect(Query{CommentText: "pronunciation verified"}, "hund")
+	expect(Query{CommentText: "verified pronunciation"}, "hund")
+	expect(Query{CommentText: "\"verified pronunciation\""})
+	expect(Query{CommentText: "\"stress pattern\""}, "hundkoja")
+	expect(Query{CommentText: "pronunc*"}, "hund", "kattlucka")
+	expect(Query{CommentText: "stress"}, "hundkoja")
+
+	// Free text: orthography, word parts and comments
+	expect(Query{FreeText: "stress"}, "hundkoja", "stressmönster")
+	expect(Query{FreeText: "lucka"}, "kattlucka")
+	expect(Query{FreeText: "hund"}, "hund", "hundkoja")
+	expect(Query{FreeText: "hund", PartOfSpeechLike: "NN", WordLike: "%koja"}, "hundkoja")
+	expect(Query{FreeText: "compound"}, "hundkoja")
+
+	// Relevance: the entry matching in both orthography and word parts comes first
+	if g := lookUp(Query{FreeText: "hund", SortBy: SortByRelevance}); strings.Join(g, " ") != "hund hundkoja" {
+		t.Errorf("expected entries sorted by relevance, got %v", g)
+	}
+	if g := lookUp(Query{FreeText: "hund", SortBy: SortByRelevance, SortDescending: true}); strings.Join(g, " ") != "hundkoja hund" {
+		t.Errorf("expected entries sorted by descending relevance, got %v", g)
+	}
+	if g := lookUp(Query{FreeText: "hund", SortBy: SortByRelevance, PageLength: 1, Page: 1}); strings.Join(g, " ") != "hundkoja" {
+		t.Errorf("expected second page sorted by relevance, got %v", g)
+	}
+	es, err := dbif.lookUpIntoSlice(db, lexNames, Query{FreeText: "hund", SortBy: SortByRelevance, PageLength: 1})
+	if err != nil || len(es) != 1 {
+		t.Fatalf("lookUp failed : %v", err)
+	}
+	if g := lookUp(Query{FreeText: "hund", SortBy: SortByRelevance, PageLength: 1, After: es[0].ID}); strings.Join(g, " ") != "hundkoja" {
+		t.Errorf("expected entries after %d sorted by relevance, got %v", es[0].ID, g)
+	}
+	if _, err := dbif.lookUpIntoSlice(db, lexNames, Query{WordLike: "%", SortBy: SortByRelevance}); err == nil {
+		t.Errorf("expected error for relevance sort without full-text search, got nil")
+	}
+
+	// Updated and deleted comments and entries
+	es, err = dbif.lookUpIntoSlice(db, lexNames, Query{Words: []string{"kattlucka"}})
+	if err != nil || len(es) != 1 {
+		t.Fatalf("lookUp failed : %v", err)
+	}
+	e := es[0]
+	e.Comments = []lex.EntryComment{{Label: "info", Source: "tst", Comment: "double consonant verified"}}
+	_, _, err = dbif.updateEntry(db, e)
+	if err != nil {
+		t.Fatalf("updateEntry failed : %v", err)
+	}
+	expect(Query{CommentText: "pronunciation"}, "hund")
+	expect(Query{CommentText: "verified"}, "hund", "kattlucka")
+
+	es, err = dbif.lookUpIntoSlice(db, lexNames, Query{Words: []string{"hund"}})
+	if err != nil || len(es) != 1 {
+		t.Fatalf("lookUp failed : %v", err)
+	}
+	_, err = dbif.deleteEntry(db, es[0].ID, l.name, "")
+	if err != nil {
+		t.Fatalf("deleteEntry failed : %v", err)
+	}
+	expect(Query{CommentText: "verified"}, "kattlucka")
+	expect(Query{FreeText: "hund"}, "hundkoja")
+
+	// Nothing to search for
+	if _, err := dbif.lookUpIntoSlice(db, lexNames, Query{CommentText: "* \"\""}); err == nil {
+		t.Errorf("expected error for empty full-text search, got nil")
+	}
+}
+
+// TestFullTextSupportSqlite checks that a db with a full-text index is refused if the sqlite driver is built without FTS5, since every write to Entry and EntryComment would fail
+func TestFullTextSupportSqlite(t *testing.T) {
+	dbm := NewSqliteDBManager()
+	err := dbm.DefineDB(".", "testlex_fulltextsupport")
+	if err != nil {
+		t.Fatalf("DefineDB failed : %v", err)
+	}
+	defer dbm.DropDB(".", "testlex_fulltextsupport")
+
+	dbm.RLock()
+	db := dbm.dbs["testlex_fulltextsupport"]
+	dbm.RUnlock()
+	var fts5 bool
+	err = db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5)
+	if err != nil {
+		t.Fatalf("Failed to check for FTS5 support : %v", err)
+	}
+	if fts5 {
+		t.Skip("the sqlite driver is built with FTS5 (tag sqlite_fts5)")
+	}
+
+	// A plain table with the name of the full-text table, since the FTS5 virtual table cannot be created without FTS5
+	_, err = db.Exec("CREATE TABLE EntryCommentFTS (comment text)")
+	if err != nil {
+		t.Fatalf("Failed to create table : %v", err)
+	}
+	_, err = dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{lex.NewLexRef("testlex_fulltextsupport", "lex")}, Query: Query{FreeText: "apa"}})
+	if err == nil || !strings.Contains(err.Error(), "sqlite_fts5") {
+		t.Errorf("expected error for missing FTS5 support, got %v", err)
+	}
+	err = dbm.CloseDB("testlex_fulltextsupport")
+	if err != nil {
+		t.Fatalf("CloseDB failed : %v", err)
+	}
+	err = dbm.RemoveDB("testlex_fulltextsupport")
+	if err != nil {
+		t.Fatalf("RemoveDB failed : %v", err)
+	}
+
+	err = dbm.OpenDB(".", "testlex_fulltextsupport")
+	if err == nil || !strings.Contains(err.Error(), "sqlite_fts5") {
+		t.Errorf("expected error for missing FTS5 support, got %v", err)
+	}
+}
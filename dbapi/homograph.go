@@ -0,0 +1,141 @@
+package dbapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// Token is a word in context, with optional linguistic information used to select between homographs (see DBManager.Disambiguate)
+type Token struct {
+	Word         string `json:"word"`
+	PartOfSpeech string `json:"partOfSpeech,omitempty"`
+	Morphology   string `json:"morphology,omitempty"`
+	Tag          string `json:"tag,omitempty"`
+}
+
+// HomographMatch describes how a token matched the selected entry
+type HomographMatch struct {
+	// The token's tag is equal to the entry tag
+	Tag bool `json:"tag,omitempty"`
+	// The token's part of speech is equal to the entry part of speech
+	PartOfSpeech bool `json:"partOfSpeech,omitempty"`
+	// The number of morphological features of the token found in the entry morphology
+	Morphology int `json:"morphology,omitempty"`
+	// None of the token's tag, part of speech or morphology matched any of the candidate entries, so the preferred entry was selected
+	Fallback bool `json:"fallback,omitempty"`
+}
+
+// DisambiguatedToken is the result of DBManager.Disambiguate for a single input token
+type DisambiguatedToken struct {
+	Token Token `json:"token"`
+	// The lexicon of the entry: the lexicon with the highest priority having an entry for the word. Nil if the word was not found in any of the lexicons.
+	LexRef *lex.LexRef `json:"lexRef,omitempty"`
+	// The selected entry. Nil if the word was not found in any of the lexicons.
+	Entry *lex.Entry `json:"entry,omitempty"`
+	// The number of entries for the word in the lexicon
+	Candidates int            `json:"candidates"`
+	Match      HomographMatch `json:"match"`
+}
+
+// Disambiguate selects exactly one entry per token, using the token's part of speech, morphology and tag to choose between homographs.
+// The lexicons are used in priority order, as for LookUpWithFallback: the candidate entries are the entries for the word in the first lexicon having an entry for the word.
+//
+// Candidates are ranked by the following criteria, in order:
+//  1. the entry tag is equal to the token tag
+//  2. the entry part of speech is equal to the token part of speech
+//  3. the number of morphological features of the token found in the entry morphology (features are separated by space or |, such as "NEU IND SIN" or "SIN|IND|NOM|UTR")
+//  4. the entry is the preferred entry (lex.Entry.Preferred)
+//  5. the entry has the lowest id
+//
+// Comparisons are case insensitive. Empty token fields are ignored. If no candidate matches the tag, part of speech or morphology of the token,
+// the preferred entry (or else the entry with the lowest id) is selected, and Match.Fallback is set.
+// The result has one DisambiguatedToken per input token, in the same order as the input.
+func (dbm *DBManager) Disambiguate(tokens []Token, lexRefs []lex.LexRef) ([]DisambiguatedToken, error) {
+	var res []DisambiguatedToken
+	if len(lexRefs) == 0 {
+		return res, fmt.Errorf("DBManager.Disambiguate cannot perform a search without at least one lexicon specified (using the 'lexicons' parameter)")
+	}
+	var words []string
+	for _, t := range tokens {
+		if strings.TrimSpace(t.Word) == "" {
+			return res, fmt.Errorf("DBManager.Disambiguate: empty word in token %#v", t)
+		}
+		words = append(words, t.Word)
+	}
+	if len(words) == 0 {
+		return res, nil
+	}
+
+	candidates, err := dbm.lookUpCandidates(words, lexRefs)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.Disambiguate failed : %v", err)
+	}
+
+	for _, t := range tokens {
+		dt := DisambiguatedToken{Token: t}
+		if es, ok := firstCandidates(candidates, t.Word, lexRefs); ok {
+			e := es[0]
+			m := homographMatch(t, e)
+			for _, e0 := range es[1:] {
+				m0 := homographMatch(t, e0)
+				if c := m0.compare(m); c > 0 || c == 0 && preferredOver(e0, e) {
+					e, m = e0, m0
+				}
+			}
+			m.Fallback = m == HomographMatch{}
+			lexRef := e.LexRef
+			dt.LexRef = &lexRef
+			dt.Entry = &e
+			dt.Candidates = len(es)
+			dt.Match = m
+		}
+		res = append(res, dt)
+	}
+	return res, nil
+}
+
+// homographMatch compares a token to an entry
+func homographMatch(t Token, e lex.Entry) HomographMatch {
+	var res HomographMatch
+	if tag := strings.TrimSpace(t.Tag); tag != "" {
+		res.Tag = strings.EqualFold(tag, e.Tag)
+	}
+	if pos := strings.TrimSpace(t.PartOfSpeech); pos != "" {
+		res.PartOfSpeech = strings.EqualFold(pos, e.PartOfSpeech)
+	}
+	entryFeats := make(map[string]bool)
+	for _, f := range morphFeatures(e.Morphology) {
+		entryFeats[f] = true
+	}
+	for _, f := range morphFeatures(t.Morphology) {
+		if entryFeats[f] {
+			res.Morphology++
+		}
+	}
+	return res
+}
+
+// compare returns a positive number if m is a better match than other, a negative number if it is worse, and 0 if they are equally good (ranking criteria 1-3 of Disambiguate)
+func (m HomographMatch) compare(other HomographMatch) int {
+	if m.Tag != other.Tag {
+		return boolToInt(m.Tag) - boolToInt(other.Tag)
+	}
+	if m.PartOfSpeech != other.PartOfSpeech {
+		return boolToInt(m.PartOfSpeech) - boolToInt(other.PartOfSpeech)
+	}
+	return m.Morphology - other.Morphology
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// morphFeatures splits a morphology string into lowercased features
+func morphFeatures(morph string) []string {
+	return strings.FieldsFunc(strings.ToLower(morph), func(r rune) bool { return r == ' ' || r == '|' })
+}
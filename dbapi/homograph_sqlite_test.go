@@ -0,0 +1,120 @@
+package dbapi
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestDisambiguateSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testDisambiguate(t, sqliteDBIF{}, db)
+}
+
+// testDisambiguate is shared between the sqlite and mariadb tests
+func testDisambiguate(t *testing.T, dbif DBIF, db *sql.DB) {
+	dbm, err := NewDBManager(dbif.engine())
+	if err != nil {
+		t.Fatalf("NewDBManager failed : %v", err)
+	}
+	err = dbm.AddDB("homographdb", db)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	entry := func(strn, pos, morph, tag, trans string, preferred bool) lex.Entry {
+		return lex.Entry{Strn: strn, PartOfSpeech: pos, Morphology: morph, Tag: tag, Language: "sv", WordParts: strn, Preferred: preferred,
+			Transcriptions: []lex.Transcription{{Strn: trans, Language: "sv"}},
+			EntryStatus:    lex.EntryStatus{Name: "ok", Source: "tst"}}
+	}
+	l, err := dbif.defineLexicon(db, lexicon{name: "homographlex", symbolSetName: "ZZ", locale: "sv_SE"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	_, err = dbif.insertEntries(db, l, []lex.Entry{
+		entry("läser", "VB", "PRS AKT", "verb", "vb", false),
+		entry("läser", "NN", "UTR PLU IND NOM", "noun", "nn", false),
+		entry("tomten", "NN", "UTR SIN DEF NOM", "tomte", "tomte", true),
+		entry("tomten", "NN", "UTR SIN DEF NOM", "tomt", "tomt", false),
+		entry("kort", "NN", "NEU SIN IND NOM", "noun", "nn", false),
+		entry("kort", "JJ", "NEU SIN IND NOM POS", "adj", "jj", false),
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+	lexRefs := []lex.LexRef{lex.NewLexRef("homographdb", "homographlex")}
+
+	for _, test := range []struct {
+		token Token
+		// transcription of the expected entry, or empty if no entry is expected
+		expect string
+		match  HomographMatch
+	}{
+		{Token{Word: "läser", PartOfSpeech: "VB"}, "vb", HomographMatch{PartOfSpeech: true}},
+		{Token{Word: "läser", PartOfSpeech: "NN"}, "nn", HomographMatch{PartOfSpeech: true}},
+		{Token{Word: "Läser", PartOfSpeech: "nn"}, "nn", HomographMatch{PartOfSpeech: true}},
+		{Token{Word: "läser", Morphology: "PRS"}, "vb", HomographMatch{Morphology: 1}},
+		{Token{Word: "läser"}, "vb", HomographMatch{Fallback: true}},
+		{Token{Word: "tomten", Tag: "tomt"}, "tomt", HomographMatch{Tag: true}},
+		{Token{Word: "tomten", PartOfSpeech: "NN"}, "tomte", HomographMatch{PartOfSpeech: true}},
+		{Token{Word: "tomten", PartOfSpeech: "VB", Tag: "TOMT"}, "tomt", HomographMatch{Tag: true}},
+		{Token{Word: "tomten", PartOfSpeech: "PM"}, "tomte", HomographMatch{Fallback: true}},
+		{Token{Word: "kort", Morphology: "NEU SIN IND NOM POS"}, "jj", HomographMatch{Morphology: 5}},
+		{Token{Word: "kort", Morphology: "neu|sin"}, "nn", HomographMatch{Morphology: 2}},
+		{Token{Word: "kort", PartOfSpeech: "NN", Morphology: "POS"}, "nn", HomographMatch{PartOfSpeech: true}},
+		{Token{Word: "kort", PartOfSpeech: "PM", Tag: "adverb"}, "nn", HomographMatch{Fallback: true}},
+		{Token{Word: "xyz", PartOfSpeech: "NN"}, "", HomographMatch{}},
+	} {
+		res, err := dbm.Disambiguate([]Token{test.token}, lexRefs)
+		if err != nil {
+			t.Fatalf("Disambiguate failed : %v", err)
+		}
+		if len(res) != 1 {
+			t.Errorf("expected one result for %#v, got %d", test.token, len(res))
+			continue
+		}
+		r := res[0]
+		if test.expect == "" {
+			if r.Entry != nil || r.LexRef != nil || r.Candidates != 0 {
+				t.Errorf("expected no entry for %#v, got %#v", test.token, r)
+			}
+			continue
+		}
+		if r.Entry == nil || r.LexRef == nil {
+			t.Errorf("expected entry for %#v, got none", test.token)
+			continue
+		}
+		if g := r.Entry.Transcriptions[0].Strn; g != test.expect {
+			t.Errorf("token %#v : expected %s, got %s", test.token, test.expect, g)
+		}
+		if r.Match != test.match {
+			t.Errorf("token %#v : expected match %#v, got %#v", test.token, test.match, r.Match)
+		}
+		if r.Candidates != 2 {
+			t.Errorf("token %#v : expected 2 candidates, got %d", test.token, r.Candidates)
+		}
+	}
+
+	// Several tokens, in input order
+	res, err := dbm.Disambiguate([]Token{{Word: "kort", PartOfSpeech: "JJ"}, {Word: "läser", PartOfSpeech: "NN"}, {Word: "kort", PartOfSpeech: "NN"}}, lexRefs)
+	if err != nil {
+		t.Fatalf("Disambiguate failed : %v", err)
+	}
+	var got []string
+	for _, r := range res {
+		got = append(got, r.Token.Word+":"+r.Entry.PartOfSpeech)
+	}
+	if x, g := "kort:JJ läser:NN kort:NN", strings.Join(got, " "); x != g {
+		t.Errorf(fs, x, g)
+	}
+
+	if _, err := dbm.Disambiguate([]Token{{Word: " ", PartOfSpeech: "NN"}}, lexRefs); err == nil {
+		t.Errorf("expected error for empty word, got nil")
+	}
+	if _, err := dbm.Disambiguate([]Token{{Word: "kort"}}, []lex.LexRef{}); err == nil {
+		t.Errorf("expected error for empty list of lexicons, got nil")
+	}
+}
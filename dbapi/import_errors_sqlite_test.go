@@ -0,0 +1,154 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+	"github.com/stts-se/pronlex/validation"
+)
+
+func TestImportErrorsSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testImportErrors(t, sqliteDBIF{}, db)
+}
+
+// testImportErrors is shared between the sqlite and mariadb tests
+func testImportErrors(t *testing.T, dbif DBIF, db *sql.DB) {
+	tmpDir := t.TempDir()
+
+	// strn, pos, morph, wordparts, lemma, paradigm, lang, four transcriptions with languages, status, source, preferred, tag, comments
+	wsLine := func(strn, trans string) string {
+		return strings.Join([]string{strn, "NN", "", strn, "", "", "SWE", trans, "SWE", "", "", "", "", "", "", "imported", "nst", "false", "", ""}, "\t")
+	}
+	lexFile := filepath.Join(tmpDir, "lex.txt")
+	lines := []string{
+		"# comment line",
+		wsLine("bil", "\" b i: l"),
+		wsLine("rom", "\" r u m"),
+		"unparsable line",
+		wsLine("apa", "\" A: . p a"),
+		wsLine("kex", ""), // no transcription
+	}
+	err := os.WriteFile(lexFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write file : %v", err)
+	}
+
+	logger := SilentLogger{}
+	validator := &validation.Validator{}
+
+	i := 0
+	newLexicon := func() lex.LexName {
+		i++
+		l := lexicon{name: fmt.Sprintf("import_errors_%d", i), symbolSetName: "ZZ", locale: "ll"}
+		l, err := dbif.defineLexicon(db, l)
+		if err != nil {
+			t.Fatalf("Ooops! : %v", err)
+		}
+		return lex.LexName(l.name)
+	}
+	entryCount := func(lexName lex.LexName) int64 {
+		n, err := dbif.entryCount(db, string(lexName))
+		if err != nil {
+			t.Fatalf("Failed to count entries : %v", err)
+		}
+		return n
+	}
+
+	// Abort on first error
+	lexName := newLexicon()
+	_, err = importLexiconFile(dbif, db, lexName, logger, lexFile, validator, ImportOptions{})
+	if err == nil {
+		t.Errorf("Expected error, got nil")
+	} else if !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("Expected error for line 4, got %v", err)
+	}
+
+	// Continue on error, with error report
+	lexName = newLexicon()
+	reportFile := filepath.Join(tmpDir, "errors.txt")
+	res, err := importLexiconFile(dbif, db, lexName, logger, lexFile, validator, ImportOptions{ContinueOnError: true, ErrorReport: reportFile})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if w, g := 2, len(res.Errors); w != g {
+		t.Fatalf("Expected %d errors, got %d : %v", w, g, res.Errors)
+	}
+	if w, g := 4, res.Errors[0].LineNumber; w != g {
+		t.Errorf("Expected line number %d, got %d", w, g)
+	}
+	if w, g := "unparsable line", res.Errors[0].Line; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := 6, res.Errors[1].LineNumber; w != g {
+		t.Errorf("Expected line number %d, got %d", w, g)
+	}
+	if w, g := int64(3), entryCount(lexName); w != g {
+		t.Errorf("Expected %d entries, got %d", w, g)
+	}
+	report, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatalf("Failed to read error report : %v", err)
+	}
+	reportLines := strings.Split(strings.TrimSpace(string(report)), "\n")
+	if w, g := 2, len(reportLines); w != g {
+		t.Fatalf("Expected %d lines in error report, got %d", w, g)
+	}
+	if !strings.HasPrefix(reportLines[0], "4\t") || !strings.HasSuffix(reportLines[0], "\tunparsable line") {
+		t.Errorf("Unexpected error report line: %s", reportLines[0])
+	}
+
+	// All or nothing
+	lexName = newLexicon()
+	res, err = importLexiconFile(dbif, db, lexName, logger, lexFile, validator, ImportOptions{AllOrNothing: true, ContinueOnError: true})
+	if err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+	if w, g := 2, len(res.Errors); w != g {
+		t.Errorf("Expected %d errors, got %d : %v", w, g, res.Errors)
+	}
+	if w, g := int64(0), entryCount(lexName); w != g {
+		t.Errorf("Expected %d entries, got %d", w, g)
+	}
+
+	// Resume from checkpoint
+	lexName = newLexicon()
+	checkpoint := filepath.Join(tmpDir, "checkpoint.txt")
+	err = writeImportCheckpoint(checkpoint, lexFile, lexName, 4)
+	if err != nil {
+		t.Fatalf("Failed to write checkpoint : %v", err)
+	}
+	res, err = importLexiconFile(dbif, db, lexName, logger, lexFile, validator, ImportOptions{Checkpoint: checkpoint, ContinueOnError: true})
+	if err != nil {
+		t.Fatalf("Expected nil, got %v", err)
+	}
+	if w, g := 4, res.ResumedAfterLine; w != g {
+		t.Errorf("Expected %d, got %d", w, g)
+	}
+	if w, g := 1, res.Inserted; w != g {
+		t.Errorf("Expected %d inserted, got %d", w, g)
+	}
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("Expected checkpoint file to be removed")
+	}
+
+	err = writeImportCheckpoint(checkpoint, lexFile, lexName, 2)
+	if err != nil {
+		t.Fatalf("Failed to write checkpoint : %v", err)
+	}
+	_, err = readImportCheckpoint(checkpoint, lexFile, "another_lexicon")
+	if err == nil {
+		t.Errorf("Expected error for checkpoint saved for another lexicon, got nil")
+	}
+
+	_, err = importLexiconFile(dbif, db, lexName, logger, lexFile, validator, ImportOptions{Checkpoint: checkpoint, DryRun: true})
+	if err == nil {
+		t.Errorf("Expected error for checkpoint with dry run, got nil")
+	}
+}
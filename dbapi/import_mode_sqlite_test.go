@@ -0,0 +1,182 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+	"github.com/stts-se/pronlex/validation"
+)
+
+func TestImportModesSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testImportModes(t, sqliteDBIF{}, db)
+}
+
+// testImportModes is shared between the sqlite and mariadb tests
+func testImportModes(t *testing.T, dbif DBIF, db *sql.DB) {
+	tmpDir := t.TempDir()
+
+	// strn, pos, morph, wordparts, lemma, paradigm, lang, four transcriptions with languages, status, source, preferred, tag, comments
+	wsLine := func(strn, trans string) string {
+		return strings.Join([]string{strn, "NN", "", strn, "", "", "SWE", trans, "SWE", "", "", "", "", "", "", "imported", "nst", "false", "", ""}, "\t")
+	}
+	writeFile := func(name string, lines ...string) string {
+		fn := filepath.Join(tmpDir, name)
+		err := os.WriteFile(fn, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+		if err != nil {
+			t.Fatalf("Failed to write file : %v", err)
+		}
+		return fn
+	}
+	initialFile := writeFile("initial.txt",
+		wsLine("bil", "\" b i: l"),
+		wsLine("rom", "\" r u m"),
+		wsLine("apa", "\" A: . p a"),
+	)
+	// bil is unchanged, rom is changed, kex is new, and apa is missing
+	correctedFile := writeFile("corrected.txt",
+		wsLine("bil", "\" b i: l"),
+		wsLine("rom", "\" r O m"),
+		wsLine("kex", "\" k E k s"),
+	)
+
+	logger := SilentLogger{}
+	validator := &validation.Validator{}
+
+	tests := []struct {
+		mode                                           ImportMode
+		inserted, updated, unchanged, skipped, deleted int
+		entries                                        int64
+		romTrans                                       string
+	}{
+		{ImportInsertOnly, 1, 0, 1, 1, 0, 4, "\" r u m"},
+		{ImportUpdateExisting, 0, 1, 1, 1, 0, 3, "\" r O m"},
+		{ImportUpsert, 1, 1, 1, 0, 0, 4, "\" r O m"},
+		{ImportReplaceLexicon, 1, 1, 1, 0, 1, 3, "\" r O m"},
+	}
+
+	for _, test := range tests {
+		l := lexicon{name: fmt.Sprintf("import_%s", test.mode), symbolSetName: "ZZ", locale: "ll"}
+		l, err := dbif.defineLexicon(db, l)
+		if err != nil {
+			t.Fatalf("Ooops! : %v", err)
+		}
+		lexName := lex.LexName(l.name)
+
+		res, err := importLexiconFile(dbif, db, lexName, logger, initialFile, validator, ImportOptions{})
+		if err != nil {
+			t.Fatalf("%s : failed to import : %v", test.mode, err)
+		}
+		if w, g := 3, res.Inserted; w != g {
+			t.Errorf("%s : expected %d inserted, got %d", test.mode, w, g)
+		}
+
+		// dry run first, the lexicon should be unchanged
+		dryRes, err := importLexiconFile(dbif, db, lexName, logger, correctedFile, validator, ImportOptions{Mode: test.mode, DryRun: true})
+		if err != nil {
+			t.Fatalf("%s : failed to import : %v", test.mode, err)
+		}
+		if w, g := test.inserted+test.updated+test.deleted, len(dryRes.Strns); w != g {
+			t.Errorf("%s : expected %d affected orthographies, got %d : %v", test.mode, w, g, dryRes.Strns)
+		}
+		n, err := dbif.entryCount(db, l.name)
+		if err != nil {
+			t.Fatalf("%s : failed to count entries : %v", test.mode, err)
+		}
+		if w, g := int64(3), n; w != g {
+			t.Errorf("%s : expected %d entries after dry run, got %d", test.mode, w, g)
+		}
+
+		for _, opts := range []ImportOptions{{Mode: test.mode, DryRun: true}, {Mode: test.mode}} {
+			res, err := importLexiconFile(dbif, db, lexName, logger, correctedFile, validator, opts)
+			if err != nil {
+				t.Fatalf("%s : failed to import : %v", test.mode, err)
+			}
+			got := []int{res.Inserted, res.Updated, res.Unchanged, res.Skipped, res.Deleted}
+			exp := []int{test.inserted, test.updated, test.unchanged, test.skipped, test.deleted}
+			if fmt.Sprintf("%v", exp) != fmt.Sprintf("%v", got) {
+				t.Errorf("%s (dry run: %v) : expected inserted/updated/unchanged/skipped/deleted %v, got %v", test.mode, opts.DryRun, exp, got)
+			}
+		}
+
+		n, err = dbif.entryCount(db, l.name)
+		if err != nil {
+			t.Fatalf("%s : failed to count entries : %v", test.mode, err)
+		}
+		if w, g := test.entries, n; w != g {
+			t.Errorf("%s : expected %d entries, got %d", test.mode, w, g)
+		}
+		var esw lex.EntrySliceWriter
+		err = dbif.lookUp(db, []lex.LexName{lexName}, Query{Words: []string{"rom"}}, &esw)
+		if err != nil {
+			t.Fatalf("%s : failed to look up entry : %v", test.mode, err)
+		}
+		if w, g := 1, len(esw.Entries); w != g {
+			t.Fatalf("%s : expected %d entries, got %d", test.mode, w, g)
+		}
+		if w, g := test.romTrans, esw.Entries[0].Transcriptions[0].Strn; w != g {
+			t.Errorf("%s : expected '%s', got '%s'", test.mode, w, g)
+		}
+
+		// importing the same file again changes nothing
+		res, err = importLexiconFile(dbif, db, lexName, logger, correctedFile, validator, ImportOptions{Mode: ImportUpsert})
+		if err != nil {
+			t.Fatalf("%s : failed to import : %v", test.mode, err)
+		}
+		if test.mode != ImportInsertOnly && test.mode != ImportUpdateExisting {
+			if w, g := 3, res.Unchanged; w != g {
+				t.Errorf("%s : expected %d unchanged, got %d", test.mode, w, g)
+			}
+		}
+	}
+
+	// A replace-lexicon import cannot skip lines with errors, since the entries of the skipped lines would be deleted
+	badFile := writeFile("bad.txt",
+		wsLine("bil", "\" b i: l"),
+		"rom\tNN",
+		wsLine("kex", "\" k E k s"),
+	)
+	replaceLex := lex.LexName(fmt.Sprintf("import_%s", ImportReplaceLexicon))
+	for _, opts := range []ImportOptions{{Mode: ImportReplaceLexicon, ContinueOnError: true}, {Mode: ImportReplaceLexicon, ContinueOnError: true, DryRun: true}} {
+		_, err := importLexiconFile(dbif, db, replaceLex, logger, badFile, validator, opts)
+		if err == nil {
+			t.Errorf("Expected error for %s import continuing on errors, got nil", ImportReplaceLexicon)
+		}
+	}
+	var esw lex.EntrySliceWriter
+	err := dbif.lookUp(db, []lex.LexName{replaceLex}, Query{Words: []string{"rom"}}, &esw)
+	if err != nil {
+		t.Fatalf("failed to look up entry : %v", err)
+	}
+	if w, g := 1, len(esw.Entries); w != g {
+		t.Errorf("expected %d entries, got %d", w, g)
+	}
+	// Without ContinueOnError, the import is aborted on the bad line, before deleting anything
+	_, err = importLexiconFile(dbif, db, replaceLex, logger, badFile, validator, ImportOptions{Mode: ImportReplaceLexicon})
+	if err == nil {
+		t.Errorf("Expected error for bad line, got nil")
+	}
+	n, err := dbif.entryCount(db, string(replaceLex))
+	if err != nil {
+		t.Fatalf("failed to count entries : %v", err)
+	}
+	if w, g := int64(3), n; w != g {
+		t.Errorf("expected %d entries, got %d", w, g)
+	}
+
+	l := lexicon{name: "import_invalid", symbolSetName: "ZZ", locale: "ll"}
+	l, err = dbif.defineLexicon(db, l)
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	_, err = importLexiconFile(dbif, db, lex.LexName(l.name), logger, initialFile, validator, ImportOptions{Mode: "no-such-mode"})
+	if err == nil {
+		t.Errorf("Expected error for invalid import mode, got nil")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,18 +18,259 @@ import (
 	"github.com/stts-se/pronlex/validation"
 )
 
+// ImportMode decides what to do with entries in an imported lexicon file that already exist in the lexicon. Entries are matched on orthography and tag, in the same way as in DiffLexicons.
+type ImportMode string
+
+const (
+	// ImportInsertOnly inserts entries not found in the lexicon, and skips existing entries
+	ImportInsertOnly ImportMode = "insert-only"
+	// ImportUpdateExisting updates existing entries, and skips entries not found in the lexicon
+	ImportUpdateExisting ImportMode = "update-existing"
+	// ImportUpsert updates existing entries, and inserts entries not found in the lexicon
+	ImportUpsert ImportMode = "upsert"
+	// ImportReplaceLexicon works as ImportUpsert, but also deletes the entries of the lexicon not found in the imported file
+	ImportReplaceLexicon ImportMode = "replace-lexicon"
+)
+
+// ImportModes lists the available import modes
+var ImportModes = []ImportMode{ImportInsertOnly, ImportUpdateExisting, ImportUpsert, ImportReplaceLexicon}
+
+// ParseImportMode returns the ImportMode with the input name
+func ParseImportMode(name string) (ImportMode, error) {
+	for _, m := range ImportModes {
+		if string(m) == name {
+			return m, nil
+		}
+	}
+	var names []string
+	for _, m := range ImportModes {
+		names = append(names, string(m))
+	}
+	return "", fmt.Errorf("invalid import mode '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// ImportOptions holds the options for ImportLexiconFile
+type ImportOptions struct {
+	// Mode is the import mode. The empty mode is interpreted as ImportInsertOnly.
+	Mode ImportMode
+	// DryRun runs the import inside a single transaction that is rolled back
+	DryRun bool
+	// AllOrNothing runs the import inside a single transaction, that is only committed if there are no errors
+	AllOrNothing bool
+	// ContinueOnError skips lines that cannot be imported, instead of aborting the import. The errors are listed in ImportResult.Errors. For imports in a single transaction (DryRun or AllOrNothing), database errors still abort the import. Cannot be combined with ImportReplaceLexicon, since the entries of skipped lines would be deleted.
+	ContinueOnError bool
+	// ErrorReport is the name of a file to which line errors are written (line number, error and raw line, tab separated)
+	ErrorReport string
+	// Checkpoint is the name of a file in which the last committed line number is saved after each batch. If the file exists when the import starts, the import is resumed after the saved line. The file is removed when the import has finished. Cannot be combined with DryRun or AllOrNothing.
+	Checkpoint string
+}
+
+// readImportCheckpoint returns the line number saved in the checkpoint file, or 0 if there is no such file. The checkpoint must have been saved for the same lexicon file and lexicon.
+func readImportCheckpoint(checkpointFile string, lexiconFileName string, lexiconName lex.LexName) (int, error) {
+	bts, err := os.ReadFile(filepath.Clean(checkpointFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read checkpoint file : %v", err)
+	}
+	fs := strings.Split(strings.TrimSpace(string(bts)), "\t")
+	if len(fs) != 3 {
+		return 0, fmt.Errorf("invalid checkpoint file %s, expected three tab separated fields, found %d", checkpointFile, len(fs))
+	}
+	if fs[0] != lexiconFileName || fs[1] != string(lexiconName) {
+		return 0, fmt.Errorf("checkpoint file %s was saved for lexicon file %s and lexicon %s", checkpointFile, fs[0], fs[1])
+	}
+	n, err := strconv.Atoi(fs[2])
+	if err != nil {
+		return 0, fmt.Errorf("invalid line number in checkpoint file %s : %v", checkpointFile, err)
+	}
+	return n, nil
+}
+
+// writeImportCheckpoint saves the lexicon file name, lexicon name and last committed line number to the checkpoint file
+func writeImportCheckpoint(checkpointFile string, lexiconFileName string, lexiconName lex.LexName, lineNumber int) error {
+	tmpFile := checkpointFile + ".tmp"
+	err := os.WriteFile(tmpFile, []byte(fmt.Sprintf("%s\t%s\t%d\n", lexiconFileName, lexiconName, lineNumber)), 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't write checkpoint file : %v", err)
+	}
+	return os.Rename(tmpFile, checkpointFile)
+}
+
+// importFields are the entry fields compared, and copied from the imported entry on update, when importing into a lexicon with existing entries
+var importFields = []string{"transcriptions", "partOfSpeech", "morphology", "wordParts", "language", "lemma", "preferred", "comments", "status"}
+
+// importEntryChanges lists the import fields that differ between an existing entry and an imported entry. Unlike entryDiffFields, a change of transcription order counts as a difference, since the first transcription is the primary one.
+func importEntryChanges(dbE lex.Entry, e lex.Entry) []FieldChange {
+	var res []FieldChange
+	for _, f := range importFields {
+		o := historyFieldValue(dbE, f)
+		n := historyFieldValue(e, f)
+		if o != n {
+			res = append(res, FieldChange{Field: f, OldValue: o, NewValue: n})
+		}
+	}
+	return res
+}
+
+// importEntriesTx imports a batch of entries according to the import mode, and adds the counts to res. The ids of existing entries matched by an earlier batch, and of entries inserted by an earlier batch, are kept in matched, so that they are not matched again. matched is only updated if the whole batch succeeds. If lookUpExisting is false, no existing entries are looked up (e.g., the lexicon was empty before the import).
+func importEntriesTx(dbif DBIF, tx *sql.Tx, l lexicon, es []lex.Entry, mode ImportMode, matched map[int64]bool, lookUpExisting bool, res *ImportResult) error {
+	var keys []string
+	srcMap := make(map[string][]lex.Entry)
+	wordSet := make(map[string]bool)
+	var words []string
+	for _, e := range es {
+		k := diffKey(e)
+		if _, ok := srcMap[k]; !ok {
+			keys = append(keys, k)
+		}
+		srcMap[k] = append(srcMap[k], e)
+		if !wordSet[e.Strn] {
+			wordSet[e.Strn] = true
+			words = append(words, e.Strn)
+		}
+	}
+
+	dbMap := make(map[string][]lex.Entry)
+	if lookUpExisting && len(words) > 0 {
+		var esw lex.EntrySliceWriter
+		err := dbif.lookUpTx(tx, []lex.LexName{lex.LexName(l.name)}, Query{Words: words}, &esw)
+		if err != nil {
+			return fmt.Errorf("failed to look up existing entries : %v", err)
+		}
+		for _, e := range esw.Entries {
+			if matched[e.ID] {
+				continue
+			}
+			k := diffKey(e)
+			dbMap[k] = append(dbMap[k], e)
+		}
+	}
+
+	var newEntries []lex.Entry
+	var newMatched []int64
+	for _, k := range keys {
+		pairs, srcOnly, _ := pairEntries(srcMap[k], dbMap[k], importFields)
+		for _, e := range srcOnly {
+			if mode == ImportUpdateExisting {
+				res.Skipped++
+				continue
+			}
+			newEntries = append(newEntries, e)
+		}
+		for _, p := range pairs {
+			e, dbE := p[0], p[1]
+			newMatched = append(newMatched, dbE.ID)
+			if len(importEntryChanges(dbE, e)) == 0 {
+				res.Unchanged++
+				continue
+			}
+			if mode == ImportInsertOnly {
+				res.Skipped++
+				continue
+			}
+			upd := copyEntryFields(dbE, e, importFields)
+			if e.EntryValidations != nil {
+				upd.EntryValidations = e.EntryValidations
+			}
+			upd.Revision = 0
+			_, err := dbif.updateEntryTx(tx, upd, false)
+			if err != nil {
+				return fmt.Errorf("failed to update entry id '%d' : %v", dbE.ID, err)
+			}
+			res.Updated++
+			if res.DryRun {
+				res.Strns = append(res.Strns, e.Strn)
+			}
+		}
+	}
+
+	if len(newEntries) > 0 {
+		ids, err := dbif.insertEntriesTx(tx, l, newEntries)
+		if err != nil {
+			return err
+		}
+		newMatched = append(newMatched, ids...)
+		res.Inserted += len(newEntries)
+		if res.DryRun {
+			for _, e := range newEntries {
+				res.Strns = append(res.Strns, e.Strn)
+			}
+		}
+	}
+	for _, id := range newMatched {
+		matched[id] = true
+	}
+	return nil
+}
+
+// deleteUnmatchedEntriesTx deletes the entries of the lexicon whose ids are not in matched, and records the deletions in the entry history. Used by ImportReplaceLexicon.
+func deleteUnmatchedEntriesTx(dbif DBIF, tx *sql.Tx, l lexicon, matched map[int64]bool, res *ImportResult) error {
+	ids, err := dbif.lookUpIdsTx(tx, []lex.LexName{lex.LexName(l.name)}, Query{})
+	if err != nil {
+		return fmt.Errorf("failed to list entry ids : %v", err)
+	}
+	for _, id := range ids {
+		if matched[id] {
+			continue
+		}
+		if res.DryRun {
+			var esw lex.EntrySliceWriter
+			err = dbif.lookUpTx(tx, []lex.LexName{lex.LexName(l.name)}, Query{EntryIDs: []int64{id}}, &esw)
+			if err != nil {
+				return fmt.Errorf("failed to look up entry id '%d' : %v", id, err)
+			}
+			for _, e := range esw.Entries {
+				res.Strns = append(res.Strns, e.Strn)
+			}
+		}
+		err = recordEntryDeleteTx(dbif, tx, l.name, id, "")
+		if err != nil {
+			return fmt.Errorf("failed to record history for entry id '%d' : %v", id, err)
+		}
+		_, err = tx.Exec("DELETE FROM Entry WHERE id = ? AND lexiconId = ?", id, l.id)
+		if err != nil {
+			return fmt.Errorf("failed to delete entry id '%d' : %v", id, err)
+		}
+		res.Deleted++
+	}
+	return nil
+}
+
 // ImportSqliteLexiconFile is intended for 'clean' imports. It doesn't check whether the words already exist and so on. It does not do any sanity checks whatsoever of the transcriptions before they are added. If the validator parameter is initialized, each entry will be validated before import, and the validation result will be added to the db.
 func ImportSqliteLexiconFile(db *sql.DB, lexiconName lex.LexName, logger Logger, lexiconFileName string, validator *validation.Validator) error {
-	return importLexiconFile(sqliteDBIF{}, db, lexiconName, logger, lexiconFileName, validator)
+	_, err := importLexiconFile(sqliteDBIF{}, db, lexiconName, logger, lexiconFileName, validator, ImportOptions{})
+	return err
 }
 
 // ImportMariDBLexiconFile is intended for 'clean' imports. It doesn't check whether the words already exist and so on. It does not do any sanity checks whatsoever of the transcriptions before they are added. If the validator parameter is initialized, each entry will be validated before import, and the validation result will be added to the db.
 func ImportMariaDBLexiconFile(db *sql.DB, lexiconName lex.LexName, logger Logger, lexiconFileName string, validator *validation.Validator) error {
-	return importLexiconFile(mariaDBIF{}, db, lexiconName, logger, lexiconFileName, validator)
+	_, err := importLexiconFile(mariaDBIF{}, db, lexiconName, logger, lexiconFileName, validator, ImportOptions{})
+	return err
 }
 
-// importLexiconFile is intended for 'clean' imports. It doesn't check whether the words already exist and so on. It does not do any sanity checks whatsoever of the transcriptions before they are added. If the validator parameter is initialized, each entry will be validated before import, and the validation result will be added to the db.
-func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Logger, lexiconFileName string, validator *validation.Validator) error {
+// importLexiconFile imports a lexicon file into a lexicon. Entries already existing in the lexicon (matched on orthography and tag) are handled according to the import mode (see ImportMode). It does not do any sanity checks whatsoever of the transcriptions before they are added. If the validator parameter is initialized, each entry will be validated before import, and the validation result will be added to the db.
+// Each batch of entries is imported in a separate transaction, unless the AllOrNothing option is set. For dry runs, all entries are imported in a single transaction that is rolled back, and the result also contains the orthographies of the would-be affected entries, and the validation stats of the lexicon as it would look after the import.
+// By default, the import is aborted on the first line that cannot be imported. See ImportOptions for how to continue on errors, and how to resume an interrupted import.
+func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Logger, lexiconFileName string, validator *validation.Validator, opts ImportOptions) (ImportResult, error) {
+	dryRun := opts.DryRun
+	singleTx := dryRun || opts.AllOrNothing
+	mode := opts.Mode
+	if mode == "" {
+		mode = ImportInsertOnly
+	}
+	res := ImportResult{DryRun: dryRun, Mode: mode}
+	if _, err := ParseImportMode(string(mode)); err != nil {
+		return res, fmt.Errorf("ImportLexiconFile : %v", err)
+	}
+	if opts.Checkpoint != "" && singleTx {
+		return res, fmt.Errorf("ImportLexiconFile : a checkpoint cannot be used for dry runs or all-or-nothing imports")
+	}
+	// the existing entry of a skipped line is never matched, and would be deleted as missing from the lexicon file
+	if opts.ContinueOnError && mode == ImportReplaceLexicon {
+		return res, fmt.Errorf("ImportLexiconFile : an import with mode %s cannot continue on errors", mode)
+	}
 
 	logger.Write(fmt.Sprintf("lexiconName: %v", lexiconName))
 	logger.Write(fmt.Sprintf("lexiconFileName: %v", lexiconFileName))
@@ -37,7 +279,7 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 	if _, err := os.Stat(lexiconFileName); os.IsNotExist(err) {
 		var msg = fmt.Sprintf("ImportLexiconFile failed to open file : %v", err)
 		logger.Write(msg)
-		return fmt.Errorf("%v", msg)
+		return res, fmt.Errorf("%v", msg)
 	}
 
 	// TODO sanitise lexiconFileName
@@ -45,7 +287,7 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 	if err != nil {
 		var msg = fmt.Sprintf("ImportLexiconFile failed to open file : %v", err)
 		logger.Write(msg)
-		return fmt.Errorf("%v", msg)
+		return res, fmt.Errorf("%v", msg)
 	}
 	/* #nosec G307 */
 	defer fh.Close()
@@ -56,7 +298,7 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 		if err != nil {
 			var msg = fmt.Sprintf("ImportLexiconFile failed to open gz reader : %v", err)
 			logger.Write(msg)
-			return fmt.Errorf("%v", msg)
+			return res, fmt.Errorf("%v", msg)
 		}
 		s = bufio.NewScanner(gz)
 	} else {
@@ -67,14 +309,150 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 	if err != nil {
 		var msg = fmt.Sprintf("ImportLexiconFile failed to instantiate lexicon line parser : %v", err)
 		logger.Write(msg)
-		return fmt.Errorf("%v", msg)
+		return res, fmt.Errorf("%v", msg)
 	}
 
 	lexicon, err := dbif.getLexicon(db, string(lexiconName))
 	if err != nil {
 		var msg = fmt.Sprintf("ImportLexiconFile failed to get lexicon id for lexicon: %s : %v", lexiconName, err)
 		logger.Write(msg)
-		return fmt.Errorf("%v", msg)
+		return res, fmt.Errorf("%v", msg)
+	}
+
+	if opts.Checkpoint != "" {
+		res.ResumedAfterLine, err = readImportCheckpoint(opts.Checkpoint, lexiconFileName, lexiconName)
+		if err != nil {
+			var msg = fmt.Sprintf("ImportLexiconFile : %v", err)
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
+		// the entries matched before the interruption are unknown, so unmatched entries cannot be deleted
+		if res.ResumedAfterLine > 0 && mode == ImportReplaceLexicon {
+			return res, fmt.Errorf("ImportLexiconFile : an import with mode %s cannot be resumed", mode)
+		}
+		if res.ResumedAfterLine > 0 {
+			logger.Write(fmt.Sprintf("Resuming import after line %d", res.ResumedAfterLine))
+		}
+	}
+
+	var report *bufio.Writer
+	if opts.ErrorReport != "" {
+		fh, err := os.Create(filepath.Clean(opts.ErrorReport))
+		if err != nil {
+			var msg = fmt.Sprintf("ImportLexiconFile failed to create error report file : %v", err)
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
+		/* #nosec G307 */
+		defer fh.Close()
+		report = bufio.NewWriter(fh)
+		defer report.Flush()
+	}
+
+	// lineError records an error for a line, and returns an error unless the import should continue
+	lineError := func(lineNumber int, l string, err error) error {
+		res.Errors = append(res.Errors, ImportLineError{LineNumber: lineNumber, Line: l, Error: err.Error()})
+		if report != nil {
+			fmt.Fprintf(report, "%d\t%v\t%s\n", lineNumber, err, l)
+		}
+		var msg = fmt.Sprintf("line %d : %v", lineNumber, err)
+		logger.Write(msg)
+		if !opts.ContinueOnError {
+			return fmt.Errorf("%v", msg)
+		}
+		return nil
+	}
+
+	// existing entries are only looked up if the lexicon was non-empty before the import
+	nExisting, err := dbif.entryCount(db, string(lexiconName))
+	if err != nil {
+		var msg = fmt.Sprintf("ImportLexiconFile failed to count entries in lexicon: %s : %v", lexiconName, err)
+		logger.Write(msg)
+		return res, fmt.Errorf("%v", msg)
+	}
+	var matched = make(map[int64]bool)
+
+	// inTx runs f in a new transaction, unless everything is run in a single transaction (dry runs and all-or-nothing imports)
+	var tx *sql.Tx
+	if singleTx {
+		tx, err = db.Begin()
+		if err != nil {
+			var msg = fmt.Sprintf("ImportLexiconFile failed to start db transaction : %v", err)
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
+		// insertEntriesTx rolls back on some errors, in which case this rollback is a no-op
+		defer tx.Rollback()
+	}
+	if dryRun {
+		res.Strns = []string{}
+	}
+	inTx := func(f func(tx *sql.Tx) error) error {
+		if singleTx {
+			return f(tx)
+		}
+		btx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to start db transaction : %v", err)
+		}
+		err = f(btx)
+		if err != nil {
+			msg := fmt.Sprintf("%v", err)
+			err2 := btx.Rollback()
+			if err2 != nil && err2 != sql.ErrTxDone {
+				msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+			}
+			return fmt.Errorf(msg)
+		}
+		return btx.Commit()
+	}
+	importEntries := func(es []lex.Entry) error {
+		saved := res
+		err := inTx(func(tx *sql.Tx) error {
+			return importEntriesTx(dbif, tx, lexicon, es, mode, matched, nExisting > 0 || res.ResumedAfterLine > 0, &res)
+		})
+		if err != nil {
+			res = saved
+		}
+		return err
+	}
+
+	// the buffered entries, with line numbers and raw lines for error reporting
+	var eBuf []lex.Entry
+	var eLineNumbers []int
+	var eLines []string
+	var lineNumber = 0
+	var nFailed = 0
+
+	// flush imports the buffered entries. If the batch fails, and the import should continue on errors, the entries are imported one by one, to find the failing lines.
+	flush := func() error {
+		defer func() {
+			eBuf = make([]lex.Entry, 0)
+			eLineNumbers = make([]int, 0)
+			eLines = make([]string, 0)
+		}()
+		if len(eBuf) > 0 {
+			err := importEntries(eBuf)
+			if err != nil && (singleTx || !opts.ContinueOnError) {
+				return fmt.Errorf("failed to import entries : %v", err)
+			}
+			if err != nil {
+				for i, e := range eBuf {
+					err := importEntries([]lex.Entry{e})
+					if err != nil {
+						nFailed++
+						_ = lineError(eLineNumbers[i], eLines[i], err)
+					}
+				}
+			}
+		}
+		if opts.Checkpoint != "" {
+			err := writeImportCheckpoint(opts.Checkpoint, lexiconFileName, lexiconName, lineNumber)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
 	msg := fmt.Sprintf("Trying to load file: %s", lexiconFileName)
@@ -83,16 +461,16 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 	var nImported = 0
 	var nSkippedDups = 0
 	var nTotal = 0
-	var eBuf []lex.Entry
 	var readLines = make(map[string]bool)
 	var readEntries = make(map[string]bool)
 	for s.Scan() {
 		if err := s.Err(); err != nil {
 			var msg = fmt.Sprintf("error when reading lines from lexicon file : %v", err)
 			logger.Write(msg)
-			return fmt.Errorf("%v", msg)
+			return res, fmt.Errorf("%v", msg)
 		}
 		l := s.Text()
+		lineNumber++
 
 		if strings.HasPrefix(l, "#") {
 			continue
@@ -100,6 +478,10 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 		if l == "" {
 			continue
 		}
+		if lineNumber <= res.ResumedAfterLine {
+			readLines[l] = true
+			continue
+		}
 
 		nTotal++
 		if _, ok := readLines[l]; ok {
@@ -108,18 +490,22 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 			//logger.Write(msg)
 			continue
 		}
+		readLines[l] = true
 		e, err := wsFmt.ParseToEntry(l)
 		if err != nil {
-			var msg = fmt.Sprintf("couldn't parse line to entry : %v", err)
-			logger.Write(msg)
-			return fmt.Errorf("%v", msg)
+			err = lineError(lineNumber, l, fmt.Errorf("couldn't parse line to entry : %v", err))
+			if err != nil {
+				return res, err
+			}
+			continue
 		}
-		readLines[l] = true
 		eToString, err := wsFmt.Entry2String(e)
 		if err != nil {
-			var msg = fmt.Sprintf("couldn't convert entry to string : %v", err)
-			logger.Write(msg)
-			return fmt.Errorf("%v", msg)
+			err = lineError(lineNumber, l, fmt.Errorf("couldn't convert entry to string : %v", err))
+			if err != nil {
+				return res, err
+			}
+			continue
 		}
 		if _, ok := readEntries[eToString]; ok {
 			//var msg = fmt.Sprintf("Skipping duplicate input entry : %v", e)
@@ -135,33 +521,50 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 		}
 
 		eBuf = append(eBuf, e)
+		eLineNumbers = append(eLineNumbers, lineNumber)
+		eLines = append(eLines, l)
 		if nTotal%1000 == 0 {
-			_, err = dbif.insertEntries(db, lexicon, eBuf)
+			nImported = nImported + len(eBuf)
+			err = flush()
 			if err != nil {
-				var msg = fmt.Sprintf("ImportLexiconFile failed to insert entries : %v", err)
+				var msg = fmt.Sprintf("ImportLexiconFile %v", err)
 				logger.Write(msg)
-				return fmt.Errorf("%v", msg)
+				return res, fmt.Errorf("%v", msg)
 			}
-			nImported = nImported + len(eBuf)
 			msg2 := fmt.Sprintf("ImportLexiconFile: Inserted entries (total lines imported: %d)", nImported)
 			logger.Progress(msg2)
-			eBuf = make([]lex.Entry, 0)
 		}
 		if logger.LogInterval() > 0 && nTotal%logger.LogInterval() == 0 {
 			msg2 := fmt.Sprintf("ImportLexiconFile: Lines read: %d                         ", nTotal)
 			logger.Progress(msg2)
 		}
 	}
-	_, err = dbif.insertEntries(db, lexicon, eBuf) // flushing the buffer
+	if err := s.Err(); err != nil {
+		var msg = fmt.Sprintf("error when reading lines from lexicon file : %v", err)
+		logger.Write(msg)
+		return res, fmt.Errorf("%v", msg)
+	}
+	nImported = nImported + len(eBuf)
+	err = flush() // flushing the buffer
 	if err != nil {
-		var msg = fmt.Sprintf("ImportLexiconFile failed to insert entries : %v", err)
+		var msg = fmt.Sprintf("ImportLexiconFile %v", err)
 		logger.Write(msg)
-		return fmt.Errorf("%v", msg)
+		return res, fmt.Errorf("%v", msg)
 	} // else
-	nImported = nImported + len(eBuf)
 	msg2 := fmt.Sprintf("ImportLexiconFile: Inserted entries (total lines imported: %d)", nImported)
 	logger.Write(msg2)
 
+	if mode == ImportReplaceLexicon {
+		err = inTx(func(tx *sql.Tx) error {
+			return deleteUnmatchedEntriesTx(dbif, tx, lexicon, matched, &res)
+		})
+		if err != nil {
+			var msg = fmt.Sprintf("ImportLexiconFile failed to delete entries not found in the lexicon file : %v", err)
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
+	}
+
 	logger.Write("Finalizing import ... ")
 
 	// An administrator could call analyze but it's not part of the import function... So I'm removing this 2020-04-16 /HL
@@ -171,24 +574,62 @@ func importLexiconFile(dbif DBIF, db *sql.DB, lexiconName lex.LexName, logger Lo
 	// 	if err != nil {
 	// 		var msg = fmt.Sprintf("failed to exec analyze cmd to db : %v", err)
 	// 		logger.Write(msg)
-	// 		return fmt.Errorf("%v", msg)
+	// 		return res, fmt.Errorf("%v", msg)
 	// 	}
 	// }
 
 	msg3 := fmt.Sprintf("Lines read:      %d", nTotal)
 	logger.Write(msg3)
-	msg3 = fmt.Sprintf("Lines imported:  %d", nImported)
+	msg3 = fmt.Sprintf("Lines imported:  %d", nImported-nFailed)
 	logger.Write(msg3)
 	msg3 = fmt.Sprintf("Lines skipped:   %d (duplicates)", nSkippedDups)
 	logger.Write(msg3)
+	msg3 = fmt.Sprintf("Lines failed:    %d", len(res.Errors))
+	logger.Write(msg3)
+	msg3 = fmt.Sprintf("Import mode:     %s (inserted: %d, updated: %d, unchanged: %d, skipped: %d, deleted: %d)", mode, res.Inserted, res.Updated, res.Unchanged, res.Skipped, res.Deleted)
+	logger.Write(msg3)
 
-	if err := s.Err(); err != nil {
-		msg4 := fmt.Sprintf("ImportLexiconFile failed to instantiate lexicon line parser : %v", err)
-		logger.Write(msg4)
-		return fmt.Errorf("%v", msg4)
+	res.Read = nTotal
+	res.SkippedDuplicates = nSkippedDups
+	if dryRun {
+		stats, err := dbif.validationStatsTx(tx, lexicon.id)
+		if err != nil {
+			var msg = fmt.Sprintf("ImportLexiconFile failed to get validation stats : %v", err)
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
+		res.ValidationStats = &stats
+		err = tx.Rollback()
+		if err != nil {
+			var msg = fmt.Sprintf("ImportLexiconFile dry run failed to roll back : %v", err)
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
+		logger.Write("Dry run: the import was rolled back")
+	} else if opts.AllOrNothing {
+		if len(res.Errors) > 0 {
+			var msg = fmt.Sprintf("ImportLexiconFile found %d lines that could not be imported, nothing was imported", len(res.Errors))
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
+		err = tx.Commit()
+		if err != nil {
+			var msg = fmt.Sprintf("ImportLexiconFile failed to commit : %v", err)
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
 	}
 
-	return nil
+	if opts.Checkpoint != "" {
+		err = os.Remove(opts.Checkpoint)
+		if err != nil && !os.IsNotExist(err) {
+			var msg = fmt.Sprintf("ImportLexiconFile failed to remove checkpoint file : %v", err)
+			logger.Write(msg)
+			return res, fmt.Errorf("%v", msg)
+		}
+	}
+
+	return res, nil
 }
 
 // PrintMode specified the type of output to print (all/valid/invalid)
@@ -0,0 +1,158 @@
+package dbapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// diffFields are the entry fields compared by diffEntries, in output order
+var diffFields = []string{"transcriptions", "partOfSpeech", "morphology", "lemma", "status"}
+
+// diffKey is the key used to match entries between two lexicons
+func diffKey(e lex.Entry) string {
+	return e.Strn + "\t" + e.Tag
+}
+
+// diffFieldValue returns a string representation of the named entry field. Transcriptions are sorted, so that a change of transcription order is not reported as a difference.
+func diffFieldValue(e lex.Entry, field string) string {
+	if field == "transcriptions" {
+		var ts []string
+		for _, t := range e.Transcriptions {
+			ts = append(ts, t.Strn)
+		}
+		sort.Strings(ts)
+		return strings.Join(ts, " | ")
+	}
+	return historyFieldValue(e, field)
+}
+
+// entryDiffFields lists the named fields that differ between two entries
+func entryDiffFields(from lex.Entry, to lex.Entry, fields []string) []FieldChange {
+	var res []FieldChange
+	for _, f := range fields {
+		o := diffFieldValue(from, f)
+		n := diffFieldValue(to, f)
+		if o != n {
+			res = append(res, FieldChange{Field: f, OldValue: o, NewValue: n})
+		}
+	}
+	return res
+}
+
+// pairEntries pairs entries sharing the same key. Identical entries (compared on the named fields) are paired first, and the remaining entries are paired with the entry with the fewest differing fields. The unpaired entries are returned as removed (only in from) and added (only in to).
+func pairEntries(from []lex.Entry, to []lex.Entry, fields []string) (pairs [][2]lex.Entry, removed []lex.Entry, added []lex.Entry) {
+	used := make([]bool, len(to))
+	paired := make([]bool, len(from))
+	for _, exactOnly := range []bool{true, false} {
+		for i, f := range from {
+			if paired[i] {
+				continue
+			}
+			best := -1
+			bestN := 0
+			for j, t := range to {
+				if used[j] {
+					continue
+				}
+				n := len(entryDiffFields(f, t, fields))
+				if exactOnly && n > 0 {
+					continue
+				}
+				if best < 0 || n < bestN {
+					best = j
+					bestN = n
+				}
+			}
+			if best >= 0 {
+				used[best] = true
+				paired[i] = true
+				pairs = append(pairs, [2]lex.Entry{f, to[best]})
+			}
+		}
+	}
+	for i, f := range from {
+		if !paired[i] {
+			removed = append(removed, f)
+		}
+	}
+	for j, t := range to {
+		if !used[j] {
+			added = append(added, t)
+		}
+	}
+	return pairs, removed, added
+}
+
+// diffEntries compares two sets of entries, keyed on Entry.Strn and Entry.Tag. If more than one entry shares the same key (e.g., untagged homographs), the entries are paired using pairEntries. The result is sorted by key.
+func diffEntries(from []lex.Entry, to []lex.Entry) LexiconDiff {
+	res := LexiconDiff{Added: []lex.Entry{}, Removed: []lex.Entry{}, Changed: []EntryDiff{}}
+
+	fromMap := make(map[string][]lex.Entry)
+	toMap := make(map[string][]lex.Entry)
+	var keys []string
+	for _, e := range from {
+		k := diffKey(e)
+		if _, ok := fromMap[k]; !ok {
+			keys = append(keys, k)
+		}
+		fromMap[k] = append(fromMap[k], e)
+	}
+	for _, e := range to {
+		k := diffKey(e)
+		_, inFrom := fromMap[k]
+		_, inTo := toMap[k]
+		if !inFrom && !inTo {
+			keys = append(keys, k)
+		}
+		toMap[k] = append(toMap[k], e)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		pairs, removed, added := pairEntries(fromMap[k], toMap[k], diffFields)
+		res.Removed = append(res.Removed, removed...)
+		res.Added = append(res.Added, added...)
+		for _, p := range pairs {
+			changes := entryDiffFields(p[0], p[1], diffFields)
+			if len(changes) > 0 {
+				res.Changed = append(res.Changed, EntryDiff{
+					Strn:    p[0].Strn,
+					Tag:     p[0].Tag,
+					FromID:  p[0].ID,
+					ToID:    p[1].ID,
+					Changes: changes,
+				})
+			}
+		}
+	}
+
+	return res
+}
+
+// String returns a line based text representation of the diff: added entries prefixed by '+', removed entries by '-', and changed entries by '~', followed by one line per changed field
+func (d LexiconDiff) String() string {
+	var res []string
+	keyString := func(strn, tag string) string {
+		if tag == "" {
+			return strn
+		}
+		return fmt.Sprintf("%s [%s]", strn, tag)
+	}
+	for _, e := range d.Removed {
+		res = append(res, fmt.Sprintf("- %s\t%s", keyString(e.Strn, e.Tag), diffFieldValue(e, "transcriptions")))
+	}
+	for _, e := range d.Added {
+		res = append(res, fmt.Sprintf("+ %s\t%s", keyString(e.Strn, e.Tag), diffFieldValue(e, "transcriptions")))
+	}
+	for _, c := range d.Changed {
+		res = append(res, fmt.Sprintf("~ %s", keyString(c.Strn, c.Tag)))
+		for _, fc := range c.Changes {
+			res = append(res, fmt.Sprintf("\t%s: %s -> %s", fc.Field, fc.OldValue, fc.NewValue))
+		}
+	}
+	res = append(res, fmt.Sprintf("added: %d, removed: %d, changed: %d", len(d.Added), len(d.Removed), len(d.Changed)))
+	return strings.Join(res, "\n")
+}
@@ -0,0 +1,119 @@
+package dbapi
+
+import (
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestDiffEntries(t *testing.T) {
+	ts := func(strns ...string) []lex.Transcription {
+		var res []lex.Transcription
+		for _, s := range strns {
+			res = append(res, lex.Transcription{Strn: s, Language: "sv"})
+		}
+		return res
+	}
+
+	from := []lex.Entry{
+		{ID: 1, Strn: "rom", Tag: "drink", PartOfSpeech: "NN", Transcriptions: ts("\" r O m")},
+		{ID: 2, Strn: "rom", Tag: "city", PartOfSpeech: "PM", Transcriptions: ts("\" r u m")},
+		{ID: 3, Strn: "bil", PartOfSpeech: "NN", Transcriptions: ts("\" b i: l", "\" b I l")},
+		{ID: 4, Strn: "dom", PartOfSpeech: "NN", Transcriptions: ts("\" d o: m")},
+		{ID: 5, Strn: "dom", PartOfSpeech: "NN", Transcriptions: ts("\" d u: m")},
+	}
+	to := []lex.Entry{
+		// changed part of speech and status
+		{ID: 11, Strn: "rom", Tag: "drink", PartOfSpeech: "NN", Morphology: "UTR", Transcriptions: ts("\" r O m"), EntryStatus: lex.EntryStatus{Name: "ok", Source: "editor"}},
+		// changed transcription order only
+		{ID: 13, Strn: "bil", PartOfSpeech: "NN", Transcriptions: ts("\" b I l", "\" b i: l")},
+		// one of two untagged homographs removed
+		{ID: 14, Strn: "dom", PartOfSpeech: "NN", Transcriptions: ts("\" d o: m")},
+		// added
+		{ID: 16, Strn: "apa", PartOfSpeech: "NN", Transcriptions: ts("\" A: . p a")},
+	}
+
+	diff := diffEntries(from, to)
+
+	if w, g := 1, len(diff.Added); w != g {
+		t.Fatalf("Expected %d added entries, got %d", w, g)
+	}
+	if w, g := int64(16), diff.Added[0].ID; w != g {
+		t.Errorf("Expected added entry id %d, got %d", w, g)
+	}
+
+	if w, g := 2, len(diff.Removed); w != g {
+		t.Fatalf("Expected %d removed entries, got %d", w, g)
+	}
+	if w, g := int64(5), diff.Removed[0].ID; w != g {
+		t.Errorf("Expected removed entry id %d, got %d", w, g)
+	}
+	if w, g := int64(2), diff.Removed[1].ID; w != g {
+		t.Errorf("Expected removed entry id %d, got %d", w, g)
+	}
+
+	if w, g := 1, len(diff.Changed); w != g {
+		t.Fatalf("Expected %d changed entries, got %d", w, g)
+	}
+	c := diff.Changed[0]
+	if w, g := "rom", c.Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "drink", c.Tag; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := int64(1), c.FromID; w != g {
+		t.Errorf("Expected %d, got %d", w, g)
+	}
+	if w, g := int64(11), c.ToID; w != g {
+		t.Errorf("Expected %d, got %d", w, g)
+	}
+	expChanges := []FieldChange{
+		{Field: "morphology", OldValue: "", NewValue: "UTR"},
+		{Field: "status", OldValue: "", NewValue: "ok (editor)"},
+	}
+	if w, g := len(expChanges), len(c.Changes); w != g {
+		t.Fatalf("Expected %d changes, got %d : %v", w, g, c.Changes)
+	}
+	for i, w := range expChanges {
+		if g := c.Changes[i]; w != g {
+			t.Errorf("Expected %v, got %v", w, g)
+		}
+	}
+
+	expString := `- dom	" d u: m
+- rom [city]	" r u m
++ apa	" A: . p a
+~ rom [drink]
+	morphology:  -> UTR
+	status:  -> ok (editor)
+added: 1, removed: 2, changed: 1`
+	if w, g := expString, diff.String(); w != g {
+		t.Errorf("Expected:\n%s\nGot:\n%s", w, g)
+	}
+
+	// A changed homograph should not affect the pairing of the other homographs
+	homs := []lex.Entry{
+		{ID: 1, Strn: "dom", PartOfSpeech: "PM", Transcriptions: ts("\" d O m")},
+		{ID: 2, Strn: "dom", PartOfSpeech: "NN", Transcriptions: ts("\" d o: m")},
+		{ID: 3, Strn: "dom", PartOfSpeech: "NN", Transcriptions: ts("\" d u: m")},
+	}
+	homs2 := []lex.Entry{homs[0], homs[1], homs[2]}
+	homs2[1].Transcriptions = ts("\" d U m")
+	diff = diffEntries(homs, homs2)
+	if w, g := 0, len(diff.Added)+len(diff.Removed); w != g {
+		t.Errorf("Expected %d added/removed entries, got %d", w, g)
+	}
+	if w, g := 1, len(diff.Changed); w != g {
+		t.Fatalf("Expected %d changed entries, got %d", w, g)
+	}
+	if w, g := (FieldChange{Field: "transcriptions", OldValue: "\" d o: m", NewValue: "\" d U m"}), diff.Changed[0].Changes[0]; w != g {
+		t.Errorf("Expected %v, got %v", w, g)
+	}
+
+	// No differences
+	diff = diffEntries(from, from)
+	if w, g := 0, len(diff.Added)+len(diff.Removed)+len(diff.Changed); w != g {
+		t.Errorf("Expected %d differences, got %d", w, g)
+	}
+}
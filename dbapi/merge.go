@@ -0,0 +1,275 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// MergeStrategy decides what to do when an entry in the source lexicon of a merge differs from the matching entry in the target lexicon. Entries are matched on orthography and tag, in the same way as in DiffLexicons.
+type MergeStrategy string
+
+const (
+	// MergeKeepTarget keeps the target entry as is
+	MergeKeepTarget MergeStrategy = "keep-target"
+	// MergePreferSource replaces the transcriptions, part of speech, morphology and lemma of the target entry with those of the source entry
+	MergePreferSource MergeStrategy = "prefer-source"
+	// MergePreferNewerStatus replaces the target entry fields (as MergePreferSource) if the source entry status is newer than the target entry status
+	MergePreferNewerStatus MergeStrategy = "prefer-newer-status"
+	// MergeTranscriptionsAsVariants appends the source entry transcriptions not found in the target entry, as transcription variants
+	MergeTranscriptionsAsVariants MergeStrategy = "merge-transcriptions-as-variants"
+	// MergeFlagConflicts keeps the target entry fields, but adds a comment listing the differences
+	MergeFlagConflicts MergeStrategy = "flag-conflicts-with-comment"
+)
+
+// MergeStrategies lists the available merge strategies
+var MergeStrategies = []MergeStrategy{MergeKeepTarget, MergePreferSource, MergePreferNewerStatus, MergeTranscriptionsAsVariants, MergeFlagConflicts}
+
+// ParseMergeStrategy returns the MergeStrategy with the input name
+func ParseMergeStrategy(name string) (MergeStrategy, error) {
+	for _, s := range MergeStrategies {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	var names []string
+	for _, s := range MergeStrategies {
+		names = append(names, string(s))
+	}
+	return "", fmt.Errorf("invalid merge strategy '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// Actions reported in the MergeResult, per source entry
+const (
+	mergeActionAdded     = "added"
+	mergeActionUpdated   = "updated"
+	mergeActionFlagged   = "flagged"
+	mergeActionKept      = "kept"
+	mergeActionUnchanged = "unchanged"
+)
+
+// mergeCommentLabel is the comment label used by MergeFlagConflicts
+const mergeCommentLabel = "merge conflict"
+
+// mergeFields are the entry fields compared when merging, and copied from the source entry on update
+var mergeFields = []string{"transcriptions", "partOfSpeech", "morphology", "lemma"}
+
+// newEntryForInsert returns a copy of e without database ids, that can be inserted into another lexicon. The entry status source is set to source, and validations are left out, since they belong to the validation of the source lexicon.
+func newEntryForInsert(e lex.Entry, source string) lex.Entry {
+	res := e
+	res.ID = 0
+	res.LexRef = lex.LexRef{}
+	res.Revision = 0
+	res.Lemma.ID = 0
+	res.Transcriptions = make([]lex.Transcription, len(e.Transcriptions))
+	for i, t := range e.Transcriptions {
+		t.ID = 0
+		t.EntryID = 0
+		res.Transcriptions[i] = t
+	}
+	res.Comments = make([]lex.EntryComment, len(e.Comments))
+	for i, c := range e.Comments {
+		c.ID = 0
+		c.EntryID = 0
+		res.Comments[i] = c
+	}
+	res.EntryStatus = lex.EntryStatus{Name: e.EntryStatus.Name, Source: source}
+	res.EntryValidations = nil
+	return res
+}
+
+// mergeVariants appends the transcriptions of src not found in dst (compared on transcription string)
+func mergeVariants(dst lex.Entry, src lex.Entry) (lex.Entry, bool) {
+	e := dst
+	seen := make(map[string]bool)
+	for _, t := range dst.Transcriptions {
+		seen[t.Strn] = true
+	}
+	var added bool
+	for _, t := range src.Transcriptions {
+		if seen[t.Strn] {
+			continue
+		}
+		if !added {
+			e.Transcriptions = append([]lex.Transcription{}, dst.Transcriptions...)
+			added = true
+		}
+		e.Transcriptions = append(e.Transcriptions, lex.Transcription{Strn: t.Strn, Language: t.Language, Sources: t.Sources})
+		seen[t.Strn] = true
+	}
+	return e, added
+}
+
+// mergeConflictComment lists the differences between the target and source entry, as a comment
+func mergeConflictComment(from lex.LexRef, changes []FieldChange, source string) lex.EntryComment {
+	var cs []string
+	for _, c := range changes {
+		cs = append(cs, fmt.Sprintf("%s: %s -> %s", c.Field, c.OldValue, c.NewValue))
+	}
+	return lex.EntryComment{Label: mergeCommentLabel, Source: source, Comment: fmt.Sprintf("conflict with %s : %s", from, strings.Join(cs, "; "))}
+}
+
+// sourceIsNewer compares the entry status timestamps of the source and target entries
+func sourceIsNewer(src lex.Entry, target lex.Entry) (bool, error) {
+	if target.EntryStatus.Timestamp == "" {
+		return true, nil
+	}
+	if src.EntryStatus.Timestamp == "" {
+		return false, nil
+	}
+	srcT, err := parseHistoryTimestamp(src.EntryStatus.Timestamp)
+	if err != nil {
+		return false, fmt.Errorf("source entry id '%d' : %v", src.ID, err)
+	}
+	targetT, err := parseHistoryTimestamp(target.EntryStatus.Timestamp)
+	if err != nil {
+		return false, fmt.Errorf("target entry id '%d' : %v", target.ID, err)
+	}
+	return srcT.After(targetT), nil
+}
+
+func mergeEntries(dbif DBIF, db *sql.DB, from lex.LexRef, srcEntries []lex.Entry, to lex.LexRef, strategy MergeStrategy, source string) (MergeResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("mergeEntries failed to start db transaction : %v", err)
+	}
+	defer tx.Commit()
+
+	res, err := mergeEntriesTx(dbif, tx, from, srcEntries, to, strategy, source)
+	if err != nil {
+		msg := fmt.Sprintf("mergeEntries failed : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+		return res, fmt.Errorf(msg)
+	}
+	return res, nil
+}
+
+// mergeEntriesTx merges the source entries (read from the from lexicon) into the to lexicon. Source entries not found in the target lexicon are added, and source entries that differ from the matching target entry are handled according to the strategy. Modified target entries get a new entry status with the input source. The source lexicon is not modified.
+func mergeEntriesTx(dbif DBIF, tx *sql.Tx, from lex.LexRef, srcEntries []lex.Entry, to lex.LexRef, strategy MergeStrategy, source string) (MergeResult, error) {
+	res := MergeResult{From: from, To: to, Strategy: strategy, Entries: []MergeEntryResult{}}
+
+	if trm(source) == "" {
+		return res, fmt.Errorf("source (the merging user) must not be empty")
+	}
+	if _, err := ParseMergeStrategy(string(strategy)); err != nil {
+		return res, err
+	}
+
+	l, err := dbif.getLexiconTx(tx, string(to.LexName))
+	if err != nil {
+		return res, err
+	}
+	var esw lex.EntrySliceWriter
+	err = dbif.lookUpTx(tx, []lex.LexName{to.LexName}, Query{WordLike: "%"}, &esw)
+	if err != nil {
+		return res, err
+	}
+
+	srcMap := make(map[string][]lex.Entry)
+	targetMap := make(map[string][]lex.Entry)
+	var keys []string
+	for _, e := range srcEntries {
+		k := diffKey(e)
+		if _, ok := srcMap[k]; !ok {
+			keys = append(keys, k)
+		}
+		srcMap[k] = append(srcMap[k], e)
+	}
+	for _, e := range esw.Entries {
+		k := diffKey(e)
+		targetMap[k] = append(targetMap[k], e)
+	}
+
+	var newEntries []lex.Entry
+	var newIndices []int // index in res.Entries of each new entry
+	for _, k := range keys {
+		pairs, srcOnly, _ := pairEntries(srcMap[k], targetMap[k], mergeFields)
+		for _, src := range srcOnly {
+			newEntries = append(newEntries, newEntryForInsert(src, source))
+			newIndices = append(newIndices, len(res.Entries))
+			res.Entries = append(res.Entries, MergeEntryResult{Strn: src.Strn, Tag: src.Tag, SourceID: src.ID, Action: mergeActionAdded})
+		}
+		for _, p := range pairs {
+			src, target := p[0], p[1]
+			changes := entryDiffFields(target, src, mergeFields)
+			item := MergeEntryResult{Strn: src.Strn, Tag: src.Tag, SourceID: src.ID, TargetID: target.ID, Changes: changes}
+			if len(changes) == 0 {
+				item.Action = mergeActionUnchanged
+				res.Entries = append(res.Entries, item)
+				continue
+			}
+
+			e := target
+			item.Action = mergeActionKept
+			switch strategy {
+			case MergePreferSource:
+				e = copyEntryFields(target, src, mergeFields)
+				item.Action = mergeActionUpdated
+			case MergePreferNewerStatus:
+				newer, err := sourceIsNewer(src, target)
+				if err != nil {
+					return res, err
+				}
+				if newer {
+					e = copyEntryFields(target, src, mergeFields)
+					item.Action = mergeActionUpdated
+				}
+			case MergeTranscriptionsAsVariants:
+				var added bool
+				e, added = mergeVariants(target, src)
+				if added {
+					item.Action = mergeActionUpdated
+				}
+			case MergeFlagConflicts:
+				e.Comments = append(append([]lex.EntryComment{}, target.Comments...), mergeConflictComment(from, changes, source))
+				item.Action = mergeActionFlagged
+			}
+
+			if item.Action != mergeActionKept {
+				statusName := target.EntryStatus.Name
+				if item.Action == mergeActionUpdated && src.EntryStatus.Name != "" {
+					statusName = src.EntryStatus.Name
+				}
+				e.EntryStatus = lex.EntryStatus{Name: statusName, Source: source}
+				e.Revision = 0
+				_, err = dbif.updateEntryTx(tx, e, false)
+				if err != nil {
+					return res, fmt.Errorf("failed to update entry id '%d' : %v", target.ID, err)
+				}
+			}
+			res.Entries = append(res.Entries, item)
+		}
+	}
+
+	if len(newEntries) > 0 {
+		ids, err := dbif.insertEntriesTx(tx, l, newEntries)
+		if err != nil {
+			return res, fmt.Errorf("failed to insert new entries : %v", err)
+		}
+		for i, index := range newIndices {
+			res.Entries[index].TargetID = ids[i]
+		}
+	}
+
+	for _, item := range res.Entries {
+		switch item.Action {
+		case mergeActionAdded:
+			res.Added++
+		case mergeActionUpdated:
+			res.Updated++
+		case mergeActionFlagged:
+			res.Flagged++
+		case mergeActionKept:
+			res.Kept++
+		case mergeActionUnchanged:
+			res.Unchanged++
+		}
+	}
+
+	return res, nil
+}
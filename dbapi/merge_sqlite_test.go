@@ -0,0 +1,186 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestMergeLexiconsSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testMergeLexicons(t, sqliteDBIF{}, db)
+}
+
+// testMergeLexicons is shared between the sqlite and mariadb tests
+func testMergeLexicons(t *testing.T, dbif DBIF, db *sql.DB) {
+	ts := func(strns ...string) []lex.Transcription {
+		var res []lex.Transcription
+		for _, s := range strns {
+			res = append(res, lex.Transcription{Strn: s, Language: "sv"})
+		}
+		return res
+	}
+
+	// Each strategy is tested using a new pair of source and target lexicons:
+	//  - rom differs (transcription, status)
+	//  - bil is the same in both lexicons
+	//  - apa only exists in the source lexicon
+	setUp := func(i int) (lex.LexRef, []lex.Entry, lex.LexRef, int64) {
+		from := lexicon{name: fmt.Sprintf("merge_from_%d", i), symbolSetName: "ZZ", locale: "ll"}
+		from, err := dbif.defineLexicon(db, from)
+		if err != nil {
+			t.Fatalf("Ooops! : %v", err)
+		}
+		to := lexicon{name: fmt.Sprintf("merge_to_%d", i), symbolSetName: "ZZ", locale: "ll"}
+		to, err = dbif.defineLexicon(db, to)
+		if err != nil {
+			t.Fatalf("Ooops! : %v", err)
+		}
+
+		targetIDs, err := dbif.insertEntries(db, to, []lex.Entry{
+			{Strn: "rom", PartOfSpeech: "NN", Language: "sv", WordParts: "rom", Transcriptions: ts("\" r u m"), EntryStatus: lex.EntryStatus{Name: "unchecked", Source: "imported"}},
+			{Strn: "bil", PartOfSpeech: "NN", Language: "sv", WordParts: "bil", Transcriptions: ts("\" b i: l"), EntryStatus: lex.EntryStatus{Name: "ok", Source: "imported"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert entries : %v", err)
+		}
+		_, err = dbif.insertEntries(db, from, []lex.Entry{
+			{Strn: "rom", PartOfSpeech: "NN", Language: "sv", WordParts: "rom", Transcriptions: ts("\" r O m"), EntryStatus: lex.EntryStatus{Name: "ok", Source: "contributor"}},
+			{Strn: "bil", PartOfSpeech: "NN", Language: "sv", WordParts: "bil", Transcriptions: ts("\" b i: l"), EntryStatus: lex.EntryStatus{Name: "ok", Source: "contributor"}},
+			{Strn: "apa", PartOfSpeech: "NN", Language: "sv", WordParts: "apa", Transcriptions: ts("\" A: . p a"), EntryStatus: lex.EntryStatus{Name: "ok", Source: "contributor"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to insert entries : %v", err)
+		}
+
+		var esw lex.EntrySliceWriter
+		err = dbif.lookUp(db, []lex.LexName{lex.LexName(from.name)}, Query{WordLike: "%"}, &esw)
+		if err != nil {
+			t.Fatalf("Failed to look up entries : %v", err)
+		}
+		// make the source status newer than the target status
+		for i := range esw.Entries {
+			esw.Entries[i].EntryStatus.Timestamp = "2101-01-01T00:00:00Z"
+		}
+		return lex.NewLexRef("merge_db", from.name), esw.Entries, lex.NewLexRef("merge_db", to.name), targetIDs[0]
+	}
+
+	getRom := func(id int64) lex.Entry {
+		e, err := dbif.getEntryFromID(db, id)
+		if err != nil {
+			t.Fatalf("Failed to get entry : %v", err)
+		}
+		return e
+	}
+
+	for i, strategy := range MergeStrategies {
+		from, srcEntries, to, romID := setUp(i)
+		res, err := mergeEntries(dbif, db, from, srcEntries, to, strategy, "merger")
+		if err != nil {
+			t.Fatalf("%s : failed to merge : %v", strategy, err)
+		}
+		if w, g := 1, res.Added; w != g {
+			t.Errorf("%s : expected %d added, got %d", strategy, w, g)
+		}
+		if w, g := 1, res.Unchanged; w != g {
+			t.Errorf("%s : expected %d unchanged, got %d", strategy, w, g)
+		}
+		if w, g := 3, len(res.Entries); w != g {
+			t.Fatalf("%s : expected %d entry results, got %d", strategy, w, g)
+		}
+		if w, g := "rom", res.Entries[0].Strn; w != g {
+			t.Errorf("%s : expected '%s', got '%s'", strategy, w, g)
+		}
+		if w, g := romID, res.Entries[0].TargetID; w != g {
+			t.Errorf("%s : expected target id %d, got %d", strategy, w, g)
+		}
+		if w, g := mergeActionAdded, res.Entries[2].Action; w != g {
+			t.Errorf("%s : expected '%s', got '%s'", strategy, w, g)
+		}
+
+		added, err := dbif.getEntryFromID(db, res.Entries[2].TargetID)
+		if err != nil {
+			t.Fatalf("%s : failed to get added entry : %v", strategy, err)
+		}
+		if w, g := "apa", added.Strn; w != g {
+			t.Errorf("%s : expected '%s', got '%s'", strategy, w, g)
+		}
+		if w, g := to.LexName, added.LexRef.LexName; w != g {
+			t.Errorf("%s : expected '%s', got '%s'", strategy, w, g)
+		}
+		if w, g := (lex.EntryStatus{Name: "ok", Source: "merger"}), added.EntryStatus; w.Name != g.Name || w.Source != g.Source {
+			t.Errorf("%s : expected '%v', got '%v'", strategy, w, g)
+		}
+
+		rom := getRom(romID)
+		var expAction, expTrans string
+		switch strategy {
+		case MergeKeepTarget:
+			expAction, expTrans = mergeActionKept, "\" r u m"
+		case MergePreferSource, MergePreferNewerStatus:
+			expAction, expTrans = mergeActionUpdated, "\" r O m"
+		case MergeTranscriptionsAsVariants:
+			expAction, expTrans = mergeActionUpdated, "\" r u m | \" r O m"
+		case MergeFlagConflicts:
+			expAction, expTrans = mergeActionFlagged, "\" r u m"
+			if w, g := 1, len(rom.Comments); w != g {
+				t.Fatalf("%s : expected %d comments, got %d", strategy, w, g)
+			}
+			if w, g := mergeCommentLabel, rom.Comments[0].Label; w != g {
+				t.Errorf("%s : expected '%s', got '%s'", strategy, w, g)
+			}
+			if !strings.Contains(rom.Comments[0].Comment, "r O m") {
+				t.Errorf("%s : expected conflicting transcription in comment, got '%s'", strategy, rom.Comments[0].Comment)
+			}
+		}
+		if w, g := expAction, res.Entries[0].Action; w != g {
+			t.Errorf("%s : expected '%s', got '%s'", strategy, w, g)
+		}
+		if w, g := expTrans, historyFieldValue(rom, "transcriptions"); w != g {
+			t.Errorf("%s : expected '%s', got '%s'", strategy, w, g)
+		}
+		if expAction != mergeActionKept {
+			if w, g := "merger", rom.EntryStatus.Source; w != g {
+				t.Errorf("%s : expected '%s', got '%s'", strategy, w, g)
+			}
+		}
+	}
+
+	// Newer target status is kept by prefer-newer-status
+	from, srcEntries, to, romID := setUp(len(MergeStrategies))
+	for i := range srcEntries {
+		srcEntries[i].EntryStatus.Timestamp = "2001-01-01T00:00:00Z"
+	}
+	res, err := mergeEntries(dbif, db, from, srcEntries, to, MergePreferNewerStatus, "merger")
+	if err != nil {
+		t.Fatalf("Failed to merge : %v", err)
+	}
+	if w, g := mergeActionKept, res.Entries[0].Action; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "\" r u m", historyFieldValue(getRom(romID), "transcriptions"); w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+
+	// Merging again adds nothing
+	res, err = mergeEntries(dbif, db, from, srcEntries, to, MergeKeepTarget, "merger")
+	if err != nil {
+		t.Fatalf("Failed to merge : %v", err)
+	}
+	if w, g := 0, res.Added; w != g {
+		t.Errorf("Expected %d added, got %d", w, g)
+	}
+
+	_, err = mergeEntries(dbif, db, from, srcEntries, to, MergeStrategy("no-such-strategy"), "merger")
+	if err == nil {
+		t.Errorf("Expected error for invalid strategy, got nil")
+	}
+	_, err = mergeEntries(dbif, db, from, srcEntries, to, MergeKeepTarget, "")
+	if err == nil {
+		t.Errorf("Expected error for empty source, got nil")
+	}
+}
@@ -0,0 +1,161 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/stts-se/pronlex/lex"
+	"github.com/stts-se/symbolset"
+)
+
+// Special tokens that can be used in a phoneme search pattern (Query.TranscriptionPhonemes), in addition to the symbols of the symbol set
+const (
+	// PhonemeStart anchors the pattern to the start of the transcription (first token only)
+	PhonemeStart = "^"
+	// PhonemeEnd anchors the pattern to the end of the transcription (last token only)
+	PhonemeEnd = "$"
+	// PhonemeAny matches any symbol of the symbol set
+	PhonemeAny = "<any>"
+	// PhonemeSyllabic matches any syllabic phoneme (typically vowels)
+	PhonemeSyllabic = "<syllabic>"
+	// PhonemeNonSyllabic matches any non-syllabic phoneme (typically consonants)
+	PhonemeNonSyllabic = "<nonsyllabic>"
+	// PhonemeStress matches any stress symbol
+	PhonemeStress = "<stress>"
+)
+
+// PhonemeRegexp converts a phoneme search pattern into a regular expression matching transcriptions that contain the pattern as a sequence of whole symbols.
+// The pattern is a sequence of symbols of the symbol set (phonemes, stress, syllable boundaries, etc), separated by the phoneme delimiter of the symbol set.
+// The special tokens PhonemeAny, PhonemeSyllabic, PhonemeNonSyllabic and PhonemeStress can be used instead of a symbol, and PhonemeStart/PhonemeEnd can be used to anchor the pattern.
+// Example, for sv-se_ws-sampa: the pattern 'rs' matches the retroflex phoneme /rs/, but not the sequence /r s/, and the pattern '" <any> rs' only matches stressed syllables starting with /rs/.
+//
+// The symbol set must have a non-empty phoneme delimiter.
+func PhonemeRegexp(ss symbolset.SymbolSet, pattern string) (string, error) {
+	delim := ss.PhonemeDelimiter.String
+	if delim == "" {
+		return "", fmt.Errorf("phoneme search requires a symbol set with a non-empty phoneme delimiter, symbol set %s has none", ss.Name)
+	}
+	qDelim := regexp.QuoteMeta(delim)
+
+	var tokens []string
+	for _, t := range strings.Split(strings.TrimSpace(pattern), delim) {
+		if t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("empty phoneme search pattern")
+	}
+
+	prefix, suffix := "(^|"+qDelim+")", "("+qDelim+"|$)"
+	if tokens[0] == PhonemeStart && !ss.ValidSymbol(PhonemeStart) {
+		prefix = "^"
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 0 && tokens[len(tokens)-1] == PhonemeEnd && !ss.ValidSymbol(PhonemeEnd) {
+		suffix = "$"
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return "", fmt.Errorf("no symbols in phoneme search pattern '%s'", pattern)
+	}
+
+	var res []string
+	for _, t := range tokens {
+		switch {
+		case ss.ValidSymbol(t):
+			res = append(res, regexp.QuoteMeta(t))
+		case t == PhonemeAny:
+			res = append(res, symbolsRe(ss, nil))
+		case t == PhonemeSyllabic:
+			res = append(res, symbolsRe(ss, []symbolset.SymbolCat{symbolset.Syllabic}))
+		case t == PhonemeNonSyllabic:
+			res = append(res, symbolsRe(ss, []symbolset.SymbolCat{symbolset.NonSyllabic}))
+		case t == PhonemeStress:
+			res = append(res, symbolsRe(ss, []symbolset.SymbolCat{symbolset.Stress}))
+		default:
+			return "", fmt.Errorf("unknown symbol '%s' in phoneme search pattern '%s' (symbol set %s)", t, pattern, ss.Name)
+		}
+	}
+	return prefix + strings.Join(res, qDelim) + suffix, nil
+}
+
+// symbolsRe returns a regexp group matching the non-empty symbols of the given categories (all symbols except the phoneme delimiter if cats is nil)
+func symbolsRe(ss symbolset.SymbolSet, cats []symbolset.SymbolCat) string {
+	var alts []string
+	for _, s := range ss.Symbols {
+		if s.String == "" || s.Cat == symbolset.PhonemeDelimiter {
+			continue
+		}
+		if cats != nil && !containsSymbolCat(cats, s.Cat) {
+			continue
+		}
+		alts = append(alts, regexp.QuoteMeta(s.String))
+	}
+	return "(?:" + strings.Join(alts, "|") + ")"
+}
+
+func containsSymbolCat(cats []symbolset.SymbolCat, cat symbolset.SymbolCat) bool {
+	for _, c := range cats {
+		if c == cat {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePhonemes compiles Query.TranscriptionPhonemes using the symbol set, so that it can be used in the SQL generation
+func (q *Query) compilePhonemes(ss symbolset.SymbolSet) error {
+	re, err := PhonemeRegexp(ss, q.TranscriptionPhonemes)
+	if err != nil {
+		return err
+	}
+	q.transcriptionPhonemesRe = re
+	return nil
+}
+
+// AddSymbolSet makes a symbol set available for phoneme search (Query.TranscriptionPhonemes) in lexicons using the symbol set.
+// A symbol set previously added with the same name is replaced.
+func (dbm *DBManager) AddSymbolSet(ss symbolset.SymbolSet) {
+	dbm.Lock()
+	defer dbm.Unlock()
+	dbm.symbolSets[ss.Name] = ss
+}
+
+// SymbolSetNames lists the names of the symbol sets available for phoneme search
+func (dbm *DBManager) SymbolSetNames() []string {
+	dbm.RLock()
+	defer dbm.RUnlock()
+	var res []string
+	for name := range dbm.symbolSets {
+		res = append(res, name)
+	}
+	return res
+}
+
+// compilePhonemes compiles the phoneme search of a query, using the symbol set of the lexicons searched. All lexicons must use the same symbol set.
+// The DBManager must be locked by the caller.
+func (dbm *DBManager) compilePhonemes(db *sql.DB, lexNames []lex.LexName, q Query) (Query, error) {
+	if strings.TrimSpace(q.TranscriptionPhonemes) == "" {
+		return q, nil
+	}
+	ssName := ""
+	for _, ln := range lexNames {
+		l, err := dbm.dbif.getLexicon(db, string(ln))
+		if err != nil {
+			return q, err
+		}
+		if ssName != "" && l.symbolSetName != ssName {
+			return q, fmt.Errorf("phoneme search requires all lexicons to use the same symbol set, found %s and %s", ssName, l.symbolSetName)
+		}
+		ssName = l.symbolSetName
+	}
+	ss, ok := dbm.symbolSets[ssName]
+	if !ok {
+		return q, fmt.Errorf("phoneme search is not available for symbol set %s (not loaded)", ssName)
+	}
+	err := q.compilePhonemes(ss)
+	return q, err
+}
@@ -0,0 +1,90 @@
+package dbapi
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+	"github.com/stts-se/symbolset"
+)
+
+func TestPhonemeSearchSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testPhonemeSearch(t, sqliteDBIF{}, db)
+}
+
+// testPhonemeSearch is shared between the sqlite and mariadb tests
+func testPhonemeSearch(t *testing.T, dbif DBIF, db *sql.DB) {
+	ss, err := symbolset.LoadSymbolSet("./test_data/sv-se_ws-sampa.sym")
+	if err != nil {
+		t.Fatalf("couldn't load symbol set : %v", err)
+	}
+
+	l, err := dbif.defineLexicon(db, lexicon{name: "phonemelex", symbolSetName: ss.Name, locale: "sv_SE"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+
+	entry := func(strn string, trans ...string) lex.Entry {
+		e := lex.Entry{Strn: strn, PartOfSpeech: "NN", Language: "sv", WordParts: strn, EntryStatus: lex.EntryStatus{Name: "ok", Source: "tst"}}
+		for _, t := range trans {
+			e.Transcriptions = append(e.Transcriptions, lex.Transcription{Strn: t, Language: "sv"})
+		}
+		return e
+	}
+	es := []lex.Entry{
+		entry("bars", "\" b A: rs"),
+		entry("bas", "\" b A: s"),
+		entry("barsk", "\" b a rs k"),
+		entry("försök", "\"\" f 9 . rs 2: k"),
+		entry("kors", "\" k O rs", "\" k O r s"),
+	}
+	_, err = dbif.insertEntries(db, l, es)
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	lookUp := func(pattern string) []string {
+		q := Query{TranscriptionPhonemes: pattern}
+		err := q.compilePhonemes(ss)
+		if err != nil {
+			t.Fatalf("compilePhonemes failed for pattern '%s' : %v", pattern, err)
+		}
+		res, err := dbif.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, q)
+		if err != nil {
+			t.Fatalf("lookUp failed for pattern '%s' : %v", pattern, err)
+		}
+		var strns []string
+		for _, e := range res {
+			strns = append(strns, e.Strn)
+		}
+		sort.Strings(strns)
+		return strns
+	}
+	expect := func(pattern string, w ...string) {
+		if g := lookUp(pattern); strings.Join(w, " ") != strings.Join(g, " ") {
+			t.Errorf("pattern '%s' : expected %v, got %v", pattern, w, g)
+		}
+	}
+
+	// The retroflex /rs/, but not /s/ or /r s/
+	expect("rs", "bars", "barsk", "försök", "kors")
+	expect("s", "bas", "kors")
+	expect("r s", "kors")
+	// Phoneme sequences, syllable boundaries and stress
+	expect("A: rs", "bars")
+	expect(". rs", "försök")
+	expect("\"\" <any>", "försök")
+	expect("\" b <syllabic>", "bars", "barsk", "bas")
+	expect("rs $", "bars", "kors")
+	expect("<syllabic> rs <nonsyllabic>", "barsk")
+
+	// A phoneme query must be compiled with a symbol set before use
+	_, err = dbif.lookUpIds(db, []lex.LexName{lex.LexName(l.name)}, Query{TranscriptionPhonemes: "rs"})
+	if err == nil {
+		t.Errorf("expected error for uncompiled phoneme query, got nil")
+	}
+}
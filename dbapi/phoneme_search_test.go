@@ -0,0 +1,54 @@
+package dbapi
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stts-se/symbolset"
+)
+
+func TestPhonemeRegexp(t *testing.T) {
+	ss, err := symbolset.LoadSymbolSet("./test_data/sv-se_ws-sampa.sym")
+	if err != nil {
+		t.Fatalf("couldn't load symbol set : %v", err)
+	}
+
+	for _, test := range []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{pattern: "s", match: []string{"\" h E s t", "s"}, noMatch: []string{"\" b A: rs", "\" x U k"}},
+		{pattern: "rs", match: []string{"\" b A: rs"}, noMatch: []string{"\" b A: r s"}},
+		{pattern: "r s", match: []string{"\" b A: r s"}, noMatch: []string{"\" b A: rs", "\" b A: r . s"}},
+		{pattern: ". rs", match: []string{"\" f 9 . rs @ k"}, noMatch: []string{"\" b A: rs"}},
+		{pattern: "^ \"\"", match: []string{"\"\" k e k + p a . k % e: t"}, noMatch: []string{"\" k e k s"}},
+		{pattern: "k s $", match: []string{"\" k e k s"}, noMatch: []string{"\" k e k . s @ t"}},
+		{pattern: "\" <any> E", match: []string{"\" h E s t"}, noMatch: []string{"\" h u0 n d"}},
+		{pattern: "<stress> h <syllabic> <nonsyllabic>", match: []string{"\" h E s t", "\" h u0 n d"}, noMatch: []string{"\" k e k s"}},
+	} {
+		reS, err := PhonemeRegexp(ss, test.pattern)
+		if err != nil {
+			t.Errorf("PhonemeRegexp failed for pattern '%s' : %v", test.pattern, err)
+			continue
+		}
+		re := regexp.MustCompile(reS)
+		for _, s := range test.match {
+			if !re.MatchString(s) {
+				t.Errorf("expected pattern '%s' (%s) to match /%s/", test.pattern, reS, s)
+			}
+		}
+		for _, s := range test.noMatch {
+			if re.MatchString(s) {
+				t.Errorf("expected pattern '%s' (%s) not to match /%s/", test.pattern, reS, s)
+			}
+		}
+	}
+
+	for _, pattern := range []string{"", " ", "x0", "^ $", "s <vowel>"} {
+		_, err := PhonemeRegexp(ss, pattern)
+		if err == nil {
+			t.Errorf("expected error for pattern '%s', got nil", pattern)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// Facet names for QueryStats.Facets
+const (
+	// FacetStatus counts entries per current entry status
+	FacetStatus = "status"
+	// FacetPartOfSpeech counts entries per part of speech
+	FacetPartOfSpeech = "partOfSpeech"
+	// FacetUser counts entries per source (user) of the current entry status
+	FacetUser = "user"
+	// FacetValidationRule counts entries per validation rule name
+	FacetValidationRule = "validationRule"
+	// FacetLanguage counts entries per entry language
+	FacetLanguage = "language"
+)
+
+// Facets lists the facets computed by DBManager.QueryStats
+var Facets = []string{FacetStatus, FacetPartOfSpeech, FacetUser, FacetValidationRule, FacetLanguage}
+
+// facetSQL holds the SQL for each facet, to be completed with the SQL selecting the ids of the matching entries
+var facetSQL = map[string]string{
+	FacetStatus:         "SELECT fs.name, count(*) FROM EntryStatus fs WHERE fs.current = 1 AND fs.entryId IN (%s) GROUP BY fs.name",
+	FacetPartOfSpeech:   "SELECT fe.partOfSpeech, count(*) FROM Entry fe WHERE fe.id IN (%s) GROUP BY fe.partOfSpeech",
+	FacetUser:           "SELECT fs.source, count(*) FROM EntryStatus fs WHERE fs.current = 1 AND fs.entryId IN (%s) GROUP BY fs.source",
+	FacetValidationRule: "SELECT fv.name, count(distinct fv.entryId) FROM EntryValidation fv WHERE fv.entryId IN (%s) GROUP BY fv.name",
+	FacetLanguage:       "SELECT fe.language, count(*) FROM Entry fe WHERE fe.id IN (%s) GROUP BY fe.language",
+}
+
+// queryStats counts the entries matching a query, and optionally the facet counts of the matching entries.
+// The SQL is the same for Sqlite and MariaDB, so only the input lexicon validation is engine specific.
+func queryStats(dbif DBIF, db *sql.DB, lexNames []lex.LexName, q Query, withFacets bool) (QueryStats, error) {
+	res := QueryStats{Query: q}
+	if q.Empty() {
+		return res, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return res, fmt.Errorf("failed to initialize transaction : %v", err)
+	}
+	defer tx.Commit()
+
+	err = dbif.validateInputLexicons(tx, lexNames, q)
+	if err != nil {
+		return res, err
+	}
+
+	q, err = q.compileFullText(dbif.engine())
+	if err != nil {
+		return res, err
+	}
+
+	countStmt, err := countEntriesSQL(lexNames, q)
+	if err != nil {
+		return res, err
+	}
+	err = tx.QueryRow(countStmt.sql, countStmt.values...).Scan(&res.Entries)
+	if err != nil {
+		return res, fmt.Errorf("failed to count entries : %v", err)
+	}
+
+	if !withFacets {
+		return res, nil
+	}
+
+	idsStmt, err := selectEntryIdsSQL(lexNames, q)
+	if err != nil {
+		return res, err
+	}
+	res.Facets = make(map[string][]FacetCount)
+	for _, facet := range Facets {
+		counts := make(map[string]int64)
+		rows, err := tx.Query(fmt.Sprintf(facetSQL[facet], idsStmt.sql), idsStmt.values...)
+		if err != nil {
+			return res, fmt.Errorf("failed to count facet %s : %v", facet, err)
+		}
+		for rows.Next() {
+			var value sql.NullString
+			var count int64
+			err = rows.Scan(&value, &count)
+			if err != nil {
+				rows.Close()
+				return res, fmt.Errorf("failed to scan facet %s : %v", facet, err)
+			}
+			counts[value.String] += count
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return res, fmt.Errorf("failed to count facet %s : %v", facet, err)
+		}
+		res.Facets[facet] = facetCounts(counts)
+	}
+
+	return res, nil
+}
+
+// facetCounts converts a map of counts to a slice, sorted by count (descending) and value
+func facetCounts(counts map[string]int64) []FacetCount {
+	res := []FacetCount{}
+	for v, n := range counts {
+		res = append(res, FacetCount{Value: v, Count: n})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Value < res[j].Value
+	})
+	return res
+}
+
+// mergeQueryStats adds the counts of one QueryStats to another, e.g. for queries over several databases
+func mergeQueryStats(to *QueryStats, from QueryStats) {
+	to.Entries += from.Entries
+	if from.Facets == nil {
+		return
+	}
+	if to.Facets == nil {
+		to.Facets = make(map[string][]FacetCount)
+	}
+	for facet, fcs := range from.Facets {
+		counts := make(map[string]int64)
+		for _, fc := range to.Facets[facet] {
+			counts[fc.Value] += fc.Count
+		}
+		for _, fc := range fcs {
+			counts[fc.Value] += fc.Count
+		}
+		to.Facets[facet] = facetCounts(counts)
+	}
+}
@@ -0,0 +1,91 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestQueryStatsSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testQueryStats(t, sqliteDBIF{}, db)
+}
+
+// testQueryStats is shared between the sqlite and mariadb tests
+func testQueryStats(t *testing.T, dbif DBIF, db *sql.DB) {
+	l, err := dbif.defineLexicon(db, lexicon{name: "statslex", symbolSetName: "ZZ", locale: "ll"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	lexNames := []lex.LexName{lex.LexName(l.name)}
+
+	entry := func(strn, pos, lang, status, user string, valRules ...string) lex.Entry {
+		e := lex.Entry{Strn: strn, PartOfSpeech: pos, Language: lang, WordParts: strn,
+			Transcriptions: []lex.Transcription{{Strn: "a " + strn, Language: lang}, {Strn: "b " + strn, Language: lang}},
+			EntryStatus:    lex.EntryStatus{Name: status, Source: user}}
+		for _, r := range valRules {
+			e.EntryValidations = append(e.EntryValidations, lex.EntryValidation{RuleName: r, Level: "Warning", Message: r + " failed"})
+		}
+		return e
+	}
+	es := []lex.Entry{
+		entry("apa", "NN", "sv", "ok", "anna", "Rule1", "Rule2"),
+		entry("bil", "NN", "sv", "imported", "nst", "Rule1"),
+		entry("cykel", "NN", "en", "imported", "nst"),
+		entry("dansa", "VB", "sv", "ok", "bertil"),
+		entry("ek", "NN", "sv", "ok", "anna"),
+	}
+	_, err = dbif.insertEntries(db, l, es)
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	// Count regardless of page settings
+	stats, err := queryStats(dbif, db, lexNames, Query{PartOfSpeechLike: "NN", PageLength: 2, Page: 1}, false)
+	if err != nil {
+		t.Fatalf("queryStats failed : %v", err)
+	}
+	if w, g := int64(4), stats.Entries; w != g {
+		t.Errorf("expected %d, got %d", w, g)
+	}
+	if stats.Facets != nil {
+		t.Errorf("expected no facets, got %v", stats.Facets)
+	}
+
+	stats, err = queryStats(dbif, db, lexNames, Query{PartOfSpeechLike: "NN"}, true)
+	if err != nil {
+		t.Fatalf("queryStats failed : %v", err)
+	}
+	for facet, w := range map[string]string{
+		FacetStatus:         "[{imported 2} {ok 2}]",
+		FacetPartOfSpeech:   "[{NN 4}]",
+		FacetUser:           "[{anna 2} {nst 2}]",
+		FacetValidationRule: "[{Rule1 2} {Rule2 1}]",
+		FacetLanguage:       "[{sv 3} {en 1}]",
+	} {
+		if g := fmt.Sprintf("%v", stats.Facets[facet]); w != g {
+			t.Errorf("facet %s : expected %s, got %s", facet, w, g)
+		}
+	}
+
+	// A filter is counted like any other search criterion
+	stats, err = queryStats(dbif, db, lexNames, Query{Filter: &Filter{Not: &Filter{Field: "status", Op: "eq", Value: "ok"}}}, true)
+	if err != nil {
+		t.Fatalf("queryStats failed : %v", err)
+	}
+	if w, g := int64(2), stats.Entries; w != g {
+		t.Errorf("expected %d, got %d", w, g)
+	}
+	if w, g := "[{nst 2}]", fmt.Sprintf("%v", stats.Facets[FacetUser]); w != g {
+		t.Errorf("expected %s, got %s", w, g)
+	}
+
+	// Non-existing lexicon
+	_, err = queryStats(dbif, db, []lex.LexName{"nolex"}, Query{WordLike: "%"}, true)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
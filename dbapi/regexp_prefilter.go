@@ -0,0 +1,106 @@
+package dbapi
+
+import (
+	"regexp/syntax"
+	"strings"
+)
+
+// REGEXP conditions are evaluated row by row, and cannot use the indexes of the database. In Sqlite, REGEXP is also a call to a Go function for each row (see Sqlite3WithRegex).
+// To speed things up, a LIKE condition is extracted from the regular expression where possible, and evaluated before the REGEXP.
+// The LIKE condition matches a superset of the strings matched by the regular expression, so it never changes the result of a query.
+// If the regular expression is anchored at the start, and starts with a literal string, the LIKE condition is a prefix search, that can use the index of the column (in Sqlite, if PRAGMA case_sensitive_like is ON).
+//
+// Example: '^hund.*ar$' is prefiltered using LIKE 'hund%ar', and '[bk]orv' using LIKE '%_orv%'.
+
+// regexpCond returns an SQL condition for column REGEXP re, prefiltered with a LIKE condition when possible, along with a slice of values corresponding to the '?':s of the condition
+func regexpCond(column, re string) (string, []interface{}) {
+	if like, ok := regexpLike(re); ok {
+		return "(" + column + " LIKE ? ESCAPE '" + likeEscape + "' AND " + column + " REGEXP ?)", []interface{}{like, re}
+	}
+	return column + " REGEXP ?", []interface{}{re}
+}
+
+// regexpLike converts a regular expression into a LIKE expression matching (at least) the same strings.
+// It returns false if the regular expression cannot be parsed, or if it has no literal parts that can be used for filtering.
+//
+// Literals are only used if they are case sensitive. Case insensitive literals, character classes (including Unicode classes, such as \p{Lu}) and . are converted into a _ per character. Anything else is converted into a %.
+// The syntax of the regular expression is that of the Go regexp package, which is also used for Sqlite. For MariaDB (PCRE), regular expressions that cannot be parsed by Go are evaluated without a prefilter.
+func regexpLike(re string) (string, bool) {
+	r, err := syntax.Parse(re, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	nodes := flattenRegexp(r.Simplify())
+
+	var b strings.Builder
+	hasLiteral := false
+	lastIsWildcard := false
+	wildcard := func() {
+		if !lastIsWildcard {
+			b.WriteString("%")
+		}
+		lastIsWildcard = true
+	}
+	char := func(s string) {
+		b.WriteString(s)
+		lastIsWildcard = false
+	}
+
+	if len(nodes) > 0 && nodes[0].Op == syntax.OpBeginText {
+		nodes = nodes[1:]
+	} else {
+		wildcard()
+	}
+	anchoredEnd := false
+	if len(nodes) > 0 && nodes[len(nodes)-1].Op == syntax.OpEndText {
+		anchoredEnd = true
+		nodes = nodes[:len(nodes)-1]
+	}
+
+	var emit func(n *syntax.Regexp)
+	emit = func(n *syntax.Regexp) {
+		switch n.Op {
+		case syntax.OpEmptyMatch:
+		case syntax.OpLiteral:
+			if n.Flags&syntax.FoldCase != 0 {
+				char(strings.Repeat("_", len(n.Rune)))
+				return
+			}
+			char(likeEscaper.Replace(string(n.Rune)))
+			hasLiteral = true
+		case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+			char("_")
+		case syntax.OpPlus:
+			// at least one occurrence, possibly followed by more
+			for _, sub := range flattenRegexp(n.Sub[0]) {
+				emit(sub)
+			}
+			wildcard()
+		default:
+			wildcard()
+		}
+	}
+	for _, n := range nodes {
+		emit(n)
+	}
+
+	if !anchoredEnd {
+		wildcard()
+	}
+	return b.String(), hasLiteral
+}
+
+// flattenRegexp returns the sequence of nodes of a concatenation, including the nodes of captured groups
+func flattenRegexp(r *syntax.Regexp) []*syntax.Regexp {
+	switch r.Op {
+	case syntax.OpConcat:
+		var res []*syntax.Regexp
+		for _, sub := range r.Sub {
+			res = append(res, flattenRegexp(sub)...)
+		}
+		return res
+	case syntax.OpCapture:
+		return flattenRegexp(r.Sub[0])
+	}
+	return []*syntax.Regexp{r}
+}
@@ -0,0 +1,273 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func regexpTestEntry(strn string) lex.Entry {
+	return lex.Entry{
+		Strn:           strn,
+		PartOfSpeech:   "NN",
+		Language:       "sv",
+		WordParts:      strn,
+		Transcriptions: []lex.Transcription{{Strn: "\" d u m i", Language: "sv"}},
+		EntryStatus:    lex.EntryStatus{Name: "ok", Source: "tst"},
+	}
+}
+
+func TestRegexpSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+	dbif := sqliteDBIF{}
+
+	l, err := dbif.defineLexicon(db, lexicon{name: "regexplex", symbolSetName: "ZZ", locale: "sv_SE"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	// Entry.strn is lowercased on insert
+	strns := []string{"hund", "hundar", "hundkoja", "skolhund", "hänt", "häst", "hästen", "ängel", "100%", "1005", "a_b", "axb", "sjö", "sjösjuk", "ökensand", "nr1"}
+	var es []lex.Entry
+	for _, s := range strns {
+		es = append(es, regexpTestEntry(s))
+	}
+	_, err = dbif.insertEntries(db, l, es)
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	for _, re := range []string{
+		"^hund",
+		"hund",
+		"^hund.*ar$",
+		"(?i)^HUND",
+		"(?i)HUND$",
+		"^h[äe]",
+		"^(h|H)ä",
+		"^HUND",
+		`^\p{L}+$`,
+		`^\p{Ll}+\p{N}$`,
+		`^[^\p{L}]`,
+		`(?i)^Ä`,
+		"ängel",
+		"^sjö+",
+		"^100%$",
+		"^a_b$",
+		"^[0-9]+$",
+		"^(hund)+ar",
+		"s$",
+		"^.$",
+		"^...$",
+	} {
+		cRe := regexp.MustCompile(re)
+		var expect []string
+		for _, s := range strns {
+			if cRe.MatchString(s) {
+				expect = append(expect, s)
+			}
+		}
+		sort.Strings(expect)
+
+		res, err := dbif.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, Query{WordRegexp: re})
+		if err != nil {
+			t.Errorf("lookUp failed for regexp '%s' : %v", re, err)
+		}
+		var got []string
+		for _, e := range res {
+			got = append(got, e.Strn)
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != strings.Join(expect, " ") {
+			t.Errorf("regexp '%s' : expected %v, got %v", re, expect, got)
+		}
+	}
+
+	// A regexp anchored at the start, and starting with a literal, uses the index on Entry.strn
+	cond, args := regexpCond("Entry.strn", "^hund.*ar$")
+	rows, err := db.Query("EXPLAIN QUERY PLAN SELECT Entry.id FROM Entry WHERE "+cond, args...)
+	if err != nil {
+		t.Fatalf("explain failed : %v", err)
+	}
+	defer rows.Close()
+	var plan []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		err = rows.Scan(&id, &parent, &notUsed, &detail)
+		if err != nil {
+			t.Fatalf("scan failed : %v", err)
+		}
+		plan = append(plan, detail)
+	}
+	if p := strings.Join(plan, "; "); !strings.Contains(p, "USING INDEX") && !strings.Contains(p, "USING COVERING INDEX") {
+		t.Errorf("expected index search for prefiltered regexp, got query plan: %s", p)
+	}
+}
+
+func TestRegexMemConcurrency(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				re := fmt.Sprintf("^a{%d}$", j%50+1)
+				ok, err := regexMem(re, strings.Repeat("a", j%50+1))
+				if err != nil || !ok {
+					t.Errorf("expected match for %s, got %v, %v", re, ok, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, err := regexMem("^a(", "a"); err == nil {
+		t.Errorf("expected error for invalid regexp, got nil")
+	}
+}
+
+// Benchmarks, using a generated lexicon of 500k entries.
+// The lexicon is generated on the first run (which takes a while), and then kept in the file regexpBenchDBPath:
+//  go test -run XXX -bench Regexp ./dbapi
+
+const regexpBenchDBPath = "./testlex_regexp_bench.db"
+const regexpBenchNEntries = 500000
+
+var regexpBenchDB struct {
+	once sync.Once
+	db   *sql.DB
+	err  error
+}
+
+// regexpBenchWords generates n pseudo-random Swedish-looking words
+func regexpBenchWords(n int) []string {
+	onsets := []string{"", "b", "d", "f", "g", "h", "j", "k", "l", "m", "n", "p", "r", "s", "t", "v", "bl", "br", "fl", "fr", "gr", "kl", "kr", "pr", "sk", "skr", "sj", "sp", "st", "str", "tr"}
+	vowels := []string{"a", "e", "i", "o", "u", "y", "å", "ä", "ö"}
+	codas := []string{"", "", "d", "g", "k", "l", "m", "n", "ng", "r", "s", "t", "st", "rt", "nd", "ck"}
+	suffixes := []string{"", "", "", "ar", "en", "er", "na", "ning", "het", "lig", "son"}
+	rnd := rand.New(rand.NewSource(1))
+	pick := func(ss []string) string { return ss[rnd.Intn(len(ss))] }
+
+	res := make([]string, n)
+	for i := range res {
+		var b strings.Builder
+		for j := 0; j < 1+rnd.Intn(3); j++ {
+			b.WriteString(pick(onsets) + pick(vowels) + pick(codas))
+		}
+		res[i] = b.String() + pick(suffixes)
+	}
+	return res
+}
+
+func openRegexpBenchDB(b *testing.B) *sql.DB {
+	regexpBenchDB.once.Do(func() {
+		if _, err := os.Stat(regexpBenchDBPath); err == nil {
+			regexpBenchDB.db, regexpBenchDB.err = sql.Open("sqlite3_with_regexp", regexpBenchDBPath)
+			if regexpBenchDB.err == nil {
+				_, regexpBenchDB.err = regexpBenchDB.db.Exec("PRAGMA case_sensitive_like=ON")
+			}
+			return
+		}
+
+		b.Logf("generating benchmark lexicon of %d entries in %s", regexpBenchNEntries, regexpBenchDBPath)
+		db := openSqliteTestDB(b, regexpBenchDBPath)
+		_, err := execSchemaSqlite(db) // Creates new lexicon database
+		if err != nil {
+			regexpBenchDB.err = err
+			return
+		}
+		dbif := sqliteDBIF{}
+		l, err := dbif.defineLexicon(db, lexicon{name: "regexpbench", symbolSetName: "ZZ", locale: "sv_SE"})
+		if err != nil {
+			regexpBenchDB.err = err
+			return
+		}
+		words := regexpBenchWords(regexpBenchNEntries)
+		for i := 0; i < len(words); i += 10000 {
+			var es []lex.Entry
+			for _, w := range words[i:min(i+10000, len(words))] {
+				es = append(es, regexpTestEntry(w))
+			}
+			_, err = dbif.insertEntries(db, l, es)
+			if err != nil {
+				regexpBenchDB.err = err
+				return
+			}
+		}
+		_, err = db.Exec("ANALYZE")
+		regexpBenchDB.db, regexpBenchDB.err = db, err
+	})
+	if regexpBenchDB.err != nil {
+		b.Fatalf("couldn't open benchmark db : %v", regexpBenchDB.err)
+	}
+	return regexpBenchDB.db
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// BenchmarkRegexpSqlite compares REGEXP only (regexp) to REGEXP with a LIKE prefilter (prefilter), and also runs the full lookup (lookup)
+func BenchmarkRegexpSqlite(b *testing.B) {
+	db := openRegexpBenchDB(b)
+
+	for _, re := range []string{
+		"^skr.*ning$", // prefix, uses the index
+		"strå",        // infix literal
+		"(?i)^STOR",   // case insensitive, no literal prefix
+		`^\p{L}+son$`,
+		"^[bdg][aeiou]+$", // no literals, no prefilter
+	} {
+		count := func(b *testing.B, cond string, args []interface{}) int {
+			var n int
+			err := db.QueryRow("SELECT count(*) FROM Entry WHERE "+cond, args...).Scan(&n)
+			if err != nil {
+				b.Fatalf("query failed : %v", err)
+			}
+			return n
+		}
+		b.Run(re+"/regexp", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				count(b, "Entry.strn REGEXP ?", []interface{}{re})
+			}
+		})
+		b.Run(re+"/prefilter", func(b *testing.B) {
+			cond, args := regexpCond("Entry.strn", re)
+			for i := 0; i < b.N; i++ {
+				count(b, cond, args)
+			}
+		})
+		b.Run(re+"/lookup", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := sqliteDBIF{}.lookUpIds(db, []lex.LexName{"regexpbench"}, Query{WordRegexp: re})
+				if err != nil {
+					b.Fatalf("lookUpIds failed : %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRegexMem measures the regexp cache, used by the Sqlite regexp function, under concurrent use
+func BenchmarkRegexMem(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := regexMem("^skr.*ning$", "skrivning")
+			if err != nil {
+				b.Fatalf("regexMem failed : %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package dbapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// ResolvedWord is the result of LookUpWithFallback for a single input word
+type ResolvedWord struct {
+	Word string `json:"word"`
+	// The lexicon of the entry: the lexicon with the highest priority having an entry for the word. Nil if the word was not found in any of the lexicons.
+	LexRef *lex.LexRef `json:"lexRef,omitempty"`
+	// The preferred entry for the word in the lexicon (see lex.Entry.Preferred). If there is no preferred entry, the entry with the lowest id is used. Nil if the word was not found in any of the lexicons.
+	Entry *lex.Entry `json:"entry,omitempty"`
+}
+
+// LookUpWithFallback looks up each of the words in a list of lexicons, in priority order, such as a user override lexicon, followed by a main lexicon and a names lexicon.
+// For each word, the preferred entry of the first lexicon having an entry for the word is returned, along with the lexicon it came from.
+// The result has one ResolvedWord per input word, in the same order as the input. As for Query.Words, words are matched case insensitively.
+func (dbm *DBManager) LookUpWithFallback(words []string, lexRefs []lex.LexRef) ([]ResolvedWord, error) {
+	var res []ResolvedWord
+	if len(lexRefs) == 0 {
+		return res, fmt.Errorf("DBManager.LookUpWithFallback cannot perform a search without at least one lexicon specified (using the 'lexicons' parameter)")
+	}
+	words = RemoveEmptyStrings(words)
+	if len(words) == 0 {
+		return res, nil
+	}
+
+	candidates, err := dbm.lookUpCandidates(words, lexRefs)
+	if err != nil {
+		return res, fmt.Errorf("DBManager.LookUpWithFallback failed : %v", err)
+	}
+
+	for _, w := range words {
+		rw := ResolvedWord{Word: w}
+		if es, ok := firstCandidates(candidates, w, lexRefs); ok {
+			e := es[0]
+			for _, e0 := range es[1:] {
+				if preferredOver(e0, e) {
+					e = e0
+				}
+			}
+			lexRef := e.LexRef
+			rw.LexRef = &lexRef
+			rw.Entry = &e
+		}
+		res = append(res, rw)
+	}
+	return res, nil
+}
+
+// lexWord is a word in a lexicon, used for grouping the candidate entries of a word
+type lexWord struct {
+	lexRef lex.LexRef
+	word   string
+}
+
+// lookUpCandidates looks up all the words in all the lexicons, and returns the entries grouped by lexicon and (lowercased) word
+func (dbm *DBManager) lookUpCandidates(words []string, lexRefs []lex.LexRef) (map[lexWord][]lex.Entry, error) {
+	res := make(map[lexWord][]lex.Entry)
+	// All lexicons are searched in parallel, see LookUp
+	es, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: lexRefs, Query: Query{Words: words}})
+	if err != nil {
+		return res, err
+	}
+	for _, e := range es {
+		k := lexWord{lexRef: normaliseLexRef(e.LexRef), word: strings.ToLower(e.Strn)}
+		res[k] = append(res[k], e)
+	}
+	return res, nil
+}
+
+// firstCandidates returns the candidate entries of a word in the first lexicon, in priority order, having an entry for the word
+func firstCandidates(candidates map[lexWord][]lex.Entry, word string, lexRefs []lex.LexRef) ([]lex.Entry, bool) {
+	for _, l := range lexRefs {
+		if es, ok := candidates[lexWord{lexRef: normaliseLexRef(l), word: strings.ToLower(word)}]; ok {
+			return es, true
+		}
+	}
+	return nil, false
+}
+
+// normaliseLexRef lowercases the lexicon name, since lexicon names are lowercased in the database (see DefineLexicon)
+func normaliseLexRef(l lex.LexRef) lex.LexRef {
+	return lex.LexRef{DBRef: l.DBRef, LexName: lex.LexName(strings.ToLower(string(l.LexName)))}
+}
+
+// preferredOver returns true if e should be selected instead of other, when both are entries for the same word in the same lexicon
+func preferredOver(e, other lex.Entry) bool {
+	if e.Preferred != other.Preferred {
+		return e.Preferred
+	}
+	return e.ID < other.ID
+}
@@ -0,0 +1,96 @@
+package dbapi
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestLookUpWithFallbackSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testLookUpWithFallback(t, sqliteDBIF{}, db)
+}
+
+// testLookUpWithFallback is shared between the sqlite and mariadb tests
+func testLookUpWithFallback(t *testing.T, dbif DBIF, db *sql.DB) {
+	dbm, err := NewDBManager(dbif.engine())
+	if err != nil {
+		t.Fatalf("NewDBManager failed : %v", err)
+	}
+	err = dbm.AddDB("resolvedb", db)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	entry := func(strn, trans string, preferred bool) lex.Entry {
+		return lex.Entry{Strn: strn, PartOfSpeech: "NN", Language: "sv", WordParts: strn, Preferred: preferred,
+			Transcriptions: []lex.Transcription{{Strn: trans, Language: "sv"}},
+			EntryStatus:    lex.EntryStatus{Name: "ok", Source: "tst"}}
+	}
+	lexEntries := []struct {
+		name string
+		es   []lex.Entry
+	}{
+		{"override", []lex.Entry{entry("katt", "\" k a t:", false)}},
+		{"main", []lex.Entry{entry("hund", "\" h u0 n d", false), entry("hund", "\" h u n d", true), entry("katt", "\" k a t", false), entry("anna", "\" a n a", false)}},
+		{"names", []lex.Entry{entry("anna", "\" a n: a", false), entry("stockholm", "\" s t O k . h O l m", false)}},
+	}
+	for _, le := range lexEntries {
+		l, err := dbif.defineLexicon(db, lexicon{name: le.name, symbolSetName: "ZZ", locale: "sv_SE"})
+		if err != nil {
+			t.Fatalf("Ooops! : %v", err)
+		}
+		_, err = dbif.insertEntries(db, l, le.es)
+		if err != nil {
+			t.Fatalf("Failed to insert entries : %v", err)
+		}
+	}
+	lexRef := func(name string) lex.LexRef {
+		return lex.NewLexRef("resolvedb", name)
+	}
+
+	// resolved returns the input word, the lexicon name and the transcription of each result, or 'none'
+	resolved := func(words []string, lexRefs ...lex.LexRef) string {
+		res, err := dbm.LookUpWithFallback(words, lexRefs)
+		if err != nil {
+			t.Fatalf("LookUpWithFallback failed : %v", err)
+		}
+		var strns []string
+		for _, rw := range res {
+			if rw.Entry == nil || rw.LexRef == nil {
+				strns = append(strns, rw.Word+":none")
+				continue
+			}
+			if rw.Entry.LexRef != *rw.LexRef {
+				t.Errorf("expected lexRef %v, got %v", rw.Entry.LexRef, *rw.LexRef)
+			}
+			strns = append(strns, rw.Word+":"+string(rw.LexRef.LexName)+":"+rw.Entry.Transcriptions[0].Strn)
+		}
+		return strings.Join(strns, " | ")
+	}
+
+	words := []string{"Katt", "hund", "anna", "stockholm", "xyz", "katt"}
+	if x, r := `Katt:override:" k a t: | hund:main:" h u n d | anna:main:" a n a | stockholm:names:" s t O k . h O l m | xyz:none | katt:override:" k a t:`, resolved(words, lexRef("override"), lexRef("main"), lexRef("names")); x != r {
+		t.Errorf(fs, x, r)
+	}
+	// Same lexicons, different priority
+	if x, r := `Katt:main:" k a t | hund:main:" h u n d | anna:names:" a n: a | stockholm:names:" s t O k . h O l m | xyz:none | katt:main:" k a t`, resolved(words, lexRef("names"), lexRef("main"), lexRef("override")); x != r {
+		t.Errorf(fs, x, r)
+	}
+	if x, r := `Katt:override:" k a t: | hund:none`, resolved([]string{"Katt", "", "hund"}, lexRef("OVERRIDE")); x != r {
+		t.Errorf(fs, x, r)
+	}
+
+	if r := resolved([]string{}, lexRef("main")); r != "" {
+		t.Errorf(fs, "", r)
+	}
+	if _, err := dbm.LookUpWithFallback(words, []lex.LexRef{}); err == nil {
+		t.Errorf("expected error for empty list of lexicons, got nil")
+	}
+	if _, err := dbm.LookUpWithFallback(words, []lex.LexRef{lex.NewLexRef("nodb", "main")}); err == nil {
+		t.Errorf("expected error for unknown db, got nil")
+	}
+}
@@ -5,12 +5,18 @@ package dbapi
 
 // TODO: SchemaVersion defined in schema.go
 
-const mariaDBDropTableStmt = `DROP TABLE IF EXISTS SchemaVersion, EntryComment, Lemma2Entry, Lemma, Transcription, EntryTag, EntryValidation, EntryStatus, Entry, Lexicon;`
+const mariaDBDropTableStmt = `DROP TABLE IF EXISTS SchemaVersion, SchemaMigration, SnapshotEntry, Snapshot, EntryHistory, EntryComment, Lemma2Entry, Lemma, Transcription, EntryTag, EntryValidation, EntryStatus, Entry, Lexicon;`
 
 var MariaDBSchema = []string{
 	`CREATE TABLE SchemaVersion (name text not null);`,
 
-	`INSERT INTO SchemaVersion VALUES (` + SchemaVersion + `);`,
+	`INSERT INTO SchemaVersion VALUES ('` + SchemaVersion + `');`,
+
+	`-- Schema migrations applied to the database (see schema_migration.go). A database created with the current schema has no applied migrations.
+	CREATE TABLE SchemaMigration (
+	    version varchar(128) not null,
+	    description text not null,
+	    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null);`,
 
 	`CREATE TABLE Lexicon (
 	    name varchar(128) not null,
@@ -47,10 +53,12 @@ var MariaDBSchema = []string{
 	    language varchar(128) not null,
 	    -- strn varchar(128) not null,
 	    strn text not null,
+	    reversedStrn text, -- strn reversed, for suffix search using the index
 	    lexiconId integer not null,
 	    partOfSpeech varchar(128),
 	    morphology varchar(128),
 	    preferred integer not null default 0, -- TODO Why doesn't it work when changing integer -> boolean?
+	    revision integer not null default 1, -- incremented on each update, for optimistic concurrency control
 	    foreign key fk_3  (lexiconId) references Lexicon(id));`,
 
 	`CREATE INDEX language on Entry (language);`,
@@ -60,6 +68,7 @@ var MariaDBSchema = []string{
 	`CREATE INDEX strnlangue on Entry (strn(255),language);`,
 	`CREATE INDEX estrnpref on Entry (strn(255),preferred);`,
 	`CREATE INDEX idid on Entry (id, lexiconId);`,
+	`CREATE INDEX erevstrn on Entry (reversedStrn(255));`,
 
 	`-- Entry tag is a string used to distinguish between homographs.
 	-- Unique for an entry of a specific word form, but not for different
@@ -142,11 +151,13 @@ var MariaDBSchema = []string{
 	    language varchar(128) not null,
 	    -- strn varchar(128) not null,
 	    strn text not null,
+	    reversedStrn text, -- strn reversed, for suffix search using the index
 	    sources TEXT not null,
 	    foreign key fk_8 (entryId) references Entry(id) on delete cascade);`,
 
 	`CREATE INDEX traeid ON Transcription (entryId);`,
 	`CREATE INDEX idtraeid ON Transcription (id, entryId);`,
+	`CREATE INDEX trarevstrn ON Transcription (reversedStrn(255));`,
 
 	`-- Linking table between a lemma form and its different surface forms
 	CREATE TABLE Lemma2Entry (
@@ -161,6 +172,40 @@ var MariaDBSchema = []string{
 	`CREATE UNIQUE INDEX l2euind on Lemma2Entry (lemmaId,entryId);`,
 	`CREATE UNIQUE INDEX idx46cf073d on Lemma2Entry (entryId);`,
 
+	`-- Edit history of entries. Each row records an insert, update or delete of an entry,
+	-- along with the changed fields (JSON) and the complete entry after the change (JSON).
+	-- There is no foreign key to Entry, since the history should be kept for deleted entries.
+	CREATE TABLE EntryHistory (
+	    id integer not null primary key auto_increment,
+	    entryId integer not null,
+	    lexiconId integer not null,
+	    action varchar(128) not null,
+	    source varchar(128) not null,
+	    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null,
+	    changes mediumtext not null,
+	    entry mediumtext not null);`,
+	`CREATE INDEX ehentid ON EntryHistory (entryId);`,
+	`CREATE INDEX ehlexentid ON EntryHistory (lexiconId, entryId);`,
+
+	`-- Snapshots are named, frozen copies of the content of a lexicon (e.g., a release shipped to a TTS voice).
+	-- Each snapshot entry holds the complete entry (JSON) at the time of the snapshot.
+	-- A lexicon cannot be deleted while it has snapshots.
+	CREATE TABLE Snapshot (
+	    id integer not null primary key auto_increment,
+	    lexiconId integer not null,
+	    name varchar(128) not null,
+	    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null,
+	    foreign key (lexiconId) references Lexicon(id) on delete restrict);`,
+	`CREATE UNIQUE INDEX snaplexname ON Snapshot (lexiconId, name);`,
+
+	`CREATE TABLE SnapshotEntry (
+	    id integer not null primary key auto_increment,
+	    snapshotId integer not null,
+	    entryId integer not null,
+	    entry mediumtext not null,
+	    foreign key (snapshotId) references Snapshot(id) on delete cascade);`,
+	`CREATE INDEX snapentsnapid ON SnapshotEntry (snapshotId);`,
+
 	/* TODO: Triggers removed for now. Triggers compile, but give runtime error
 
 	   	`-- Triggers to ensure only one preferred = 1 per orthographic word
@@ -0,0 +1,450 @@
+package dbapi
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// Schema migrations upgrade a database from an older schema version to SchemaVersion. Each migration takes the database from the version of the preceding migration (or oldestMigratableSchemaVersion) to its own version, using a list of statements per db engine, and an optional update function for changes that cannot be expressed in SQL for both engines.
+//
+// When the schema is changed, SchemaVersion is bumped, the schema in schema_sqlite.go and schema_mariadb.go is updated for new databases, and a migration to the new version is appended to schemaMigrations for existing databases. Migrations must never be edited once released.
+//
+// Each migration is run in a transaction, and recorded in the SchemaMigration table, along with the new version in the SchemaVersion table.
+// Please note that MariaDB commits schema changes (ALTER TABLE, CREATE TABLE, etc) implicitly, so a failed MariaDB migration may leave the database partly migrated.
+
+// oldestMigratableSchemaVersion is the oldest schema version that can be migrated to SchemaVersion
+const oldestMigratableSchemaVersion = "3.1"
+
+type schemaMigration struct {
+	version     string
+	description string
+	sqlite      []string
+	mariadb     []string
+	// update is called after the statements have been run, in the same transaction
+	update func(tx *sql.Tx) error
+	// done reports if the changes of the migration are already in the database, in which case only the new version is recorded. This is the case for databases created by development versions, before each schema change had its own version.
+	done func(tx *sql.Tx, engine DBEngine) (bool, error)
+}
+
+func (m schemaMigration) statements(engine DBEngine) ([]string, error) {
+	switch engine {
+	case Sqlite:
+		return m.sqlite, nil
+	case MariaDB:
+		return m.mariadb, nil
+	default:
+		return nil, fmt.Errorf("unknown db engine: %s", engine.String())
+	}
+}
+
+// schemaMigrations lists the schema migrations, ordered by version
+var schemaMigrations = []schemaMigration{
+	{
+		version:     "3.2",
+		description: "Add table EntryHistory",
+		sqlite: []string{
+			`CREATE TABLE EntryHistory (
+			    id integer not null primary key autoincrement,
+			    entryId integer not null,
+			    lexiconId integer not null,
+			    action varchar(128) not null,
+			    source varchar(128) not null,
+			    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null,
+			    changes text not null,
+			    entry text not null)`,
+			`CREATE INDEX ehentid ON EntryHistory (entryId)`,
+			`CREATE INDEX ehlexentid ON EntryHistory (lexiconId, entryId)`,
+		},
+		mariadb: []string{
+			`CREATE TABLE EntryHistory (
+			    id integer not null primary key auto_increment,
+			    entryId integer not null,
+			    lexiconId integer not null,
+			    action varchar(128) not null,
+			    source varchar(128) not null,
+			    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null,
+			    changes mediumtext not null,
+			    entry mediumtext not null)`,
+			`CREATE INDEX ehentid ON EntryHistory (entryId)`,
+			`CREATE INDEX ehlexentid ON EntryHistory (lexiconId, entryId)`,
+		},
+		done: tableExists("EntryHistory"),
+	},
+	{
+		version:     "3.3",
+		description: "Add column Entry.revision",
+		sqlite:      []string{`ALTER TABLE Entry ADD COLUMN revision integer not null default 1`},
+		mariadb:     []string{`ALTER TABLE Entry ADD COLUMN revision integer not null default 1`},
+		done:        columnExists("Entry", "revision"),
+	},
+	{
+		version:     "3.4",
+		description: "Add tables Snapshot and SnapshotEntry",
+		sqlite: []string{
+			`CREATE TABLE Snapshot (
+			    id integer not null primary key autoincrement,
+			    lexiconId integer not null,
+			    name varchar(128) not null,
+			    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null,
+			    foreign key (lexiconId) references Lexicon(id) on delete restrict)`,
+			`CREATE UNIQUE INDEX snaplexname ON Snapshot (lexiconId, name)`,
+			`CREATE TABLE SnapshotEntry (
+			    id integer not null primary key autoincrement,
+			    snapshotId integer not null,
+			    entryId integer not null,
+			    entry text not null,
+			    foreign key (snapshotId) references Snapshot(id) on delete cascade)`,
+			`CREATE INDEX snapentsnapid ON SnapshotEntry (snapshotId)`,
+		},
+		mariadb: []string{
+			`CREATE TABLE Snapshot (
+			    id integer not null primary key auto_increment,
+			    lexiconId integer not null,
+			    name varchar(128) not null,
+			    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null,
+			    foreign key (lexiconId) references Lexicon(id) on delete restrict)`,
+			`CREATE UNIQUE INDEX snaplexname ON Snapshot (lexiconId, name)`,
+			`CREATE TABLE SnapshotEntry (
+			    id integer not null primary key auto_increment,
+			    snapshotId integer not null,
+			    entryId integer not null,
+			    entry mediumtext not null,
+			    foreign key (snapshotId) references Snapshot(id) on delete cascade)`,
+			`CREATE INDEX snapentsnapid ON SnapshotEntry (snapshotId)`,
+		},
+		done: tableExists("Snapshot"),
+	},
+	{
+		version:     "3.5",
+		description: "Add columns Entry.reversedStrn and Transcription.reversedStrn",
+		sqlite: []string{
+			`ALTER TABLE Entry ADD COLUMN reversedStrn text`,
+			`CREATE INDEX erevstrn on Entry (reversedStrn)`,
+			`ALTER TABLE Transcription ADD COLUMN reversedStrn text`,
+			`CREATE INDEX trarevstrn ON Transcription (reversedStrn)`,
+		},
+		mariadb: []string{
+			`ALTER TABLE Entry ADD COLUMN reversedStrn text`,
+			`CREATE INDEX erevstrn on Entry (reversedStrn(255))`,
+			`ALTER TABLE Transcription ADD COLUMN reversedStrn text`,
+			`CREATE INDEX trarevstrn ON Transcription (reversedStrn(255))`,
+		},
+		update: setReversedStrn,
+		done:   columnExists("Entry", "reversedStrn"),
+	},
+}
+
+// tableExists returns a schemaMigration.done function, checking that the table exists
+func tableExists(table string) func(tx *sql.Tx, engine DBEngine) (bool, error) {
+	return func(tx *sql.Tx, engine DBEngine) (bool, error) {
+		return tableExistsTx(tx, engine, table)
+	}
+}
+
+// columnExists returns a schemaMigration.done function, checking that the column exists
+func columnExists(table, column string) func(tx *sql.Tx, engine DBEngine) (bool, error) {
+	return func(tx *sql.Tx, engine DBEngine) (bool, error) {
+		var q string
+		switch engine {
+		case Sqlite:
+			q = "SELECT count(*) FROM pragma_table_info(?) WHERE name = ?"
+		case MariaDB:
+			q = "SELECT count(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?"
+		default:
+			return false, fmt.Errorf("unknown db engine: %s", engine.String())
+		}
+		var n int64
+		err := tx.QueryRow(q, table, column).Scan(&n)
+		if err != nil {
+			return false, fmt.Errorf("failed to check for column %s.%s : %v", table, column, err)
+		}
+		return n > 0, nil
+	}
+}
+
+// setReversedStrn populates the reversedStrn columns of existing entries and transcriptions. The strings are reversed in Go, since Sqlite's lower function only handles ASCII characters.
+func setReversedStrn(tx *sql.Tx) error {
+	for _, t := range []struct {
+		table string
+		lower bool
+	}{{"Entry", true}, {"Transcription", false}} {
+		rows, err := tx.Query("SELECT id, strn FROM " + t.table)
+		if err != nil {
+			return fmt.Errorf("failed to read table %s : %v", t.table, err)
+		}
+		strns := make(map[int64]string)
+		for rows.Next() {
+			var id int64
+			var strn string
+			err = rows.Scan(&id, &strn)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read table %s : %v", t.table, err)
+			}
+			strns[id] = strn
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read table %s : %v", t.table, err)
+		}
+
+		stmt, err := tx.Prepare("UPDATE " + t.table + " SET reversedStrn = ? WHERE id = ?")
+		if err != nil {
+			return fmt.Errorf("failed to prepare update of table %s : %v", t.table, err)
+		}
+		for id, strn := range strns {
+			if t.lower {
+				strn = strings.ToLower(strn)
+			}
+			_, err = stmt.Exec(reverseString(strn), id)
+			if err != nil {
+				stmt.Close()
+				return fmt.Errorf("failed to update table %s : %v", t.table, err)
+			}
+		}
+		stmt.Close()
+	}
+	return nil
+}
+
+// schemaMigrationTable is created by the first migration of a database created before the SchemaMigration table was added to the schema
+var schemaMigrationTable = `CREATE TABLE IF NOT EXISTS SchemaMigration (
+    version varchar(128) not null,
+    description text not null,
+    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null)`
+
+// compareSchemaVersions compares two schema versions, such as 3.1 and 3.10, number by number. The result is 0 if v1 == v2, -1 if v1 < v2, and +1 if v1 > v2.
+func compareSchemaVersions(v1, v2 string) (int, error) {
+	parse := func(v string) ([]int, error) {
+		var res []int
+		for _, s := range strings.Split(strings.TrimSpace(v), ".") {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return res, fmt.Errorf("invalid schema version '%s'", v)
+			}
+			res = append(res, i)
+		}
+		return res, nil
+	}
+	n1, err := parse(v1)
+	if err != nil {
+		return 0, err
+	}
+	n2, err := parse(v2)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(n1) || i < len(n2); i++ {
+		var i1, i2 int
+		if i < len(n1) {
+			i1 = n1[i]
+		}
+		if i < len(n2) {
+			i2 = n2[i]
+		}
+		if i1 < i2 {
+			return -1, nil
+		}
+		if i1 > i2 {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// pendingSchemaMigrations returns the migrations needed to upgrade a database with the schema version dbVersion to SchemaVersion. An error is returned if the database is newer than SchemaVersion, or if the version is unknown.
+func pendingSchemaMigrations(dbVersion string) ([]schemaMigration, error) {
+	var res []schemaMigration
+
+	cmp, err := compareSchemaVersions(dbVersion, SchemaVersion)
+	if err != nil {
+		return res, err
+	}
+	if cmp == 0 {
+		return res, nil
+	}
+	if cmp > 0 {
+		return res, fmt.Errorf("db schema version %s is newer than dbapi.SchemaVersion %s", dbVersion, SchemaVersion)
+	}
+
+	known := dbVersion == oldestMigratableSchemaVersion
+	for _, m := range schemaMigrations {
+		cmp, err := compareSchemaVersions(m.version, dbVersion)
+		if err != nil {
+			return res, err
+		}
+		if cmp == 0 {
+			known = true
+		}
+		if cmp > 0 {
+			res = append(res, m)
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("no migration path from db schema version %s to dbapi.SchemaVersion %s (oldest migratable version is %s)", dbVersion, SchemaVersion, oldestMigratableSchemaVersion)
+	}
+	return res, nil
+}
+
+func listPendingSchemaMigrations(dbif DBIF, db *sql.DB) ([]SchemaMigration, error) {
+	var res []SchemaMigration
+	dbVersion, err := dbif.getSchemaVersion(db)
+	if err != nil {
+		return res, err
+	}
+	ms, err := pendingSchemaMigrations(dbVersion)
+	if err != nil {
+		return res, err
+	}
+	for _, m := range ms {
+		res = append(res, SchemaMigration{Version: m.version, Description: m.description})
+	}
+	return res, nil
+}
+
+// listSchemaMigrations lists the migrations applied to the database. A database without the SchemaMigration table has no applied migrations.
+func listSchemaMigrations(dbif DBIF, db *sql.DB) ([]SchemaMigration, error) {
+	var res []SchemaMigration
+	exists, err := schemaMigrationTableExists(dbif.engine(), db)
+	if err != nil {
+		return res, err
+	}
+	if !exists {
+		return res, nil
+	}
+	rows, err := db.Query("SELECT version, description, Timestamp FROM SchemaMigration")
+	if err != nil {
+		return res, fmt.Errorf("failed to list schema migrations : %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m SchemaMigration
+		err = rows.Scan(&m.Version, &m.Description, &m.Timestamp)
+		if err != nil {
+			return res, fmt.Errorf("failed to list schema migrations : %v", err)
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
+
+func schemaMigrationTableExists(engine DBEngine, db *sql.DB) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction : %v", err)
+	}
+	defer tx.Rollback()
+	return tableExistsTx(tx, engine, "SchemaMigration")
+}
+
+func tableExistsTx(tx *sql.Tx, engine DBEngine, table string) (bool, error) {
+	var q string
+	switch engine {
+	case Sqlite:
+		q = "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	case MariaDB:
+		q = "SELECT count(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	default:
+		return false, fmt.Errorf("unknown db engine: %s", engine.String())
+	}
+	var n int64
+	err := tx.QueryRow(q, table).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for table %s : %v", table, err)
+	}
+	return n > 0, nil
+}
+
+// migrateSchema applies the pending schema migrations to the database, in order. If a migration fails, the migrations before it are kept.
+func migrateSchema(dbif DBIF, db *sql.DB, dbRef lex.DBRef) (MigrateDBResult, error) {
+	res := MigrateDBResult{DB: dbRef, Applied: []SchemaMigration{}}
+
+	fromVersion, err := dbif.getSchemaVersion(db)
+	if err != nil {
+		return res, err
+	}
+	res.FromVersion = fromVersion
+	res.ToVersion = fromVersion
+
+	ms, err := pendingSchemaMigrations(fromVersion)
+	if err != nil {
+		return res, err
+	}
+	if len(ms) == 0 {
+		return res, nil
+	}
+
+	_, err = db.Exec(schemaMigrationTable)
+	if err != nil {
+		return res, fmt.Errorf("failed to create table SchemaMigration : %v", err)
+	}
+
+	for _, m := range ms {
+		err = applySchemaMigration(dbif.engine(), db, m)
+		if err != nil {
+			return res, fmt.Errorf("failed to migrate db '%s' from schema version %s to %s : %v", dbRef, res.ToVersion, m.version, err)
+		}
+		res.ToVersion = m.version
+		res.Applied = append(res.Applied, SchemaMigration{Version: m.version, Description: m.description})
+	}
+	return res, nil
+}
+
+func applySchemaMigration(engine DBEngine, db *sql.DB, m schemaMigration) error {
+	stmts, err := m.statements(engine)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction : %v", err)
+	}
+
+	rollback := func(err error) error {
+		msg := err.Error()
+		err2 := tx.Rollback()
+		if err2 != nil && err2 != sql.ErrTxDone {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+		return fmt.Errorf(msg)
+	}
+
+	if m.done != nil {
+		done, err := m.done(tx, engine)
+		if err != nil {
+			return rollback(err)
+		}
+		if done {
+			stmts = nil
+			m.update = nil
+		}
+	}
+
+	for _, s := range stmts {
+		_, err = tx.Exec(s)
+		if err != nil {
+			return rollback(fmt.Errorf("failed to run statement '%s' : %v", s, err))
+		}
+	}
+	if m.update != nil {
+		err = m.update(tx)
+		if err != nil {
+			return rollback(err)
+		}
+	}
+	_, err = tx.Exec("UPDATE SchemaVersion SET name = ?", m.version)
+	if err != nil {
+		return rollback(fmt.Errorf("failed to update schema version : %v", err))
+	}
+	_, err = tx.Exec("INSERT INTO SchemaMigration (version, description) VALUES (?, ?)", m.version, m.description)
+	if err != nil {
+		return rollback(fmt.Errorf("failed to record schema migration : %v", err))
+	}
+	return tx.Commit()
+}
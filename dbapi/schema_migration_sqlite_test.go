@@ -0,0 +1,289 @@
+package dbapi
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// openSchema31TestDBSqlite creates a sqlite db with the schema of version 3.1, the oldest version that can be migrated
+func openSchema31TestDBSqlite(t *testing.T, dbPath string) *sql.DB {
+	db := openSqliteTestDB(t, dbPath)
+	schema, err := os.ReadFile(filepath.Join("test_data", "schema_3.1_sqlite.sql"))
+	if err != nil {
+		t.Fatalf("Failed to read schema : %v", err)
+	}
+	_, err = db.Exec(string(schema))
+	if err != nil {
+		t.Fatalf("Failed to create lexicon db: %v", err)
+	}
+	return db
+}
+
+func TestSchemaMigrationSqlite(t *testing.T) {
+	db := openSchema31TestDBSqlite(t, filepath.Join(t.TempDir(), "testlex_schemamigration.db"))
+	defer db.Close()
+
+	testSchemaMigration(t, sqliteDBIF{}, db)
+}
+
+// testSchemaMigration is shared between the sqlite and mariadb tests. The db should have the schema of version 3.1.
+func testSchemaMigration(t *testing.T, dbif DBIF, db *sql.DB) {
+	// Data inserted using the 3.1 schema
+	for _, s := range []string{
+		`INSERT INTO Lexicon (id, name, symbolSetName, locale) VALUES (1, 'lex1', 'ZZ', 'sv_SE')`,
+		`INSERT INTO Entry (id, wordParts, label, language, strn, lexiconId, partOfSpeech, morphology, preferred) VALUES (1, 'Örfil', 'x', 'sv', 'Örfil', 1, 'NN', '', 1)`,
+		`INSERT INTO Transcription (entryId, language, strn, sources) VALUES (1, 'sv', '" 9 r . f i: l', '')`,
+		`INSERT INTO EntryStatus (entryId, name, source) VALUES (1, 'imported', 'tst')`,
+	} {
+		_, err := db.Exec(s)
+		if err != nil {
+			t.Fatalf("Failed to insert data : %v", err)
+		}
+	}
+
+	dbm, err := NewDBManager(dbif.engine())
+	if err != nil {
+		t.Fatalf("NewDBManager failed : %v", err)
+	}
+	err = dbm.AddDB("schemamigration", db)
+	if err != nil {
+		t.Fatalf("AddDB failed : %v", err)
+	}
+
+	pending, err := dbm.PendingSchemaMigrations("schemamigration")
+	if err != nil {
+		t.Fatalf("PendingSchemaMigrations failed : %v", err)
+	}
+	if w, g := len(schemaMigrations), len(pending); w != g {
+		t.Errorf(fs, w, g)
+	}
+	applied, err := dbm.ListSchemaMigrations("schemamigration")
+	if err != nil {
+		t.Fatalf("ListSchemaMigrations failed : %v", err)
+	}
+	if w, g := 0, len(applied); w != g {
+		t.Errorf(fs, w, g)
+	}
+
+	// The db is refused unless it is migrated on open
+	err = dbm.checkSchemaVersion(db, "schemamigration")
+	if err == nil {
+		t.Errorf("expected error for out-of-date db")
+	}
+
+	res, err := dbm.MigrateDB("schemamigration")
+	if err != nil {
+		t.Fatalf("MigrateDB failed : %v", err)
+	}
+	if w, g := "3.1", res.FromVersion; w != g {
+		t.Errorf(fs, w, g)
+	}
+	if w, g := SchemaVersion, res.ToVersion; w != g {
+		t.Errorf(fs, w, g)
+	}
+	if w, g := len(schemaMigrations), len(res.Applied); w != g {
+		t.Errorf(fs, w, g)
+	}
+	version, err := dbm.GetSchemaVersion("schemamigration")
+	if err != nil {
+		t.Fatalf("GetSchemaVersion failed : %v", err)
+	}
+	if w, g := SchemaVersion, version; w != g {
+		t.Errorf(fs, w, g)
+	}
+	err = dbm.checkSchemaVersion(db, "schemamigration")
+	if err != nil {
+		t.Errorf("expected no error for migrated db, got %v", err)
+	}
+	applied, err = dbm.ListSchemaMigrations("schemamigration")
+	if err != nil {
+		t.Fatalf("ListSchemaMigrations failed : %v", err)
+	}
+	if w, g := len(schemaMigrations), len(applied); w != g {
+		t.Fatalf(fs, w, g)
+	}
+	for i, m := range applied {
+		if w, g := schemaMigrations[i].version, m.Version; w != g {
+			t.Errorf(fs, w, g)
+		}
+		if m.Timestamp == "" {
+			t.Errorf("expected timestamp for applied migration %s", m.Version)
+		}
+	}
+
+	// The reversed strings are set for existing entries and transcriptions
+	lexRef := lex.NewLexRef("schemamigration", "lex1")
+	es, err := dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{WordSuffix: "RFIL"}})
+	if err != nil {
+		t.Fatalf("LookUpIntoSlice failed : %v", err)
+	}
+	if w, g := 1, len(es); w != g {
+		t.Fatalf(fs, w, g)
+	}
+	es, err = dbm.LookUpIntoSlice(DBMQuery{LexRefs: []lex.LexRef{lexRef}, Query: Query{TranscriptionSuffix: "f i: l"}})
+	if err != nil {
+		t.Fatalf("LookUpIntoSlice failed : %v", err)
+	}
+	if w, g := 1, len(es); w != g {
+		t.Fatalf(fs, w, g)
+	}
+
+	// Existing entries can be updated, with revision and history
+	e := es[0]
+	if w, g := int64(1), e.Revision; w != g {
+		t.Errorf(fs, w, g)
+	}
+	e.Transcriptions[0].Strn = "\" 9 r . f I l"
+	e.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor"}
+	e, updated, err := dbm.UpdateEntry(e)
+	if err != nil {
+		t.Fatalf("UpdateEntry failed : %v", err)
+	}
+	if !updated {
+		t.Errorf("expected entry to be updated")
+	}
+	if w, g := int64(2), e.Revision; w != g {
+		t.Errorf(fs, w, g)
+	}
+	hist, err := dbm.EntryHistory(lexRef, e.ID)
+	if err != nil {
+		t.Fatalf("EntryHistory failed : %v", err)
+	}
+	if w, g := 1, len(hist); w != g {
+		t.Errorf(fs, w, g)
+	}
+
+	// Nothing to do for an up-to-date db
+	res, err = dbm.MigrateDB("schemamigration")
+	if err != nil {
+		t.Fatalf("MigrateDB failed : %v", err)
+	}
+	if w, g := 0, len(res.Applied); w != g {
+		t.Errorf(fs, w, g)
+	}
+}
+
+func TestOpenDBSchemaCheckSqlite(t *testing.T) {
+	dir := t.TempDir()
+	db := openSchema31TestDBSqlite(t, filepath.Join(dir, "testlex_schemacheck.db"))
+	db.Close()
+
+	dbm := NewSqliteDBManager()
+	err := dbm.OpenDB(dir, "testlex_schemacheck")
+	if err == nil {
+		t.Errorf("expected error for out-of-date db")
+	}
+	if dbm.ContainsDB("testlex_schemacheck") {
+		t.Errorf("expected out-of-date db not to be opened")
+	}
+
+	dbm.SchemaCheck = MigrateOutdatedSchema
+	err = dbm.OpenDB(dir, "testlex_schemacheck")
+	if err != nil {
+		t.Fatalf("OpenDB failed : %v", err)
+	}
+	defer dbm.CloseDB("testlex_schemacheck")
+	version, err := dbm.GetSchemaVersion("testlex_schemacheck")
+	if err != nil {
+		t.Fatalf("GetSchemaVersion failed : %v", err)
+	}
+	if w, g := SchemaVersion, version; w != g {
+		t.Errorf(fs, w, g)
+	}
+
+	// A new db is created with the current schema version, and no applied migrations
+	err = dbm.DefineDB(".", "testlex_schemacheck_new")
+	if err != nil {
+		t.Fatalf("DefineDB failed : %v", err)
+	}
+	defer dbm.DropDB(".", "testlex_schemacheck_new")
+	defer dbm.CloseDB("testlex_schemacheck_new")
+	pending, err := dbm.PendingSchemaMigrations("testlex_schemacheck_new")
+	if err != nil {
+		t.Fatalf("PendingSchemaMigrations failed : %v", err)
+	}
+	if w, g := 0, len(pending); w != g {
+		t.Errorf(fs, w, g)
+	}
+	applied, err := dbm.ListSchemaMigrations("testlex_schemacheck_new")
+	if err != nil {
+		t.Fatalf("ListSchemaMigrations failed : %v", err)
+	}
+	if w, g := 0, len(applied); w != g {
+		t.Errorf(fs, w, g)
+	}
+}
+
+// A db labelled 3.2 by a development version may already contain the changes of the later migrations
+func TestSchemaMigrationDoneSqlite(t *testing.T) {
+	dbm := NewSqliteDBManager()
+	err := dbm.DefineDB(".", "testlex_schemamigration_done")
+	if err != nil {
+		t.Fatalf("DefineDB failed : %v", err)
+	}
+	defer dbm.DropDB(".", "testlex_schemamigration_done")
+	defer dbm.CloseDB("testlex_schemamigration_done")
+
+	db := dbm.dbs["testlex_schemamigration_done"]
+	_, err = db.Exec("UPDATE SchemaVersion SET name = '3.2'")
+	if err != nil {
+		t.Fatalf("Failed to update schema version : %v", err)
+	}
+
+	res, err := dbm.MigrateDB("testlex_schemamigration_done")
+	if err != nil {
+		t.Fatalf("MigrateDB failed : %v", err)
+	}
+	if w, g := len(schemaMigrations)-1, len(res.Applied); w != g {
+		t.Errorf(fs, w, g)
+	}
+	if w, g := SchemaVersion, res.ToVersion; w != g {
+		t.Errorf(fs, w, g)
+	}
+}
+
+func TestPendingSchemaMigrations(t *testing.T) {
+	for _, v := range []string{"", "x", "3.0", "3.1.5", "99"} {
+		_, err := pendingSchemaMigrations(v)
+		if err == nil {
+			t.Errorf("expected error for schema version '%s'", v)
+		}
+	}
+	ms, err := pendingSchemaMigrations(SchemaVersion)
+	if err != nil {
+		t.Errorf("pendingSchemaMigrations failed : %v", err)
+	}
+	if w, g := 0, len(ms); w != g {
+		t.Errorf(fs, w, g)
+	}
+	ms, err = pendingSchemaMigrations(oldestMigratableSchemaVersion)
+	if err != nil {
+		t.Errorf("pendingSchemaMigrations failed : %v", err)
+	}
+	if len(ms) == 0 || ms[0].version != "3.2" {
+		t.Errorf("expected first pending migration to be 3.2, got %#v", ms)
+	}
+
+	for _, c := range []struct {
+		v1, v2 string
+		cmp    int
+	}{
+		{"3.1", "3.1", 0},
+		{"3", "3.0", 0},
+		{"3.1", "3.2", -1},
+		{"3.2", "3.10", -1},
+		{"4", "3.10", 1},
+	} {
+		cmp, err := compareSchemaVersions(c.v1, c.v2)
+		if err != nil {
+			t.Errorf("compareSchemaVersions failed : %v", err)
+		}
+		if w, g := c.cmp, cmp; w != g {
+			t.Errorf("%s vs %s: "+fs, c.v1, c.v2, w, g)
+		}
+	}
+}
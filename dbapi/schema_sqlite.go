@@ -4,12 +4,18 @@ package dbapi
 const SqliteSchema = `
 
 -- TODO: Remove!
---DROP TABLE IF EXISTS SchemaVersion, Lexicon, Entry, EntryComment, Lemma2Entry, Lemma, Transcription, EntryTag, EntryValidation, EntryStatus;
+--DROP TABLE IF EXISTS SchemaVersion, SchemaMigration, Lexicon, Entry, EntryComment, Lemma2Entry, Lemma, Transcription, EntryTag, EntryValidation, EntryStatus, EntryHistory, Snapshot, SnapshotEntry;
 
 -- To keep track of the version of this schema
 CREATE TABLE SchemaVersion (name varchar(255) not null);
 
-INSERT INTO SchemaVersion VALUES (` + SchemaVersion + `);
+INSERT INTO SchemaVersion VALUES ('` + SchemaVersion + `');
+
+-- Schema migrations applied to the database (see schema_migration.go). A database created with the current schema has no applied migrations.
+CREATE TABLE SchemaMigration (
+    version varchar(128) not null,
+    description text not null,
+    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null);
 
 -- Each lexical entry belongs to a lexicon.
 -- The Lexicon table defines a lexicon through a unique name, along with the name a of symbol set and a locale
@@ -66,10 +72,12 @@ CREATE TABLE Entry (
     language varchar(128) not null,
     -- strn varchar(128) not null,
     strn text not null,
+    reversedStrn text, -- strn reversed, for suffix search using the index
     lexiconId integer not null,
     partOfSpeech varchar(128),
     morphology varchar(128),
     preferred integer not null default 0, -- TODO Why doesn't it work when changing integer -> boolean? 
+    revision integer not null default 1, -- incremented on each update, for optimistic concurrency control
 foreign key (lexiconId) references Lexicon(id));
 CREATE INDEX idx28d70584 on Entry (language);
 CREATE INDEX idx15890407 on Entry (strn);
@@ -78,6 +86,7 @@ CREATE INDEX entrypref ON Entry (preferred);
 CREATE INDEX idx4a250778 on Entry (strn,language);
 CREATE INDEX estrnpref on Entry (strn,preferred);
 CREATE INDEX idid on Entry (id, lexiconId);
+CREATE INDEX erevstrn on Entry (reversedStrn);
 
 
 -- CREATE TABLE Tag (
@@ -171,10 +180,12 @@ CREATE TABLE Transcription (
     language varchar(128) not null,
     -- strn varchar(128) not null,
     strn text not null,
+    reversedStrn text, -- strn reversed, for suffix search using the index
     sources TEXT not null,
 foreign key (entryId) references Entry(id) on delete cascade);
 CREATE INDEX traeid ON Transcription (entryId);
 CREATE INDEX idtraeid ON Transcription (id, entryId);
+CREATE INDEX trarevstrn ON Transcription (reversedStrn);
 
 -- CREATE TABLE TranscriptionStatus (
 --    name varchar(128) not null,
@@ -197,6 +208,40 @@ CREATE INDEX l2eind2 on Lemma2Entry (lemmaId);
 CREATE UNIQUE INDEX l2euind on Lemma2Entry (lemmaId,entryId);
 CREATE UNIQUE INDEX idx46cf073d on Lemma2Entry (entryId);
 
+-- Edit history of entries. Each row records an insert, update or delete of an entry,
+-- along with the changed fields (JSON) and the complete entry after the change (JSON).
+-- There is no foreign key to Entry, since the history should be kept for deleted entries.
+CREATE TABLE EntryHistory (
+    id integer not null primary key autoincrement,
+    entryId integer not null,
+    lexiconId integer not null,
+    action varchar(128) not null,
+    source varchar(128) not null,
+    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null,
+    changes text not null,
+    entry text not null);
+CREATE INDEX ehentid ON EntryHistory (entryId);
+CREATE INDEX ehlexentid ON EntryHistory (lexiconId, entryId);
+
+-- Snapshots are named, frozen copies of the content of a lexicon (e.g., a release shipped to a TTS voice).
+-- Each snapshot entry holds the complete entry (JSON) at the time of the snapshot.
+-- A lexicon cannot be deleted while it has snapshots.
+CREATE TABLE Snapshot (
+    id integer not null primary key autoincrement,
+    lexiconId integer not null,
+    name varchar(128) not null,
+    Timestamp DATETIME DEFAULT CURRENT_TIMESTAMP not null,
+    foreign key (lexiconId) references Lexicon(id) on delete restrict);
+CREATE UNIQUE INDEX snaplexname ON Snapshot (lexiconId, name);
+
+CREATE TABLE SnapshotEntry (
+    id integer not null primary key autoincrement,
+    snapshotId integer not null,
+    entryId integer not null,
+    entry text not null,
+    foreign key (snapshotId) references Snapshot(id) on delete cascade);
+CREATE INDEX snapentsnapid ON SnapshotEntry (snapshotId);
+
 -- CREATE TABLE SurfaceForm2Entry (
 --    entryId bigint not null,
 --    surfaceFormId bigint not null,
@@ -0,0 +1,94 @@
+package dbapi
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The databases used by Test_SharedMariaDB (see scripts/mariadb_setup.sql)
+const (
+	mariaDBTestDB  = "wikispeech_pronlex_test_shared"
+	mariaDBTestDB2 = "wikispeech_pronlex_test_shared2"
+)
+
+// openMariaDBTestDB opens a MariaDB test database, and resets it to an empty lexicon database. The db is closed when the test is done.
+func openMariaDBTestDB(t *testing.T, dbName string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("mysql", "speechoid:@tcp(127.0.0.1:3306)/"+dbName)
+	if err != nil {
+		t.Fatalf("Failed to open db %s : %v", dbName, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = execSchemaMariadb(db) // Creates new lexicon database
+	if err != nil {
+		t.Fatalf("Failed to create lexicon db: %v", err)
+	}
+	return db
+}
+
+// Test_SharedMariaDB runs the tests that are shared with sqlite, each one on a newly reset test database
+func Test_SharedMariaDB(t *testing.T) {
+	dbif := mariaDBIF{}
+	tests := []struct {
+		name string
+		test func(t *testing.T, dbif DBIF, db *sql.DB)
+	}{
+		{"EntryHistory", testEntryHistory},
+		{"RevertEntry", testRevertEntry},
+		{"UpdateConflict", testUpdateConflict},
+		{"UnsetPreferred", testUnsetPreferred},
+		{"Snapshots", testSnapshots},
+		{"MergeLexicons", testMergeLexicons},
+		{"ImportModes", testImportModes},
+		{"ImportErrors", testImportErrors},
+		{"Filter", testFilter},
+		{"Sorting", testSorting},
+		{"QueryStats", testQueryStats},
+		{"Suffix", testSuffix},
+		{"PhonemeSearch", testPhonemeSearch},
+		{"FullText", testFullText},
+		{"LookUpWithFallback", testLookUpWithFallback},
+		{"Disambiguate", testDisambiguate},
+		{"BulkUpdate", testBulkUpdate},
+		{"DeleteEntries", testDeleteEntries},
+		// copies a lexicon within the db, and into a second db
+		{"CopyLexicon", func(t *testing.T, dbif DBIF, db *sql.DB) {
+			testCopyLexicon(t, dbif, db, openMariaDBTestDB(t, mariaDBTestDB2))
+		}},
+		// copies a sqlite db into the mariadb db
+		{"CopyDB", func(t *testing.T, dbif DBIF, db *sql.DB) {
+			testCopyDB(t, db, dbif)
+		}},
+		{"SchemaMigration", func(t *testing.T, dbif DBIF, db *sql.DB) {
+			_, err := db.Exec(mariaDBDropTableStmt)
+			if err != nil {
+				t.Fatalf("Failed to drop tables: %v", err)
+			}
+			// Creates a lexicon database with the schema of version 3.1
+			schema, err := os.ReadFile(filepath.Join("test_data", "schema_3.1_mariadb.sql"))
+			if err != nil {
+				t.Fatalf("Failed to read schema : %v", err)
+			}
+			for _, s := range strings.Split(string(schema), ";\n") {
+				if strings.TrimSpace(s) == "" {
+					continue
+				}
+				_, err = db.Exec(s)
+				if err != nil {
+					t.Fatalf("Failed to create lexicon db: %v", err)
+				}
+			}
+			testSchemaMigration(t, dbif, db)
+		}},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, dbif, openMariaDBTestDB(t, mariaDBTestDB))
+		})
+	}
+}
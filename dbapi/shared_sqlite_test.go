@@ -0,0 +1,38 @@
+package dbapi
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// openSqliteTestDB opens a sqlite db file, using the same settings as the sqlite DBManager. A new db has no schema.
+func openSqliteTestDB(t testing.TB, dbPath string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3_with_regexp", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open db file %s : %v", dbPath, err)
+	}
+	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	if err != nil {
+		t.Fatalf("Failed to call PRAGMA on db : %v", err)
+	}
+	_, err = db.Exec("PRAGMA case_sensitive_like=ON")
+	if err != nil {
+		t.Fatalf("Failed to exec PRAGMA call %v", err)
+	}
+	return db
+}
+
+// newSqliteTestDB creates an empty lexicon db in a temporary directory of the test. The db is closed when the test is done.
+func newSqliteTestDB(t testing.TB) *sql.DB {
+	t.Helper()
+	db := openSqliteTestDB(t, filepath.Join(t.TempDir(), "testlex.db"))
+	t.Cleanup(func() { db.Close() })
+
+	_, err := execSchemaSqlite(db) // Creates new lexicon database
+	if err != nil {
+		t.Fatalf("Failed to create lexicon db: %v", err)
+	}
+	return db
+}
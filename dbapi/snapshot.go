@@ -0,0 +1,195 @@
+package dbapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+// snapshotChunkSize is the number of entries looked up at a time when creating a snapshot
+const snapshotChunkSize = 500
+
+func createSnapshot(dbif DBIF, db *sql.DB, lexName string, name string) (Snapshot, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("createSnapshot failed to start db transaction : %v", err)
+	}
+	defer tx.Commit()
+
+	res, err := createSnapshotTx(dbif, tx, lexName, name)
+	if err != nil {
+		msg := fmt.Sprintf("createSnapshot failed : %v", err)
+		err2 := tx.Rollback()
+		if err2 != nil {
+			msg = fmt.Sprintf("%s : rollback failed : %v", msg, err2)
+		}
+		return res, fmt.Errorf(msg)
+	}
+	return res, nil
+}
+
+// createSnapshotTx copies all entries of a lexicon (including transcriptions, lemma, tag, status, comments and validations) into a new snapshot. The snapshot name must be unique for the lexicon.
+func createSnapshotTx(dbif DBIF, tx *sql.Tx, lexName string, name string) (Snapshot, error) {
+	var res Snapshot
+
+	if trm(name) == "" {
+		return res, fmt.Errorf("snapshot name must not be empty")
+	}
+
+	l, err := dbif.getLexiconTx(tx, lexName)
+	if err != nil {
+		return res, err
+	}
+
+	var n int64
+	err = tx.QueryRow("SELECT count(*) FROM Snapshot WHERE lexiconId = ? AND name = ?", l.id, name).Scan(&n)
+	if err != nil {
+		return res, fmt.Errorf("failed to look up snapshot '%s' : %v", name, err)
+	}
+	if n > 0 {
+		return res, fmt.Errorf("snapshot '%s' already exists for lexicon '%s'", name, lexName)
+	}
+
+	sqlRes, err := tx.Exec("INSERT INTO Snapshot (lexiconId, name) VALUES (?, ?)", l.id, name)
+	if err != nil {
+		return res, fmt.Errorf("failed to insert snapshot '%s' : %v", name, err)
+	}
+	res.ID, err = sqlRes.LastInsertId()
+	if err != nil {
+		return res, fmt.Errorf("failed to get snapshot id : %v", err)
+	}
+	res.Name = name
+
+	lexNames := []lex.LexName{lex.LexName(lexName)}
+	ids, err := dbif.lookUpIdsTx(tx, lexNames, Query{})
+	if err != nil {
+		return res, err
+	}
+	for i := 0; i < len(ids); i += snapshotChunkSize {
+		j := i + snapshotChunkSize
+		if j > len(ids) {
+			j = len(ids)
+		}
+		var esw lex.EntrySliceWriter
+		err = dbif.lookUpTx(tx, lexNames, Query{EntryIDs: ids[i:j]}, &esw)
+		if err != nil {
+			return res, err
+		}
+		for _, e := range esw.Entries {
+			entryJSON, err := json.Marshal(e)
+			if err != nil {
+				return res, fmt.Errorf("failed to marshal entry id '%d' : %v", e.ID, err)
+			}
+			_, err = tx.Exec("INSERT INTO SnapshotEntry (snapshotId, entryId, entry) VALUES (?, ?, ?)", res.ID, e.ID, string(entryJSON))
+			if err != nil {
+				return res, fmt.Errorf("failed to insert snapshot entry id '%d' : %v", e.ID, err)
+			}
+			res.EntryCount++
+		}
+	}
+
+	err = tx.QueryRow("SELECT Timestamp FROM Snapshot WHERE id = ?", res.ID).Scan(&res.Timestamp)
+	if err != nil {
+		return res, fmt.Errorf("failed to look up snapshot timestamp : %v", err)
+	}
+
+	return res, nil
+}
+
+// listSnapshots lists the snapshots of a lexicon, oldest snapshot first
+func listSnapshots(db *sql.DB, lexName string) ([]Snapshot, error) {
+	var res = []Snapshot{}
+
+	var lexID int64
+	err := db.QueryRow("SELECT id FROM Lexicon WHERE name = ?", lexName).Scan(&lexID)
+	if err == sql.ErrNoRows {
+		return res, fmt.Errorf("listSnapshots : no such lexicon '%s'", lexName)
+	}
+	if err != nil {
+		return res, fmt.Errorf("listSnapshots : failed to look up lexicon '%s' : %v", lexName, err)
+	}
+
+	q := "SELECT Snapshot.id, Snapshot.name, Snapshot.Timestamp, count(SnapshotEntry.id) FROM Snapshot LEFT JOIN SnapshotEntry ON SnapshotEntry.snapshotId = Snapshot.id WHERE Snapshot.lexiconId = ? GROUP BY Snapshot.id, Snapshot.name, Snapshot.Timestamp ORDER BY Snapshot.id"
+	rows, err := db.Query(q, lexID)
+	if err != nil {
+		return res, fmt.Errorf("listSnapshots : failed to query snapshots : %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Snapshot
+		err = rows.Scan(&s.ID, &s.Name, &s.Timestamp, &s.EntryCount)
+		if err != nil {
+			return res, fmt.Errorf("listSnapshots : failed to scan row : %v", err)
+		}
+		res = append(res, s)
+	}
+	err = rows.Err()
+	if err != nil {
+		return res, fmt.Errorf("listSnapshots : %v", err)
+	}
+
+	return res, nil
+}
+
+// deleteSnapshot deletes a snapshot of a lexicon, along with its entries
+func deleteSnapshot(db *sql.DB, lexName string, name string) error {
+	q := "DELETE FROM Snapshot WHERE name = ? AND lexiconId IN (SELECT id FROM Lexicon WHERE name = ?)"
+	res, err := db.Exec(q, name, lexName)
+	if err != nil {
+		return fmt.Errorf("deleteSnapshot : failed to delete snapshot '%s' : %v", name, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("deleteSnapshot : failed to call RowsAffected : %v", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("deleteSnapshot : no snapshot '%s' for lexicon '%s'", name, lexName)
+	}
+	return nil
+}
+
+// exportSnapshot writes the entries of a snapshot to out, ordered by entry id. The entries are written as they were when the snapshot was created, with lexRef as lexicon reference.
+func exportSnapshot(db *sql.DB, lexRef lex.LexRef, name string, out lex.EntryWriter) error {
+	var snapshotID int64
+	q := "SELECT Snapshot.id FROM Snapshot, Lexicon WHERE Snapshot.lexiconId = Lexicon.id AND Lexicon.name = ? AND Snapshot.name = ?"
+	err := db.QueryRow(q, string(lexRef.LexName), name).Scan(&snapshotID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("exportSnapshot : no snapshot '%s' for lexicon '%s'", name, lexRef.LexName)
+	}
+	if err != nil {
+		return fmt.Errorf("exportSnapshot : failed to look up snapshot '%s' : %v", name, err)
+	}
+
+	rows, err := db.Query("SELECT entry FROM SnapshotEntry WHERE snapshotId = ? ORDER BY entryId", snapshotID)
+	if err != nil {
+		return fmt.Errorf("exportSnapshot : failed to query snapshot entries : %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryJSON string
+		err = rows.Scan(&entryJSON)
+		if err != nil {
+			return fmt.Errorf("exportSnapshot : failed to scan row : %v", err)
+		}
+		var e lex.Entry
+		err = json.Unmarshal([]byte(entryJSON), &e)
+		if err != nil {
+			return fmt.Errorf("exportSnapshot : failed to unmarshal entry : %v", err)
+		}
+		e.LexRef = lexRef
+		err = out.Write(e)
+		if err != nil {
+			return fmt.Errorf("exportSnapshot : error writing to lex.EntryWriter : %v", err)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("exportSnapshot : %v", err)
+	}
+
+	return nil
+}
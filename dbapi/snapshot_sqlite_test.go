@@ -0,0 +1,225 @@
+package dbapi
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+	"github.com/stts-se/pronlex/line"
+)
+
+func TestSnapshotSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testSnapshots(t, sqliteDBIF{}, db)
+}
+
+// testSnapshots is shared between the sqlite and mariadb tests
+func testSnapshots(t *testing.T, dbif DBIF, db *sql.DB) {
+	l := lexicon{name: "snapshot_test", symbolSetName: "ZZ", locale: "ll"}
+	l, err := dbif.defineLexicon(db, l)
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	lexRef := lex.NewLexRef("snapshot_db", l.name)
+
+	e1 := lex.Entry{Strn: "rom",
+		PartOfSpeech:   "NN",
+		Morphology:     "UTR IND SIN",
+		WordParts:      "rom",
+		Language:       "sv",
+		Tag:            "drink",
+		Lemma:          lex.Lemma{Strn: "rom", Paradigm: "s2r"},
+		Transcriptions: []lex.Transcription{{Strn: "\" r O m", Language: "sv"}},
+		Comments:       []lex.EntryComment{{Label: "label", Source: "imported", Comment: "a drink"}},
+		EntryStatus:    lex.EntryStatus{Name: "ok", Source: "imported"}}
+	e2 := lex.Entry{Strn: "bil",
+		PartOfSpeech:   "NN",
+		WordParts:      "bil",
+		Language:       "sv",
+		Transcriptions: []lex.Transcription{{Strn: "\" b i: l", Language: "sv"}},
+		EntryStatus:    lex.EntryStatus{Name: "unchecked", Source: "imported"}}
+
+	ids, err := dbif.insertEntries(db, l, []lex.Entry{e1, e2})
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	snapshots, err := listSnapshots(db, l.name)
+	if err != nil {
+		t.Fatalf("Failed to list snapshots : %v", err)
+	}
+	if w, g := 0, len(snapshots); w != g {
+		t.Fatalf("Expected %d snapshots, got %d", w, g)
+	}
+
+	_, err = createSnapshot(dbif, db, l.name, "")
+	if err == nil {
+		t.Errorf("Expected error for empty snapshot name, got nil")
+	}
+	_, err = createSnapshot(dbif, db, "no_such_lexicon", "release1")
+	if err == nil {
+		t.Errorf("Expected error for non-existing lexicon, got nil")
+	}
+
+	s, err := createSnapshot(dbif, db, l.name, "release1")
+	if err != nil {
+		t.Fatalf("Failed to create snapshot : %v", err)
+	}
+	if w, g := int64(2), s.EntryCount; w != g {
+		t.Errorf("Expected %d entries, got %d", w, g)
+	}
+	if s.Timestamp == "" {
+		t.Errorf("Expected snapshot timestamp, got empty string")
+	}
+
+	_, err = createSnapshot(dbif, db, l.name, "release1")
+	if err == nil {
+		t.Errorf("Expected error for duplicate snapshot name, got nil")
+	}
+
+	// Changes after the snapshot should not affect the snapshot
+	dbE, err := dbif.getEntryFromID(db, ids[0])
+	if err != nil {
+		t.Fatalf("Failed to get entry : %v", err)
+	}
+	dbE.Transcriptions = []lex.Transcription{{Strn: "\" r u m", Language: "sv"}}
+	dbE.EntryStatus = lex.EntryStatus{Name: "ok", Source: "editor1"}
+	_, _, err = dbif.updateEntry(db, dbE)
+	if err != nil {
+		t.Fatalf("Failed to update entry : %v", err)
+	}
+	_, err = dbif.deleteEntry(db, ids[1], l.name, "")
+	if err != nil {
+		t.Fatalf("Failed to delete entry : %v", err)
+	}
+
+	var esw lex.EntrySliceWriter
+	err = exportSnapshot(db, lexRef, "release1", &esw)
+	if err != nil {
+		t.Fatalf("Failed to export snapshot : %v", err)
+	}
+	if w, g := 2, len(esw.Entries); w != g {
+		t.Fatalf("Expected %d entries, got %d", w, g)
+	}
+	res := esw.Entries[0]
+	if w, g := "rom", res.Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := lexRef, res.LexRef; w != g {
+		t.Errorf("Expected '%v', got '%v'", w, g)
+	}
+	if w, g := 1, len(res.Transcriptions); w != g {
+		t.Fatalf("Expected %d transcriptions, got %d", w, g)
+	}
+	if w, g := "\" r O m", res.Transcriptions[0].Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "s2r", res.Lemma.Paradigm; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "drink", res.Tag; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := "imported", res.EntryStatus.Source; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := 1, len(res.Comments); w != g {
+		t.Errorf("Expected %d comments, got %d", w, g)
+	}
+	if w, g := "bil", esw.Entries[1].Strn; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+
+	// Export using the line.WS format
+	wsFmt, err := line.NewWS()
+	if err != nil {
+		t.Fatalf("Failed to create WS format : %v", err)
+	}
+	var buf bytes.Buffer
+	err = exportSnapshot(db, lexRef, "release1", line.FileWriter{Parser: wsFmt, Writer: &buf})
+	if err != nil {
+		t.Fatalf("Failed to export snapshot : %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if w, g := 2, len(lines); w != g {
+		t.Fatalf("Expected %d lines, got %d", w, g)
+	}
+	if !strings.HasPrefix(lines[0], "rom\t") {
+		t.Errorf("Expected line starting with 'rom', got '%s'", lines[0])
+	}
+
+	err = exportSnapshot(db, lexRef, "release2", &esw)
+	if err == nil {
+		t.Errorf("Expected error for non-existing snapshot, got nil")
+	}
+
+	s2, err := createSnapshot(dbif, db, l.name, "release2")
+	if err != nil {
+		t.Fatalf("Failed to create snapshot : %v", err)
+	}
+	if w, g := int64(1), s2.EntryCount; w != g {
+		t.Errorf("Expected %d entries, got %d", w, g)
+	}
+
+	snapshots, err = listSnapshots(db, l.name)
+	if err != nil {
+		t.Fatalf("Failed to list snapshots : %v", err)
+	}
+	if w, g := 2, len(snapshots); w != g {
+		t.Fatalf("Expected %d snapshots, got %d", w, g)
+	}
+	if w, g := "release1", snapshots[0].Name; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := int64(2), snapshots[0].EntryCount; w != g {
+		t.Errorf("Expected %d entries, got %d", w, g)
+	}
+	if w, g := "release2", snapshots[1].Name; w != g {
+		t.Errorf("Expected '%s', got '%s'", w, g)
+	}
+	if w, g := int64(1), snapshots[1].EntryCount; w != g {
+		t.Errorf("Expected %d entries, got %d", w, g)
+	}
+
+	// A lexicon with snapshots cannot be deleted
+	l2 := lexicon{name: "snapshot_test2", symbolSetName: "ZZ", locale: "ll"}
+	_, err = dbif.defineLexicon(db, l2)
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	_, err = createSnapshot(dbif, db, l2.name, "release1")
+	if err != nil {
+		t.Fatalf("Failed to create snapshot : %v", err)
+	}
+	err = dbif.deleteLexicon(db, l2.name)
+	if err == nil {
+		t.Errorf("Expected error for deleting lexicon with snapshots, got nil")
+	}
+	_, err = db.Exec("DELETE FROM Lexicon WHERE name = ?", l2.name)
+	if err == nil {
+		t.Errorf("Expected foreign key error for deleting lexicon with snapshots, got nil")
+	}
+	snapshots, err = listSnapshots(db, l2.name)
+	if err != nil {
+		t.Fatalf("Failed to list snapshots : %v", err)
+	}
+	if w, g := 1, len(snapshots); w != g {
+		t.Fatalf("Expected %d snapshots, got %d", w, g)
+	}
+
+	err = deleteSnapshot(db, l2.name, "release2")
+	if err == nil {
+		t.Errorf("Expected error for non-existing snapshot, got nil")
+	}
+	err = deleteSnapshot(db, l2.name, "release1")
+	if err != nil {
+		t.Fatalf("Failed to delete snapshot : %v", err)
+	}
+	err = dbif.deleteLexicon(db, l2.name)
+	if err != nil {
+		t.Errorf("Failed to delete lexicon : %v", err)
+	}
+}
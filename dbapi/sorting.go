@@ -0,0 +1,139 @@
+package dbapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SortKey defines the sort order of lookup results
+type SortKey string
+
+const (
+	// SortByID sorts entries by Entry.ID (default)
+	SortByID SortKey = "id"
+
+	// SortByStrn sorts entries by orthography
+	SortByStrn SortKey = "strn"
+
+	// SortByReversedStrn sorts entries by reversed orthography, i.e., grouping words with the same suffix
+	SortByReversedStrn SortKey = "reversedStrn"
+
+	// SortByStatusTimestamp sorts entries by the timestamp of the current entry status
+	SortByStatusTimestamp SortKey = "statusTimestamp"
+
+	// SortByLemma sorts entries by lemma form
+	SortByLemma SortKey = "lemma"
+
+	// SortByPartOfSpeech sorts entries by part of speech
+	SortByPartOfSpeech SortKey = "partOfSpeech"
+
+	// SortByRelevance sorts entries by full-text search relevance, most relevant first (requires Query.CommentText or Query.FreeText)
+	SortByRelevance SortKey = "relevance"
+)
+
+// SortKeys lists the available sort keys
+var SortKeys = []SortKey{SortByID, SortByStrn, SortByReversedStrn, SortByStatusTimestamp, SortByLemma, SortByPartOfSpeech, SortByRelevance}
+
+// ParseSortKey returns the SortKey with the given name. The empty string is parsed as SortByID.
+func ParseSortKey(s string) (SortKey, error) {
+	if strings.TrimSpace(s) == "" {
+		return SortByID, nil
+	}
+	for _, k := range SortKeys {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	var keys []string
+	for _, k := range SortKeys {
+		keys = append(keys, string(k))
+	}
+	return SortByID, fmt.Errorf("unknown sort key '%s' (expected one of %s)", s, strings.Join(keys, ", "))
+}
+
+// sortKeyExpr returns an SQL expression for the sort key of the query, for the Entry table with the given alias, along with a slice of values corresponding to the '?':s of the expression.
+// Each expression has a single value per entry, so that the rows of an entry are kept together when the result is sorted.
+func sortKeyExpr(q Query, alias string) (string, []interface{}, error) {
+	var noArgs []interface{}
+	switch q.SortBy {
+	case SortByID, "":
+		return alias + ".id", noArgs, nil
+	case SortByStrn:
+		return alias + ".strn", noArgs, nil
+	case SortByReversedStrn:
+		return alias + ".reversedStrn", noArgs, nil
+	case SortByStatusTimestamp:
+		return "COALESCE((SELECT sks.timestamp FROM EntryStatus sks WHERE sks.entryId = " + alias + ".id AND sks.current = 1), '')", noArgs, nil
+	case SortByLemma:
+		return "COALESCE((SELECT MIN(skl.strn) FROM Lemma2Entry skle, Lemma skl WHERE skl.id = skle.lemmaId AND skle.entryId = " + alias + ".id), '')", noArgs, nil
+	case SortByPartOfSpeech:
+		return alias + ".partOfSpeech", noArgs, nil
+	case SortByRelevance:
+		if q.fullText == nil {
+			return "", noArgs, fmt.Errorf("sort key '%s' requires a full-text search", q.SortBy)
+		}
+		return fmt.Sprintf(q.fullText.rank, alias), q.fullText.rankArgs, nil
+	}
+	return "", noArgs, fmt.Errorf("unknown sort key '%s'", q.SortBy)
+}
+
+// reverseString reverses a string, rune by rune
+func reverseString(s string) string {
+	rs := []rune(s)
+	for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+		rs[i], rs[j] = rs[j], rs[i]
+	}
+	return string(rs)
+}
+
+// paged returns true if the query selects a page of entries, rather than all matching entries
+func (q Query) paged() bool {
+	return q.PageLength > 0 || q.Page > 0 || q.After > 0
+}
+
+// pageSQL selects the ids of the entries on the page defined by Query.Page, Query.PageLength and Query.After,
+// from the entries selected by idsSQL. Pages are counted in entries, not in rows of the joined tables.
+func pageSQL(q Query, idsSQL string, idsArgs []interface{}) (string, []interface{}, error) {
+	args := idsArgs
+	key, keyArgs, err := sortKeyExpr(q, "pe")
+	if err != nil {
+		return "", args, err
+	}
+	dir, cmp := "ASC", ">"
+	if q.SortDescending {
+		dir, cmp = "DESC", "<"
+	}
+
+	res := "SELECT pe.id FROM Entry pe WHERE pe.id IN (" + idsSQL + ")"
+
+	// Keyset pagination: entries sorted after the entry with id Query.After
+	if q.After > 0 {
+		if q.SortBy == SortByID || q.SortBy == "" {
+			res += " AND pe.id " + cmp + " ?"
+			args = append(args, q.After)
+		} else {
+			afterKey, afterKeyArgs, err := sortKeyExpr(q, "ce")
+			if err != nil {
+				return "", args, err
+			}
+			afterKey = "(SELECT " + afterKey + " FROM Entry ce WHERE ce.id = ?)"
+			afterKeyArgs = append(afterKeyArgs, q.After)
+			res += " AND (" + key + " " + cmp + " " + afterKey + " OR (" + key + " = " + afterKey + " AND pe.id " + cmp + " ?))"
+			args = append(args, keyArgs...)
+			args = append(args, afterKeyArgs...)
+			args = append(args, keyArgs...)
+			args = append(args, afterKeyArgs...)
+			args = append(args, q.After)
+		}
+	}
+
+	res += " ORDER BY " + key + " " + dir + ", pe.id " + dir
+	args = append(args, keyArgs...)
+
+	// When both PageLength and Page values are zero, no page limit is used
+	if q.PageLength > 0 || q.Page > 0 {
+		res += " LIMIT " + strconv.FormatInt(q.PageLength, 10) + " OFFSET " + strconv.FormatInt(q.PageLength*q.Page, 10)
+	}
+	return res, args, nil
+}
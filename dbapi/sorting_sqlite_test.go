@@ -0,0 +1,109 @@
+package dbapi
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestSortingSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testSorting(t, sqliteDBIF{}, db)
+}
+
+// testSorting is shared between the sqlite and mariadb tests
+func testSorting(t *testing.T, dbif DBIF, db *sql.DB) {
+	l, err := dbif.defineLexicon(db, lexicon{name: "sortlex", symbolSetName: "ZZ", locale: "ll"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+	lexNames := []lex.LexName{lex.LexName(l.name)}
+
+	entry := func(strn, pos, lemma string, nTrans int) lex.Entry {
+		e := lex.Entry{Strn: strn, PartOfSpeech: pos, Language: "sv", WordParts: strn, Lemma: lex.Lemma{Strn: lemma}, EntryStatus: lex.EntryStatus{Name: "ok", Source: "tst"}}
+		for i := 0; i < nTrans; i++ {
+			e.Transcriptions = append(e.Transcriptions, lex.Transcription{Strn: strings.Repeat("a ", i+1) + strn, Language: "sv"})
+		}
+		return e
+	}
+	es := []lex.Entry{
+		entry("kapa", "VB", "kapa", 3),
+		entry("bil", "NN", "bil", 1),
+		entry("apa", "NN", "apa", 2),
+		entry("hus", "AB", "hus", 2),
+		entry("ost", "NN", "ost", 1),
+	}
+	_, err = dbif.insertEntries(db, l, es)
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	lookUp := func(q Query) []lex.Entry {
+		res, err := dbif.lookUpIntoSlice(db, lexNames, q)
+		if err != nil {
+			t.Fatalf("lookUp failed for query %#v : %v", q, err)
+		}
+		return res
+	}
+	strns := func(es []lex.Entry) string {
+		var res []string
+		for _, e := range es {
+			res = append(res, e.Strn)
+		}
+		return strings.Join(res, " ")
+	}
+
+	for _, test := range []struct {
+		q      Query
+		expect string
+	}{
+		{Query{WordLike: "%"}, "kapa bil apa hus ost"},
+		{Query{WordLike: "%", SortBy: SortByStrn}, "apa bil hus kapa ost"},
+		{Query{WordLike: "%", SortBy: SortByStrn, SortDescending: true}, "ost kapa hus bil apa"},
+		{Query{WordLike: "%", SortBy: SortByReversedStrn}, "apa kapa bil hus ost"},
+		{Query{WordLike: "%", SortBy: SortByLemma, PageLength: 2, Page: 1}, "hus kapa"},
+		{Query{WordLike: "%", SortBy: SortByPartOfSpeech}, "hus bil apa ost kapa"},
+		{Query{WordLike: "%", SortBy: SortByStatusTimestamp}, "kapa bil apa hus ost"},
+		{Query{WordLike: "%", SortBy: SortByID, SortDescending: true, PageLength: 2}, "ost hus"},
+	} {
+		if w, g := test.expect, strns(lookUp(test.q)); w != g {
+			t.Errorf("query %#v : expected '%s', got '%s'", test.q, w, g)
+		}
+	}
+
+	// Pages are counted in entries, and each entry has all its transcriptions
+	page := lookUp(Query{WordLike: "%", PageLength: 2})
+	if w, g := "kapa bil", strns(page); w != g {
+		t.Errorf("expected '%s', got '%s'", w, g)
+	}
+	if w, g := 3, len(page[0].Transcriptions); w != g {
+		t.Errorf("expected %d, got %d", w, g)
+	}
+
+	// Keyset pagination through the whole lexicon
+	for _, sortDesc := range []bool{false, true} {
+		var all []lex.Entry
+		q := Query{WordLike: "%", SortBy: SortByReversedStrn, SortDescending: sortDesc, PageLength: 2}
+		for i := 0; i < 10; i++ {
+			page := lookUp(q)
+			if len(page) == 0 {
+				break
+			}
+			all = append(all, page...)
+			q.After = page[len(page)-1].ID
+		}
+		w := strns(lookUp(Query{WordLike: "%", SortBy: SortByReversedStrn, SortDescending: sortDesc}))
+		if g := strns(all); w != g {
+			t.Errorf("expected '%s', got '%s'", w, g)
+		}
+	}
+
+	// Invalid sort key
+	_, err = dbif.lookUpIntoSlice(db, lexNames, Query{WordLike: "%", SortBy: "nokey"})
+	if err == nil {
+		t.Errorf("expected error for invalid sort key, got nil")
+	}
+}
@@ -1,7 +1,7 @@
 package dbapi
 
 import (
-	"strconv"
+	"fmt"
 	"strings"
 
 	"github.com/stts-se/pronlex/lex"
@@ -99,7 +99,7 @@ func words(lexNames []lex.LexName, q Query) (string, []interface{}) {
 
 	//fmt.Printf("sql_gen QUERY : %#v\n", q)
 
-	if len(q.Words) == 0 && len(q.WordParts) == 0 && trm(q.WordLike) == "" && trm(q.WordPartsLike) == "" && trm(q.WordPartsRegexp) == "" && trm(q.WordRegexp) == "" && trm(q.PartOfSpeechLike) == "" && trm(q.PartOfSpeechRegexp) == "" && trm(q.LanguageLike) == "" && trm(q.MorphologyLike) == "" && len(q.EntryIDs) == 0 {
+	if len(q.Words) == 0 && len(q.WordParts) == 0 && trm(q.WordLike) == "" && trm(q.WordPartsLike) == "" && trm(q.WordPartsRegexp) == "" && trm(q.WordRegexp) == "" && trm(q.WordSuffix) == "" && trm(q.PartOfSpeechLike) == "" && trm(q.PartOfSpeechRegexp) == "" && trm(q.LanguageLike) == "" && trm(q.MorphologyLike) == "" && len(q.EntryIDs) == 0 {
 		return "", resv
 	} //else {
 	if len(q.Words) > 0 {
@@ -115,8 +115,9 @@ func words(lexNames []lex.LexName, q Query) (string, []interface{}) {
 		resv = append(resv, q.WordPartsLike)
 	}
 	if trm(q.WordPartsRegexp) != "" {
-		reses = append(reses, "Entry.wordParts REGEXP ?")
-		resv = append(resv, q.WordPartsRegexp)
+		c, v := regexpCond("Entry.wordParts", q.WordPartsRegexp)
+		reses = append(reses, c)
+		resv = append(resv, v...)
 	}
 	if len(q.EntryIDs) > 0 {
 		reses = append(reses, "Entry.id in "+nQs(len(q.EntryIDs)))
@@ -127,8 +128,13 @@ func words(lexNames []lex.LexName, q Query) (string, []interface{}) {
 		resv = append(resv, q.WordLike)
 	}
 	if trm(q.WordRegexp) != "" {
-		reses = append(reses, "Entry.strn REGEXP ?")
-		resv = append(resv, q.WordRegexp)
+		c, v := regexpCond("Entry.strn", q.WordRegexp)
+		reses = append(reses, c)
+		resv = append(resv, v...)
+	}
+	if trm(q.WordSuffix) != "" {
+		reses = append(reses, "Entry.reversedStrn LIKE ? ESCAPE '"+likeEscape+"'")
+		resv = append(resv, suffixLike(strings.ToLower(q.WordSuffix)))
 	}
 
 	if trm(q.LanguageLike) != "" {
@@ -144,8 +150,9 @@ func words(lexNames []lex.LexName, q Query) (string, []interface{}) {
 		resv = append(resv, q.PartOfSpeechLike)
 	}
 	if trm(q.PartOfSpeechRegexp) != "" {
-		reses = append(reses, "Entry.partOfSpeech REGEXP ?")
-		resv = append(resv, q.PartOfSpeechRegexp)
+		c, v := regexpCond("Entry.partOfSpeech", q.PartOfSpeechRegexp)
+		reses = append(reses, c)
+		resv = append(resv, v...)
 	}
 
 	//}
@@ -177,8 +184,9 @@ func lemmas(q Query) (string, []interface{}) {
 		resv = append(resv, q.LemmaLike)
 	}
 	if trm(q.LemmaRegexp) != "" {
-		reses = append(reses, "Lemma.strn REGEXP ?")
-		resv = append(resv, q.LemmaRegexp)
+		c, v := regexpCond("Lemma.strn", q.LemmaRegexp)
+		reses = append(reses, c)
+		resv = append(resv, v...)
 	}
 
 	if trm(q.ReadingLike) != "" {
@@ -186,16 +194,18 @@ func lemmas(q Query) (string, []interface{}) {
 		resv = append(resv, q.ReadingLike)
 	}
 	if trm(q.ReadingRegexp) != "" {
-		reses = append(reses, "Lemma.reading REGEXP ?")
-		resv = append(resv, q.ReadingRegexp)
+		c, v := regexpCond("Lemma.reading", q.ReadingRegexp)
+		reses = append(reses, c)
+		resv = append(resv, v...)
 	}
 	if trm(q.ParadigmLike) != "" {
 		reses = append(reses, "Lemma.paradigm like ?")
 		resv = append(resv, q.ParadigmLike)
 	}
 	if trm(q.ParadigmRegexp) != "" {
-		reses = append(reses, "Lemma.paradigm REGEXP ?")
-		resv = append(resv, q.ParadigmRegexp)
+		c, v := regexpCond("Lemma.paradigm", q.ParadigmRegexp)
+		reses = append(reses, c)
+		resv = append(resv, v...)
 	}
 
 	res := strings.Join(reses, " AND ")
@@ -216,14 +226,39 @@ func transcriptions(q Query) (string, []interface{}) {
 	}
 
 	if trm(q.TranscriptionRegexp) != "" {
-		reses = append(reses, "Transcription.strn REGEXP ?")
-		resv = append(resv, q.TranscriptionRegexp)
+		c, v := regexpCond("Transcription.strn", q.TranscriptionRegexp)
+		reses = append(reses, c)
+		resv = append(resv, v...)
+	}
+
+	if trm(q.TranscriptionSuffix) != "" {
+		reses = append(reses, "Transcription.reversedStrn LIKE ? ESCAPE '"+likeEscape+"'")
+		resv = append(resv, suffixLike(q.TranscriptionSuffix))
+	}
+
+	if trm(q.TranscriptionPhonemes) != "" {
+		c, v := regexpCond("Transcription.strn", q.transcriptionPhonemesRe)
+		reses = append(reses, c)
+		resv = append(resv, v...)
 	}
 
 	res := strings.Join(reses, " AND ")
 	return res, resv
 }
 
+// likeEscape is the escape character used in LIKE expressions generated from literal strings.
+// A backslash is not used, since it needs different quoting in Sqlite and MariaDB.
+const likeEscape = "!"
+
+// suffixLike converts a literal suffix into a LIKE expression matching the reversed strings ending with the suffix.
+// Since the reversed suffix is a prefix of the reversed string, the index on the reversed column can be used.
+func suffixLike(suffix string) string {
+	return likeEscaper.Replace(reverseString(suffix)) + "%"
+}
+
+// likeEscaper escapes the special characters of a literal string for use in a LIKE expression
+var likeEscaper = strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_")
+
 func entryStatuses(q Query) (string, []interface{}) {
 	var res string
 	var resv []interface{}
@@ -353,9 +388,9 @@ WHERE Entry.id = Transcription.entryId AND Entry.lexiconId = Lexicon.id` // Entr
 // AND Lexicon.id = ? ORDER BY Entry.id, Transcription.id ASC`
 
 // Queries db for all entries with transcriptions and optional lemma forms.
-var baseSQLSelect = "SELECT Lexicon.name, Entry.id, Entry.strn, Entry.language, Entry.partOfSpeech, Entry.morphology, Entry.wordParts, Entry.preferred, Transcription.id, Transcription.entryId, Transcription.strn, Transcription.language, Transcription.sources, Lemma.id, Lemma.strn, Lemma.reading, Lemma.paradigm, EntryTag.tag, EntryStatus.id, EntryStatus.name, EntryStatus.source, EntryStatus.timestamp, EntryStatus.current, EntryValidation.id, EntryValidation.level, EntryValidation.name, EntryValidation.message, EntryValidation.timestamp, EntryComment.id, EntryComment.label, EntryComment.source, EntryComment.comment " + baseSQLFrom
+var baseSQLSelect = "SELECT Lexicon.name, Entry.id, Entry.strn, Entry.language, Entry.partOfSpeech, Entry.morphology, Entry.wordParts, Entry.preferred, Entry.revision, Transcription.id, Transcription.entryId, Transcription.strn, Transcription.language, Transcription.sources, Lemma.id, Lemma.strn, Lemma.reading, Lemma.paradigm, EntryTag.tag, EntryStatus.id, EntryStatus.name, EntryStatus.source, EntryStatus.timestamp, EntryStatus.current, EntryValidation.id, EntryValidation.level, EntryValidation.name, EntryValidation.message, EntryValidation.timestamp, EntryComment.id, EntryComment.label, EntryComment.source, EntryComment.comment " + baseSQLFrom
 
-//var baseSQLCount = `SELECT count(distinct Entry.id) ` + baseSQLFrom
+var baseSQLCount = `SELECT count(distinct Entry.id) ` + baseSQLFrom
 
 var baseSQLSelectIds = `SELECT distinct Entry.id ` + baseSQLFrom
 
@@ -367,9 +402,16 @@ type sqlStmt struct {
 	values []interface{}
 }
 
-func appendQuery(sql string, lexNames []lex.LexName, q Query) (string, []interface{}) {
+func appendQuery(sql string, lexNames []lex.LexName, q Query) (string, []interface{}, error) {
 	var args []interface{}
 
+	if trm(q.TranscriptionPhonemes) != "" && q.transcriptionPhonemesRe == "" {
+		return sql, args, fmt.Errorf("phoneme search (Query.TranscriptionPhonemes) requires a symbol set, see DBManager.AddSymbolSet")
+	}
+	if q.hasFullText() && q.fullText == nil {
+		return sql, args, fmt.Errorf("full-text search (Query.CommentText, Query.FreeText) has not been compiled for the db engine")
+	}
+
 	// Query.Lexicons
 	l, lv := lexicons(lexNames)
 	args = append(args, lv...)
@@ -407,51 +449,101 @@ func appendQuery(sql string, lexNames []lex.LexName, q Query) (string, []interfa
 		ev = "EntryValidation.entryId = Entry.id"
 	}
 
+	// Query.Filter
+	f := ""
+	if q.Filter != nil {
+		var fv []interface{}
+		var err error
+		f, fv, err = q.Filter.sql()
+		if err != nil {
+			return sql, args, fmt.Errorf("invalid filter : %v", err)
+		}
+		args = append(args, fv...)
+	}
+
+	// Query.CommentText, Query.FreeText
+	ft := ""
+	if q.fullText != nil {
+		ft = q.fullText.cond
+		args = append(args, q.fullText.condArgs...)
+	}
+
 	// puts together pieces of sql created above with " and " in between
-	qRes := strings.TrimSpace(strings.Join(RemoveEmptyStrings([]string{l, w, le, t, es, us, tl, cl, vl, ev}), " AND "))
+	qRes := strings.TrimSpace(strings.Join(RemoveEmptyStrings([]string{l, w, le, t, es, us, tl, cl, vl, ev, f, ft}), " AND "))
 	if qRes != "" {
 		sql += " AND " + qRes
 	}
 	// log.Printf("DEBUG QUERY %#v", q)
 	// log.Printf("DEBUG QUERY RESULT %s\n\n", sql)
-	return sql, args
+	return sql, args, nil
 }
 
 // SelectEntriesSQL creates a SQL query string based on the values of
 // a Query struct instance, along with a slice of values,
 // corresponding to the params to be set (the '?':s of the query)
-func selectEntriesSQL(lexNames []lex.LexName, q Query) sqlStmt {
-	sqlQuery, args := appendQuery(baseSQLSelect, lexNames, q)
-
-	// sort by id to make sql rows -> Entry simpler
-	sqlQuery += " ORDER BY Entry.id, Transcription.id"
+func selectEntriesSQL(lexNames []lex.LexName, q Query) (sqlStmt, error) {
+	sqlQuery, args, err := appendQuery(baseSQLSelect, lexNames, q)
+	if err != nil {
+		return sqlStmt{}, err
+	}
 
+	// Pages are selected as a set of entry ids, so that a page doesn't cut an entry in half
 	// When both PageLength and Page values are zero, no page limit is used
 	// This is useful for example when exporting a complete lexicon
-	if q.PageLength > 0 || q.Page > 0 {
-		sqlQuery += " LIMIT " + strconv.FormatInt(q.PageLength, 10) + " OFFSET " + strconv.FormatInt(q.PageLength*q.Page, 10)
+	if q.paged() {
+		idsSQL, idsArgs, err := appendQuery(baseSQLSelectIds, lexNames, q)
+		if err != nil {
+			return sqlStmt{}, err
+		}
+		pSQL, pArgs, err := pageSQL(q, idsSQL, idsArgs)
+		if err != nil {
+			return sqlStmt{}, err
+		}
+		// the extra derived table is needed for MariaDB, that doesn't support LIMIT in IN subqueries
+		sqlQuery += " AND Entry.id IN (SELECT pg.id FROM (" + pSQL + ") pg)"
+		args = append(args, pArgs...)
 	}
-	return sqlStmt{sql: sqlQuery, values: args}
 
+	// all rows of an entry must be kept together, to make sql rows -> Entry simpler
+	key, keyArgs, err := sortKeyExpr(q, "Entry")
+	if err != nil {
+		return sqlStmt{}, err
+	}
+	dir := "ASC"
+	if q.SortDescending {
+		dir = "DESC"
+	}
+	if q.SortBy == SortByID || q.SortBy == "" {
+		sqlQuery += " ORDER BY Entry.id " + dir + ", Transcription.id"
+	} else {
+		sqlQuery += " ORDER BY " + key + " " + dir + ", Entry.id " + dir + ", Transcription.id"
+		args = append(args, keyArgs...)
+	}
+	return sqlStmt{sql: sqlQuery, values: args}, nil
 }
 
 // SelectEntryIdsSQL creates a SQL query string based on the values of
 // a Query struct instance, along with a slice of values,
 // corresponding to the params to be set (the '?':s of the query)
-func selectEntryIdsSQL(lexNames []lex.LexName, q Query) sqlStmt {
-	sqlQuery, args := appendQuery(baseSQLSelectIds, lexNames, q)
-	return sqlStmt{sql: sqlQuery, values: args}
+func selectEntryIdsSQL(lexNames []lex.LexName, q Query) (sqlStmt, error) {
+	sqlQuery, args, err := appendQuery(baseSQLSelectIds, lexNames, q)
+	if err != nil {
+		return sqlStmt{}, err
+	}
+	return sqlStmt{sql: sqlQuery, values: args}, nil
 }
 
 // CountEntriesSQL creates a SQL query string based on the values of
 // a Query struct instance, along with a slice of values,
-// corresponding to the params to be set (the '?':s of the query)
-/*
-func countEntriesSQL(lexNames []lex.LexName, q Query) sqlStmt {
-	sqlQuery, args := appendQuery(baseSQLCount, lexNames, q)
-	return sqlStmt{sql: sqlQuery, values: args}
+// corresponding to the params to be set (the '?':s of the query).
+// The count is the total number of matching entries, regardless of the page settings of the query.
+func countEntriesSQL(lexNames []lex.LexName, q Query) (sqlStmt, error) {
+	sqlQuery, args, err := appendQuery(baseSQLCount, lexNames, q)
+	if err != nil {
+		return sqlStmt{}, err
+	}
+	return sqlStmt{sql: sqlQuery, values: args}, nil
 }
-*/
 
 // // entriesFromIdsSelect builds an sql select and returns it along with slice of matching id values
 // func entriesFromIdsSelect(ids []int64) (string, []interface{}) {
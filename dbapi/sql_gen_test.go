@@ -98,7 +98,10 @@ func TestSql_nQs(t *testing.T) {
 
 func TestSql_SelectEntriesSQL(t *testing.T) {
 	q := Query{LemmaLike: "%gal_", ReadingLike: "%grus_"}
-	sq := selectEntriesSQL([]lex.LexName{}, q)
+	sq, err := selectEntriesSQL([]lex.LexName{}, q)
+	if err != nil {
+		t.Errorf("selectEntriesSQL failed : %v", err)
+	}
 	if sq.sql == "" {
 		t.Error(fs, "non empty", sq.sql)
 	}
@@ -109,3 +112,144 @@ func TestSql_SelectEntriesSQL(t *testing.T) {
 		t.Error(fs, 2, len(sq.values))
 	}
 }
+
+func TestSql_Filter(t *testing.T) {
+	f := Filter{Or: []Filter{
+		{Field: "partOfSpeech", Op: "like", Value: "PM%"},
+		{Not: &Filter{Field: "status", Op: "in", Values: []string{"ok", "checked"}}},
+	}}
+	s, v, err := f.sql()
+	if err != nil {
+		t.Errorf("Gah! %v", err)
+	}
+	x := "(Entry.partOfSpeech LIKE ? OR NOT (Entry.id IN (SELECT fs.entryId FROM EntryStatus fs WHERE fs.current = 1 AND fs.name IN (?,?))))"
+	if s != x {
+		t.Errorf(fs, x, s)
+	}
+	if len(v) != 3 {
+		t.Errorf(fs, 3, len(v))
+	}
+
+	for _, f := range []Filter{
+		{},
+		{Field: "nofield", Op: "eq", Value: "x"},
+		{Field: "strn", Op: "noop", Value: "x"},
+		{Field: "strn", Op: "in"},
+		{Field: "strn", Op: "eq", Values: []string{"x", "y"}},
+		{Field: "strn", Op: "eq", Value: "x", Not: &Filter{Field: "strn", Op: "eq", Value: "y"}},
+		{And: []Filter{{Field: "strn", Op: "eq", Value: "x"}, {}}},
+	} {
+		err = f.Validate()
+		if err == nil {
+			t.Errorf("expected error for filter %#v, got nil", f)
+		}
+	}
+}
+
+func TestSql_SuffixLike(t *testing.T) {
+	for in, x := range map[string]string{
+		"ning":  "gnin%",
+		"a: n":  "n :a%",
+		"5%":    "!%5%",
+		"_a!":   "!!a!_%",
+		"ärter": "reträ%",
+	} {
+		if r := suffixLike(in); r != x {
+			t.Errorf(fs, x, r)
+		}
+	}
+
+	s, v := words(nil, Query{WordSuffix: "NING"})
+	x := "Entry.reversedStrn LIKE ? ESCAPE '!'"
+	if s != x {
+		t.Errorf(fs, x, s)
+	}
+	if len(v) != 1 || v[0] != "gnin%" {
+		t.Errorf(fs, []interface{}{"gnin%"}, v)
+	}
+}
+
+func TestSql_FullTextQuery(t *testing.T) {
+	for in, x := range map[string][2]string{
+		"hund":                     {`"hund"`, `+hund`},
+		"hund koja":                {`"hund" "koja"`, `+hund +koja`},
+		`"stress pattern" verif*`:  {`"stress pattern" "verif"*`, `+"stress pattern" +verif*`},
+		`"wrong stress*" -hund OR`: {`"wrong stress" "hund" "OR"`, `+"wrong stress" +hund +OR`},
+		`sjö-sjuk (NEAR) "a" "" *`: {`"sjö sjuk" "NEAR" "a"`, `+"sjö sjuk" +NEAR +a`},
+		`åsna's "ärter  ,  bönor"`: {`"åsna s" "ärter bönor"`, `+"åsna s" +"ärter bönor"`},
+	} {
+		for i, engine := range []DBEngine{Sqlite, MariaDB} {
+			r, err := fullTextQuery(engine, in)
+			if err != nil {
+				t.Errorf("fullTextQuery failed for '%s' : %v", in, err)
+			}
+			if r != x[i] {
+				t.Errorf(fs, x[i], r)
+			}
+		}
+	}
+
+	for _, in := range []string{"", " * ", `"" -`} {
+		if _, err := fullTextQuery(Sqlite, in); err == nil {
+			t.Errorf("expected error for full-text query '%s', got nil", in)
+		}
+	}
+
+	q, err := Query{CommentText: "hund"}.compileFullText(Sqlite)
+	if err != nil {
+		t.Errorf("compileFullText failed : %v", err)
+	}
+	if q.fullText == nil || len(q.fullText.condArgs) != 1 || len(q.fullText.rankArgs) != 1 {
+		t.Errorf("expected compiled full-text query, got %#v", q.fullText)
+	}
+	_, _, err = appendQuery("", []lex.LexName{"lex"}, Query{FreeText: "hund"})
+	if err == nil {
+		t.Errorf("expected error for uncompiled full-text query, got nil")
+	}
+}
+
+func TestSql_RegexpLike(t *testing.T) {
+	for in, x := range map[string]string{
+		"^hund":         "hund%",
+		"hund":          "%hund%",
+		"^hund.*ar$":    "hund%ar",
+		"^(hund)+ar":    "hund%ar%",
+		"[bk]orv":       "%_orv%",
+		"^h[äe]st.?$":   "h_st%",
+		`^\p{L}+son$`:   "_%son",
+		"(?i)^HUND":     "",
+		"(?i)^hund|^ko": "",
+		"^100%$":        "100!%",
+		"^a_b!c":        "a!_b!!c%",
+		"^.....$":       "",
+		"^[a-z]+$":      "",
+		"^(":            "",
+		`^(?P<x>a)\1`:   "",
+	} {
+		r, ok := regexpLike(in)
+		if ok != (x != "") {
+			t.Errorf("regexpLike '%s' : expected ok=%v, got %v (%s)", in, x != "", ok, r)
+			continue
+		}
+		if ok && r != x {
+			t.Errorf(fs, x, r)
+		}
+	}
+
+	s, v := regexpCond("Entry.strn", "^hund")
+	x := "(Entry.strn LIKE ? ESCAPE '!' AND Entry.strn REGEXP ?)"
+	if s != x {
+		t.Errorf(fs, x, s)
+	}
+	if len(v) != 2 || v[0] != "hund%" || v[1] != "^hund" {
+		t.Errorf(fs, []interface{}{"hund%", "^hund"}, v)
+	}
+	s, v = regexpCond("Entry.strn", "^[a-z]+$")
+	x = "Entry.strn REGEXP ?"
+	if s != x {
+		t.Errorf(fs, x, s)
+	}
+	if len(v) != 1 || v[0] != "^[a-z]+$" {
+		t.Errorf(fs, []interface{}{"^[a-z]+$"}, v)
+	}
+}
@@ -1,6 +1,7 @@
 package dbapi
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/stts-se/pronlex/lex"
@@ -17,18 +18,19 @@ type DBMQuery struct {
 // 	Query    Query
 // }
 
-// TODO Lägga till bolska fält för 'not'?
 // Kunna sätta sortering eller ej?
 
-// Query represents an sql search query to the lexicon database
-// TODO Change to list(s) of search critieria.
-// TODO add boolean for include/exclude (i.e., "NOT" in the generated SQL).
+// Query represents an sql search query to the lexicon database.
+// All search criteria are joined with AND. For negation (NOT) and OR groups, use Filter.
+// Regexp fields use the syntax of the Go regexp package for Sqlite (with flags such as (?i), and Unicode classes such as \p{L}), and PCRE for MariaDB.
 type Query struct {
 	// list of words to get corresponding entries for
 	Words []string `json:"words"`
 	// a 'like' db search expression matching words
 	WordLike   string `json:"wordLike"`
 	WordRegexp string `json:"wordRegexp"`
+	// a literal word suffix (not a 'like' expression), matched using the reversed orthography index
+	WordSuffix string `json:"wordSuffix,omitempty"`
 
 	WordParts       []string `json:"wordParts"`
 	WordPartsLike   string   `json:"wordPartsLike"`
@@ -39,6 +41,12 @@ type Query struct {
 	// a 'like' db search expression matching transcriptions
 	TranscriptionLike   string `json:"transcriptionLike"`
 	TranscriptionRegexp string `json:"transcriptionRegexp"`
+	// a literal transcription suffix (not a 'like' expression), matched using the reversed transcription index
+	TranscriptionSuffix string `json:"transcriptionSuffix,omitempty"`
+	// a sequence of whole transcription symbols, tokenized using the symbol set of the lexicon (see PhonemeRegexp)
+	TranscriptionPhonemes string `json:"transcriptionPhonemes,omitempty"`
+	// TranscriptionPhonemes compiled into a regexp, set by the DBManager
+	transcriptionPhonemesRe string
 	// a 'like' db search expression matching part of speech strings
 	PartOfSpeechLike   string `json:"partOfSpeechLike"`
 	PartOfSpeechRegexp string `json:"partOfSpeechRegexp"`
@@ -64,6 +72,13 @@ type Query struct {
 	CommentSourceLike string `json:"commenSourceLike"`
 	CommentLike       string `json:"commentLike"`
 
+	// Full-text search in comments, see DBManager.EnableFullTextSearch. All words must be found in the same comment. "Quoted phrases" and prefix* search can be used.
+	CommentText string `json:"commentText,omitempty"`
+	// Full-text search in orthography, word parts and comments, see CommentText
+	FreeText string `json:"freeText,omitempty"`
+	// CommentText and FreeText compiled into SQL for the db engine
+	fullText *fullTextSQL
+
 	// A list of entry statuses to match
 	EntryStatus []string `json:"entryStatus"`
 
@@ -77,14 +92,23 @@ type Query struct {
 
 	MultipleTags bool `json:"multipleTags"`
 
+	// A tree of search criteria, with support for AND, OR and NOT. It is combined with the other criteria using AND.
+	Filter *Filter `json:"filter,omitempty"`
+
 	// // Search for Entries with EntryValidations with the listed
 	// // validation rule names (such as 'Decomp2Orth', etc)
 	// EntryValidations []string `json:"entryValidations"`
 
-	// the page returned by the SQL query's 'LIMIT' (starts at 1)
+	// the sort order of the result (default: SortByID)
+	SortBy         SortKey `json:"sortBy,omitempty"`
+	SortDescending bool    `json:"sortDescending,omitempty"`
+
+	// the page returned by the SQL query's 'LIMIT' (starts at 0). Pages are counted in entries, not in SQL rows.
 	Page int64 `json:"page"`
-	// the page length of the SQL query's 'LIMIT'
+	// the page length (number of entries) of the SQL query's 'LIMIT'
 	PageLength int64 `json:"pageLength"`
+	// keyset (cursor) pagination: return the entries sorted after the entry with this ID, typically the last entry of the previous page. Unlike Page, it doesn't slow down on deep pages.
+	After int64 `json:"after,omitempty"`
 }
 
 // Empty returns true if there are not search criteria values
@@ -93,10 +117,14 @@ func (q Query) Empty() bool {
 	switch {
 	case len(q.Words) > 0:
 		return false
+	case q.Filter != nil:
+		return false
 	case strings.TrimSpace(q.WordLike) != "":
 		return false
 	case strings.TrimSpace(q.WordRegexp) != "":
 		return false
+	case strings.TrimSpace(q.WordSuffix) != "":
+		return false
 	case len(q.WordParts) > 0:
 		return false
 	case strings.TrimSpace(q.WordPartsLike) != "":
@@ -109,6 +137,10 @@ func (q Query) Empty() bool {
 		return false
 	case strings.TrimSpace(q.TranscriptionRegexp) != "":
 		return false
+	case strings.TrimSpace(q.TranscriptionSuffix) != "":
+		return false
+	case strings.TrimSpace(q.TranscriptionPhonemes) != "":
+		return false
 	case strings.TrimSpace(q.PartOfSpeechLike) != "":
 		return false
 	case strings.TrimSpace(q.PartOfSpeechRegexp) != "":
@@ -139,6 +171,10 @@ func (q Query) Empty() bool {
 		return false
 	case strings.TrimSpace(q.CommentLike) != "":
 		return false
+	case strings.TrimSpace(q.CommentText) != "":
+		return false
+	case strings.TrimSpace(q.FreeText) != "":
+		return false
 	case strings.TrimSpace(q.ValidationRuleLike) != "":
 		return false
 	case strings.TrimSpace(q.ValidationLevelLike) != "":
@@ -209,11 +245,19 @@ type LexStats struct {
 	LatestUpdatesPerSource LatestUpdatesPerSource
 }
 
-// QueryStats holds the result of a call to the dbapi.LexiconStats function.
-// TODO add fields for additional stats
+// QueryStats holds the result of a call to the DBManager.QueryStats function.
 type QueryStats struct {
-	Query   Query `json:"query"`
+	Query Query `json:"query"`
+	// The total number of entries matching the query, regardless of the query's page settings
 	Entries int64 `json:"entries"`
+	// Facets holds the number of matching entries per value, for each facet (see Facets). Only set if facets are requested.
+	Facets map[string][]FacetCount `json:"facets,omitempty"`
+}
+
+// FacetCount holds the number of entries with a certain facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
 }
 
 // LatestUpdatesPerSource holds the latest status timestamp per source
@@ -221,6 +265,43 @@ type LatestUpdatesPerSource struct {
 	Sources map[string]string `json:"sources"` // source name => timestamp
 }
 
+// ImportResult is returned from ImportLexiconFile
+type ImportResult struct {
+	// DryRun is true if the import was rolled back (see DBManager.ImportLexiconFile)
+	DryRun bool
+	// Read is the number of lines read, not counting comments and empty lines
+	Read int
+	// Mode is the import mode used
+	Mode ImportMode
+	// Inserted is the number of new entries inserted
+	Inserted int
+	// Updated is the number of existing entries updated
+	Updated int
+	// Unchanged is the number of imported entries identical to an existing entry
+	Unchanged int
+	// Skipped is the number of entries skipped because of the import mode (existing entries for ImportInsertOnly, new entries for ImportUpdateExisting)
+	Skipped int
+	// Deleted is the number of existing entries deleted (only for ImportReplaceLexicon)
+	Deleted int
+	// SkippedDuplicates is the number of duplicate lines/entries skipped
+	SkippedDuplicates int
+	// ResumedAfterLine is the line number after which an interrupted import was resumed (see ImportOptions.Checkpoint)
+	ResumedAfterLine int
+	// Errors lists the lines that could not be imported
+	Errors []ImportLineError `json:",omitempty"`
+	// Strns lists the orthographies of the inserted, updated and deleted entries. Only set for dry runs.
+	Strns []string `json:",omitempty"`
+	// ValidationStats for the lexicon after the import. Only set for dry runs.
+	ValidationStats *ValStats `json:",omitempty"`
+}
+
+// ImportLineError is an error for a single line of an imported lexicon file
+type ImportLineError struct {
+	LineNumber int
+	Line       string
+	Error      string
+}
+
 // ValStats is used to incrementally give statistics during a validation process, or to just represent a final validation statistics.
 type ValStats struct {
 	// TotalEntries is the total entries to be validated
@@ -238,3 +319,147 @@ type ValStats struct {
 	Levels map[string]int `json:"levels"`
 	Rules  map[string]int `json:"rules"`
 }
+
+// FieldChange holds the old and new value of a single entry field, as recorded in the entry history
+type FieldChange struct {
+	Field    string `json:"field"`
+	OldValue string `json:"oldValue"`
+	NewValue string `json:"newValue"`
+}
+
+// EntryHistoryItem is a recorded change (insert, update or delete) of an entry. Entry holds the complete entry after the change (or, for a delete, before it), and Revision is the entry revision after the change.
+type EntryHistoryItem struct {
+	ID        int64         `json:"id"`
+	EntryID   int64         `json:"entryId"`
+	Revision  int64         `json:"revision"`
+	Action    string        `json:"action"`
+	Source    string        `json:"source"`
+	Timestamp string        `json:"timestamp"`
+	Changes   []FieldChange `json:"changes"`
+	Entry     lex.Entry     `json:"entry"`
+}
+
+// Snapshot is a named, frozen copy of the content of a lexicon, see DBManager.CreateSnapshot
+type Snapshot struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Timestamp  string `json:"timestamp"`
+	EntryCount int64  `json:"entryCount"`
+}
+
+// LexiconDiff is the result of comparing two lexicons, see DBManager.DiffLexicons. Added holds the entries only found in the second (to) lexicon, and Removed the entries only found in the first (from) lexicon.
+type LexiconDiff struct {
+	From    lex.LexRef  `json:"from"`
+	To      lex.LexRef  `json:"to"`
+	Added   []lex.Entry `json:"added"`
+	Removed []lex.Entry `json:"removed"`
+	Changed []EntryDiff `json:"changed"`
+}
+
+// EntryDiff lists the field differences between two matching entries (same Strn and Tag) in two lexicons. For each FieldChange, OldValue is the value in the from lexicon, and NewValue the value in the to lexicon.
+type EntryDiff struct {
+	Strn    string        `json:"strn"`
+	Tag     string        `json:"tag,omitempty"`
+	FromID  int64         `json:"fromId"`
+	ToID    int64         `json:"toId"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// MergeResult is the report of a call to DBManager.MergeLexicons, with the number of source entries per action, and the action taken for each source entry
+type MergeResult struct {
+	From      lex.LexRef         `json:"from"`
+	To        lex.LexRef         `json:"to"`
+	Strategy  MergeStrategy      `json:"strategy"`
+	Added     int                `json:"added"`
+	Updated   int                `json:"updated"`
+	Flagged   int                `json:"flagged"`
+	Kept      int                `json:"kept"`
+	Unchanged int                `json:"unchanged"`
+	Entries   []MergeEntryResult `json:"entries"`
+}
+
+// MergeEntryResult reports what happened to a single source entry in a merge. Action is one of added (no matching target entry), updated, flagged (a comment was added to the target entry), kept (the target entry was kept as is, in spite of differences) or unchanged (no differences). For each FieldChange, OldValue is the value in the target entry, and NewValue the value in the source entry.
+type MergeEntryResult struct {
+	Strn     string        `json:"strn"`
+	Tag      string        `json:"tag,omitempty"`
+	SourceID int64         `json:"sourceId"`
+	TargetID int64         `json:"targetId,omitempty"`
+	Action   string        `json:"action"`
+	Changes  []FieldChange `json:"changes,omitempty"`
+}
+
+// BulkUpdateResult is the report of a call to DBManager.BulkUpdate. Matched is the number of entries matching the query, and Entries is the change log, listing the changed fields of each updated entry. For each FieldChange, OldValue is the value before the update, and NewValue the value after.
+type BulkUpdateResult struct {
+	Operation BulkOperation           `json:"operation"`
+	DryRun    bool                    `json:"dryRun"`
+	Matched   int                     `json:"matched"`
+	Updated   int                     `json:"updated"`
+	Unchanged int                     `json:"unchanged"`
+	Entries   []BulkUpdateEntryResult `json:"entries"`
+}
+
+// BulkUpdateEntryResult lists the changes made to a single entry by a bulk update
+type BulkUpdateEntryResult struct {
+	ID      int64         `json:"id"`
+	LexRef  lex.LexRef    `json:"lexRef"`
+	Strn    string        `json:"strn"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// DeleteEntriesResult is the result of a call to DBManager.DeleteEntries, with the ids of the deleted entries
+type DeleteEntriesResult struct {
+	Deleted    int     `json:"deleted"`
+	DeletedIDs []int64 `json:"deletedIds"`
+}
+
+// CopyLexiconResult is the result of a call to DBManager.CopyLexicon, with the number of copied entries
+type CopyLexiconResult struct {
+	From    lex.LexRef `json:"from"`
+	To      lex.LexRef `json:"to"`
+	Entries int        `json:"entries"`
+}
+
+// CopyDBResult is the result of a call to DBManager.CopyDBTo, with the number of rows per table
+type CopyDBResult struct {
+	From   lex.DBRef           `json:"from"`
+	To     lex.DBRef           `json:"to"`
+	Tables []CopyDBTableResult `json:"tables"`
+	// ResumedAtTable is the table at which an interrupted copy was resumed (see CopyDBOptions.Checkpoint)
+	ResumedAtTable string `json:"resumedAtTable,omitempty"`
+	// ResumedAfterKey is the key of the last row of ResumedAtTable copied before the copy was resumed
+	ResumedAfterKey int64 `json:"resumedAfterKey,omitempty"`
+	// FullText is true if a full-text index was created for the target database, since the source database has one
+	FullText bool `json:"fullText"`
+}
+
+// CopyDBTableResult is the number of rows of a table copied by DBManager.CopyDBTo. Rows is the number of rows in the source table, verified to be equal to the number of rows in the target table after the copy. Copied is the number of rows copied in this run, that is less than Rows if the copy was resumed.
+type CopyDBTableResult struct {
+	Table  string `json:"table"`
+	Rows   int64  `json:"rows"`
+	Copied int64  `json:"copied"`
+}
+
+// SchemaMigration is a migration of a database from one schema version to the next. Timestamp is set for migrations that have been applied to the database.
+type SchemaMigration struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	Timestamp   string `json:"timestamp,omitempty"`
+}
+
+// MigrateDBResult is the result of a call to DBManager.MigrateDB, with the migrations applied to the database
+type MigrateDBResult struct {
+	DB          lex.DBRef         `json:"db"`
+	FromVersion string            `json:"fromVersion"`
+	ToVersion   string            `json:"toVersion"`
+	Applied     []SchemaMigration `json:"applied"`
+}
+
+// EntryConflictError is returned when updating an entry with a revision that doesn't match the revision in the database, i.e., the entry has been updated by someone else after it was read. Current holds the entry as it is in the database.
+type EntryConflictError struct {
+	Revision int64
+	Current  lex.Entry
+}
+
+func (e *EntryConflictError) Error() string {
+	return fmt.Sprintf("update conflict for entry id '%d' : input revision %d, but the current revision is %d", e.Current.ID, e.Revision, e.Current.Revision)
+}
@@ -0,0 +1,109 @@
+package dbapi
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stts-se/pronlex/lex"
+)
+
+func TestSuffixSqlite(t *testing.T) {
+	db := newSqliteTestDB(t)
+
+	testSuffix(t, sqliteDBIF{}, db)
+}
+
+// testSuffix is shared between the sqlite and mariadb tests
+func testSuffix(t *testing.T, dbif DBIF, db *sql.DB) {
+	l, err := dbif.defineLexicon(db, lexicon{name: "suffixlex", symbolSetName: "ZZ", locale: "ll"})
+	if err != nil {
+		t.Fatalf("Ooops! : %v", err)
+	}
+
+	entry := func(strn string, trans ...string) lex.Entry {
+		e := lex.Entry{Strn: strn, PartOfSpeech: "NN", Language: "sv", WordParts: strn, EntryStatus: lex.EntryStatus{Name: "ok", Source: "tst"}}
+		for _, t := range trans {
+			e.Transcriptions = append(e.Transcriptions, lex.Transcription{Strn: t, Language: "sv"})
+		}
+		return e
+	}
+	es := []lex.Entry{
+		entry("Tidning", "\" t i: d . n I N"),
+		entry("ning", "\" n I N"),
+		entry("ringning", "\" r I N . n I N"),
+		entry("ringa", "\" r I N . a"),
+		entry("procent_%", "p r u . \" s E n t"),
+	}
+	_, err = dbif.insertEntries(db, l, es)
+	if err != nil {
+		t.Fatalf("Failed to insert entries : %v", err)
+	}
+
+	lookUp := func(q Query) []string {
+		res, err := dbif.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, q)
+		if err != nil {
+			t.Fatalf("lookUp failed for query %#v : %v", q, err)
+		}
+		var strns []string
+		for _, e := range res {
+			strns = append(strns, e.Strn)
+		}
+		sort.Strings(strns)
+		return strns
+	}
+	expect := func(q Query, w ...string) {
+		g := lookUp(q)
+		if strings.Join(w, " ") != strings.Join(g, " ") {
+			t.Errorf("query %#v : expected %v, got %v", q, w, g)
+		}
+	}
+
+	expect(Query{WordSuffix: "ning"}, "ning", "ringning", "tidning")
+	expect(Query{WordSuffix: "NING"}, "ning", "ringning", "tidning")
+	expect(Query{WordSuffix: "gning"}, "ringning")
+	expect(Query{WordSuffix: "ringning"}, "ringning")
+	expect(Query{WordSuffix: "xning"})
+	// Wildcards are literal
+	expect(Query{WordSuffix: "_%"}, "procent_%")
+	expect(Query{WordSuffix: "%"}, "procent_%")
+	expect(Query{WordSuffix: "_ning"})
+
+	expect(Query{TranscriptionSuffix: "n I N"}, "ning", "ringning", "tidning")
+	expect(Query{TranscriptionSuffix: ". n I N"}, "ringning", "tidning")
+	expect(Query{TranscriptionSuffix: "n I N", WordLike: "r%"}, "ringning")
+
+	// The reversed transcription is maintained on update
+	res, err := dbif.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, Query{Words: []string{"ringa"}})
+	if err != nil {
+		t.Fatalf("lookUp failed : %v", err)
+	}
+	if w, g := 1, len(res); w != g {
+		t.Fatalf("expected %d, got %d", w, g)
+	}
+	e := res[0]
+	e.Transcriptions[0].Strn = "\" r I N . n I N"
+	_, updated, err := dbif.updateEntry(db, e)
+	if err != nil {
+		t.Fatalf("updateEntry failed : %v", err)
+	}
+	if !updated {
+		t.Errorf("expected entry to be updated")
+	}
+	expect(Query{TranscriptionSuffix: ". n I N"}, "ringa", "ringning", "tidning")
+	expect(Query{TranscriptionSuffix: "N . a"})
+
+	// Sorting by reversed orthography
+	res, err = dbif.lookUpIntoSlice(db, []lex.LexName{lex.LexName(l.name)}, Query{WordLike: "%", SortBy: SortByReversedStrn})
+	if err != nil {
+		t.Fatalf("lookUp failed : %v", err)
+	}
+	var strns []string
+	for _, e := range res {
+		strns = append(strns, e.Strn)
+	}
+	if w, g := "procent_% ringa ning tidning ringning", strings.Join(strns, " "); w != g {
+		t.Errorf("expected %v, got %v", w, g)
+	}
+}
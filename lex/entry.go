@@ -1,6 +1,7 @@
 package lex
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -190,6 +191,11 @@ type Entry struct {
 	Preferred bool           `json:"preferred,omitempty"`
 	Tag       string         `json:"tag,omitempty"`
 	Comments  []EntryComment `json:"comments,omitempty"`
+
+	// Revision is incremented by the database on each update of the entry. An update with a
+	// revision that doesn't match the database revision is rejected, since the entry has
+	// been modified by someone else after it was read.
+	Revision int64 `json:"revision,omitempty"`
 }
 
 // EntryWriter is an interface defining things to which one can write an Entry.
@@ -223,6 +229,24 @@ func (w *EntryFileWriter) Write(e Entry) error {
 	return err
 }
 
+// EntryJSONLinesWriter outputs entries to an io.Writer in the JSON Lines format, one JSON encoded entry per line.
+type EntryJSONLinesWriter struct {
+	size   int
+	Writer io.Writer
+}
+
+// Size returns the number of entries written to the EntryJSONLinesWriter
+func (w *EntryJSONLinesWriter) Size() int {
+	return w.size
+}
+
+// Write is used to write one lex.Entry at a time as a JSON line
+func (w *EntryJSONLinesWriter) Write(e Entry) error {
+	w.size = w.size + 1
+	// json.Encoder terminates each value with a newline
+	return json.NewEncoder(w.Writer).Encode(e)
+}
+
 // EntrySliceWriter is a container for returning Entries from a LookUp call to the db
 // Example usage:
 //	var q := dbapi.Query{ ... }
@@ -1,6 +1,10 @@
 package lex
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
 
 func Test_ParseLexRef(t *testing.T) {
 
@@ -49,3 +53,30 @@ func Test_ParseLexRef(t *testing.T) {
 	}
 
 }
+
+func Test_EntryJSONLinesWriter(t *testing.T) {
+	var buf strings.Builder
+	w := EntryJSONLinesWriter{Writer: &buf}
+	for _, s := range []string{"apa", "bil"} {
+		err := w.Write(Entry{Strn: s, Transcriptions: []Transcription{{Strn: "\" A: . p a"}}})
+		if err != nil {
+			t.Errorf("Auch! %v", err)
+		}
+	}
+	if w, g := 2, w.Size(); w != g {
+		t.Errorf("wanted %d got %d", w, g)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if w, g := 2, len(lines); w != g {
+		t.Fatalf("wanted %d got %d", w, g)
+	}
+	var e Entry
+	err := json.Unmarshal([]byte(lines[1]), &e)
+	if err != nil {
+		t.Errorf("Auch! %v", err)
+	}
+	if w, g := "bil", e.Strn; w != g {
+		t.Errorf("wanted %s got '%s'", w, g)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	//"time"
 	//"database/sql"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,10 +11,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/stts-se/pronlex/dbapi"
 	"github.com/stts-se/pronlex/lex"
+	"github.com/stts-se/pronlex/line"
 	"github.com/stts-se/pronlex/validation"
 )
 
@@ -77,7 +80,7 @@ var adminLexImport = urlHandler{
 	name: "lex_import (api)",
 	url:  "/lex_import",
 	//help:     "Import lexicon file (API). Requires POST request. Mainly for server internal use.<p/>Available params: lexicon_name, symbolset_name, validate, file",
-	help:     "Import lexicon file (API). Requires POST request. Mainly for server internal use.<p/>Available params: lexicon_name, symbolset_name, file",
+	help:     "Import lexicon file (API). Requires POST request. Mainly for server internal use.<p/>Available params: lexicon_name, symbolset_name, file, mode (how to handle entries already in the lexicon, matched on orthography and tag: insert-only, update-existing, upsert or replace-lexicon; required for importing into an existing lexicon), dry_run (true/false; if true, the import is rolled back, and a JSON report of what would have been imported is returned), all_or_nothing (true/false; if true, the file is imported in a single transaction, and nothing is imported if any line fails), continue_on_error (true/false; if true, failing lines are skipped and listed in the response, instead of aborting the import on the first error; cannot be combined with mode replace-lexicon)",
 	examples: []string{},
 	handler: func(w http.ResponseWriter, r *http.Request) {
 
@@ -148,6 +151,32 @@ var adminLexImport = urlHandler{
 			return
 		}
 
+		modeS := r.PostFormValue("mode")
+		mode := dbapi.ImportInsertOnly
+		if strings.TrimSpace(modeS) != "" {
+			mode, err = dbapi.ParseImportMode(modeS)
+			if err != nil {
+				msg := fmt.Sprintf("adminLexImport : %v", err)
+				log.Println(msg)
+				http.Error(w, msg, http.StatusBadRequest)
+				return
+			}
+		}
+
+		boolParams := map[string]bool{"dry_run": false, "all_or_nothing": false, "continue_on_error": false}
+		for name := range boolParams {
+			if v := r.PostFormValue(name); strings.TrimSpace(v) != "" {
+				boolParams[name], err = strconv.ParseBool(v)
+				if err != nil {
+					msg := fmt.Sprintf("adminLexImport failed parsing boolean argument %s %s : %v", name, v, err)
+					log.Println(msg)
+					http.Error(w, msg, http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		dryRun := boolParams["dry_run"]
+
 		file, handler, err := r.FormFile("file")
 		if err != nil {
 			log.Println(err)
@@ -180,8 +209,9 @@ var adminLexImport = urlHandler{
 			deleteUploadedFile(serverPath)
 			return
 		}
-		if exists {
-			msg := fmt.Sprintf("Nothing will be added. Lexicon already exists: %s", lexRef.String())
+		// importing into an existing lexicon requires an explicit import mode
+		if exists && strings.TrimSpace(modeS) == "" {
+			msg := fmt.Sprintf("Nothing will be added. Lexicon already exists: %s (use the mode param to import into an existing lexicon)", lexRef.String())
 			log.Println(msg)
 			http.Error(w, msg, http.StatusInternalServerError)
 			deleteUploadedFile(serverPath)
@@ -196,14 +226,16 @@ var adminLexImport = urlHandler{
 		// 	return
 		// }
 
-		err = dbm.DefineLexicon(lexRef, symbolSetName, locale)
-		if err != nil {
-			log.Println(err)
-			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
-			deleteUploadedFile(serverPath)
-			return
+		if !exists {
+			err = dbm.DefineLexicon(lexRef, symbolSetName, locale)
+			if err != nil {
+				log.Println(err)
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				deleteUploadedFile(serverPath)
+				return
+			}
+			log.Println("Created lexicon: ", lexRef.String())
 		}
-		log.Println("Created lexicon: ", lexRef.String())
 
 		var validator *validation.Validator = &validation.Validator{}
 		// if validate {
@@ -218,13 +250,25 @@ var adminLexImport = urlHandler{
 		// 	}
 		// }
 
-		err = dbm.ImportLexiconFile(lexRef, logger, serverPath, validator)
+		importRes, err := dbm.ImportLexiconFile(lexRef, logger, serverPath, validator, dbapi.ImportOptions{
+			Mode:            mode,
+			DryRun:          dryRun,
+			AllOrNothing:    boolParams["all_or_nothing"],
+			ContinueOnError: boolParams["continue_on_error"],
+		})
 
 		if err == nil {
 			msg := fmt.Sprintf("lexicon file imported successfully : %v", handler.Filename)
 			log.Println(msg)
 		} else {
-			msg := fmt.Sprintf("couldn't import lexicon file : %v", err)
+			msg := fmt.Sprintf("couldn't import lexicon file : %v%s", err, importErrorsString(importRes))
+			// a lexicon defined for the dry run is deleted also if the dry run fails
+			if dryRun && !exists {
+				err2 := dbm.DeleteLexicon(lexRef)
+				if err2 != nil {
+					msg = fmt.Sprintf("%s : couldn't delete lexicon : %v", msg, err2)
+				}
+			}
 			log.Println(msg)
 			http.Error(w, msg, http.StatusInternalServerError)
 			deleteUploadedFile(serverPath)
@@ -234,6 +278,27 @@ var adminLexImport = urlHandler{
 		//f.Close()
 		deleteUploadedFile(serverPath)
 
+		if dryRun {
+			// a lexicon defined for the dry run is deleted again
+			if !exists {
+				err = dbm.DeleteLexicon(lexRef)
+				if err != nil {
+					msg := fmt.Sprintf("dry run completed, but couldn't delete lexicon : %v", err)
+					log.Println(msg)
+					http.Error(w, msg, http.StatusInternalServerError)
+					return
+				}
+			}
+			jsn, err := marshal(importRes, r)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed marshalling : %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprint(w, string(jsn))
+			return
+		}
+
 		entryCount, err := dbm.EntryCount(lexRef)
 		if err != nil {
 			msg := fmt.Sprintf("lexicon imported, but couldn't retrieve lexicon info from server : %v", err)
@@ -247,10 +312,24 @@ var adminLexImport = urlHandler{
 			SymbolSetName: symbolSetName,
 			EntryCount:    entryCount,
 		}
-		fmt.Fprintf(w, "imported %v entries into lexicon '%v'", info.EntryCount, info.Name)
+		fmt.Fprintf(w, "imported lexicon file into lexicon '%v' (mode: %s, inserted: %d, updated: %d, unchanged: %d, skipped: %d, deleted: %d); the lexicon now has %v entries", info.Name, importRes.Mode, importRes.Inserted, importRes.Updated, importRes.Unchanged, importRes.Skipped, importRes.Deleted, info.EntryCount)
+		fmt.Fprint(w, importErrorsString(importRes))
 	},
 }
 
+// importErrorsString lists the failed lines of an import, one per line
+func importErrorsString(res dbapi.ImportResult) string {
+	if len(res.Errors) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%d lines failed:", len(res.Errors))
+	for _, e := range res.Errors {
+		fmt.Fprintf(&b, "\nline %d: %s", e.LineNumber, e.Error)
+	}
+	return b.String()
+}
+
 var adminDefineLex = urlHandler{
 	name:     "define_lex",
 	url:      "/define_lex/{lexicon_name}/{locale}/{symbolset_name}",
@@ -436,10 +515,33 @@ var adminCreateDB = urlHandler{
 	},
 }
 
+var adminEnableFullText = urlHandler{
+	name:     "enable_fulltext",
+	url:      "/enable_fulltext/{db_name}",
+	help:     "Create the full-text index of a lexicon database, used by the commenttext and freetext params of /lexicon/lookup. Existing entries and comments are indexed, which may take a while for large databases. For Sqlite, the server must be built with the tag sqlite_fts5.",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		dbName := delQuote(getParam("db_name", r))
+		if dbName == "" {
+			http.Error(w, "no value for parameter 'db_name'", http.StatusBadRequest)
+			return
+		}
+
+		err := dbm.EnableFullTextSearch(lex.DBRef(dbName))
+		if err != nil {
+			log.Printf("lexserver: Failed to enable full-text search : %v", err)
+			http.Error(w, fmt.Sprintf("failed to enable full-text search : %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, "Enabled full-text search for database "+dbName)
+	},
+}
+
 var adminMoveNewEntries = urlHandler{
 	name:     "move_new_entries",
 	url:      "/move_new_entries/{db_name}/{from_lexicon_name}/{to_lexicon_name}/{new_source}/{new_status}",
-	help:     "Move entries from one lexicon to another. N.B! Only entries that do not already exist in the right hand will be moved.",
+	help:     "Move entries from one lexicon to another. N.B! Only entries that do not already exist in the right hand will be moved. Optional param: dry_run (true/false; if true, the move is rolled back, and a JSON report is returned, listing the orthographies of the entries that would be moved, and the validation stats of the right hand lexicon as it would look after the move). Returns the number of moved entries.",
 	examples: []string{},
 	handler: func(w http.ResponseWriter, r *http.Request) {
 		dbName := delQuote(getParam("db_name", r))
@@ -447,14 +549,14 @@ var adminMoveNewEntries = urlHandler{
 			http.Error(w, "no value for parameter 'db_name'", http.StatusBadRequest)
 			return
 		}
-		fromLexName := delQuote(getParam("from_lexicon", r))
+		fromLexName := delQuote(getParam("from_lexicon_name", r))
 		if fromLexName == "" {
-			http.Error(w, "no value for parameter 'from_lexicon'", http.StatusBadRequest)
+			http.Error(w, "no value for parameter 'from_lexicon_name'", http.StatusBadRequest)
 			return
 		}
-		toLexName := delQuote(getParam("to_lexicon", r))
+		toLexName := delQuote(getParam("to_lexicon_name", r))
 		if toLexName == "" {
-			http.Error(w, "no value for parameter 'to_lexicon'", http.StatusBadRequest)
+			http.Error(w, "no value for parameter 'to_lexicon_name'", http.StatusBadRequest)
 			return
 		}
 
@@ -469,13 +571,286 @@ var adminMoveNewEntries = urlHandler{
 			return
 		}
 
-		moveRes, err := dbm.MoveNewEntries(lex.DBRef(dbName), lex.LexName(fromLexName), lex.LexName(toLexName), sourceName, statusName)
+		dryRun := false
+		if dryRunS := getParam("dry_run", r); strings.TrimSpace(dryRunS) != "" {
+			var err error
+			dryRun, err = strconv.ParseBool(dryRunS)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed parsing boolean argument dry_run %s : %v", dryRunS, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		moveRes, err := dbm.MoveNewEntries(lex.DBRef(dbName), lex.LexName(fromLexName), lex.LexName(toLexName), sourceName, statusName, dryRun)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("failure when trying to move entries from '%s' to '%s' : %v", fromLexName, toLexName, err), http.StatusInternalServerError)
 			return
 		}
 
-		fmt.Fprintf(w, "number of entries moved from '%s' to '%s': %d", fromLexName, toLexName, moveRes.N)
+		if !dryRun {
+			fmt.Fprintf(w, "number of entries moved from '%s' to '%s': %d", fromLexName, toLexName, moveRes.N)
+			return
+		}
+		jsn, err := marshal(moveRes, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed marshalling : %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+var adminMergeLexicons = urlHandler{
+	name:     "merge_lexicons",
+	url:      "/merge_lexicons",
+	help:     "Merge the entries of one lexicon into another, possibly in different databases. Entries are matched on orthography and tag. New entries are added to the target lexicon, and differing entries are handled according to the merge strategy: keep-target, prefer-source, prefer-newer-status, merge-transcriptions-as-variants or flag-conflicts-with-comment. Required params: from_lexicon and to_lexicon (full lexicon names, db:lexicon), strategy and source (the merging user, saved as the source of a new entry status for modified entries). Returns a report of what happened to each source entry.",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		var lexRefs []lex.LexRef
+		for _, param := range []string{"from_lexicon", "to_lexicon"} {
+			lexRefS := getParam(param, r)
+			if strings.TrimSpace(lexRefS) == "" {
+				http.Error(w, fmt.Sprintf("no value for parameter '%s'", param), http.StatusBadRequest)
+				return
+			}
+			lexRef, err := lex.ParseLexRef(lexRefS)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %s : %v", lexRefS, err), http.StatusBadRequest)
+				return
+			}
+			lexRefs = append(lexRefs, lexRef)
+		}
+		strategy, err := dbapi.ParseMergeStrategy(getParam("strategy", r))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		source := getParam("source", r)
+		if strings.TrimSpace(source) == "" {
+			http.Error(w, "no value for parameter 'source'", http.StatusBadRequest)
+			return
+		}
+
+		res, err := dbm.MergeLexicons(lexRefs[0], lexRefs[1], strategy, source)
+		if err != nil {
+			log.Printf("lexserver: Failed to merge lexicons : %v", err)
+			http.Error(w, fmt.Sprintf("failed to merge lexicons : %v", err), http.StatusInternalServerError)
+			return
+		}
+		jsn, err := marshal(res, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed marshalling : %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+var adminCopyLexicon = urlHandler{
+	name:     "copy_lexicon",
+	url:      "/copy_lexicon",
+	help:     "Copy a lexicon into a new lexicon, in the same or in another database. Entries are copied with lemmas, tags, comments, status history and validations. Since entry tags are unique per database, a lexicon with tagged entries can only be copied to another database. Required params: from_lexicon and to_lexicon (full lexicon names, db:lexicon). Copying to a database using another db engine is only available through the dbapi (DBManager.CopyLexiconTo).",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		var lexRefs []lex.LexRef
+		for _, param := range []string{"from_lexicon", "to_lexicon"} {
+			lexRefS := getParam(param, r)
+			if strings.TrimSpace(lexRefS) == "" {
+				http.Error(w, fmt.Sprintf("no value for parameter '%s'", param), http.StatusBadRequest)
+				return
+			}
+			lexRef, err := lex.ParseLexRef(lexRefS)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %s : %v", lexRefS, err), http.StatusBadRequest)
+				return
+			}
+			lexRefs = append(lexRefs, lexRef)
+		}
+
+		res, err := dbm.CopyLexicon(lexRefs[0], lexRefs[1])
+		if err != nil {
+			log.Printf("lexserver: Failed to copy lexicon : %v", err)
+			http.Error(w, fmt.Sprintf("failed to copy lexicon : %v", err), http.StatusInternalServerError)
+			return
+		}
+		jsn, err := marshal(res, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed marshalling : %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+var adminRenameLexicon = urlHandler{
+	name:     "rename_lexicon",
+	url:      "/rename_lexicon",
+	help:     "Rename a lexicon. Required params: lexicon (full lexicon name, db:lexicon) and new_name (the new lexicon name, without db).",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		lexRefS := getParam("lexicon", r)
+		if strings.TrimSpace(lexRefS) == "" {
+			http.Error(w, "no value for parameter 'lexicon'", http.StatusBadRequest)
+			return
+		}
+		lexRef, err := lex.ParseLexRef(lexRefS)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %s : %v", lexRefS, err), http.StatusBadRequest)
+			return
+		}
+		newName := strings.TrimSpace(getParam("new_name", r))
+		if newName == "" {
+			http.Error(w, "no value for parameter 'new_name'", http.StatusBadRequest)
+			return
+		}
+		if strings.Contains(newName, ":") {
+			http.Error(w, fmt.Sprintf("invalid lexicon name '%s' : the new name cannot contain a db reference", newName), http.StatusBadRequest)
+			return
+		}
+
+		err = dbm.RenameLexicon(lexRef, lex.LexName(newName))
+		if err != nil {
+			log.Printf("lexserver: Failed to rename lexicon : %v", err)
+			http.Error(w, fmt.Sprintf("failed to rename lexicon : %v", err), http.StatusInternalServerError)
+			return
+		}
+		newRef := lex.NewLexRef(string(lexRef.DBRef), strings.ToLower(newName))
+		log.Printf("Renamed lexicon %s to %s", lexRef.String(), newRef.String())
+		fmt.Fprint(w, "Renamed lexicon "+lexRef.String()+" to "+newRef.String())
+	},
+}
+
+var adminCreateSnapshot = urlHandler{
+	name:     "snapshots/create",
+	url:      "/snapshots/create/{lexicon_name}/{snapshot_name}",
+	help:     "Freeze the current content of a lexicon under a snapshot (release) name. The snapshot name must be unique for the lexicon.",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		lexRef, err := getLexRefParam(r)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %v : %v", lexRef, err), http.StatusBadRequest)
+			return
+		}
+		snapshotName := delQuote(getParam("snapshot_name", r))
+		if snapshotName == "" {
+			http.Error(w, "no value for parameter 'snapshot_name'", http.StatusBadRequest)
+			return
+		}
+
+		snapshot, err := dbm.CreateSnapshot(lexRef, snapshotName)
+		if err != nil {
+			log.Printf("lexserver: Failed to create snapshot : %v", err)
+			http.Error(w, fmt.Sprintf("failed to create snapshot : %v", err), http.StatusInternalServerError)
+			return
+		}
+		res, err := json.Marshal(snapshot)
+		if err != nil {
+			msg := fmt.Sprintf("lexserver: Failed to marshal snapshot : %v", err)
+			log.Print(msg)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(res))
+	},
+}
+
+var adminListSnapshots = urlHandler{
+	name:     "snapshots/list",
+	url:      "/snapshots/list/{lexicon_name}",
+	help:     "List the snapshots of a lexicon.",
+	examples: []string{"/snapshots/list/wikispeech_lexserver_testdb:sv"},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		lexRef, err := getLexRefParam(r)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %v : %v", lexRef, err), http.StatusBadRequest)
+			return
+		}
+
+		snapshots, err := dbm.ListSnapshots(lexRef)
+		if err != nil {
+			log.Printf("lexserver: Failed to list snapshots : %v", err)
+			http.Error(w, fmt.Sprintf("failed to list snapshots : %v", err), http.StatusInternalServerError)
+			return
+		}
+		res, err := json.Marshal(snapshots)
+		if err != nil {
+			msg := fmt.Sprintf("lexserver: Failed to marshal snapshots : %v", err)
+			log.Print(msg)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(res))
+	},
+}
+
+var adminExportSnapshot = urlHandler{
+	name:     "snapshots/export",
+	url:      "/snapshots/export/{lexicon_name}/{snapshot_name}",
+	help:     "Export a lexicon snapshot using the Wikispeech lexicon file format (see line/ws.go).",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		lexRef, err := getLexRefParam(r)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %v : %v", lexRef, err), http.StatusBadRequest)
+			return
+		}
+		snapshotName := delQuote(getParam("snapshot_name", r))
+		if snapshotName == "" {
+			http.Error(w, "no value for parameter 'snapshot_name'", http.StatusBadRequest)
+			return
+		}
+
+		wsFmt, err := line.NewWS()
+		if err != nil {
+			log.Printf("lexserver: Failed to create line writer : %v", err)
+			http.Error(w, fmt.Sprintf("failed to create line writer : %v", err), http.StatusInternalServerError)
+			return
+		}
+		var buf bytes.Buffer
+		err = dbm.ExportSnapshot(lexRef, snapshotName, line.FileWriter{Parser: wsFmt, Writer: &buf})
+		if err != nil {
+			log.Printf("lexserver: Failed to export snapshot : %v", err)
+			http.Error(w, fmt.Sprintf("failed to export snapshot : %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, buf.String())
+	},
+}
+
+var adminDeleteSnapshot = urlHandler{
+	name:     "snapshots/delete",
+	url:      "/snapshots/delete/{lexicon_name}/{snapshot_name}",
+	help:     "Delete a lexicon snapshot. A lexicon cannot be deleted while it has snapshots.",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		lexRef, err := getLexRefParam(r)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %v : %v", lexRef, err), http.StatusBadRequest)
+			return
+		}
+		snapshotName := delQuote(getParam("snapshot_name", r))
+		if snapshotName == "" {
+			http.Error(w, "no value for parameter 'snapshot_name'", http.StatusBadRequest)
+			return
+		}
+
+		err = dbm.DeleteSnapshot(lexRef, snapshotName)
+		if err != nil {
+			log.Printf("lexserver: Failed to delete snapshot : %v", err)
+			http.Error(w, fmt.Sprintf("failed to delete snapshot : %v", err), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "Deleted snapshot '%s' of lexicon %s", snapshotName, lexRef.String())
 	},
 }
 
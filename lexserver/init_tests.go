@@ -84,12 +84,52 @@ func testURLsWithContent(port string) (int, int, error) {
 	lookupTests := map[string]string{
 		"/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv&wordlike=h%C3%A4st__": `[{"id":6,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hästar","language":"sv","partOfSpeech":"NN","morphology":"NEU IND PLU","wordParts":"hästar","lemma":{"id":4,"strn":"häst"},"transcriptions":[{"id":9,"entryId":6,"strn":"\" h E . s t a r","language":"sv"}],"status":{"id":6,"name":"demo","source":"auto","timestamp":"2020-05-25T12:44:47Z","current":true},"preferred":false,"tag":""},{"id":7,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hästar","language":"sv","partOfSpeech":"NN","morphology":"NEU IND PLU","wordParts":"hästar","lemma":{"id":4,"strn":"häst"},"transcriptions":[{"id":10,"entryId":7,"strn":"\" h { . s t a r","language":"sv"}],"status":{"id":7,"name":"demo","source":"auto","timestamp":"2020-05-25T12:44:47Z","current":true},"preferred":false,"tag":""}]`,
 
+		"/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv&wordsuffix=star": `[{"id":6,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hästar","language":"sv","partOfSpeech":"NN","morphology":"NEU IND PLU","wordParts":"hästar","lemma":{"id":4,"strn":"häst"},"transcriptions":[{"id":9,"entryId":6,"strn":"\" h E . s t a r","language":"sv"}],"status":{"id":6,"name":"demo","source":"auto","timestamp":"2020-05-25T12:44:47Z","current":true},"preferred":false,"tag":""},{"id":7,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hästar","language":"sv","partOfSpeech":"NN","morphology":"NEU IND PLU","wordParts":"hästar","lemma":{"id":4,"strn":"häst"},"transcriptions":[{"id":10,"entryId":7,"strn":"\" h { . s t a r","language":"sv"}],"status":{"id":7,"name":"demo","source":"auto","timestamp":"2020-05-25T12:44:47Z","current":true},"preferred":false,"tag":""}]`,
+
 		"/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv&wordpartsregexp=h%C3%A4st": `[{"id":5,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"häst","language":"sv","partOfSpeech":"NN","morphology":"NEU IND SIN","wordParts":"häst","lemma":{"id":4,"strn":"häst"},"transcriptions":[{"id":8,"entryId":5,"strn":"\" h E s t","language":"sv"}],"status":{"id":5,"name":"demo","source":"auto","timestamp":"2020-05-25T12:46:16Z","current":true},"preferred":false,"tag":""},{"id":6,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hästar","language":"sv","partOfSpeech":"NN","morphology":"NEU IND PLU","wordParts":"hästar","lemma":{"id":4,"strn":"häst"},"transcriptions":[{"id":9,"entryId":6,"strn":"\" h E . s t a r","language":"sv"}],"status":{"id":6,"name":"demo","source":"auto","timestamp":"2020-05-25T12:46:16Z","current":true},"preferred":false,"tag":""},{"id":7,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hästar","language":"sv","partOfSpeech":"NN","morphology":"NEU IND PLU","wordParts":"hästar","lemma":{"id":4,"strn":"häst"},"transcriptions":[{"id":10,"entryId":7,"strn":"\" h { . s t a r","language":"sv"}],"status":{"id":7,"name":"demo","source":"auto","timestamp":"2020-05-25T12:46:16Z","current":true},"preferred":false,"tag":""}]`,
 
 		"/lexicon/lookup?lemmas=kex&lexicons=wikispeech_lexserver_testdb:sv": `[{"id":1,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"kex","language":"sv","partOfSpeech":"NN","morphology":"NEU IND SIN","wordParts":"kex","lemma":{"id":1,"strn":"kex"},"transcriptions":[{"id":1,"entryId":1,"strn":"\" k e k s","language":"sv"},{"id":2,"entryId":1,"strn":"\" C e k s","language":"sv"}],"status":{"id":1,"name":"demo","source":"auto","timestamp":"2020-05-25T12:46:40Z","current":true},"preferred":false,"tag":""},{"id":2,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"kexet","language":"sv","partOfSpeech":"NN","morphology":"NEU DEF SIN","wordParts":"kexet","lemma":{"id":1,"strn":"kex"},"transcriptions":[{"id":3,"entryId":2,"strn":"\" k e k . s @ t","language":"sv"},{"id":4,"entryId":2,"strn":"\" C e k . s @ t","language":"sv"}],"status":{"id":2,"name":"demo","source":"auto","timestamp":"2020-05-25T12:46:40Z","current":true},"preferred":false,"tag":""}]`,
 
+		"/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv&filter=%7B%22and%22%3A%5B%7B%22field%22%3A%22lemma%22%2C%22op%22%3A%22eq%22%2C%22value%22%3A%22kex%22%7D%2C%7B%22not%22%3A%7B%22field%22%3A%22strn%22%2C%22op%22%3A%22eq%22%2C%22value%22%3A%22kexet%22%7D%7D%5D%7D": `[{"id":1,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"kex","language":"sv","partOfSpeech":"NN","morphology":"NEU IND SIN","wordParts":"kex","lemma":{"id":1,"strn":"kex"},"transcriptions":[{"id":1,"entryId":1,"strn":"\" k e k s","language":"sv"},{"id":2,"entryId":1,"strn":"\" C e k s","language":"sv"}],"status":{"id":1,"name":"demo","source":"auto","timestamp":"2020-05-25T12:46:40Z","current":true},"preferred":false,"tag":""}]`,
+
 		"/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv&words=dom&transcriptionlike=%25o:%25&pp=yes": `[   {     "id": 9,     "lexRef": {       "dbRef": "wikispeech_lexserver_testdb",       "lexName": "sv"     },     "strn": "dom",     "language": "sv",     "partOfSpeech": "NN",     "morphology": "UTR IND SIN",     "wordParts": "dom",     "lemma": {       "id": 5,       "strn": "dom"     },     "transcriptions": [       {         "id": 12,         "entryId": 9,         "strn": "\" d o: m",         "language": "sv"       }     ],     "status": {       "id": 11,       "name": "demo",       "source": "auto",       "timestamp": "2020-05-25T12:47:04Z",       "current": true     },         "preferred": false,     "tag": "building" } ]`}
 
+	// Phoneme search requires the symbol set of the demo lexicon (see the -ss_files flag)
+	for _, ssName := range dbm.SymbolSetNames() {
+		if ssName == "sv-se_ws-sampa" {
+			lookupTests["/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv&transcriptionphonemes=u0%20n"] = `[{"id":4,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hund","language":"sv","partOfSpeech":"NN","morphology":"NEU IND SIN","wordParts":"hund","lemma":{"id":3,"strn":"hund"},"transcriptions":[{"id":7,"entryId":4,"strn":"\" h u0 n d","language":"sv"}],"status":{"id":4,"name":"demo","source":"auto","timestamp":"2020-05-25T12:44:47Z","current":true}}]`
+		}
+	}
+
+	// POST requests with a JSON body
+	lookupPostTests := []struct {
+		url, body, expect string
+	}{
+		{"/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv", `["hund", ""]`, `[{"id":4,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hund","language":"sv","partOfSpeech":"NN","morphology":"NEU IND SIN","wordParts":"hund","lemma":{"id":3,"strn":"hund"},"transcriptions":[{"id":7,"entryId":4,"strn":"\" h u0 n d","language":"sv"}],"status":{"id":4,"name":"demo","source":"auto","timestamp":"2020-05-25T12:44:47Z","current":true}}]`},
+		{"/lexicon/lookup", `{"lexRefs": [{"dbRef": "wikispeech_lexserver_testdb", "lexName": "sv"}], "query": {"words": ["hund"]}}`, `[{"id":4,"lexRef":{"dbRef":"wikispeech_lexserver_testdb","lexName":"sv"},"strn":"hund","language":"sv","partOfSpeech":"NN","morphology":"NEU IND SIN","wordParts":"hund","lemma":{"id":3,"strn":"hund"},"transcriptions":[{"id":7,"entryId":4,"strn":"\" h u0 n d","language":"sv"}],"status":{"id":4,"name":"demo","source":"auto","timestamp":"2020-05-25T12:44:47Z","current":true}}]`},
+	}
+	postStatusTests := []struct {
+		url, body string
+		status    int
+	}{
+		{"/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv", `["hund"`, http.StatusBadRequest},
+		{"/lexicon/lookup", `{"lexRefs": [{"dbRef": "wikispeech_lexserver_testdb", "lexName": "sv"}], "query": {"wordz": ["hund"]}}`, http.StatusBadRequest},
+		{"/lexicon/lookup", `{"lexRefs": [{"dbRef": "wikispeech_lexserver_testdb", "lexName": "sv"}], "query": {"words": ["hund"], "sortBy": "size"}}`, http.StatusBadRequest},
+		{"/lexicon/entries_exist?lexicons=wikispeech_lexserver_testdb:sv", `["hund", "hunnd"]`, http.StatusOK},
+		{"/lexicon/updateentry", `{"id": 4,`, http.StatusBadRequest},
+		{"/lexicon/updateentry", `{"id": 4, "lexRef": {"dbRef": "wikispeech_lexserver_testdb", "lexName": "sv"}, "strn": "hund", "language": "sv"}`, http.StatusBadRequest},
+		{"/lexicon/disambiguate?lexicons=wikispeech_lexserver_testdb:sv", `[{"word": "dom", "partOfSpeech": "NN"}, {"word": "hunnd"}]`, http.StatusOK},
+		{"/lexicon/disambiguate?lexicons=wikispeech_lexserver_testdb:sv", `[{"word": "dom", "pos": "NN"}]`, http.StatusBadRequest},
+		{"/lexicon/disambiguate?lexicons=wikispeech_lexserver_testdb:sv", `[{"word": ""}]`, http.StatusBadRequest},
+		{"/lexicon/bulk_update?lexicons=wikispeech_lexserver_testdb:sv&operation=set-part-of-speech&value=NNS&source=tester&dry_run=true", `["hund"]`, http.StatusOK},
+		{"/lexicon/bulk_update?lexicons=wikispeech_lexserver_testdb:sv&operation=set-part-of-speech&value=NNS", `["hund"]`, http.StatusBadRequest},
+		{"/lexicon/delete_entries?lexicons=wikispeech_lexserver_testdb:sv&expected_count=5", `["hund"]`, http.StatusPreconditionFailed},
+		{"/lexicon/delete_entries?lexicons=wikispeech_lexserver_testdb:sv", `["hund"]`, http.StatusBadRequest},
+		{"/admin/copy_lexicon?from_lexicon=wikispeech_lexserver_testdb:sv", `{}`, http.StatusBadRequest},
+		{"/admin/rename_lexicon?lexicon=wikispeech_lexserver_testdb:sv&new_name=otherdb:sv2", `{}`, http.StatusBadRequest},
+		{"/lexicon/lookup?lexicons=wikispeech_lexserver_testdb:sv", `["` + strings.Repeat("a", maxRequestBodySize) + `"]`, http.StatusRequestEntityTooLarge},
+	}
+
 	jsonMapTests := map[string]string{
 		// "/mapper/map/sv-se_ws-sampa-DEMO/sv-se_sampa_mary-DEMO/%22%22%20p%20O%20j%20.%20k%20@": `{"From":"sv-se_ws-sampa-DEMO","To":"sv-se_sampa_mary-DEMO","Input":"\"\" p O j . k @","Result":"\" p O j - k @"}`,
 		// "/mapper/map/sv-se_sampa_mary-DEMO/sv-se_ws-sampa-DEMO/%22%20p%20O%20j%20-%20k%20@":    `{"From":"sv-se_sampa_mary-DEMO","To":"sv-se_ws-sampa-DEMO","Input":"\" p O j - k @","Result":"\"\" p O j . k @"}`,
@@ -136,6 +176,30 @@ func testURLsWithContent(port string) (int, int, error) {
 		}
 	}
 
+	log.Printf("init_tests: testing entry lookup (POST): %d", len(lookupPostTests))
+	for _, t := range lookupPostTests {
+		nTests = nTests + 1
+		ok, err := lookupPostTest(port, t.url, t.body, t.expect)
+		if !ok {
+			nFailed = nFailed + 1
+		}
+		if err != nil {
+			return nFailed, nTests, err
+		}
+	}
+
+	log.Printf("init_tests: testing response status (POST): %d", len(postStatusTests))
+	for _, t := range postStatusTests {
+		nTests = nTests + 1
+		ok, err := postStatusTest(port, t.url, t.body, t.status)
+		if !ok {
+			nFailed = nFailed + 1
+		}
+		if err != nil {
+			return nFailed, nTests, err
+		}
+	}
+
 	log.Printf("init_tests: testing json map results: %d", len(jsonMapTests))
 	for url, expect := range jsonMapTests {
 		nTests = nTests + 1
@@ -308,7 +372,41 @@ func lookupTest(port string, url string, expect string) (bool, error) {
 	}
 	defer resp.Body.Close()
 	log.Printf("init_tests: lookup/entry %s", url)
+	return compareLookupResponse(url, resp, expect)
+}
+
+func lookupPostTest(port string, url string, body string, expect string) (bool, error) {
+	url = "http://localhost" + port + url
+	/* #nosec G107 */
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		fmt.Printf("** FAILED TEST ** for %s : couldn't retrieve URL : %v\n", url, err)
+		return false, nil
+	}
+	defer resp.Body.Close()
+	log.Printf("init_tests: lookup/entry (POST) %s", url)
+	return compareLookupResponse(url, resp, expect)
+}
+
+func postStatusTest(port string, url string, body string, expect int) (bool, error) {
+	url = "http://localhost" + port + url
+	/* #nosec G107 */
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		fmt.Printf("** FAILED TEST ** for %s : couldn't retrieve URL : %v\n", url, err)
+		return false, nil
+	}
+	defer resp.Body.Close()
+	log.Printf("init_tests: status (POST) %s", shortenURL(url))
+
+	if resp.StatusCode != expect {
+		fmt.Printf("** FAILED TEST ** for %s : expected response code %d, found %d\n", url, expect, resp.StatusCode)
+		return false, nil
+	}
+	return true, nil
+}
 
+func compareLookupResponse(url string, resp *http.Response, expect string) (bool, error) {
 	if resp.StatusCode != http.StatusOK {
 		fmt.Printf("** FAILED TEST ** for %s : expected response code 200, found %d\n", url, resp.StatusCode)
 		return false, nil
@@ -331,10 +429,12 @@ func lookupTest(port string, url string, expect string) (bool, error) {
 	}
 	for i, e := range gotEs {
 		e.EntryStatus.Timestamp = ""
+		e.Revision = 0
 		gotEs[i] = e
 	}
 	for i, e := range expEs {
 		e.EntryStatus.Timestamp = ""
+		e.Revision = 0
 		expEs[i] = e
 	}
 
@@ -3,15 +3,23 @@ package main
 // The handlers of calls prefixed with '/lexicon/':
 
 import (
+	"bufio"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/stts-se/pronlex/dbapi"
 	"github.com/stts-se/pronlex/lex"
+	"github.com/stts-se/pronlex/line"
 )
 
 // var lexiconValidationPage = urlHandler{
@@ -61,27 +69,57 @@ var lexiconUpdateEntryURL = `/updateentry?entry={
         "current": true
     },
     "entryValidations": [ ],
-    "preferred": false
+    "preferred": false,
+    "revision": 1
 }`
 
+// UpdateConflict is returned (with HTTP status 409) when an update is rejected since the input entry's revision is stale. Current is the entry as it is in the database.
+type UpdateConflict struct {
+	Message string    `json:"message"`
+	Current lex.Entry `json:"current"`
+}
+
 var lexiconUpdateEntry = urlHandler{
 	name:     "updateentry",
 	url:      "/updateentry",
-	help:     "Updates an entry in the database. Input is an entry variable in JSON format. For examples, see <a href=\"https://godoc.org/github.com/stts-se/pronlex/lex\">package documentation</a>.",
+	help:     "Updates an entry in the database. Input is an entry variable in JSON format. For examples, see <a href=\"https://godoc.org/github.com/stts-se/pronlex/lex\">package documentation</a>. The entry is given using the entry param, or as the body of a POST request with content type application/json. The entry must have the revision it was read with (status 400 otherwise). If the revision doesn't match the current revision in the database, the update is rejected with status 409 (Conflict), and the current entry is returned.",
 	examples: []string{lexiconUpdateEntryURL},
 	handler: func(w http.ResponseWriter, r *http.Request) {
-		entryJSON := getParam("entry", r)
-		//body, err := ioutil.ReadAll(r.Body)
+		entryJSON, err := entryJSONFromRequest(w, r)
+		if err != nil {
+			log.Printf("lexserver: Failed to read entry: %v", err)
+			http.Error(w, fmt.Sprintf("failed to process incoming Entry json : %v", err), httpStatus(err, http.StatusBadRequest))
+			return
+		}
 		var e lex.Entry
-		err := json.Unmarshal([]byte(entryJSON), &e)
+		err = json.Unmarshal(entryJSON, &e)
 		if err != nil {
 			log.Printf("lexserver: Failed to unmarshal json: %v", err)
-			http.Error(w, fmt.Sprintf("failed to process incoming Entry json : %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("failed to process incoming Entry json : %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if e.Revision == 0 {
+			msg := fmt.Sprintf("no revision for entry with id '%d' : the entry must have the revision it was read with", e.ID)
+			log.Printf("lexserver: Failed to update entry : %s", msg)
+			http.Error(w, msg, http.StatusBadRequest)
 			return
 		}
 
 		// Underscore below matches bool indicating if any update has taken place. Return this info?
 		res, _, err2 := dbm.UpdateEntry(e)
+		if conflict, ok := err2.(*dbapi.EntryConflictError); ok {
+			log.Printf("lexserver: Failed to update entry : %v", conflict)
+			jsn, err3 := json.Marshal(UpdateConflict{Message: conflict.Error(), Current: conflict.Current})
+			if err3 != nil {
+				http.Error(w, fmt.Sprintf("failed to marshal conflicting entry : %v", err3), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, string(jsn))
+			return
+		}
 		if err2 != nil {
 			log.Printf("lexserver: Failed to update entry : %v", err2)
 			http.Error(w, fmt.Sprintf("failed to update Entry : %v", err2), http.StatusInternalServerError)
@@ -99,6 +137,68 @@ var lexiconUpdateEntry = urlHandler{
 	},
 }
 
+// bulkUpdateParams are the params of /lexicon/bulk_update, in addition to the search params of /lexicon/lookup
+var bulkUpdateParams = map[string]bool{"operation": true, "value": true, "pattern": true, "label": true, "source": true, "dry_run": true}
+
+var lexiconBulkUpdate = urlHandler{
+	name:     "bulk_update",
+	url:      "/bulk_update",
+	help:     "Apply an edit to all entries matching a search query, in a single transaction. The entries are selected using the search params of /lexicon/lookup (the page params are ignored), or a JSON body as for /lexicon/lookup. All lexicons must be in the same database. Required params: operation and source (the updating user, saved as the source of a new entry status for modified entries). Operations: set-status, set-part-of-speech, set-morphology, set-language (using the value param), add-comment (value and label params), replace-transcription (replaces the regexp of the pattern param with the value param, matching at phoneme boundaries only, such as pattern=r s and value=rs), set-preferred and clear-preferred. Optional param: dry_run (true/false; if true, the update is rolled back, and the report shows what would have been changed). Returns the number of matching entries, and the changed fields of each updated entry.",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range r.URL.Query() {
+			if _, ok := knownParams[k]; !ok && !bulkUpdateParams[k] {
+				log.Printf("lexiconBulkUpdate: unknown URL parameter: '%s': '%s'", k, v)
+				http.Error(w, fmt.Sprintf("lexiconBulkUpdate: unknown URL parameter: '%s': '%s'", k, v), http.StatusBadRequest)
+				return
+			}
+		}
+
+		opType, err := dbapi.ParseBulkOperationType(getParam("operation", r))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+		op := dbapi.BulkOperation{Type: opType, Value: getParam("value", r), Pattern: getParam("pattern", r), Label: getParam("label", r)}
+		source := getParam("source", r)
+		if strings.TrimSpace(source) == "" {
+			http.Error(w, "no value for parameter 'source'", http.StatusBadRequest)
+			return
+		}
+		dryRun := false
+		if dryRunS := getParam("dry_run", r); strings.TrimSpace(dryRunS) != "" {
+			dryRun, err = strconv.ParseBool(dryRunS)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed parsing boolean argument dry_run %s : %v", dryRunS, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		q, err := queryFromRequest(w, r)
+		if err != nil {
+			log.Printf("failed to process query: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), httpStatus(err, http.StatusBadRequest))
+			return
+		}
+
+		res, err := dbm.BulkUpdate(q, op, source, dryRun)
+		if err != nil {
+			log.Printf("lexserver: Failed to bulk update entries : %v", err)
+			http.Error(w, fmt.Sprintf("failed to bulk update entries : %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		jsn, err := marshal(res, r)
+		if err != nil {
+			log.Printf("lexserver: Failed to marshal json: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
 var lexiconUpdateValidation = urlHandler{
 	name:     "updatevalidation",
 	url:      "/updatevalidation",
@@ -386,7 +486,7 @@ var lexiconStats = urlHandler{
 var lexiconLookup = urlHandler{
 	name:     "lookup",
 	url:      "/lookup",
-	help:     "Lookup in lexicon.",
+	help:     "Lookup in lexicon. Search criteria are joined with AND. The filter param takes a JSON encoded tree of search criteria, with support for AND, OR and NOT, such as {\"or\": [{\"field\": \"partOfSpeech\", \"op\": \"like\", \"value\": \"PM%\"}, {\"not\": {\"field\": \"status\", \"op\": \"eq\", \"value\": \"ok\"}}]} (see dbapi.Filter). The wordsuffix and transcriptionsuffix params match a literal suffix (not a 'like' expression) using the reversed orthography/transcription index, e.g. for rhyme search. The transcriptionphonemes param matches a sequence of whole transcription symbols, tokenized using the symbol set of the lexicon, such as '\" <any> rs' (see dbapi.PhonemeRegexp; requires the server to be started with the symbol set files). The commenttext param is a full-text search in the comments, and freetext in the orthography, word parts and comments: all words must be found, and \"quoted phrases\" and prefix* search can be used (requires the full-text index, see /admin/enable_fulltext). Results can be sorted using sortby (id, strn, reversedStrn, statusTimestamp, lemma, partOfSpeech, or relevance for full-text search) and sortdesc (true/false). Pagination counts entries: pagelength sets the number of entries per page, and either page (starting at 0), or after (the id of the last entry of the previous page) selects the page. If withcount=true (the total number of matching entries) or facets=true (also entry counts per status, part of speech, user, validation rule and language), the result is an object with the entries and the stats, as returned by /lexicon/query_stats. For long queries, use a POST request with content type application/json: the body is either a dbapi.DBMQuery, such as {\"lexRefs\": [{\"dbRef\": \"wikispeech_lexserver_testdb\", \"lexName\": \"sv\"}], \"query\": {\"words\": [\"hund\", \"häst\"]}}, replacing the query params, or a list of words, such as [\"hund\", \"häst\"], added to the query params.",
 	examples: []string{"/lookup"},
 	handler: func(w http.ResponseWriter, r *http.Request) {
 
@@ -399,7 +499,7 @@ var lexiconLookup = urlHandler{
 			return
 		}
 		params := u.Query()
-		if len(params) == 0 {
+		if len(params) == 0 && !hasJSONBody(r) {
 			log.Print("lexiconLookup: zero params, serving lexlookup.html")
 			http.ServeFile(w, r, filepath.Join(staticFolder, "lexlookup.html"))
 			return
@@ -412,18 +512,281 @@ var lexiconLookup = urlHandler{
 			}
 		}
 
+		q, err := queryFromRequest(w, r)
+
+		if err != nil {
+			log.Printf("failed to process query: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), httpStatus(err, http.StatusBadRequest))
+			return
+		}
+
+		res, err := dbm.LookUpIntoSlice(q)
+
+		if err != nil {
+			log.Printf("lexserver: Failed to get entries: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		var jsnRes interface{} = res
+		withFacets := strings.ToLower(getParam("facets", r)) == "true"
+		if withFacets || strings.ToLower(getParam("withcount", r)) == "true" {
+			stats, err := dbm.QueryStats(q, withFacets)
+			if err != nil {
+				log.Printf("lexserver: Failed to get query stats: %v", err)
+				http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+				return
+			}
+			jsnRes = LookUpWithStats{Entries: res, Stats: stats}
+		}
+
+		jsn, err := marshal(jsnRes, r)
+		if err != nil {
+			log.Printf("lexserver: Failed to marshal json: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+// deadlineEntryWriter extends the write deadline of a streaming response while entries are being written.
+// The deadline is not extended if the client stops reading, or if no entries are produced, so that stalled downloads still time out.
+type deadlineEntryWriter struct {
+	r        *http.Request
+	out      lex.EntryWriter
+	extended time.Time
+	n        int
+}
+
+func (w *deadlineEntryWriter) Write(e lex.Entry) error {
+	if time.Since(w.extended) > time.Second {
+		err := extendWriteDeadline(w.r)
+		if err != nil {
+			return err
+		}
+		w.extended = time.Now()
+	}
+	w.n = w.n + 1
+	return w.out.Write(e)
+}
+
+// Size returns the number of entries written
+func (w *deadlineEntryWriter) Size() int {
+	return w.n
+}
+
+var lexiconExport = urlHandler{
+	name:     "export",
+	url:      "/export/{lexicon_name}",
+	help:     "Export (download) a lexicon, or the entries matching a search query. The entries are streamed to the client as they are read from the database. Optional params: format (ws for the Wikispeech lexicon file format (see line/ws.go), or jsonl for JSON Lines with one entry per line; default: ws), gzip (true/false; default: false), and the search params of /lexicon/lookup, except lexicons.",
+	examples: []string{"/export/wikispeech_lexserver_testdb:sv", "/export/wikispeech_lexserver_testdb:sv?format=jsonl&wordlike=a%", "/export/wikispeech_lexserver_testdb:sv?gzip=true"},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		lexRef, err := getLexRefParam(r)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %v : %v", lexRef, err), http.StatusBadRequest)
+			return
+		}
+		for k, v := range r.URL.Query() {
+			if _, ok := knownParams[k]; (!ok || k == "lexicons") && k != "format" && k != "gzip" {
+				http.Error(w, fmt.Sprintf("lexiconExport: unknown URL parameter: '%s': '%s'", k, v), http.StatusBadRequest)
+				return
+			}
+		}
 		q, err := queryFromParams(r)
+		if err != nil {
+			log.Printf("failed to process query params: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		useGzip := false
+		if gzipS := getParam("gzip", r); strings.TrimSpace(gzipS) != "" {
+			useGzip, err = strconv.ParseBool(gzipS)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed parsing boolean argument gzip %s : %v", gzipS, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var out io.Writer = w
+		fileName := string(lexRef.LexName)
+		var gz *gzip.Writer
+		if useGzip {
+			gz = gzip.NewWriter(w)
+			out = gz
+		}
+		bf := bufio.NewWriter(out)
+
+		var ew lex.EntryWriter
+		switch format := getParam("format", r); format {
+		case "", "ws":
+			wsFmt, err := line.NewWS()
+			if err != nil {
+				log.Printf("lexserver: Failed to create line writer : %v", err)
+				http.Error(w, fmt.Sprintf("failed to create line writer : %v", err), http.StatusInternalServerError)
+				return
+			}
+			ew = line.FileWriter{Parser: wsFmt, Writer: bf}
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fileName = fileName + ".txt"
+		case "jsonl":
+			ew = &lex.EntryJSONLinesWriter{Writer: bf}
+			w.Header().Set("Content-Type", "application/jsonl; charset=utf-8")
+			fileName = fileName + ".jsonl"
+		default:
+			http.Error(w, fmt.Sprintf("unknown format '%s' (expected ws or jsonl)", format), http.StatusBadRequest)
+			return
+		}
+		if useGzip {
+			w.Header().Set("Content-Type", "application/gzip")
+			fileName = fileName + ".gz"
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+
+		dw := &deadlineEntryWriter{r: r, out: ew}
+		err = dbm.ExportLexicon(lexRef, q.Query, dw)
+		if err != nil {
+			log.Printf("lexserver: Failed to export lexicon : %v", err)
+			if dw.Size() == 0 && bf.Buffered() == 0 {
+				// nothing has been sent to the client yet
+				w.Header().Del("Content-Disposition")
+				http.Error(w, fmt.Sprintf("failed to export lexicon : %v", err), http.StatusInternalServerError)
+			}
+			// else, the response is cut off, and the client gets an incomplete download
+			return
+		}
+		err = bf.Flush()
+		if err == nil && gz != nil {
+			err = gz.Close()
+		}
+		if err != nil {
+			log.Printf("lexserver: Failed to write lexicon export : %v", err)
+		}
+	},
+}
+
+// LookUpWithStats is the result of a /lexicon/lookup call with the withcount or facets param
+type LookUpWithStats struct {
+	Entries []lex.Entry      `json:"entries"`
+	Stats   dbapi.QueryStats `json:"stats"`
+}
+
+var lexiconQueryStats = urlHandler{
+	name:     "query_stats",
+	url:      "/query_stats",
+	help:     "Count the entries matching a search query, regardless of page settings, and the number of matching entries per status, part of speech, user, validation rule and language (facets). Takes the same params as /lexicon/lookup. Use facets=false to get only the total count.",
+	examples: []string{"/query_stats?lexicons=wikispeech_lexserver_testdb:sv&wordlike=%25"},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range r.URL.Query() {
+			if _, ok := knownParams[k]; !ok {
+				log.Printf("lexiconQueryStats: unknown URL parameter: '%s': '%s'", k, v)
+				http.Error(w, fmt.Sprintf("lexiconQueryStats: unknown URL parameter: '%s': '%s'", k, v), http.StatusBadRequest)
+				return
+			}
+		}
 
+		q, err := queryFromParams(r)
 		if err != nil {
 			log.Printf("failed to process query params: %v", err)
 			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
 			return
 		}
 
-		res, err := dbm.LookUpIntoSlice(q)
+		withFacets := strings.ToLower(getParam("facets", r)) != "false"
+		stats, err := dbm.QueryStats(q, withFacets)
+		if err != nil {
+			log.Printf("lexserver: Failed to get query stats: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
 
+		jsn, err := marshal(stats, r)
 		if err != nil {
-			log.Printf("lexserver: Failed to get entries: %v", err)
+			log.Printf("lexserver: Failed to marshal json: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+var lexiconResolve = urlHandler{
+	name:     "resolve",
+	url:      "/resolve",
+	help:     "Resolve words using a list of lexicons in priority order (such as a user override lexicon, the main lexicon and a names lexicon). For each word, the preferred entry from the first lexicon having an entry for the word is returned, along with the lexicon it came from. Words not found in any of the lexicons are returned without an entry. Params: lexicons (in priority order) and words. The words can also be sent in a POST request with content type application/json, as a list of words (see /lexicon/lookup).",
+	examples: []string{"/resolve?lexicons=wikispeech_lexserver_testdb:sv&words=hund,h%C3%A4st,hunnd"},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range r.URL.Query() {
+			if !(k == "lexicons" || k == "words" || k == "pp") {
+				log.Printf("lexiconResolve: unknown URL parameter: '%s': '%s'", k, v)
+				http.Error(w, fmt.Sprintf("lexiconResolve: unknown URL parameter: '%s': '%s'. Valid parameters: lexicons, words", k, v), http.StatusBadRequest)
+				return
+			}
+		}
+
+		q, err := queryFromRequest(w, r)
+		if err != nil {
+			log.Printf("failed to process query: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), httpStatus(err, http.StatusBadRequest))
+			return
+		}
+
+		res, err := dbm.LookUpWithFallback(q.Query.Words, q.LexRefs)
+		if err != nil {
+			log.Printf("lexserver: Failed to resolve words: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		jsn, err := marshal(res, r)
+		if err != nil {
+			log.Printf("lexserver: Failed to marshal json: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+var lexiconDisambiguate = urlHandler{
+	name:     "disambiguate",
+	url:      "/disambiguate",
+	help:     "Select exactly one entry per token, using the part of speech, morphology and tag of each token to choose between homographs. Params: lexicons (in priority order, see /lexicon/resolve) and tokens: a JSON list of tokens, such as [{\"word\": \"läser\", \"partOfSpeech\": \"VB\", \"morphology\": \"PRS AKT\"}] (word is required; partOfSpeech, morphology and tag are optional). The tokens can also be sent in a POST request with content type application/json. Candidate entries are ranked by matching tag, matching part of speech, and the number of matching morphological features, in that order. If none of them matches, the preferred entry is selected (match.fallback is true). For the complete ranking, see dbapi.DBManager.Disambiguate. Tokens not found in any of the lexicons are returned without an entry.",
+	examples: []string{"/disambiguate?lexicons=wikispeech_lexserver_testdb:sv&tokens=%5B%7B%22word%22%3A%22dom%22%2C%22partOfSpeech%22%3A%22NN%22%7D%5D"},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range r.URL.Query() {
+			if !(k == "lexicons" || k == "tokens" || k == "pp") {
+				log.Printf("lexiconDisambiguate: unknown URL parameter: '%s': '%s'", k, v)
+				http.Error(w, fmt.Sprintf("lexiconDisambiguate: unknown URL parameter: '%s': '%s'. Valid parameters: lexicons, tokens", k, v), http.StatusBadRequest)
+				return
+			}
+		}
+
+		q, err := queryFromParams(r)
+		if err != nil {
+			log.Printf("failed to process query params: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			return
+		}
+
+		tokens, err := tokensFromRequest(w, r)
+		if err != nil {
+			log.Printf("failed to process tokens: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), httpStatus(err, http.StatusBadRequest))
+			return
+		}
+
+		res, err := dbm.Disambiguate(tokens, q.LexRefs)
+		if err != nil {
+			log.Printf("lexserver: Failed to disambiguate tokens: %v", err)
 			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
 			return
 		}
@@ -450,7 +813,7 @@ type MiniEntry struct {
 var lexiconEntriesExist = urlHandler{
 	name:     "entries_exist",
 	url:      "/entries_exist",
-	help:     "Lookup orthographies in the db and see if they exist as entries.",
+	help:     "Lookup orthographies in the db and see if they exist as entries. The words can also be sent in a POST request with content type application/json, as a list of words (see /lexicon/lookup).",
 	examples: []string{"/entries_exist?lexicons=wikispeech_lexserver_testdb:sv&words=hund,h%C3%A4st,hunnd"},
 	handler: func(w http.ResponseWriter, r *http.Request) {
 
@@ -476,11 +839,11 @@ var lexiconEntriesExist = urlHandler{
 			}
 		}
 
-		q, err := queryFromParams(r)
+		q, err := queryFromRequest(w, r)
 
 		if err != nil {
-			log.Printf("failed to process query params: %v", err)
-			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			log.Printf("failed to process query: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), httpStatus(err, http.StatusBadRequest))
 			return
 		}
 		var res = make(map[string][]MiniEntry)
@@ -540,7 +903,7 @@ type IDs struct {
 var lexiconAddEntry = urlHandler{
 	name:     "addentry",
 	url:      "/addentry",
-	help:     "Add an entry to the database. Input entry in JSON format. For examples, see <a href=\"https://godoc.org/github.com/stts-se/pronlex/lex\">package documentation</a>.",
+	help:     "Add an entry to the database. Input entry in JSON format, using the entry param, or as the body of a POST request with content type application/json. For examples, see <a href=\"https://godoc.org/github.com/stts-se/pronlex/lex\">package documentation</a>.",
 	examples: []string{lexiconAddEntryURL},
 	handler: func(w http.ResponseWriter, r *http.Request) {
 		lexRef, err := getLexRefParam(r)
@@ -550,12 +913,17 @@ var lexiconAddEntry = urlHandler{
 			return
 		}
 
-		entryJSON := getParam("entry", r)
+		entryJSON, err := entryJSONFromRequest(w, r)
+		if err != nil {
+			log.Printf("lexserver: Failed to read entry: %v", err)
+			http.Error(w, fmt.Sprintf("failed to process incoming Entry json : %v", err), httpStatus(err, http.StatusBadRequest))
+			return
+		}
 		var e lex.Entry
-		err = json.Unmarshal([]byte(entryJSON), &e)
+		err = json.Unmarshal(entryJSON, &e)
 		if err != nil {
 			log.Printf("lexserver: Failed to unmarshal json: %v", err)
-			http.Error(w, fmt.Sprintf("failed to process incoming Entry json : %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("failed to process incoming Entry json : %v", err), http.StatusBadRequest)
 			return
 		}
 
@@ -596,7 +964,9 @@ var deleteEntry = func(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	idRes, err := dbm.DeleteEntry(id, lexRef)
+	source := getParam("source", r)
+
+	idRes, err := dbm.DeleteEntry(id, lexRef, source)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, fmt.Sprintf("failed to detele entry id '%s' in lexicon '%s' : %v", entryID, lexRef.LexName, err), http.StatusInternalServerError)
@@ -606,14 +976,268 @@ var deleteEntry = func(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "deleted entry id '%d' from lexicon '%s'\n", idRes, lexRef.LexName)
 }
 
+// DeleteEntriesResult is the response of /lexicon/delete_entries
+type DeleteEntriesResult struct {
+	dbapi.DeleteEntriesResult
+	// The server side WS file containing the deleted entries, if archive=true
+	ArchiveFile string `json:"archiveFile,omitempty"`
+}
+
+// deleteEntriesParams are the params of /lexicon/delete_entries, in addition to the search params of /lexicon/lookup
+var deleteEntriesParams = map[string]bool{"expected_count": true, "archive": true, "source": true}
+
+var lexiconDeleteEntries = urlHandler{
+	name:     "delete_entries",
+	url:      "/delete_entries",
+	help:     "Delete all entries matching a search query, in a single transaction. The entries are selected using the search params of /lexicon/lookup (the page params are ignored), or a JSON body as for /lexicon/lookup. All lexicons must be in the same database. Required param: expected_count, the number of matching entries (see /lexicon/query_stats). If the number of matching entries differs, nothing is deleted, and status 412 (Precondition Failed) is returned. Optional params: archive (true/false; if true, the entries are written to a WS file in the archive folder of the server before they are deleted), source (the deleting user, saved in the entry history). Returns the ids of the deleted entries.",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range r.URL.Query() {
+			if _, ok := knownParams[k]; !ok && !deleteEntriesParams[k] {
+				log.Printf("lexiconDeleteEntries: unknown URL parameter: '%s': '%s'", k, v)
+				http.Error(w, fmt.Sprintf("lexiconDeleteEntries: unknown URL parameter: '%s': '%s'", k, v), http.StatusBadRequest)
+				return
+			}
+		}
+
+		expectedCountS := getParam("expected_count", r)
+		if strings.TrimSpace(expectedCountS) == "" {
+			http.Error(w, "no value for parameter 'expected_count'", http.StatusBadRequest)
+			return
+		}
+		expectedCount, err := strconv.ParseInt(expectedCountS, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed parsing integer argument expected_count %s : %v", expectedCountS, err), http.StatusBadRequest)
+			return
+		}
+		archive := false
+		if archiveS := getParam("archive", r); strings.TrimSpace(archiveS) != "" {
+			archive, err = strconv.ParseBool(archiveS)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed parsing boolean argument archive %s : %v", archiveS, err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		q, err := queryFromRequest(w, r)
+		if err != nil {
+			log.Printf("failed to process query: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), httpStatus(err, http.StatusBadRequest))
+			return
+		}
+		if len(q.LexRefs) == 0 {
+			http.Error(w, "no value for parameter 'lexicons'", http.StatusBadRequest)
+			return
+		}
+
+		var res DeleteEntriesResult
+		var archiveWriter lex.EntryWriter
+		if archive {
+			f, err := createArchiveFile(q.LexRefs[0].DBRef)
+			if err != nil {
+				log.Printf("lexserver: Failed to create archive file : %v", err)
+				http.Error(w, fmt.Sprintf("failed to create archive file : %v", err), http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+			wsFmt, err := line.NewWS()
+			if err != nil {
+				log.Printf("lexserver: Failed to create line writer : %v", err)
+				http.Error(w, fmt.Sprintf("failed to create line writer : %v", err), http.StatusInternalServerError)
+				return
+			}
+			archiveWriter = line.FileWriter{Parser: wsFmt, Writer: f}
+			res.ArchiveFile = f.Name()
+		}
+
+		res.DeleteEntriesResult, err = dbm.DeleteEntries(q, expectedCount, getParam("source", r), archiveWriter)
+		if err != nil && res.ArchiveFile != "" {
+			if err2 := os.Remove(res.ArchiveFile); err2 != nil {
+				log.Printf("lexserver: Failed to remove archive file %s : %v", res.ArchiveFile, err2)
+			}
+		}
+		if _, ok := err.(*dbapi.DeleteCountError); ok {
+			log.Printf("lexserver: Failed to delete entries : %v", err)
+			http.Error(w, fmt.Sprintf("failed to delete entries : %v", err), http.StatusPreconditionFailed)
+			return
+		}
+		if err != nil {
+			log.Printf("lexserver: Failed to delete entries : %v", err)
+			http.Error(w, fmt.Sprintf("failed to delete entries : %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		jsn, err := marshal(res, r)
+		if err != nil {
+			log.Printf("lexserver: Failed to marshal json: %v", err)
+			http.Error(w, fmt.Sprintf("%v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+// createArchiveFile creates a new, uniquely named, file in the archive folder, for entries deleted from a database
+func createArchiveFile(dbRef lex.DBRef) (*os.File, error) {
+	err := os.MkdirAll(archiveFolder, 0750)
+	if err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(archiveFolder, fmt.Sprintf("%s_deleted_%s_*.txt", dbRef, time.Now().Format("20060102T150405")))
+}
+
 var lexiconDeleteEntry = urlHandler{
 	name:     "delete_entry",
 	url:      "/delete_entry/{lexicon_name}/{entry_id}",
-	help:     "Delete an entry from the database.",
+	help:     "Delete an entry from the database. Optional param: source (the deleting user, saved in the entry history).",
 	examples: []string{},
 	handler:  deleteEntry,
 }
 
+var lexiconHistory = urlHandler{
+	name:     "history",
+	url:      "/history/{lexicon_name}/{entry_id}",
+	help:     "Lists the recorded changes of an entry (action, source, timestamp, and old and new value of each changed field), oldest first. Optional param as_of (timestamp, e.g. 2017-11-14T09:34:30Z) returns the entry as it was at that time instead.",
+	examples: []string{"/history/wikispeech_lexserver_testdb:sv/9"},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		lexRef, err := getLexRefParam(r)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %v : %v", lexRef, err), http.StatusInternalServerError)
+			return
+		}
+
+		entryID := getParam("entry_id", r)
+		id, err := strconv.ParseInt(entryID, 10, 64)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("failed to parse entry id %s : %v", entryID, err), http.StatusBadRequest)
+			return
+		}
+
+		var res interface{}
+		if asOf := getParam("as_of", r); asOf != "" {
+			res, err = dbm.EntryAsOf(lexRef, id, asOf)
+		} else {
+			res, err = dbm.EntryHistory(lexRef, id)
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("failed to get history for entry id '%s' in lexicon '%s' : %v", entryID, lexRef.LexName, err), http.StatusInternalServerError)
+			return
+		}
+
+		jsn, err := marshal(res, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed marshalling : %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+var lexiconRevertEntry = urlHandler{
+	name:     "revert_entry",
+	url:      "/revert_entry",
+	help:     "Reverts the transcriptions, lemma, tag, part of speech, morphology, preferred flag and comments of an entry to an earlier revision (the entry revision number, as listed by /lexicon/history). Required params: lexicon_name, entry_id, revision and source (the reverting user, saved as the source of a new entry status). Returns the reverted entry.",
+	examples: []string{},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		lexRef, err := getLexRefParam(r)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %v : %v", lexRef, err), http.StatusBadRequest)
+			return
+		}
+
+		entryID := getParam("entry_id", r)
+		id, err := strconv.ParseInt(entryID, 10, 64)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("failed to parse entry id %s : %v", entryID, err), http.StatusBadRequest)
+			return
+		}
+		revision := getParam("revision", r)
+		rev, err := strconv.ParseInt(revision, 10, 64)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("failed to parse revision %s : %v", revision, err), http.StatusBadRequest)
+			return
+		}
+		source := getParam("source", r)
+		if strings.TrimSpace(source) == "" {
+			msg := "input param <source> must not be empty"
+			log.Println(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		res, err := dbm.RevertEntry(lexRef, id, rev, source)
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("failed to revert entry id '%s' in lexicon '%s' : %v", entryID, lexRef.LexName, err), http.StatusInternalServerError)
+			return
+		}
+
+		jsn, err := marshal(res, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed marshalling : %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
+var lexiconDiff = urlHandler{
+	name:     "diff",
+	url:      "/diff",
+	help:     "Compares two lexicons, possibly in different databases. Entries are matched on orthography and tag, and compared on transcriptions (regardless of order), part of speech, morphology, lemma and status. Required params: from_lexicon and to_lexicon (full lexicon names, db:lexicon). Optional param format: json (default) or text.",
+	examples: []string{"/diff?from_lexicon=wikispeech_lexserver_testdb:sv&to_lexicon=wikispeech_lexserver_testdb:sv"},
+	handler: func(w http.ResponseWriter, r *http.Request) {
+		var lexRefs []lex.LexRef
+		for _, param := range []string{"from_lexicon", "to_lexicon"} {
+			lexRefS := getParam(param, r)
+			if strings.TrimSpace(lexRefS) == "" {
+				http.Error(w, fmt.Sprintf("no value for parameter '%s'", param), http.StatusBadRequest)
+				return
+			}
+			lexRef, err := lex.ParseLexRef(lexRefS)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("couldn't parse lexicon ref %s : %v", lexRefS, err), http.StatusBadRequest)
+				return
+			}
+			lexRefs = append(lexRefs, lexRef)
+		}
+		format := getParam("format", r)
+		if format != "" && format != "json" && format != "text" {
+			http.Error(w, fmt.Sprintf("invalid format '%s', expected json or text", format), http.StatusBadRequest)
+			return
+		}
+
+		diff, err := dbm.DiffLexicons(lexRefs[0], lexRefs[1])
+		if err != nil {
+			log.Println(err)
+			http.Error(w, fmt.Sprintf("failed to diff lexicons : %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		if format == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, diff.String())
+			return
+		}
+		jsn, err := marshal(diff, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed marshalling : %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		fmt.Fprint(w, string(jsn))
+	},
+}
+
 // var lexiconValidation = urlHandler{
 // 	name:     "validation (api)",
 // 	url:      "/validation/{lexicon_name}",
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/stts-se/pronlex/dbapi"
 	"github.com/stts-se/pronlex/lex"
+	"github.com/stts-se/symbolset"
 )
 
 func getParam(paramName string, r *http.Request) string {
@@ -159,8 +161,9 @@ func protect(w http.ResponseWriter) {
 var uploadFileArea string // = ioutil.TempDir("", filepath.Join("lexserver","upload_area"))
 //var downloadFileArea string  // = ioutil.TempDir("", filepath.Join("lexserver",""download_area"))
 //var symbolSetFileArea string // = filepath.Join(".", "symbol_files")
-var dbLocation *string  // = filepath.Join(".", "db_files")
-var staticFolder string // = "."
+var dbLocation *string   // = filepath.Join(".", "db_files")
+var staticFolder string  // = "."
+var archiveFolder string // = filepath.Join(".", "archive_files")
 
 // TODO config stuff
 func initFolders() error {
@@ -326,40 +329,51 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 
 // TODO Gör konstanter som kan användas istället för strängar
 var knownParams = map[string]int{
-	"lexicons":            1,
-	"entryids":            1,
-	"words":               1,
-	"lemmas":              1,
-	"wordlike":            1,
-	"wordregexp":          1,
-	"entrystatus":         1,
-	"users":               1,
-	"wordparts":           1,
-	"wordpartslike":       1,
-	"wordpartsregexp":     1,
-	"transcriptionlike":   1,
-	"transcriptionregexp": 1,
-	"partofspeechlike":    1,
-	"partofspeechregexp":  1,
-	"lemmalike":           1,
-	"lemmaregexp":         1,
-	"readinglike":         1,
-	"readingregexp":       1,
-	"paradigmlike":        1,
-	"paradigmregexp":      1,
-	"hasentryvalidation":  1,
-	"validationrulelike":  1,
-	"validationlevellike": 1,
-	"taglike":             1,
-	"languagelike":        1,
-	"morphologylike":      1,
-	"commentlabellike":    1,
-	"commentsourcelike":   1,
-	"commentlike":         1,
-	"multipletags":        1,
-	"page":                1,
-	"pagelength":          1,
-	"pp":                  1,
+	"lexicons":              1,
+	"entryids":              1,
+	"words":                 1,
+	"lemmas":                1,
+	"wordlike":              1,
+	"wordregexp":            1,
+	"wordsuffix":            1,
+	"entrystatus":           1,
+	"users":                 1,
+	"wordparts":             1,
+	"wordpartslike":         1,
+	"wordpartsregexp":       1,
+	"transcriptionlike":     1,
+	"transcriptionregexp":   1,
+	"transcriptionsuffix":   1,
+	"transcriptionphonemes": 1,
+	"partofspeechlike":      1,
+	"partofspeechregexp":    1,
+	"lemmalike":             1,
+	"lemmaregexp":           1,
+	"readinglike":           1,
+	"readingregexp":         1,
+	"paradigmlike":          1,
+	"paradigmregexp":        1,
+	"hasentryvalidation":    1,
+	"validationrulelike":    1,
+	"validationlevellike":   1,
+	"taglike":               1,
+	"languagelike":          1,
+	"morphologylike":        1,
+	"commentlabellike":      1,
+	"commentsourcelike":     1,
+	"commentlike":           1,
+	"commenttext":           1,
+	"freetext":              1,
+	"multipletags":          1,
+	"filter":                1,
+	"page":                  1,
+	"pagelength":            1,
+	"sortby":                1,
+	"sortdesc":              1,
+	"after":                 1,
+	"withcount":             1,
+	"facets":                1,
+	"pp":                    1,
 }
 
 // list of values to the same param splits on comma and/or space
@@ -388,10 +402,13 @@ func queryFromParams(r *http.Request) (dbapi.DBMQuery, error) {
 
 	wordLike := strings.TrimSpace(getParam("wordlike", r))
 	wordRegexp := strings.TrimSpace(getParam("wordregexp", r))
+	wordSuffix := strings.TrimSpace(getParam("wordsuffix", r))
 	wordPartsLike := strings.TrimSpace(getParam("wordpartslike", r))
 	wordPartsRegexp := strings.TrimSpace(getParam("wordpartsregexp", r))
 	transcriptionLike := strings.TrimSpace(getParam("transcriptionlike", r))
 	transcriptionRegexp := strings.TrimSpace(getParam("transcriptionregexp", r))
+	transcriptionSuffix := strings.TrimSpace(getParam("transcriptionsuffix", r))
+	transcriptionPhonemes := strings.TrimSpace(getParam("transcriptionphonemes", r))
 	partOfSpeechLike := strings.TrimSpace(getParam("partofspeechlike", r))
 	partOfSpeechRegexp := strings.TrimSpace(getParam("partofspeechregexp", r))
 	languageLike := strings.TrimSpace(getParam("languagelike", r))
@@ -427,6 +444,9 @@ func queryFromParams(r *http.Request) (dbapi.DBMQuery, error) {
 	commentLabelLike := strings.TrimSpace(getParam("commentlabellike", r))
 	commentSourceLike := strings.TrimSpace(getParam("commentsourcelike", r))
 	commentLike := strings.TrimSpace(getParam("commentlike", r))
+	// Full-text search, see dbapi.Query.CommentText and dbapi.Query.FreeText
+	commentText := strings.TrimSpace(getParam("commenttext", r))
+	freeText := strings.TrimSpace(getParam("freetext", r))
 
 	// TODO report error if getParam("page", r) != ""?
 	// Silently sets deafault if no value, or faulty value
@@ -444,6 +464,38 @@ func queryFromParams(r *http.Request) (dbapi.DBMQuery, error) {
 		pageLength = 0
 	}
 
+	// A tree of search criteria in JSON, see dbapi.Filter
+	var filter *dbapi.Filter
+	if filterS := strings.TrimSpace(getParam("filter", r)); filterS != "" {
+		filter = &dbapi.Filter{}
+		err = json.Unmarshal([]byte(filterS), filter)
+		if err != nil {
+			return dbapi.DBMQuery{}, fmt.Errorf("couldn't parse filter '%s' : %v", filterS, err)
+		}
+		err = filter.Validate()
+		if err != nil {
+			return dbapi.DBMQuery{}, fmt.Errorf("invalid filter '%s' : %v", filterS, err)
+		}
+	}
+
+	sortBy, err := dbapi.ParseSortKey(getParam("sortby", r))
+	if err != nil {
+		return dbapi.DBMQuery{}, err
+	}
+	sortDesc := false
+	if strings.ToLower(getParam("sortdesc", r)) == "true" {
+		sortDesc = true
+	}
+
+	// Keyset pagination: the id of the last entry of the previous page
+	var after int64
+	if afterS := strings.TrimSpace(getParam("after", r)); afterS != "" {
+		after, err = strconv.ParseInt(afterS, 10, 64)
+		if err != nil {
+			return dbapi.DBMQuery{}, fmt.Errorf("couldn't create int64 from input string '%s' : %v", afterS, err)
+		}
+	}
+
 	lexRefs := []lex.LexRef{}
 	for _, l := range lexs {
 		ref, err := lex.ParseLexRef(l)
@@ -454,38 +506,47 @@ func queryFromParams(r *http.Request) (dbapi.DBMQuery, error) {
 	}
 
 	q := dbapi.Query{
-		Words:               words,
-		WordParts:           wordParts,
-		WordPartsLike:       wordPartsLike,
-		WordPartsRegexp:     wordPartsRegexp,
-		EntryIDs:            entryIDs,
-		WordLike:            wordLike,
-		WordRegexp:          wordRegexp,
-		TranscriptionLike:   transcriptionLike,
-		TranscriptionRegexp: transcriptionRegexp,
-		PartOfSpeechLike:    partOfSpeechLike,
-		PartOfSpeechRegexp:  partOfSpeechRegexp,
-		MorphologyLike:      morphologyLike,
-		Lemmas:              lemmas,
-		LemmaLike:           lemmaLike,
-		LemmaRegexp:         lemmaRegexp,
-		LanguageLike:        languageLike,
-		ReadingLike:         readingLike,
-		ReadingRegexp:       readingRegexp,
-		ParadigmLike:        paradigmLike,
-		ParadigmRegexp:      paradigmRegexp,
-		EntryStatus:         entryStatus,
-		TagLike:             tagLike,
-		CommentLabelLike:    commentLabelLike,
-		CommentSourceLike:   commentSourceLike,
-		CommentLike:         commentLike,
-		Page:                page,
-		PageLength:          pageLength,
-		HasEntryValidation:  hasEntryValidation,
-		MultipleTags:        multipleTags,
-		ValidationRuleLike:  validationRuleLike,
-		ValidationLevelLike: validationLevelLike,
-		Users:               users,
+		Words:                 words,
+		WordParts:             wordParts,
+		WordPartsLike:         wordPartsLike,
+		WordPartsRegexp:       wordPartsRegexp,
+		EntryIDs:              entryIDs,
+		WordLike:              wordLike,
+		WordRegexp:            wordRegexp,
+		WordSuffix:            wordSuffix,
+		TranscriptionLike:     transcriptionLike,
+		TranscriptionRegexp:   transcriptionRegexp,
+		TranscriptionSuffix:   transcriptionSuffix,
+		TranscriptionPhonemes: transcriptionPhonemes,
+		PartOfSpeechLike:      partOfSpeechLike,
+		PartOfSpeechRegexp:    partOfSpeechRegexp,
+		MorphologyLike:        morphologyLike,
+		Lemmas:                lemmas,
+		LemmaLike:             lemmaLike,
+		LemmaRegexp:           lemmaRegexp,
+		LanguageLike:          languageLike,
+		ReadingLike:           readingLike,
+		ReadingRegexp:         readingRegexp,
+		ParadigmLike:          paradigmLike,
+		ParadigmRegexp:        paradigmRegexp,
+		EntryStatus:           entryStatus,
+		TagLike:               tagLike,
+		CommentLabelLike:      commentLabelLike,
+		CommentSourceLike:     commentSourceLike,
+		CommentLike:           commentLike,
+		CommentText:           commentText,
+		FreeText:              freeText,
+		SortBy:                sortBy,
+		SortDescending:        sortDesc,
+		Page:                  page,
+		PageLength:            pageLength,
+		After:                 after,
+		HasEntryValidation:    hasEntryValidation,
+		MultipleTags:          multipleTags,
+		ValidationRuleLike:    validationRuleLike,
+		ValidationLevelLike:   validationLevelLike,
+		Users:                 users,
+		Filter:                filter,
 	}
 
 	dq := dbapi.DBMQuery{
@@ -495,6 +556,26 @@ func queryFromParams(r *http.Request) (dbapi.DBMQuery, error) {
 	return dq, nil
 }
 
+// writeTimeout is the server's WriteTimeout. Handlers streaming large responses can extend it using extendWriteDeadline.
+const writeTimeout = 10 * time.Second
+
+type connContextKey struct{}
+
+// saveConnInContext makes the client connection available to the handlers, see extendWriteDeadline
+func saveConnInContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// extendWriteDeadline moves the write deadline of the request's connection to writeTimeout from now.
+// It is used by handlers streaming large responses, that would otherwise be cut off by the server's WriteTimeout.
+func extendWriteDeadline(r *http.Request) error {
+	c, ok := r.Context().Value(connContextKey{}).(net.Conn)
+	if !ok {
+		return fmt.Errorf("no connection found for request")
+	}
+	return c.SetWriteDeadline(time.Now().Add(writeTimeout))
+}
+
 // Remove initial and trailing " or ' from string
 func delQuote(s string) string {
 	res := s
@@ -635,10 +716,13 @@ func main() {
 	var test = flag.Bool("test", false, "run server tests")
 	dbEngine = flag.String("db_engine", "sqlite", "db engine (sqlite or mariadb)")
 	var maxOpenConns = flag.Int("max_open_conns", 0, "max open connections to one db")
+	var migrateSchema = flag.Bool("migrate_schema", false, "migrate dbs with an out-of-date schema version on startup (default: refuse to start; see also cmd/lexio/migrateSchema)")
 	dbLocation = flag.String("db_location", "", fmt.Sprintf("db location (default \"%s\" for sqlite; \"%s\" for mariadb)", defaultSqliteLocation, defaultMariaDBLocation))
 	var logger = flag.String("logger", "stderr", "System `logger` (stderr, syslog or filename)")
 	var prefixFlag = flag.String("prefix", "", "Explicit server prefix (e.g. /lexserver)")
 	var static = flag.String("static", filepath.Join(".", "static"), "location for static html files")
+	var ssFiles = flag.String("ss_files", "", "location for symbol set files, used for phoneme search (optional)")
+	var archive = flag.String("archive_dir", filepath.Join(".", "archive_files"), "location for archive files of deleted entries (see /lexicon/delete_entries)")
 	var version = flag.Bool("version", false, "print version and exit")
 	var help = flag.Bool("help", false, "print usage/help and exit")
 
@@ -731,6 +815,7 @@ Default ports:
 	//symbolSetFileArea = *ssFiles
 	//dbLocation = *dbFiles
 	staticFolder = *static
+	archiveFolder = *archive
 
 	var engine dbapi.DBEngine
 	if *dbEngine == "sqlite" {
@@ -760,6 +845,20 @@ Default ports:
 		os.Exit(1)
 	}
 	dbm.MaxOpenConns = *maxOpenConns
+	if *migrateSchema {
+		dbm.SchemaCheck = dbapi.MigrateOutdatedSchema
+	}
+	if *ssFiles != "" {
+		symbolSets, err := symbolset.LoadSymbolSetsFromDir(*ssFiles)
+		if err != nil {
+			log.Fatal(fmt.Errorf("lexserver: couldn't load symbol sets : %v", err))
+			os.Exit(1)
+		}
+		for _, ss := range symbolSets {
+			dbm.AddSymbolSet(ss)
+		}
+		log.Printf("lexserver: loaded %d symbol sets from %s", len(symbolSets), *ssFiles)
+	}
 	if engine == dbapi.Sqlite {
 		dbapi.Sqlite3WithRegex()
 	}
@@ -853,7 +952,10 @@ func createServer(port string) (*http.Server, error) {
 	lexicon := newSubRouter(rout, "/lexicon", "Lexicon management/admin, including full validation")
 	lexicon.addHandler(lexiconList)
 	lexicon.addHandler(lexiconLookup) // has its own index page in static/
+	lexicon.addHandler(lexiconQueryStats)
 	lexicon.addHandler(lexiconEntriesExist)
+	lexicon.addHandler(lexiconResolve)
+	lexicon.addHandler(lexiconDisambiguate)
 	lexicon.addHandler(lexiconInfo)
 	lexicon.addHandler(lexiconStats)
 	lexicon.addHandler(lexiconListCommentLabels)
@@ -864,19 +966,33 @@ func createServer(port string) (*http.Server, error) {
 	// lexicon.addHandler(lexiconValidation)
 	lexicon.addHandler(lexiconUpdateEntry)
 	lexicon.addHandler(lexiconUpdateValidation)
+	lexicon.addHandler(lexiconBulkUpdate)
 	lexicon.addHandler(lexiconAddEntry)
 	lexicon.addHandler(lexiconDeleteEntry)
+	lexicon.addHandler(lexiconDeleteEntries)
+	lexicon.addHandler(lexiconHistory)
+	lexicon.addHandler(lexiconRevertEntry)
+	lexicon.addHandler(lexiconDiff)
+	lexicon.addHandler(lexiconExport)
 
 	admin := newSubRouter(rout, "/admin", "Misc admin tools")
 	admin.addHandler(adminLexImportPage)
 	admin.addHandler(adminLexImport)
 	admin.addHandler(adminListDBs)
 	admin.addHandler(adminCreateDB)
+	admin.addHandler(adminEnableFullText)
 	admin.addHandler(adminDefineLex)
 	admin.addHandler(adminMoveNewEntries)
+	admin.addHandler(adminMergeLexicons)
+	admin.addHandler(adminCopyLexicon)
+	admin.addHandler(adminRenameLexicon)
 	admin.addHandler(adminDeleteLex)
 	// // admin.addHandler(adminSuperDeleteLex)
 	admin.addHandler(adminListIDs)
+	admin.addHandler(adminCreateSnapshot)
+	admin.addHandler(adminListSnapshots)
+	admin.addHandler(adminExportSnapshot)
+	admin.addHandler(adminDeleteSnapshot)
 
 	// Sqlite3 ANALYZE command in some instances make search quicker,
 	// but it takes a while to perform. TODO: Re-add this call?
@@ -928,8 +1044,9 @@ func createServer(port string) (*http.Server, error) {
 		Addr:           port,
 		Handler:        rout,
 		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		WriteTimeout:   writeTimeout,
 		MaxHeaderBytes: 1 << 20,
+		ConnContext:    saveConnInContext,
 	}
 
 	return s, nil
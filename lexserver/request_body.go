@@ -0,0 +1,167 @@
+package main
+
+// JSON request bodies (POST), as an alternative to URL params for large input, such as long word lists or entries
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/stts-se/pronlex/dbapi"
+)
+
+// maxRequestBodySize is the max size in bytes of a JSON request body
+const maxRequestBodySize = 10 << 20
+
+// requestError is an error caused by the client request, with the HTTP status code to return
+type requestError struct {
+	status int
+	msg    string
+}
+
+func (e requestError) Error() string {
+	return e.msg
+}
+
+// httpStatus returns the status code of a requestError, or defaultStatus for other errors
+func httpStatus(err error, defaultStatus int) int {
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		return reqErr.status
+	}
+	return defaultStatus
+}
+
+// hasJSONBody returns true if the request is a POST request with content type application/json
+func hasJSONBody(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// readJSONBody reads the JSON body of a request, limited to maxRequestBodySize.
+// It returns a requestError (status 400 or 413) if the body is too large, or is not a single well-formed JSON value.
+func readJSONBody(w http.ResponseWriter, r *http.Request) (json.RawMessage, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, requestError{status: http.StatusRequestEntityTooLarge, msg: fmt.Sprintf("request body too large (max %d bytes)", maxErr.Limit)}
+		}
+		return nil, requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("couldn't read request body : %v", err)}
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, requestError{status: http.StatusBadRequest, msg: "empty request body"}
+	}
+	if !json.Valid(body) {
+		return nil, requestError{status: http.StatusBadRequest, msg: "malformed JSON in request body"}
+	}
+	return json.RawMessage(body), nil
+}
+
+// unmarshalStrict unmarshals JSON into v, rejecting unknown fields. Errors are returned as requestErrors (status 400).
+func unmarshalStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("couldn't parse JSON in request body : %v", err)}
+	}
+	return nil
+}
+
+// queryFromRequest returns the search query of a request. For a POST request with a JSON body, the body is either
+// a dbapi.DBMQuery, such as {"lexRefs": [{"dbRef": "lexdb", "lexName": "sv"}], "query": {"words": ["hund", "häst"]}}, that replaces the query params,
+// or a list of words, such as ["hund", "häst"], that is added to the query params (see queryFromParams).
+// Otherwise, the query params are used.
+func queryFromRequest(w http.ResponseWriter, r *http.Request) (dbapi.DBMQuery, error) {
+	if !hasJSONBody(r) {
+		q, err := queryFromParams(r)
+		if err != nil {
+			return q, requestError{status: http.StatusBadRequest, msg: err.Error()}
+		}
+		return q, nil
+	}
+
+	body, err := readJSONBody(w, r)
+	if err != nil {
+		return dbapi.DBMQuery{}, err
+	}
+
+	if body[0] == '[' {
+		var words []string
+		err = unmarshalStrict(body, &words)
+		if err != nil {
+			return dbapi.DBMQuery{}, err
+		}
+		q, err := queryFromParams(r)
+		if err != nil {
+			return q, requestError{status: http.StatusBadRequest, msg: err.Error()}
+		}
+		q.Query.Words = append(q.Query.Words, dbapi.RemoveEmptyStrings(words)...)
+		return q, nil
+	}
+
+	var q dbapi.DBMQuery
+	err = unmarshalStrict(body, &q)
+	if err != nil {
+		return q, err
+	}
+	if q.Query.Filter != nil {
+		err = q.Query.Filter.Validate()
+		if err != nil {
+			return q, requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid filter : %v", err)}
+		}
+	}
+	_, err = dbapi.ParseSortKey(string(q.Query.SortBy))
+	if err != nil {
+		return q, requestError{status: http.StatusBadRequest, msg: err.Error()}
+	}
+	return q, nil
+}
+
+// entryJSONFromRequest returns the JSON of the entry of a request: the JSON body of a POST request, or else the entry param
+func entryJSONFromRequest(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if hasJSONBody(r) {
+		return readJSONBody(w, r)
+	}
+	return []byte(getParam("entry", r)), nil
+}
+
+// tokensFromRequest returns the tokens of a request for dbapi.DBManager.Disambiguate: the JSON body of a POST request, or else the tokens param.
+// The tokens are a JSON list, such as [{"word": "läser", "partOfSpeech": "VB"}].
+func tokensFromRequest(w http.ResponseWriter, r *http.Request) ([]dbapi.Token, error) {
+	var data []byte
+	if hasJSONBody(r) {
+		body, err := readJSONBody(w, r)
+		if err != nil {
+			return nil, err
+		}
+		data = body
+	} else {
+		data = []byte(strings.TrimSpace(getParam("tokens", r)))
+		if len(data) == 0 {
+			return nil, requestError{status: http.StatusBadRequest, msg: "missing tokens param"}
+		}
+	}
+	var tokens []dbapi.Token
+	err := unmarshalStrict(data, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tokens {
+		if strings.TrimSpace(t.Word) == "" {
+			return nil, requestError{status: http.StatusBadRequest, msg: fmt.Sprintf("empty word in token %#v", t)}
+		}
+	}
+	return tokens, nil
+}
@@ -18,7 +18,7 @@ Options:
   -l db location (required for mariadb; for sqlite default is application folder)
   -f lexdata folder (required)
   -r lexdata release tag (default: master)
-  -b use go binaries (optional, as opposed to 'go run' with source code)
+  -b use go binaries (optional, as opposed to 'go run' with source code; the binaries must be built with -tags sqlite_fts5)
 
 Imports lexicon data for Swedish, Norwegian, US English, and a small set of test data for Arabic from the wikispeech-lexdata repository.
 Imports from sql dump files (file extension .sql.gz).
@@ -216,8 +216,8 @@ function run_go_command {
     if [ $GOBINARIES -eq 1 ]; then
 	$cmd $args
     else
-	#echo "go run $CMDDIR/$cmd/$cmd.go $args"
-	go run $CMDDIR/$cmd/$cmd.go $args
+	#echo "go run -tags sqlite_fts5 $CMDDIR/$cmd/$cmd.go $args"
+	go run -tags sqlite_fts5 $CMDDIR/$cmd/$cmd.go $args
     fi
 }
 
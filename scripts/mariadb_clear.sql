@@ -13,3 +13,5 @@ DROP DATABASE IF EXISTS wikispeech_pronlex_test10;
 DROP DATABASE IF EXISTS wikispeech_pronlex_test11;
 DROP DATABASE IF EXISTS wikispeech_pronlex_test12;
 DROP DATABASE IF EXISTS wikispeech_pronlex_test13;
+DROP DATABASE IF EXISTS wikispeech_pronlex_test_shared;
+DROP DATABASE IF EXISTS wikispeech_pronlex_test_shared2;
@@ -56,3 +56,9 @@ GRANT ALL PRIVILEGES ON wikispeech_pronlex_test12.* TO 'speechoid'@'localhost' ;
 -- Test_Validation1
 CREATE DATABASE wikispeech_pronlex_test13;
 GRANT ALL PRIVILEGES ON wikispeech_pronlex_test13.* TO 'speechoid'@'localhost' ;
+
+-- Test_SharedMariaDB
+CREATE DATABASE wikispeech_pronlex_test_shared;
+GRANT ALL PRIVILEGES ON wikispeech_pronlex_test_shared.* TO 'speechoid'@'localhost' ;
+CREATE DATABASE wikispeech_pronlex_test_shared2;
+GRANT ALL PRIVILEGES ON wikispeech_pronlex_test_shared2.* TO 'speechoid'@'localhost' ;
@@ -18,7 +18,7 @@ Options:
   -e db engine (optional, default: sqlite)
   -a application folder (required)
   -l db location (required for mariadb; for sqlite default is application folder)
-  -b use go binaries (optional, as opposed to 'go run' with source code)
+  -b use go binaries (optional, as opposed to 'go run' with source code; the binaries must be built with -tags sqlite_fts5)
 
 EXAMPLE INVOCATIONS:
  bash $0 -a ~/wikispeech/sqlite -e sqlite
@@ -145,7 +145,7 @@ function run_go_command {
     if [ $GOBINARIES -eq 1 ]; then
 	$cmd $args
     else
-	go run $CMDDIR/$cmd/$cmd.go $args
+	go run -tags sqlite_fts5 $CMDDIR/$cmd/$cmd.go $args
     fi
 }
 
@@ -36,7 +36,7 @@ Options:
   -a application folder (required)
   -l db location (required for mariadb; for sqlite default is application folder)
   -p lexserver port (default: $PORT)
-  -b use go binaries (optional, as opposed to 'go run' with source code)
+  -b use go binaries (optional, as opposed to 'go run' with source code; the binaries must be built with -tags sqlite_fts5)
   -o system logger (stderr, syslog or filename)
   -t test mode (default: $TESTMODE)
      $TESTOFF: no tests
@@ -158,7 +158,7 @@ function run_go_cmd {
 	$GOCMD $args
     else
 	cd $PRONLEXPATH/lexserver
-	go run *.go $args
+	go run -tags sqlite_fts5 *.go $args
     fi
 }
 
@@ -169,6 +169,9 @@ fi
 if [ "<$MAXOPENCONNS>" != "<>" ]; then
     switches="$switches -max_open_conns $MAXOPENCONNS"
 fi
+if [ -d $APPDIR/symbol_sets ]; then
+    switches="$switches -ss_files `realpath $APPDIR/symbol_sets`"
+fi
 if [ $SERVERHELP -eq 1 ]; then
     switches="-help"
     echo "[$CMD] Calling lexserver help and exit" >&2